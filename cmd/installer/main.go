@@ -3,14 +3,21 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/HanHan666666/go-pkg-installer/pkg/builtin"
 	"github.com/HanHan666666/go-pkg-installer/pkg/core"
@@ -25,18 +32,33 @@ var (
 
 func main() {
 	// Parse command line flags
-	configPath := flag.String("config", "", "Path to installer configuration YAML file")
+	flag.String("config", "", "Path to installer configuration YAML file")
 	action := flag.String("action", "install", "Action to perform: install, uninstall")
 	validateOnly := flag.Bool("validate", false, "Only validate the configuration file")
 	showVersion := flag.Bool("version", false, "Show version information")
 	headless := flag.Bool("headless", false, "Run in headless/CLI mode (no GUI)")
 	verbose := flag.Bool("verbose", false, "Enable verbose logging")
+	logLevel := flag.String("log-level", "", "Log level: trace|debug|info|warn|error (default info, debug with -verbose)")
 	acceptLicense := flag.Bool("accept-license", false, "Accept license agreement (CLI)")
 	installDir := flag.String("install-dir", "", "Installation directory (CLI)")
 	installType := flag.String("install-type", "", "Installation type (CLI)")
 	privilege := flag.String("privilege", "", "Privilege strategy: sudo|pkexec|none")
+	dryRun := flag.Bool("dry-run", false, "Run the flow without side effects and print the planned actions")
+	planOutput := flag.String("plan-output", "", "Write the dry-run plan as JSON to this file")
+	recoverMode := flag.String("recover", "", "Handle an interrupted install: rollback|resume|ignore (prompts if unset)")
+	sessionPath := flag.String("session", "", "Continue a saved session (written on elevation or cancel) from this file")
 	var overrides kvFlags
 	flag.Var(&overrides, "set", "Set context value (key=value), repeatable")
+
+	// The config is loaded before the flags are parsed, so that the flags of
+	// its variables exist and -help lists the variables.
+	absConfigPath, err := findConfig(os.Args[1:])
+	var cfg *core.Config
+	if err == nil && absConfigPath != "" {
+		cfg, err = loadAndValidateConfig(absConfigPath)
+	}
+	variableFlags := defineVariableFlags(cfg)
+	flag.Usage = func() { printUsage(cfg) }
 	flag.Parse()
 
 	// Show version
@@ -46,50 +68,52 @@ func main() {
 	}
 
 	// Require config file
-	if *configPath == "" {
-		// Try to find config in common locations
-		candidates := []string{
-			"installer.yaml",
-			"installer.yml",
-			"config/installer.yaml",
-			"examples/demo-installer.yaml",
-		}
-		for _, c := range candidates {
-			if _, err := os.Stat(c); err == nil {
-				*configPath = c
-				break
-			}
-		}
-		if *configPath == "" {
-			fmt.Fprintln(os.Stderr, "Error: No configuration file specified. Use -config flag.")
-			flag.Usage()
-			os.Exit(1)
-		}
-	}
-
-	// Ensure absolute path
-	absConfigPath, err := filepath.Abs(*configPath)
-	if err != nil {
-		log.Fatalf("Failed to resolve config path: %v", err)
+	if err == nil && absConfigPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: No configuration file specified. Use -config flag.")
+		flag.Usage()
+		os.Exit(1)
 	}
-
-	// Load and validate configuration
 	if *verbose {
 		log.Printf("Loading configuration from: %s", absConfigPath)
 	}
-
-	cfg, err := loadAndValidateConfig(absConfigPath)
 	if err != nil {
 		log.Fatalf("Configuration error: %v", err)
 	}
+	for _, warning := range core.LintConfig(cfg) {
+		log.Printf("Warning: %s", warning)
+	}
 
 	if *validateOnly {
 		fmt.Println("✓ Configuration is valid")
 		os.Exit(0)
 	}
 
+	recovery, err := core.ParseRecoverMode(*recoverMode)
+	if err != nil {
+		log.Fatalf("Invalid -recover value: %v", err)
+	}
+
+	minLogLevel := core.LogInfo
+	if *verbose {
+		minLogLevel = core.LogDebug
+	}
+	if *logLevel != "" {
+		if minLogLevel, err = core.ParseLogLevel(*logLevel); err != nil {
+			log.Fatalf("Invalid -log-level value: %v", err)
+		}
+	}
+
 	// Register builtin tasks
 	builtin.RegisterAll()
+	// Register exec: task plugins shipped next to the config
+	pluginDir := filepath.Join(filepath.Dir(absConfigPath), "plugins")
+	plugins, err := builtin.RegisterExecPlugins(pluginDir)
+	if err != nil {
+		log.Fatalf("Failed to load plugins: %v", err)
+	}
+	if *verbose && len(plugins) > 0 {
+		log.Printf("Loaded task plugins from %s: %s", pluginDir, strings.Join(plugins, ", "))
+	}
 	// Register builtin guards
 	core.RegisterBuiltinGuards()
 
@@ -127,15 +151,35 @@ func main() {
 	if *installType != "" {
 		ctx.Set("install.type", *installType)
 	}
+
+	// Preflight environment detection
+	core.DetectEnv(ctx)
+
+	// Declared variables are typed; their flags and -set values are
+	// converted by the declaration instead of guessed
+	if err := ctx.DeclareVariables(cfg.Variables); err != nil {
+		log.Fatalf("Invalid variables: %v", err)
+	}
+	variableValues := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if name, ok := variableFlags[f.Name]; ok {
+			variableValues[name] = f.Value.String()
+		}
+	})
 	for _, kv := range overrides {
 		key, value := parseOverride(kv)
-		if key != "" {
+		if key == "" {
+			continue
+		}
+		if _, ok := ctx.Variable(key); ok {
+			variableValues[key] = strings.TrimSpace(strings.SplitN(kv, "=", 2)[1])
+		} else {
 			ctx.Set(key, value)
 		}
 	}
-
-	// Preflight environment detection
-	core.DetectEnv(ctx)
+	if err := ctx.ResolveVariables(variableValues); err != nil {
+		log.Fatalf("Invalid variable value: %v", err)
+	}
 
 	// Create event bus
 	eventBus := core.NewEventBus()
@@ -153,9 +197,17 @@ func main() {
 
 		for _, stepCfg := range flowCfg.Steps {
 			step := &core.Step{
-				ID:     stepCfg.ID,
-				Title:  ctx.Render(stepCfg.Title),
-				Config: stepCfg,
+				ID:         stepCfg.ID,
+				Title:      ctx.Render(stepCfg.Title),
+				Next:       stepCfg.Next,
+				Prev:       stepCfg.Prev,
+				Branch:     stepCfg.Branch,
+				When:       stepCfg.When,
+				CalledFrom: stepCfg.CalledFrom,
+				AllowBack:  stepCfg.AllowBack,
+				AllowJump:  stepCfg.AllowJump,
+				Route:      stepCfg.Route,
+				Config:     stepCfg,
 			}
 
 			// Copy guards config
@@ -189,16 +241,45 @@ func main() {
 	}
 	ctx.Runtime.Action = *action
 	ctx.Plan = core.BuildTaskPlan(cfg.Flows[*action])
+	if *dryRun {
+		// The dry run fills the plan with rendered, task-provided actions.
+		ctx.Runtime.DryRun = true
+		ctx.Plan = &core.TaskPlan{}
+	}
 
-	// Setup log file output
-	if logPath := defaultLogPath(cfg); logPath != "" {
-		if err := ctx.SetLogFile(logPath); err != nil && *verbose {
-			log.Printf("Failed to set log file: %v", err)
+	// Continue where a saved session left off; an elevated run continues
+	// the journal of the run that elevated
+	continued := ""
+	if *sessionPath != "" {
+		session := restoreSession(ctx, workflow, *sessionPath)
+		if core.Elevated() {
+			continued = session.Journal
 		}
 	}
 
-	// Elevate if needed
-	maybeElevate(ctx, cfg, *action)
+	// Setup log file output
+	ctx.SetLogLevel(minLogLevel)
+	if err := setupLogFiles(ctx, cfg); err != nil && *verbose {
+		log.Printf("Failed to set log file: %v", err)
+	}
+
+	// A dry run changes nothing, so it needs neither root nor a journal
+	if !*dryRun {
+		// Elevate once the flow reaches a step that needs privileges
+		workflow.SetElevator(elevator(ctx, cfg, nil))
+
+		// Keep removed paths until the flow succeeds; the data directory
+		// holds what cannot be kept next to the path
+		if root := defaultQuarantineRoot(cfg); root != "" {
+			ctx.SetQuarantine(core.NewQuarantine(root))
+		}
+
+		// Open the install journal and recover an interrupted session
+		journal := setupJournal(ctx, workflow, eventBus, cfg, *action, recovery, *headless, continued)
+		if journal != nil {
+			defer journal.Close()
+		}
+	}
 
 	if *verbose {
 		log.Printf("Selected flow: %s", *action)
@@ -209,7 +290,11 @@ func main() {
 	if *verbose {
 		eventBus.Subscribe(core.EventLog, func(e core.Event) {
 			if p := e.LogPayload(); p != nil {
-				log.Printf("[LOG] %s", p.Message)
+				if p.TaskID != "" {
+					log.Printf("[LOG] [%s] %s", p.TaskID, p.Message)
+				} else {
+					log.Printf("[LOG] %s", p.Message)
+				}
 			}
 		})
 		eventBus.Subscribe(core.EventProgress, func(e core.Event) {
@@ -227,6 +312,11 @@ func main() {
 				log.Printf("[TASK] Completed: %s", t.TaskID)
 			}
 		})
+		eventBus.Subscribe(core.EventTaskSkipped, func(e core.Event) {
+			if t := e.TaskPayload(); t != nil {
+				log.Printf("[TASK] Skipped: %s", t.TaskID)
+			}
+		})
 		eventBus.Subscribe(core.EventTaskError, func(e core.Event) {
 			if t := e.TaskPayload(); t != nil {
 				log.Printf("[TASK] Failed: %s - %v", t.TaskID, t.Error)
@@ -234,24 +324,21 @@ func main() {
 		})
 	}
 
+	// Stop running tasks and roll back on Ctrl+C
+	handleInterrupt(ctx)
+
 	// Run in appropriate mode
 	if *headless {
-		runHeadless(ctx, workflow, eventBus, cfg, *verbose)
+		runHeadless(ctx, workflow, eventBus, cfg, *verbose, *planOutput)
 	} else {
-		runGUI(ctx, workflow, eventBus)
+		runGUI(ctx, workflow, eventBus, cfg, *planOutput)
 	}
 }
 
 // loadAndValidateConfig loads and validates the configuration file
 func loadAndValidateConfig(path string) (*core.Config, error) {
-	// Read file content
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	// Use schema.LoadConfig which validates and parses
-	cfg, err := schema.LoadConfig(content)
+	// Use schema.LoadConfigFile which merges includes, validates and parses
+	cfg, err := schema.LoadConfigFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -260,19 +347,52 @@ func loadAndValidateConfig(path string) (*core.Config, error) {
 }
 
 // runGUI runs the installer in GUI mode
-func runGUI(ctx *core.InstallContext, workflow *core.Workflow, eventBus *core.EventBus) {
+func runGUI(ctx *core.InstallContext, workflow *core.Workflow, eventBus *core.EventBus, cfg *core.Config, planOutput string) {
+	// The first step is entered without navigating to it
+	if err := workflow.EnterCurrentStep(); err != nil {
+		log.Fatalf("Failed to enter step: %v", err)
+	}
+
 	// Create installer window
 	win := ui.NewInstallerWindow(ctx, workflow, eventBus)
+	if !ctx.Runtime.DryRun {
+		workflow.SetElevator(elevator(ctx, cfg, win.Hide))
+	}
 
 	// Set callbacks
 	win.OnComplete(func() {
+		if ctx.Runtime.DryRun {
+			exportPlan(ctx.Plan, planOutput)
+			log.Println("Dry run completed, no changes were made")
+			return
+		}
+		endJournal(ctx, core.SessionCompleted)
 		log.Println("Installation completed successfully")
 	})
 
+	// The window has rolled back the flow by the time it calls OnCancel or
+	// OnFailure
 	win.OnCancel(func() {
+		rolledBack := workflow.Transaction().Results()
+		endRolledBackJournal(ctx, rolledBack, core.SessionCancelled)
 		log.Println("Installation cancelled by user")
+		// Let the user pick up later where they left off, unless the work
+		// of earlier steps has been undone
+		if !ctx.Runtime.DryRun && len(rolledBack) == 0 {
+			if path := defaultSessionPath(cfg); path != "" {
+				if err := core.SaveSession(path, ctx, workflow); err != nil {
+					log.Printf("Failed to save session: %v", err)
+				} else {
+					log.Printf("Session saved, continue with -session %s", path)
+				}
+			}
+		}
 		os.Exit(1)
 	})
+	win.OnFailure(func() {
+		endRolledBackJournal(ctx, workflow.Transaction().Results(), core.SessionFailed)
+		log.Println("Installation failed")
+	})
 
 	// Run the window
 	if err := win.Run(); err != nil {
@@ -281,7 +401,7 @@ func runGUI(ctx *core.InstallContext, workflow *core.Workflow, eventBus *core.Ev
 }
 
 // runHeadless runs the installer in CLI/headless mode
-func runHeadless(ctx *core.InstallContext, workflow *core.Workflow, eventBus *core.EventBus, cfg *core.Config, verbose bool) {
+func runHeadless(ctx *core.InstallContext, workflow *core.Workflow, eventBus *core.EventBus, cfg *core.Config, verbose bool, planOutput string) {
 	productName := "Application"
 	if cfg.Product != nil {
 		productName = cfg.Product.Name
@@ -290,8 +410,23 @@ func runHeadless(ctx *core.InstallContext, workflow *core.Workflow, eventBus *co
 	fmt.Printf("=== %s Installation ===\n", productName)
 	fmt.Println()
 
-	// Create task runner
-	runner := core.NewTaskRunner(ctx, eventBus)
+	// Verbose mode already logs every progress event
+	if !verbose {
+		reportProgress(eventBus)
+	}
+
+	// Without screens every required variable must come from the command line
+	if err := ctx.CheckVariables(); err != nil {
+		log.Fatalf("Invalid variables: %v", err)
+	}
+
+	// The first step is entered without navigating to it
+	if err := workflow.EnterCurrentStep(); err != nil {
+		if errors.Is(err, core.ErrCancelled) {
+			exitCancelled(ctx)
+		}
+		exitFailed(ctx, "Failed to enter step: %v", err)
+	}
 
 	// Process each step
 	for !workflow.IsComplete() {
@@ -306,35 +441,482 @@ func runHeadless(ctx *core.InstallContext, workflow *core.Workflow, eventBus *co
 		if step.Config != nil && len(step.Config.Tasks) > 0 {
 			fmt.Println("  Executing tasks...")
 
+			// Each step gets its own runner so earlier tasks are not re-run
+			runner := core.NewTaskRunner(ctx, eventBus)
+			ctx.SetTaskRunner(runner)
+
 			// Queue tasks from config
 			for _, taskCfg := range step.Config.Tasks {
 				if err := runner.QueueConfig(taskCfg); err != nil {
-					log.Fatalf("Failed to queue task: %v", err)
+					exitFailed(ctx, "Failed to queue task: %v", err)
 				}
 			}
 
 			// Run tasks
 			if err := runner.Run(); err != nil {
-				log.Fatalf("Task execution failed: %v", err)
+				if errors.Is(err, core.ErrCancelled) {
+					exitCancelled(ctx)
+				}
+				exitFailed(ctx, "Task execution failed: %v", err)
 			}
 
 			fmt.Println("  ✓ Tasks completed")
 		}
 
-		// Move to next step
+		// Move to next step, running the step hooks on the way
 		if !workflow.IsLastStep() {
 			if _, err := workflow.Next(); err != nil {
-				log.Fatalf("Failed to advance: %v", err)
+				if errors.Is(err, core.ErrCancelled) {
+					exitCancelled(ctx)
+				}
+				exitFailed(ctx, "Failed to advance: %v", err)
 			}
 		} else {
-			workflow.Complete()
+			if err := workflow.LeaveCurrentStep(); err != nil {
+				if errors.Is(err, core.ErrCancelled) {
+					exitCancelled(ctx)
+				}
+				exitFailed(ctx, "Failed to finish: %v", err)
+			}
+			if err := workflow.Complete(); err != nil {
+				log.Printf("Failed to clean up: %v", err)
+			}
 		}
 	}
 
+	if ctx.Runtime.DryRun {
+		fmt.Println()
+		printPlan(ctx.Plan)
+		exportPlan(ctx.Plan, planOutput)
+		fmt.Println()
+		fmt.Println("=== Dry Run Complete (no changes made) ===")
+		return
+	}
+
+	endJournal(ctx, core.SessionCompleted)
+
 	fmt.Println()
 	fmt.Println("=== Installation Complete ===")
 }
 
+// reportProgress prints the overall progress of each step's task runner in
+// steps of progressInterval percent, with an ETA once one can be estimated.
+func reportProgress(eventBus *core.EventBus) {
+	const progressInterval = 10
+	last := -1
+	eventBus.Subscribe(core.EventProgress, func(e core.Event) {
+		p := e.ProgressPayload()
+		if p == nil {
+			return
+		}
+		percent := int(p.Progress * 100)
+		if percent < last {
+			// A new step started its own runner
+			last = -1
+		}
+		if last >= 0 && (percent == last || (percent/progressInterval == last/progressInterval && percent != 100)) {
+			return
+		}
+		last = percent
+		line := fmt.Sprintf("  [%3d%%] %s", percent, p.Message)
+		if p.ETA >= time.Second {
+			line += fmt.Sprintf(" (ETA %s)", core.FormatETA(p.ETA))
+		}
+		fmt.Println(line)
+	})
+}
+
+// printPlan writes the dry-run plan to stdout.
+func printPlan(plan *core.TaskPlan) {
+	fmt.Println("Planned actions:")
+	if plan == nil || len(plan.Tasks) == 0 {
+		fmt.Println("  (none)")
+		return
+	}
+	for _, task := range plan.Tasks {
+		line := fmt.Sprintf("  [%s] %s (%s)", task.Step, task.Description, task.Type)
+		if task.Hook != "" {
+			line += fmt.Sprintf(" (%s)", task.Hook)
+		}
+		if task.RequiresRoot {
+			line += " (admin)"
+		}
+		if task.Skipped {
+			line += fmt.Sprintf(" (skipped, when: %s)", task.When)
+		}
+		fmt.Println(line)
+		for _, action := range task.Actions {
+			// Indent continuation lines of multi-line commands under the bullet
+			fmt.Printf("      - %s\n", strings.ReplaceAll(action.String(), "\n", "\n        "))
+		}
+	}
+}
+
+// exportPlan writes the dry-run plan as JSON when a path is given.
+func exportPlan(plan *core.TaskPlan, path string) {
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode plan: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		log.Fatalf("Failed to write plan: %v", err)
+	}
+	fmt.Printf("Plan written to %s\n", path)
+}
+
+// setupJournal opens the install journal and, if the previous session was
+// interrupted, rolls it back or resumes it according to the -recover flag or
+// the user's answer. continued is the journal of the run this elevated run
+// continues, if any; its session goes on without asking.
+func setupJournal(ctx *core.InstallContext, workflow *core.Workflow, eventBus *core.EventBus, cfg *core.Config, action, recovery string, headless bool, continued string) *core.Journal {
+	path := defaultJournalPath(cfg)
+	if continued != "" {
+		path = continued
+	}
+	if path == "" {
+		return nil
+	}
+
+	state, err := core.ReadJournal(path)
+	if err != nil {
+		log.Printf("Failed to read install journal: %v", err)
+		state = &core.JournalState{}
+	}
+
+	journal, err := core.OpenJournal(path)
+	if err != nil {
+		log.Printf("Failed to open install journal: %v", err)
+		return nil
+	}
+	ctx.SetJournal(journal)
+
+	// The restored session already holds the input and step, so only the
+	// finished tasks are taken over
+	if continued != "" && state.Status == "" && state.Flow == action {
+		if err := journal.Continue(state); err != nil {
+			log.Fatalf("Failed to continue install journal: %v", err)
+		}
+		if err := ctx.Transaction().Continue(state); err != nil {
+			log.Printf("Some finished tasks cannot be rolled back: %v", err)
+		}
+		return journal
+	}
+
+	if state.Interrupted() {
+		if recovery == "" {
+			if headless {
+				recovery = promptRecovery(state)
+			} else {
+				recovery = ui.PromptRecovery(ctx, state)
+			}
+		}
+		if recovery == core.RecoverResume && state.Flow != action {
+			log.Printf("Interrupted session belongs to flow %q, rolling back instead of resuming", state.Flow)
+			recovery = core.RecoverRollback
+		}
+
+		switch recovery {
+		case core.RecoverResume:
+			ctx.RestoreInput(state.Input)
+			if err := journal.Resume(state); err != nil {
+				log.Fatalf("Failed to resume install journal: %v", err)
+			}
+			if state.Step != "" {
+				if err := workflow.ResumeAt(state.Step); err != nil {
+					log.Fatalf("Failed to resume at step %s: %v", state.Step, err)
+				}
+			}
+			ctx.AddLog(core.LogInfo, fmt.Sprintf("Resuming interrupted installation at step %s", state.Step))
+			return journal
+		case core.RecoverRollback:
+			// Rollback commands may reference the input of the interrupted run
+			ctx.RestoreInput(state.Input)
+			if err := state.Rollback(ctx, eventBus, journal); err != nil {
+				log.Fatalf("Failed to roll back interrupted installation: %v", err)
+			}
+		case core.RecoverIgnore:
+			ctx.AddLog(core.LogWarn, "Ignoring interrupted installation journal")
+		default:
+			journal.Close()
+			os.Exit(1)
+		}
+	}
+
+	// Nothing is resumed, so paths earlier sessions quarantined are no
+	// longer needed for a rollback
+	if root := defaultQuarantineRoot(cfg); root != "" {
+		if err := core.PurgeQuarantines(root); err != nil {
+			log.Printf("Failed to purge old quarantine: %v", err)
+		}
+	}
+
+	if err := journal.Begin(action, ctx.InputSnapshot()); err != nil {
+		log.Printf("Failed to start install journal: %v", err)
+	}
+	return journal
+}
+
+// promptRecovery asks on stdin how to handle an interrupted session.
+func promptRecovery(state *core.JournalState) string {
+	step := state.Step
+	if failed := state.FailedTask(); failed != nil && failed.Step != "" {
+		step = failed.Step
+	}
+	fmt.Printf("A previous installation was interrupted at step %q.\n", step)
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("[r]esume, roll [b]ack, [i]gnore or [q]uit? ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return ""
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "r", "resume":
+			return core.RecoverResume
+		case "b", "rollback":
+			return core.RecoverRollback
+		case "i", "ignore":
+			return core.RecoverIgnore
+		case "q", "quit":
+			return ""
+		}
+	}
+}
+
+// handleInterrupt cancels the running task runner on SIGINT or SIGTERM, so
+// in-flight tasks stop and completed work is rolled back before exiting.
+func handleInterrupt(ctx *core.InstallContext) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("Interrupted, cancelling installation...")
+		if runner := ctx.TaskRunner(); runner != nil && runner.IsRunning() {
+			runner.Cancel()
+			runner.Wait()
+		}
+		exitCancelled(ctx)
+	}()
+}
+
+var cancelOnce sync.Once
+
+// exitCancelled rolls back the work of the flow's earlier steps, closes the
+// journal of a cancelled installation and exits. It is safe to call from
+// several goroutines; only the first call proceeds.
+func exitCancelled(ctx *core.InstallContext) {
+	cancelOnce.Do(func() {
+		if rolledBack, ok := rollbackFlow(ctx); ok {
+			if rolledBack {
+				endJournal(ctx, core.SessionRolledBack)
+			} else {
+				endJournal(ctx, core.SessionCancelled)
+			}
+		}
+		log.Println("Installation cancelled")
+		os.Exit(130)
+	})
+	select {}
+}
+
+// exitFailed rolls back the work of the flow's steps so far and exits with
+// the error.
+func exitFailed(ctx *core.InstallContext, format string, args ...any) {
+	if rolledBack, ok := rollbackFlow(ctx); ok {
+		if rolledBack {
+			endJournal(ctx, core.SessionRolledBack)
+		} else {
+			endJournal(ctx, core.SessionFailed)
+		}
+	}
+	log.Fatal(ctx.Redact(fmt.Sprintf(format, args...)))
+}
+
+// rollbackFlow undoes the tasks the flow's steps completed and prints the
+// outcome of each. It reports whether there was anything to undo and whether
+// all of it was undone; after a failed rollback the journal stays open, so
+// the next run offers to recover.
+func rollbackFlow(ctx *core.InstallContext) (rolledBack bool, ok bool) {
+	tx := ctx.Transaction()
+	if tx == nil || tx.Pending() == 0 {
+		return false, true
+	}
+
+	log.Printf("Rolling back %d completed tasks...", tx.Pending())
+	results, err := tx.Rollback()
+	for _, result := range results {
+		if result.State == core.TaskRolledBack {
+			log.Printf("  ↺ %s (step %s) rolled back", result.TaskID, result.Step)
+		} else {
+			log.Printf("  ✗ %s (step %s) could not be rolled back: %v", result.TaskID, result.Step, result.Error)
+		}
+	}
+	if err != nil {
+		log.Printf("Rollback incomplete: %v", err)
+		return true, false
+	}
+	return true, true
+}
+
+// endRolledBackJournal closes the journal after the window rolled back the
+// flow: as rolled back if anything was undone, otherwise with status. After
+// a failed rollback the journal stays open, so the next run offers to
+// recover.
+func endRolledBackJournal(ctx *core.InstallContext, results []core.RollbackResult, status string) {
+	for _, result := range results {
+		if result.State != core.TaskRolledBack {
+			return
+		}
+	}
+	if len(results) > 0 {
+		status = core.SessionRolledBack
+	}
+	endJournal(ctx, status)
+}
+
+// endJournal closes the journal session so the next run starts cleanly.
+func endJournal(ctx *core.InstallContext, status string) {
+	if journal := ctx.Journal(); journal != nil {
+		if err := journal.End(status); err != nil {
+			log.Printf("Failed to close install journal: %v", err)
+		}
+	}
+}
+
+// findConfig returns the absolute path of the config given by -config, or
+// of the first config found in a common location. It only looks at -config
+// so that it can run before the flags are parsed.
+func findConfig(args []string) (string, error) {
+	path := ""
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			path = value
+		} else if i+1 < len(args) {
+			path = args[i+1]
+		}
+	}
+
+	if path == "" {
+		// Try to find config in common locations
+		candidates := []string{
+			"installer.yaml",
+			"installer.yml",
+			"config/installer.yaml",
+			"examples/demo-installer.yaml",
+		}
+		for _, c := range candidates {
+			if _, err := os.Stat(c); err == nil {
+				path = c
+				break
+			}
+		}
+		if path == "" {
+			return "", nil
+		}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	return abs, nil
+}
+
+// variableFlag holds the value of a flag declared by a config variable.
+type variableFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *variableFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *variableFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+// IsBoolFlag lets bool variables be set with a bare -flag.
+func (f *variableFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// defineVariableFlags defines the flags of the config's variables and
+// returns the variable name of each flag. A flag the installer already has,
+// such as -install-dir, is shared with the variable.
+func defineVariableFlags(cfg *core.Config) map[string]string {
+	names := make(map[string]string)
+	if cfg == nil {
+		return names
+	}
+	for _, v := range cfg.Variables {
+		if v.Flag == "" {
+			continue
+		}
+		names[v.Flag] = v.Name
+		if flag.Lookup(v.Flag) == nil {
+			flag.Var(&variableFlag{isBool: v.TypeName() == core.VarBool}, v.Flag, v.Description)
+		}
+	}
+	return names
+}
+
+// printUsage prints the flags and the variables the config declares.
+func printUsage(cfg *core.Config) {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+	if cfg == nil || len(cfg.Variables) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "\nVariables (set with -set name=value):")
+	for _, v := range cfg.Variables {
+		var sources []string
+		if v.Required {
+			sources = append(sources, "required")
+		}
+		if v.Default != nil && v.TypeName() != core.VarSecret {
+			sources = append(sources, fmt.Sprintf("default %v", v.Default))
+		}
+		if v.Flag != "" {
+			sources = append(sources, "flag -"+v.Flag)
+		}
+		if v.Env != "" {
+			sources = append(sources, "env $"+v.Env)
+		}
+		if v.Compute != "" {
+			sources = append(sources, "computed: "+v.Compute)
+		}
+		if len(v.Enum) > 0 {
+			sources = append(sources, fmt.Sprintf("one of %v", v.Enum))
+		}
+		line := fmt.Sprintf("  %s %s", v.Name, v.TypeName())
+		if len(sources) > 0 {
+			line += " (" + strings.Join(sources, ", ") + ")"
+		}
+		fmt.Fprintln(out, line)
+		if v.Description != "" {
+			fmt.Fprintf(out, "    \t%s\n", v.Description)
+		}
+	}
+}
+
 type kvFlags []string
 
 func (k *kvFlags) String() string {
@@ -369,46 +951,154 @@ func parseOverride(input string) (string, any) {
 	return key, val
 }
 
-func maybeElevate(ctx *core.InstallContext, cfg *core.Config, action string) {
-	if core.Elevated() || ctx.Env.IsRoot {
-		return
-	}
-	if !core.NeedsPrivilege(cfg, action) {
-		return
-	}
+// elevator returns the function the workflow calls before entering a step
+// that needs privileges. Unless this run is privileged already, it saves
+// the session as of that step and re-runs the installer with it through the
+// privilege strategy. hide, if set, is called before the elevated run
+// starts.
+func elevator(ctx *core.InstallContext, cfg *core.Config, hide func()) core.ElevateFunc {
+	return func(step *core.Step, session *core.Session) error {
+		if ctx.Runtime.DryRun || core.Elevated() || ctx.Env.IsRoot {
+			return nil
+		}
 
-	strategy := core.GetPrivilegeStrategy(ctx)
-	switch strategy {
-	case core.PrivilegeSudo:
-		if !ctx.Env.HasSudo {
-			log.Fatalf("Privilege required but sudo is not available")
+		var cmdName string
+		var args []string
+		strategy := core.GetPrivilegeStrategy(ctx)
+		switch strategy {
+		case core.PrivilegeSudo:
+			if !ctx.Env.HasSudo {
+				return fmt.Errorf("step %s requires privileges but sudo is not available", step.ID)
+			}
+			cmdName, args = "sudo", []string{"-E", os.Args[0]}
+		case core.PrivilegePkexec:
+			if !ctx.Env.HasPolkit {
+				return fmt.Errorf("step %s requires privileges but pkexec is not available", step.ID)
+			}
+			cmdName, args = "pkexec", []string{"env", "GPKI_ELEVATED=1", os.Args[0]}
+		case core.PrivilegeNone:
+			return fmt.Errorf("step %s requires privileges but no elevation strategy is configured", step.ID)
+		default:
+			return fmt.Errorf("unknown privilege strategy: %s", strategy)
 		}
-		runElevated("sudo", append([]string{"-E", os.Args[0]}, os.Args[1:]...))
-	case core.PrivilegePkexec:
-		if !ctx.Env.HasPolkit {
-			log.Fatalf("Privilege required but pkexec is not available")
+
+		path := defaultSessionPath(cfg)
+		if path == "" {
+			path = filepath.Join(os.TempDir(), fmt.Sprintf("gpki-session-%d.json", os.Getpid()))
+		}
+		// The elevated run writes the journal from here on
+		journal := ctx.Journal()
+		if journal != nil {
+			session.Journal = journal.Path()
+		}
+		if err := session.Save(path); err != nil {
+			return fmt.Errorf("failed to save session for elevation: %w", err)
 		}
-		runElevated("pkexec", append([]string{"env", "GPKI_ELEVATED=1", os.Args[0]}, os.Args[1:]...))
-	case core.PrivilegeNone:
-		log.Fatalf("Privilege required but no elevation strategy configured")
-	default:
-		log.Fatalf("Unknown privilege strategy: %s", strategy)
+		if journal != nil {
+			journal.Close()
+		}
+
+		log.Printf("Step %s requires privileges, continuing with %s", step.ID, cmdName)
+		if hide != nil {
+			hide()
+		}
+		args = append(append(args, os.Args[1:]...), "-session", path)
+		runElevated(cmdName, args)
+		return nil
 	}
 }
 
+// restoreSession loads a saved session into the context and workflow. The
+// file is removed once restored; a later cancel saves a new one.
+func restoreSession(ctx *core.InstallContext, workflow *core.Workflow, path string) *core.Session {
+	session, err := core.LoadSession(path)
+	if err != nil {
+		log.Fatalf("Failed to load session: %v", err)
+	}
+	if err := session.Restore(ctx, workflow); err != nil {
+		log.Fatalf("Failed to restore session: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Failed to remove session file: %v", err)
+	}
+	ctx.AddLog(core.LogInfo, fmt.Sprintf("Restored session saved at %s, continuing at step %s",
+		session.SavedAt.Format(time.RFC3339), workflow.CurrentStepID()))
+	return session
+}
+
 func runElevated(cmdName string, args []string) {
 	cmd := exec.Command(cmdName, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = append(os.Environ(), "GPKI_ELEVATED=1")
+	// The elevated run handles Ctrl+C and rolls back the flow, including
+	// the tasks of this run
+	signal.Ignore(os.Interrupt, syscall.SIGTERM)
 	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
 		log.Fatalf("Elevation failed: %v", err)
 	}
 	os.Exit(0)
 }
 
 func defaultLogPath(cfg *core.Config) string {
+	dir := defaultDataDir(cfg)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "installer.log")
+}
+
+// setupLogFiles writes the human-readable installer.log and, next to it, the
+// same entries as JSON lines in installer.jsonl. Both rotate by size.
+func setupLogFiles(ctx *core.InstallContext, cfg *core.Config) error {
+	logPath := defaultLogPath(cfg)
+	if logPath == "" {
+		return nil
+	}
+	ctx.CloseLogFile()
+	if err := ctx.AddLogFile(logPath, core.LogFileOptions{
+		Format:  core.LogFormatText,
+		MaxSize: core.DefaultLogMaxSize,
+	}); err != nil {
+		return err
+	}
+	jsonPath := strings.TrimSuffix(logPath, filepath.Ext(logPath)) + ".jsonl"
+	return ctx.AddLogFile(jsonPath, core.LogFileOptions{
+		Format:  core.LogFormatJSON,
+		MaxSize: core.DefaultLogMaxSize,
+	})
+}
+
+func defaultQuarantineRoot(cfg *core.Config) string {
+	dir := defaultDataDir(cfg)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "quarantine")
+}
+
+func defaultSessionPath(cfg *core.Config) string {
+	dir := defaultDataDir(cfg)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "session.json")
+}
+
+func defaultJournalPath(cfg *core.Config) string {
+	dir := defaultDataDir(cfg)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "journal.jsonl")
+}
+
+func defaultDataDir(cfg *core.Config) string {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return ""
@@ -418,5 +1108,5 @@ func defaultLogPath(cfg *core.Config) string {
 		productName = cfg.Product.Name
 	}
 	safeName := strings.ToLower(strings.ReplaceAll(productName, " ", "-"))
-	return filepath.Join(home, ".local", "share", "go-pkg-installer", safeName, "installer.log")
+	return filepath.Join(home, ".local", "share", "go-pkg-installer", safeName)
 }
@@ -1,6 +1,58 @@
 // Package builtin provides exec helpers for tasks.
 package builtin
 
-import "os/exec"
+import (
+	"os"
+	"os/exec"
+	"sort"
+	"syscall"
+	"time"
+)
 
 var execCommand = exec.Command
+
+// commandWaitDelay bounds how long Wait keeps reading output after a
+// command was killed, in case a detached child still holds the pipes.
+const commandWaitDelay = 5 * time.Second
+
+// setProcessGroup starts cmd in its own process group so that
+// killProcessGroup also stops the children of scripts run through sh.
+// For commands created with exec.CommandContext the group is killed when
+// the context is done.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.WaitDelay = commandWaitDelay
+	if cmd.Cancel != nil {
+		cmd.Cancel = func() error {
+			return killProcessGroup(cmd)
+		}
+	}
+}
+
+// killProcessGroup kills the process group started by setProcessGroup.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// commandEnv returns the environment of a script: the installer's own, then
+// the context values and the task's env, which win in that order.
+func commandEnv(contextEnv, env map[string]string) []string {
+	result := os.Environ()
+	for _, vars := range []map[string]string{contextEnv, env} {
+		keys := make([]string, 0, len(vars))
+		for k := range vars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			result = append(result, k+"="+vars[k])
+		}
+	}
+	return result
+}
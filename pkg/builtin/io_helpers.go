@@ -0,0 +1,47 @@
+// Package builtin provides I/O helpers for tasks.
+package builtin
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader stops reading once its context is done, so copying a large
+// file can be interrupted between chunks.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// withContext returns r wrapped so reads fail with ctx.Err() once ctx is done.
+func withContext(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return &contextReader{ctx: ctx, reader: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the
+// rest, so capturing command output cannot exhaust memory.
+type cappedBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.buf); room > 0 {
+		b.buf = append(b.buf, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	return string(b.buf)
+}
@@ -0,0 +1,27 @@
+// Package builtin provides helpers for persisting task rollback state in the install journal.
+package builtin
+
+import "encoding/json"
+
+// encodeState converts a rollback state struct into the generic map stored in
+// the journal.
+func encodeState(state any) map[string]any {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil
+	}
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return result
+}
+
+// decodeState loads a journaled map back into a rollback state struct.
+func decodeState(state map[string]any, target any) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
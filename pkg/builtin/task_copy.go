@@ -2,6 +2,7 @@
 package builtin
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -21,8 +22,7 @@ type CopyTask struct {
 	RequirePrivilege bool
 
 	// For rollback
-	copiedFiles []string
-	createdDirs []string
+	backups []core.FileBackup
 }
 
 // RegisterCopyTask registers the copy task factory.
@@ -67,11 +67,17 @@ func (t *CopyTask) Validate() error {
 
 // Execute copies the file or directory.
 func (t *CopyTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
+	return t.ExecuteContext(context.Background(), ctx, bus)
+}
+
+// ExecuteContext copies the file or directory, stopping between and within
+// files when cctx is done.
+func (t *CopyTask) ExecuteContext(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	if err := ensurePrivilege(ctx, t.RequirePrivilege); err != nil {
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Copying %s to %s", t.Source, t.Destination))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Copying %s to %s", t.Source, t.Destination))
 
 	info, err := os.Stat(t.Source)
 	if err != nil {
@@ -79,20 +85,22 @@ func (t *CopyTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
 	}
 
 	if info.IsDir() {
-		return t.copyDir(ctx)
+		return t.copyDir(cctx, ctx)
 	}
-	return t.copyFile(ctx, t.Source, t.Destination)
+	return t.copyFile(cctx, ctx, t.Source, t.Destination)
 }
 
-func (t *CopyTask) copyFile(ctx *core.InstallContext, src, dst string) error {
+func (t *CopyTask) copyFile(cctx context.Context, ctx *core.InstallContext, src, dst string) error {
 	// Check if destination exists
 	if _, err := os.Stat(dst); err == nil && !t.Overwrite {
 		return fmt.Errorf("destination already exists: %s", dst)
 	}
 
 	// Ensure parent directory exists
-	dstDir := filepath.Dir(dst)
-	if err := os.MkdirAll(dstDir, 0755); err != nil {
+	backups := ctx.Backups()
+	created, err := backups.MkdirAll(filepath.Dir(dst), 0755)
+	t.backups = append(t.backups, created...)
+	if err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
@@ -102,25 +110,38 @@ func (t *CopyTask) copyFile(ctx *core.InstallContext, src, dst string) error {
 	}
 	defer srcFile.Close()
 
+	// Keep an overwritten file for rollback
+	backup, err := backups.Snapshot(dst)
+	if err != nil {
+		return err
+	}
+	t.backups = append(t.backups, backup)
+
 	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, t.Mode)
 	if err != nil {
 		return fmt.Errorf("failed to create destination: %w", err)
 	}
 	defer dstFile.Close()
 
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
+	if _, err := io.Copy(dstFile, withContext(cctx, srcFile)); err != nil {
+		if cctx.Err() != nil {
+			// Do not leave a truncated file behind
+			os.Remove(dst)
+			return fmt.Errorf("copy cancelled: %w", cctx.Err())
+		}
 		return fmt.Errorf("failed to copy: %w", err)
 	}
-
-	t.copiedFiles = append(t.copiedFiles, dst)
 	return nil
 }
 
-func (t *CopyTask) copyDir(ctx *core.InstallContext) error {
+func (t *CopyTask) copyDir(cctx context.Context, ctx *core.InstallContext) error {
 	return filepath.Walk(t.Source, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if cctx.Err() != nil {
+			return fmt.Errorf("copy cancelled: %w", cctx.Err())
+		}
 
 		// Calculate relative path
 		relPath, err := filepath.Rel(t.Source, path)
@@ -130,40 +151,59 @@ func (t *CopyTask) copyDir(ctx *core.InstallContext) error {
 		dstPath := filepath.Join(t.Destination, relPath)
 
 		if info.IsDir() {
-			if err := os.MkdirAll(dstPath, info.Mode()); err != nil {
+			created, err := ctx.Backups().MkdirAll(dstPath, info.Mode())
+			t.backups = append(t.backups, created...)
+			if err != nil {
 				return fmt.Errorf("failed to create directory: %w", err)
 			}
-			t.createdDirs = append(t.createdDirs, dstPath)
 			return nil
 		}
 
-		return t.copyFile(ctx, path, dstPath)
+		return t.copyFile(cctx, ctx, path, dstPath)
 	})
 }
 
+// Plan describes the copy without touching the destination.
+func (t *CopyTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	action := core.PlannedAction{Kind: core.ActionWriteFile, Path: t.Destination, Source: t.Source}
+	if t.Overwrite {
+		action.Detail = "overwrite"
+	}
+	return []core.PlannedAction{action}
+}
+
 // CanRollback returns true if the task can be rolled back.
 func (t *CopyTask) CanRollback() bool {
-	return len(t.copiedFiles) > 0 || len(t.createdDirs) > 0
+	return len(t.backups) > 0
 }
 
-// Rollback removes copied files and directories.
+// Rollback removes copied files and created directories and restores the
+// files that were overwritten.
 func (t *CopyTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
-	ctx.AddLog(core.LogInfo, "Rolling back copied files")
+	t.Log(ctx, core.LogInfo, "Rolling back copied files")
 
-	// Remove files first
-	for _, file := range t.copiedFiles {
-		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
-			ctx.AddLog(core.LogWarn, fmt.Sprintf("Failed to remove file: %s", file))
-		}
+	if err := ctx.Backups().RestoreAll(t.backups); err != nil {
+		return fmt.Errorf("failed to restore copied files: %w", err)
 	}
+	return nil
+}
 
-	// Remove directories in reverse order
-	for i := len(t.createdDirs) - 1; i >= 0; i-- {
-		dir := t.createdDirs[i]
-		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
-			ctx.AddLog(core.LogWarn, fmt.Sprintf("Failed to remove directory: %s", dir))
-		}
-	}
+// copyState is the journaled form of the CopyTask rollback data.
+type copyState struct {
+	Backups []core.FileBackup `json:"backups,omitempty"`
+}
+
+// RollbackState returns the data needed to roll back after a restart.
+func (t *CopyTask) RollbackState() map[string]any {
+	return encodeState(copyState{Backups: t.backups})
+}
 
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *CopyTask) RestoreRollbackState(data map[string]any) error {
+	var state copyState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.backups = state.Backups
 	return nil
 }
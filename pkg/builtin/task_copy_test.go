@@ -1,6 +1,8 @@
 package builtin
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -57,7 +59,7 @@ func TestCopyTaskExecuteFile(t *testing.T) {
 	content := "test content"
 	os.WriteFile(srcFile, []byte(content), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &CopyTask{
@@ -95,7 +97,7 @@ func TestCopyTaskExecuteDirectory(t *testing.T) {
 	os.WriteFile(filepath.Join(srcDir, "file1.txt"), []byte("content1"), 0644)
 	os.WriteFile(filepath.Join(srcDir, "subdir", "file2.txt"), []byte("content2"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &CopyTask{
@@ -139,7 +141,7 @@ func TestCopyTaskOverwrite(t *testing.T) {
 	os.WriteFile(srcFile, []byte("new content"), 0644)
 	os.WriteFile(dstFile, []byte("old content"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	t.Run("without overwrite", func(t *testing.T) {
@@ -182,7 +184,7 @@ func TestCopyTaskRollback(t *testing.T) {
 
 	os.WriteFile(srcFile, []byte("content"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &CopyTask{
@@ -219,7 +221,7 @@ func TestCopyTaskRollback(t *testing.T) {
 func TestCopyTaskSourceNotFound(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &CopyTask{
@@ -232,3 +234,59 @@ func TestCopyTaskSourceNotFound(t *testing.T) {
 		t.Error("expected error for non-existent source")
 	}
 }
+
+func TestCopyTaskExecuteContextCancelled(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dstDir := filepath.Join(t.TempDir(), "dst")
+
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	task := &CopyTask{Source: srcDir, Destination: dstDir, Mode: 0644}
+	err := task.ExecuteContext(cctx, newQuarantineContext(t), core.NewEventBus())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if len(task.backups) != 0 {
+		t.Errorf("no files should be copied after cancellation, got %v", task.backups)
+	}
+}
+
+func TestCopyTaskRollbackRestoresOverwritten(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	dstDir := filepath.Join(tmpDir, "dst")
+	os.MkdirAll(filepath.Join(srcDir, "lib"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "app.conf"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "lib", "data"), []byte("data"), 0644)
+	os.MkdirAll(dstDir, 0755)
+	os.WriteFile(filepath.Join(dstDir, "app.conf"), []byte("old"), 0600)
+
+	ctx := newQuarantineContext(t)
+	bus := core.NewEventBus()
+
+	task := &CopyTask{Source: srcDir, Destination: dstDir, Mode: 0644, Overwrite: true}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if err := task.Rollback(ctx, bus); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dstDir, "app.conf")); string(data) != "old" {
+		t.Errorf("expected the overwritten file to be restored, got %q", data)
+	}
+	if info, _ := os.Stat(filepath.Join(dstDir, "app.conf")); info.Mode().Perm() != 0600 {
+		t.Errorf("expected the mode to be restored, got %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "lib")); !os.IsNotExist(err) {
+		t.Error("expected the created directory to be removed")
+	}
+	if _, err := os.Stat(dstDir); err != nil {
+		t.Error("expected the existing destination to be kept")
+	}
+}
@@ -73,7 +73,7 @@ func (t *DbusServiceTask) Execute(ctx *core.InstallContext, bus *core.EventBus)
 		args = append([]string{"--user"}, args...)
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("dbus %s %s", t.Action, unit))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("dbus %s %s", t.Action, unit))
 	cmd := execCommand("systemctl", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -82,6 +82,11 @@ func (t *DbusServiceTask) Execute(ctx *core.InstallContext, bus *core.EventBus)
 	return nil
 }
 
+// Plan describes the systemctl call without running it.
+func (t *DbusServiceTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	return planSystemctl(t.Name, t.Action, t.UserScope)
+}
+
 // CanRollback returns false by default.
 func (t *DbusServiceTask) CanRollback() bool {
 	return false
@@ -39,26 +39,39 @@ func RegisterDesktopEntryTask() {
 			taskType = "desktopEntry"
 		}
 
+		var renderErr error
+		render := func(text string) string {
+			rendered, err := ctx.RenderTemplate(text)
+			if err != nil && renderErr == nil {
+				renderErr = fmt.Errorf("%s: %w", taskType, err)
+			}
+			return rendered
+		}
+
 		task := &DesktopEntryTask{
 			BaseTask: core.BaseTask{
 				TaskID:   getConfigString(config, "id"),
 				TaskType: taskType,
 				Config:   config,
 			},
-			Name:             ctx.Render(getConfigString(config, "name")),
-			Exec:             ctx.Render(getConfigString(config, "exec")),
-			Icon:             ctx.Render(getConfigString(config, "icon")),
-			Comment:          ctx.Render(getConfigString(config, "comment")),
-			Categories:       getConfigStringSlice(config, "categories"),
+			Name:             render(getConfigString(config, "name")),
+			Exec:             render(getConfigString(config, "exec")),
+			Icon:             render(getConfigString(config, "icon")),
+			Comment:          render(getConfigString(config, "comment")),
+			Categories:       renderDesktopList(render, getConfigStringSlice(config, "categories")),
 			Terminal:         getConfigBool(config, "terminal"),
 			EntryType:        getConfigStringAny(config, "entryType", "entry_type"),
-			StartupWMClass:   ctx.Render(getConfigString(config, "startup_wm_class")),
-			MimeTypes:        getConfigStringSlice(config, "mime_types"),
-			Keywords:         getConfigStringSlice(config, "keywords"),
-			Destination:      ctx.Render(getConfigString(config, "destination")),
+			StartupWMClass:   render(getConfigString(config, "startup_wm_class")),
+			MimeTypes:        renderDesktopList(render, getConfigStringSlice(config, "mime_types")),
+			Keywords:         renderDesktopList(render, getConfigStringSlice(config, "keywords")),
+			Destination:      render(getConfigString(config, "destination")),
 			RequirePrivilege: getConfigBool(config, "requirePrivilege"),
 		}
 
+		if renderErr != nil {
+			return nil, renderErr
+		}
+
 		if task.TaskID == "" {
 			task.TaskID = fmt.Sprintf("desktopEntry-%s", strings.ToLower(strings.ReplaceAll(task.Name, " ", "-")))
 		}
@@ -82,6 +95,18 @@ func RegisterDesktopEntryTask() {
 	core.Tasks.Register("createDesktopEntry", factory)
 }
 
+// renderDesktopList renders each item of a list key.
+func renderDesktopList(render func(string) string, items []string) []string {
+	if items == nil {
+		return nil
+	}
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = render(item)
+	}
+	return result
+}
+
 // Validate validates the desktop_entry task configuration.
 func (t *DesktopEntryTask) Validate() error {
 	if t.Name == "" {
@@ -99,7 +124,7 @@ func (t *DesktopEntryTask) Execute(ctx *core.InstallContext, bus *core.EventBus)
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Creating desktop entry: %s", t.Destination))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Creating desktop entry: %s", t.Destination))
 
 	// Ensure parent directory exists
 	destDir := filepath.Dir(t.Destination)
@@ -150,11 +175,16 @@ func (t *DesktopEntryTask) Execute(ctx *core.InstallContext, bus *core.EventBus)
 	}
 
 	t.createdFile = t.Destination
-	ctx.AddLog(core.LogInfo, "Desktop entry created successfully")
+	t.Log(ctx, core.LogInfo, "Desktop entry created successfully")
 
 	return nil
 }
 
+// Plan describes the desktop entry without writing it.
+func (t *DesktopEntryTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	return []core.PlannedAction{{Kind: core.ActionWriteFile, Path: t.Destination, Detail: "desktop entry " + t.Name}}
+}
+
 // CanRollback returns true if the task can be rolled back.
 func (t *DesktopEntryTask) CanRollback() bool {
 	return t.createdFile != ""
@@ -166,7 +196,7 @@ func (t *DesktopEntryTask) Rollback(ctx *core.InstallContext, bus *core.EventBus
 		return nil
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Removing desktop entry: %s", t.createdFile))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Removing desktop entry: %s", t.createdFile))
 
 	if err := os.Remove(t.createdFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove desktop entry: %w", err)
@@ -174,3 +204,25 @@ func (t *DesktopEntryTask) Rollback(ctx *core.InstallContext, bus *core.EventBus
 
 	return nil
 }
+
+// desktopEntryState is the journaled form of the DesktopEntryTask rollback data.
+type desktopEntryState struct {
+	CreatedFile string `json:"createdFile,omitempty"`
+}
+
+// RollbackState returns the data needed to roll back after a restart.
+func (t *DesktopEntryTask) RollbackState() map[string]any {
+	return encodeState(desktopEntryState{
+		CreatedFile: t.createdFile,
+	})
+}
+
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *DesktopEntryTask) RestoreRollbackState(data map[string]any) error {
+	var state desktopEntryState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.createdFile = state.CreatedFile
+	return nil
+}
@@ -2,6 +2,7 @@
 package builtin
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -24,10 +25,15 @@ type DownloadTask struct {
 	SHA256           string
 	Timeout          time.Duration
 	Headers          map[string]string
+	Size             int64 // Expected size in bytes, for progress weighting
 	RequirePrivilege bool
 
 	// For rollback
 	downloadedFile string
+
+	// Outputs of the last run
+	sha256Sum string
+	written   int64
 }
 
 // RegisterDownloadTask registers the download task factory.
@@ -53,6 +59,7 @@ func RegisterDownloadTask() {
 			SHA256:           getConfigString(config, "sha256"),
 			Timeout:          time.Duration(getConfigIntAny(config, 300, "timeoutSec", "timeout")) * time.Second,
 			Headers:          headers,
+			Size:             int64(getConfigInt(config, "size", 0)),
 			RequirePrivilege: getConfigBool(config, "requirePrivilege"),
 		}
 
@@ -81,11 +88,16 @@ func (t *DownloadTask) Validate() error {
 
 // Execute downloads the file.
 func (t *DownloadTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
+	return t.ExecuteContext(context.Background(), ctx, bus)
+}
+
+// ExecuteContext downloads the file, aborting the transfer when cctx is done.
+func (t *DownloadTask) ExecuteContext(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	if err := ensurePrivilege(ctx, t.RequirePrivilege); err != nil {
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Downloading %s to %s", t.URL, t.Destination))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Downloading %s to %s", t.URL, t.Destination))
 
 	// Ensure destination directory exists
 	destDir := filepath.Dir(t.Destination)
@@ -99,9 +111,9 @@ func (t *DownloadTask) Execute(ctx *core.InstallContext, bus *core.EventBus) err
 	}
 
 	// Start download
-	req, err := http.NewRequest(http.MethodGet, t.URL, nil)
+	req, err := http.NewRequestWithContext(cctx, http.MethodGet, t.URL, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return core.Permanent(fmt.Errorf("failed to create request: %w", err))
 	}
 	for k, v := range t.Headers {
 		req.Header.Set(k, v)
@@ -109,12 +121,15 @@ func (t *DownloadTask) Execute(ctx *core.InstallContext, bus *core.EventBus) err
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download: %w", err)
+		if cctx.Err() != nil {
+			return fmt.Errorf("download cancelled: %w", cctx.Err())
+		}
+		return core.Retryable(fmt.Errorf("failed to download: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status: %s", resp.Status)
+		return classifyStatus(fmt.Errorf("download failed with status: %s", resp.Status), resp.StatusCode)
 	}
 
 	// Create destination file
@@ -124,15 +139,19 @@ func (t *DownloadTask) Execute(ctx *core.InstallContext, bus *core.EventBus) err
 	}
 	defer out.Close()
 
-	// Track progress if content length is known
+	// Track progress if content length is known, falling back to the declared size
 	var reader io.Reader = resp.Body
 	contentLength := resp.ContentLength
+	if contentLength <= 0 {
+		contentLength = t.Size
+	}
 	if contentLength > 0 {
 		reader = &progressReader{
 			reader:       resp.Body,
 			total:        contentLength,
 			bus:          bus,
 			taskID:       t.TaskID,
+			label:        "Downloading",
 			lastProgress: -1,
 		}
 	}
@@ -141,28 +160,56 @@ func (t *DownloadTask) Execute(ctx *core.InstallContext, bus *core.EventBus) err
 	hasher := sha256.New()
 	writer := io.MultiWriter(out, hasher)
 
-	_, err = io.Copy(writer, reader)
+	written, err := io.Copy(writer, reader)
 	if err != nil {
 		os.Remove(t.Destination)
-		return fmt.Errorf("download failed: %w", err)
+		if cctx.Err() != nil {
+			return fmt.Errorf("download cancelled: %w", cctx.Err())
+		}
+		return core.Retryable(fmt.Errorf("download failed: %w", err))
 	}
 
 	// Verify checksum if provided
+	actualHash := hex.EncodeToString(hasher.Sum(nil))
 	if t.SHA256 != "" {
-		actualHash := hex.EncodeToString(hasher.Sum(nil))
 		if actualHash != t.SHA256 {
 			os.Remove(t.Destination)
-			return fmt.Errorf("checksum mismatch: expected %s, got %s", t.SHA256, actualHash)
+			return core.Permanent(fmt.Errorf("checksum mismatch: expected %s, got %s", t.SHA256, actualHash))
 		}
-		ctx.AddLog(core.LogInfo, "Checksum verified")
+		t.Log(ctx, core.LogInfo, "Checksum verified")
 	}
 
 	t.downloadedFile = t.Destination
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Downloaded %s successfully", t.URL))
+	t.sha256Sum = actualHash
+	t.written = written
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Downloaded %s successfully", t.URL))
 
 	return nil
 }
 
+// Plan describes the download without fetching anything.
+func (t *DownloadTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	action := core.PlannedAction{Kind: core.ActionDownload, Path: t.Destination, Source: t.URL}
+	if t.SHA256 != "" {
+		action.Detail = "sha256 " + t.SHA256
+	}
+	return []core.PlannedAction{action}
+}
+
+// Outputs returns the path, SHA-256 and size of the downloaded file.
+func (t *DownloadTask) Outputs() map[string]any {
+	return map[string]any{
+		"path":   t.downloadedFile,
+		"sha256": t.sha256Sum,
+		"size":   t.written,
+	}
+}
+
+// Weight estimates the download cost from its declared size.
+func (t *DownloadTask) Weight() float64 {
+	return core.BytesWeight(t.Size)
+}
+
 // CanRollback returns true if the task can be rolled back.
 func (t *DownloadTask) CanRollback() bool {
 	return t.downloadedFile != ""
@@ -171,7 +218,7 @@ func (t *DownloadTask) CanRollback() bool {
 // Rollback removes the downloaded file.
 func (t *DownloadTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
 	if t.downloadedFile != "" {
-		ctx.AddLog(core.LogInfo, fmt.Sprintf("Removing downloaded file: %s", t.downloadedFile))
+		t.Log(ctx, core.LogInfo, fmt.Sprintf("Removing downloaded file: %s", t.downloadedFile))
 		if err := os.Remove(t.downloadedFile); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to remove downloaded file: %w", err)
 		}
@@ -179,6 +226,37 @@ func (t *DownloadTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) er
 	return nil
 }
 
+// downloadState is the journaled form of the DownloadTask rollback data.
+type downloadState struct {
+	DownloadedFile string `json:"downloadedFile,omitempty"`
+}
+
+// RollbackState returns the data needed to roll back after a restart.
+func (t *DownloadTask) RollbackState() map[string]any {
+	return encodeState(downloadState{
+		DownloadedFile: t.downloadedFile,
+	})
+}
+
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *DownloadTask) RestoreRollbackState(data map[string]any) error {
+	var state downloadState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.downloadedFile = state.DownloadedFile
+	return nil
+}
+
+// classifyStatus marks server-side and throttling HTTP failures as retryable and
+// every other unexpected status (404, 403, ...) as permanent.
+func classifyStatus(err error, status int) error {
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout {
+		return core.Retryable(err)
+	}
+	return core.Permanent(err)
+}
+
 // progressReader wraps an io.Reader and reports progress.
 type progressReader struct {
 	reader       io.Reader
@@ -186,7 +264,8 @@ type progressReader struct {
 	current      int64
 	bus          *core.EventBus
 	taskID       string
-	lastProgress int // Last reported progress percentage
+	label        string // Message prefix, e.g. "Downloading"
+	lastProgress int    // Last reported progress percentage
 }
 
 func (r *progressReader) Read(p []byte) (int, error) {
@@ -199,10 +278,11 @@ func (r *progressReader) Read(p []byte) (int, error) {
 	// Only report if progress changed by at least 1%
 	if progress != r.lastProgress {
 		r.lastProgress = progress
-		r.bus.PublishProgress(
+		r.bus.PublishTaskProgress(
 			r.taskID,
-			float64(r.current)/float64(r.total),
-			fmt.Sprintf("Downloading: %d%%", progress),
+			r.current,
+			r.total,
+			fmt.Sprintf("%s: %d%%", r.label, progress),
 		)
 	}
 
@@ -1,11 +1,16 @@
 package builtin
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/HanHan666666/go-pkg-installer/pkg/core"
 )
@@ -117,6 +122,11 @@ func TestDownloadTaskWithChecksum(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Execute() error = %v", err)
 		}
+
+		outputs := task.Outputs()
+		if outputs["path"] != destination || outputs["sha256"] != expectedHash || outputs["size"] != int64(len(content)) {
+			t.Errorf("unexpected outputs: %v", outputs)
+		}
 	})
 
 	t.Run("invalid checksum", func(t *testing.T) {
@@ -135,6 +145,9 @@ func TestDownloadTaskWithChecksum(t *testing.T) {
 		if err == nil {
 			t.Error("expected error for invalid checksum")
 		}
+		if !core.IsPermanent(err) {
+			t.Errorf("expected checksum mismatch to be permanent, got %v", err)
+		}
 
 		if _, err := os.Stat(destination2); !os.IsNotExist(err) {
 			t.Error("file should have been removed after checksum failure")
@@ -216,3 +229,62 @@ func TestDownloadTaskFactory(t *testing.T) {
 		t.Errorf("expected destination to be rendered, got %q", dlTask.Destination)
 	}
 }
+
+func TestDownloadTaskReportsProgress(t *testing.T) {
+	content := strings.Repeat("x", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	bus := core.NewEventBus()
+	var last *core.ProgressPayload
+	bus.Subscribe(core.EventTaskProgress, func(e core.Event) {
+		last = e.ProgressPayload()
+	})
+
+	task := &DownloadTask{
+		BaseTask:    core.BaseTask{TaskID: "progress-download", TaskType: "download"},
+		URL:         server.URL + "/file.bin",
+		Destination: filepath.Join(t.TempDir(), "file.bin"),
+		Size:        8 * core.BytesPerWeight,
+	}
+	if err := task.Execute(core.NewInstallContext(), bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if last == nil || last.TaskID != "progress-download" || last.Current != 4096 || last.Total != 4096 {
+		t.Errorf("expected final byte progress, got %+v", last)
+	}
+	if task.Weight() != 8 {
+		t.Errorf("expected weight from declared size, got %f", task.Weight())
+	}
+}
+
+func TestDownloadTaskExecuteContextCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	cctx, cancel := context.WithCancel(context.Background())
+	destination := filepath.Join(t.TempDir(), "big.bin")
+	task := &DownloadTask{
+		BaseTask:    core.BaseTask{TaskID: "cancel-download", TaskType: "download"},
+		URL:         server.URL + "/big.bin",
+		Destination: destination,
+	}
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err := task.ExecuteContext(cctx, core.NewInstallContext(), core.NewEventBus())
+	if err == nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if _, statErr := os.Stat(destination); !os.IsNotExist(statErr) {
+		t.Error("partial download should be removed")
+	}
+}
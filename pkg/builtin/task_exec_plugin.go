@@ -0,0 +1,376 @@
+// Package builtin provides tasks backed by external plugin executables.
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HanHan666666/go-pkg-installer/pkg/core"
+)
+
+// ExecPluginProtocol is the version of the JSON protocol spoken with plugins.
+const ExecPluginProtocol = 1
+
+// ExecPluginPrefix is the task type namespace of plugin executables.
+const ExecPluginPrefix = "exec:"
+
+// execPluginTimeout bounds a plugin command unless timeoutSec is set.
+const execPluginTimeout = 300 * time.Second
+
+// execPluginName matches plugin names usable in a task type.
+var execPluginName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// ExecPluginTask runs a task implemented by an external program.
+//
+// Each command (validate, execute or rollback) starts the program once and
+// writes one JSON request to its stdin. The program answers with JSON lines
+// on stdout: log and progress messages while it works, then a result. Other
+// stdout lines are logged as they are, stderr lines as warnings.
+type ExecPluginTask struct {
+	core.BaseTask
+	Path             string
+	Params           map[string]any // Rendered task config sent to the plugin
+	Timeout          time.Duration
+	RequirePrivilege bool
+
+	ctx *core.InstallContext // For Validate, which has no context of its own
+
+	// Result of execute
+	outputs     map[string]any
+	state       map[string]any
+	canRollback bool
+}
+
+// execPluginRequest is written to the plugin's stdin.
+type execPluginRequest struct {
+	Protocol int            `json:"protocol"`
+	Command  string         `json:"command"` // validate, execute or rollback
+	TaskID   string         `json:"taskId"`
+	TaskType string         `json:"taskType"`
+	Config   map[string]any `json:"config"`
+	Context  map[string]any `json:"context,omitempty"`
+	State    map[string]any `json:"state,omitempty"` // From the execute result, for rollback
+	DryRun   bool           `json:"dryRun,omitempty"`
+}
+
+// execPluginMessage is one JSON line the plugin writes to stdout.
+type execPluginMessage struct {
+	Type string `json:"type"` // log, progress or result
+
+	// log
+	Level   string         `json:"level,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Fields  map[string]any `json:"fields,omitempty"`
+
+	// progress (and Message)
+	Current int64 `json:"current,omitempty"`
+	Total   int64 `json:"total,omitempty"`
+
+	// result
+	OK       bool           `json:"ok,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Outputs  map[string]any `json:"outputs,omitempty"`
+	State    map[string]any `json:"state,omitempty"`
+	Rollback bool           `json:"rollback,omitempty"` // The execute result can be rolled back
+}
+
+// RegisterExecPlugins registers every executable file in dir as an
+// exec:<name> task type, where name is the file name without its extension.
+// A missing directory has no plugins. It returns the registered task types.
+func RegisterExecPlugins(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	var types []string
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if !execPluginName.MatchString(name) {
+			continue
+		}
+
+		typeName := ExecPluginPrefix + name
+		if err := core.Tasks.Register(typeName, execPluginFactory(typeName, path)); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", path, err))
+			continue
+		}
+		types = append(types, typeName)
+	}
+	sort.Strings(types)
+	return types, errors.Join(errs...)
+}
+
+// execPluginFactory creates tasks run by the plugin at path.
+func execPluginFactory(typeName, path string) core.TaskFactory {
+	return func(config map[string]any, ctx *core.InstallContext) (core.Task, error) {
+		rendered, err := renderValue(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", typeName, err)
+		}
+		params, _ := rendered.(map[string]any)
+		task := &ExecPluginTask{
+			BaseTask: core.BaseTask{
+				TaskID:   getConfigString(config, "id"),
+				TaskType: typeName,
+				Config:   config,
+			},
+			Path:             path,
+			Params:           params,
+			Timeout:          time.Duration(getConfigInt(config, "timeoutSec", 0)) * time.Second,
+			RequirePrivilege: getConfigBool(config, "requirePrivilege"),
+			ctx:              ctx,
+		}
+
+		if task.TaskID == "" {
+			task.TaskID = strings.TrimPrefix(typeName, ExecPluginPrefix)
+		}
+
+		return task, nil
+	}
+}
+
+// Validate asks the plugin to check the task configuration.
+func (t *ExecPluginTask) Validate() error {
+	if t.Path == "" {
+		return errors.New("exec plugin: path is required")
+	}
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = core.NewInstallContext()
+	}
+	if _, err := t.run(context.Background(), ctx, nil, "validate", nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Execute runs the plugin.
+func (t *ExecPluginTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
+	return t.ExecuteContext(context.Background(), ctx, bus)
+}
+
+// ExecuteContext runs the plugin, killing it when cctx is done.
+func (t *ExecPluginTask) ExecuteContext(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
+	if err := ensurePrivilege(ctx, t.RequirePrivilege); err != nil {
+		return err
+	}
+
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Running plugin %s", t.Path))
+
+	result, err := t.run(cctx, ctx, bus, "execute", nil)
+	if result != nil {
+		t.outputs = result.Outputs
+		t.state = result.State
+		t.canRollback = result.Rollback
+	}
+	return err
+}
+
+// run sends one command to the plugin and processes its messages until it
+// exits. It returns the plugin's result, if it sent one.
+func (t *ExecPluginTask) run(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus, command string, state map[string]any) (*execPluginMessage, error) {
+	request, err := json.Marshal(execPluginRequest{
+		Protocol: ExecPluginProtocol,
+		Command:  command,
+		TaskID:   t.TaskID,
+		TaskType: t.TaskType,
+		Config:   t.Params,
+		Context:  ctx.InputSnapshot(),
+		State:    state,
+		DryRun:   ctx.Runtime.DryRun,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("exec plugin: failed to encode request: %w", err)
+	}
+
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = execPluginTimeout
+	}
+	ctxTimeout, cancel := context.WithTimeout(cctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctxTimeout, t.Path)
+	setProcessGroup(cmd)
+	cmd.Stdin = bytes.NewReader(append(request, '\n'))
+
+	// Output is copied through pipes that are closed only after Wait, as for
+	// shell tasks.
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec plugin: failed to start %s: %w", t.Path, err)
+	}
+
+	var result *execPluginMessage
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		result = t.readMessages(ctx, bus, stdoutReader)
+	}()
+	go streamOutput(ctx, &t.BaseTask, stderrReader, core.LogWarn, "stderr", &wg)
+
+	err = cmd.Wait()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+
+	switch {
+	case cctx.Err() != nil:
+		return result, fmt.Errorf("plugin %s cancelled: %w", command, cctx.Err())
+	case ctxTimeout.Err() == context.DeadlineExceeded:
+		return result, fmt.Errorf("plugin %s timed out after %v", command, timeout)
+	case result != nil && !result.OK:
+		message := result.Error
+		if message == "" {
+			message = "no reason given"
+		}
+		return result, fmt.Errorf("plugin %s failed: %s", command, message)
+	case err != nil:
+		return result, fmt.Errorf("plugin %s failed: %w", command, err)
+	}
+	return result, nil
+}
+
+// readMessages handles the JSON lines the plugin writes and returns its last
+// result message.
+func (t *ExecPluginTask) readMessages(ctx *core.InstallContext, bus *core.EventBus, reader io.Reader) *execPluginMessage {
+	scanner := bufio.NewScanner(reader)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	var result *execPluginMessage
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var msg execPluginMessage
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &msg) != nil {
+			t.Log(ctx, core.LogInfo, line, "stream", "stdout")
+			continue
+		}
+
+		switch msg.Type {
+		case "log":
+			level, err := core.ParseLogLevel(msg.Level)
+			if err != nil {
+				level = core.LogInfo
+			}
+			t.Log(ctx, level, msg.Message, execPluginFields(msg.Fields)...)
+		case "progress":
+			if bus != nil {
+				bus.PublishTaskProgress(t.TaskID, msg.Current, msg.Total, msg.Message)
+			}
+		case "result":
+			result = &msg
+		default:
+			t.Log(ctx, core.LogWarn, fmt.Sprintf("Unknown plugin message type %q", msg.Type))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Log(ctx, core.LogWarn, fmt.Sprintf("stream read error (stdout): %v", err))
+		// Keep draining so the plugin never blocks
+		_, _ = io.Copy(io.Discard, reader)
+	}
+	return result
+}
+
+// execPluginFields turns the fields of a log message into key-value pairs.
+func execPluginFields(fields map[string]any) []any {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	keyvals := make([]any, 0, 2*len(keys))
+	for _, k := range keys {
+		keyvals = append(keyvals, k, fields[k])
+	}
+	return keyvals
+}
+
+// Plan describes the plugin run without starting it.
+func (t *ExecPluginTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	return []core.PlannedAction{{Kind: core.ActionRunCommand, Command: t.Path, Detail: "plugin " + t.TaskType}}
+}
+
+// Outputs returns the outputs of the plugin's result.
+func (t *ExecPluginTask) Outputs() map[string]any {
+	return t.outputs
+}
+
+// Weight returns the fixed progress weight of a command.
+func (t *ExecPluginTask) Weight() float64 {
+	return shellTaskWeight
+}
+
+// CanRollback returns true if the plugin's execute result said so.
+func (t *ExecPluginTask) CanRollback() bool {
+	return t.canRollback
+}
+
+// Rollback asks the plugin to undo its execute, passing back the state it
+// returned then.
+func (t *ExecPluginTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
+	if !t.canRollback {
+		return nil
+	}
+
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Rolling back plugin %s", t.Path))
+
+	_, err := t.run(context.Background(), ctx, bus, "rollback", t.state)
+	return err
+}
+
+// execPluginState is the journaled form of the ExecPluginTask rollback data.
+type execPluginState struct {
+	State    map[string]any `json:"state,omitempty"`
+	Rollback bool           `json:"rollback,omitempty"`
+}
+
+// RollbackState returns the data needed to roll back after a restart.
+func (t *ExecPluginTask) RollbackState() map[string]any {
+	return encodeState(execPluginState{State: t.state, Rollback: t.canRollback})
+}
+
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *ExecPluginTask) RestoreRollbackState(data map[string]any) error {
+	var state execPluginState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.state = state.State
+	t.canRollback = state.Rollback
+	return nil
+}
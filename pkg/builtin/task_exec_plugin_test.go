@@ -0,0 +1,160 @@
+package builtin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HanHan666666/go-pkg-installer/pkg/core"
+)
+
+// testPlugin answers the plugin protocol: it rejects a config without
+// "name", writes "name" to a marker file on execute and removes the file
+// named in its state on rollback.
+const testPlugin = `#!/bin/sh
+req=$(cat)
+case "$req" in
+*'"command":"validate"'*)
+	case "$req" in
+	*'"name":'*) echo '{"type":"result","ok":true}' ;;
+	*) echo '{"type":"result","ok":false,"error":"name is required"}' ;;
+	esac ;;
+*'"command":"execute"'*)
+	echo "plain output"
+	echo "a warning" >&2
+	echo '{"type":"log","level":"debug","message":"writing marker","fields":{"file":"marker"}}'
+	echo '{"type":"progress","current":1,"total":2,"message":"halfway"}'
+	echo "$req" > "$MARKER"
+	echo '{"type":"result","ok":true,"rollback":true,"outputs":{"version":"1.2"},"state":{"file":"'"$MARKER"'"}}' ;;
+*'"command":"rollback"'*)
+	file=$(echo "$req" | sed 's/.*"state":{"file":"\([^"]*\)".*/\1/')
+	rm -f "$file"
+	echo '{"type":"result","ok":true}' ;;
+esac
+`
+
+func writeTestPlugin(t *testing.T, dir, name string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(testPlugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterExecPlugins(t *testing.T) {
+	// The global registry cannot forget plugins, so each run uses a new name
+	dir := t.TempDir()
+	name := fmt.Sprintf("check-env-%d", time.Now().UnixNano())
+	writeTestPlugin(t, dir, name+".sh")
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a plugin"), 0644)
+
+	types, err := RegisterExecPlugins(dir)
+	if err != nil {
+		t.Fatalf("RegisterExecPlugins failed: %v", err)
+	}
+	if len(types) != 1 || types[0] != "exec:"+name || !core.Tasks.Has("exec:"+name) {
+		t.Errorf("expected only exec:%s to be registered, got %v", name, types)
+	}
+	if _, err := RegisterExecPlugins(dir); err == nil {
+		t.Error("expected error when a plugin name is taken")
+	}
+
+	if types, err := RegisterExecPlugins(filepath.Join(dir, "missing")); err != nil || len(types) != 0 {
+		t.Errorf("expected a missing directory to have no plugins, got %v %v", types, err)
+	}
+}
+
+func TestExecPluginTaskProtocol(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPlugin(t, dir, "marker")
+	marker := filepath.Join(dir, "marker.out")
+	t.Setenv("MARKER", marker)
+
+	ctx := core.NewInstallContext()
+	ctx.SetLogLevel(core.LogDebug)
+	ctx.Set("install_dir", "/opt/app")
+	bus := core.NewEventBus()
+	var progress []core.ProgressPayload
+	bus.Subscribe(core.EventTaskProgress, func(e core.Event) {
+		progress = append(progress, e.Payload.(core.ProgressPayload))
+	})
+
+	factory := execPluginFactory("exec:marker", filepath.Join(dir, "marker"))
+	invalid, _ := factory(map[string]any{"type": "exec:marker"}, ctx)
+	if err := invalid.Validate(); err == nil || !strings.Contains(err.Error(), "name is required") {
+		t.Errorf("expected the plugin to reject the config, got %v", err)
+	}
+
+	task, _ := factory(map[string]any{"type": "exec:marker", "name": "${install_dir}/app"}, ctx)
+	if err := task.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	// The request carries the rendered config
+	data, _ := os.ReadFile(marker)
+	var request map[string]any
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatalf("expected the request to be JSON, got %s", data)
+	}
+	if config, _ := request["config"].(map[string]any); config["name"] != "/opt/app/app" {
+		t.Errorf("expected rendered config, got %v", request["config"])
+	}
+
+	messages := map[string]core.LogEntry{}
+	for _, entry := range ctx.Runtime.Logs {
+		messages[entry.Message] = entry
+	}
+	if entry, ok := messages["writing marker"]; !ok || entry.Level != core.LogDebug || entry.Fields["file"] != "marker" {
+		t.Errorf("expected the log message to be logged, got %+v", entry)
+	}
+	if _, ok := messages["plain output"]; !ok {
+		t.Error("expected plain stdout to be logged")
+	}
+	if entry, ok := messages["a warning"]; !ok || entry.Level != core.LogWarn {
+		t.Errorf("expected stderr to be logged as warning, got %+v", entry)
+	}
+	if len(progress) != 1 || progress[0].Current != 1 || progress[0].Total != 2 {
+		t.Errorf("expected a progress event, got %+v", progress)
+	}
+	if outputs := task.(*ExecPluginTask).Outputs(); outputs["version"] != "1.2" {
+		t.Errorf("expected outputs from the result, got %v", outputs)
+	}
+
+	// Simulate a restart: a fresh task only has the journaled state.
+	state, _ := json.Marshal(task.(*ExecPluginTask).RollbackState())
+	var journaled map[string]any
+	_ = json.Unmarshal(state, &journaled)
+	restored, _ := factory(map[string]any{"type": "exec:marker", "name": "app"}, ctx)
+	if err := restored.(*ExecPluginTask).RestoreRollbackState(journaled); err != nil {
+		t.Fatalf("RestoreRollbackState failed: %v", err)
+	}
+	if !restored.CanRollback() {
+		t.Fatal("expected the task to be rollbackable")
+	}
+	if err := restored.Rollback(ctx, bus); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("expected the plugin to undo its work")
+	}
+}
+
+func TestExecPluginTaskFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fail")
+	os.WriteFile(path, []byte("#!/bin/sh\necho broken >&2\nexit 3\n"), 0755)
+
+	task, _ := execPluginFactory("exec:fail", path)(map[string]any{}, core.NewInstallContext())
+	if err := task.Execute(core.NewInstallContext(), core.NewEventBus()); err == nil {
+		t.Error("expected a failing plugin to fail the task")
+	}
+	if task.CanRollback() {
+		t.Error("expected no rollback without a result")
+	}
+}
@@ -24,6 +24,7 @@ type NetScriptTask struct {
 	SHA256           string
 	Timeout          time.Duration
 	Env              map[string]string
+	ContextEnv       map[string]string // Context values as GPKI_* variables
 	WorkDir          string
 	RequirePrivilege bool
 }
@@ -50,6 +51,7 @@ func RegisterNetScriptTask() {
 			SHA256:           getConfigString(config, "sha256"),
 			Timeout:          time.Duration(getConfigIntAny(config, 300, "timeoutSec", "timeout")) * time.Second,
 			Env:              env,
+			ContextEnv:       ctx.ShellEnv(getConfigStringSlice(config, "passEnv")),
 			WorkDir:          ctx.Render(getConfigStringAny(config, "workDir", "workdir")),
 			RequirePrivilege: getConfigBool(config, "requirePrivilege"),
 		}
@@ -72,21 +74,33 @@ func (t *NetScriptTask) Validate() error {
 
 // Execute downloads and runs the script.
 func (t *NetScriptTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
+	return t.ExecuteContext(context.Background(), ctx, bus)
+}
+
+// ExecuteContext downloads and runs the script, killing it when cctx is done.
+func (t *NetScriptTask) ExecuteContext(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	if err := ensurePrivilege(ctx, t.RequirePrivilege); err != nil {
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Downloading script: %s", t.URL))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Downloading script: %s", t.URL))
 
 	client := &http.Client{Timeout: t.Timeout}
-	resp, err := client.Get(t.URL)
+	req, err := http.NewRequestWithContext(cctx, http.MethodGet, t.URL, nil)
 	if err != nil {
-		return fmt.Errorf("failed to download script: %w", err)
+		return core.Permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if cctx.Err() != nil {
+			return fmt.Errorf("script download cancelled: %w", cctx.Err())
+		}
+		return core.Retryable(fmt.Errorf("failed to download script: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("script download failed with status: %s", resp.Status)
+		return classifyStatus(fmt.Errorf("script download failed with status: %s", resp.Status), resp.StatusCode)
 	}
 
 	data, err := io.ReadAll(resp.Body)
@@ -98,7 +112,7 @@ func (t *NetScriptTask) Execute(ctx *core.InstallContext, bus *core.EventBus) er
 		hash := sha256.Sum256(data)
 		actual := hex.EncodeToString(hash[:])
 		if actual != t.SHA256 {
-			return fmt.Errorf("checksum mismatch: expected %s, got %s", t.SHA256, actual)
+			return core.Permanent(fmt.Errorf("checksum mismatch: expected %s, got %s", t.SHA256, actual))
 		}
 	}
 
@@ -108,7 +122,7 @@ func (t *NetScriptTask) Execute(ctx *core.InstallContext, bus *core.EventBus) er
 	}
 	defer os.Remove(scriptPath)
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Executing script: %s", scriptPath))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Executing script: %s", scriptPath))
 
 	timeout := t.Timeout
 	if timeout == 0 {
@@ -116,21 +130,17 @@ func (t *NetScriptTask) Execute(ctx *core.InstallContext, bus *core.EventBus) er
 	}
 
 	cmd := execCommand("sh", scriptPath)
+	setProcessGroup(cmd)
 	if t.WorkDir != "" {
 		cmd.Dir = t.WorkDir
 	}
-	if len(t.Env) > 0 {
-		cmd.Env = os.Environ()
-		for k, v := range t.Env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	}
+	cmd.Env = commandEnv(t.ContextEnv, t.Env)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), timeout)
+	ctxWithTimeout, cancel := context.WithTimeout(cctx, timeout)
 	defer cancel()
 
 	if err := cmd.Start(); err != nil {
@@ -148,16 +158,33 @@ func (t *NetScriptTask) Execute(ctx *core.InstallContext, bus *core.EventBus) er
 			return fmt.Errorf("script failed: %w: %s", err, stderr.String())
 		}
 	case <-ctxWithTimeout.Done():
-		_ = cmd.Process.Kill()
+		_ = killProcessGroup(cmd)
+		<-done
+		if cctx.Err() != nil {
+			return fmt.Errorf("script cancelled: %w", cctx.Err())
+		}
 		return fmt.Errorf("script timed out after %v", timeout)
 	}
 
 	if stdout.Len() > 0 {
-		ctx.AddLog(core.LogInfo, fmt.Sprintf("stdout: %s", stdout.String()))
+		t.Log(ctx, core.LogInfo, fmt.Sprintf("stdout: %s", stdout.String()))
 	}
 	return nil
 }
 
+// Plan describes the script download and run without fetching it.
+func (t *NetScriptTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	download := core.PlannedAction{Kind: core.ActionDownload, Path: os.TempDir(), Source: t.URL}
+	if t.SHA256 != "" {
+		download.Detail = "sha256 " + t.SHA256
+	}
+	run := core.PlannedAction{Kind: core.ActionRunCommand, Command: "sh <script from " + t.URL + ">"}
+	if t.WorkDir != "" {
+		run.Detail = "in " + t.WorkDir
+	}
+	return []core.PlannedAction{download, run}
+}
+
 // CanRollback returns false by default.
 func (t *NetScriptTask) CanRollback() bool {
 	return false
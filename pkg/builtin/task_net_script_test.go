@@ -49,3 +49,33 @@ func TestNetScriptTaskExecute(t *testing.T) {
 		t.Fatalf("expected output file, got error: %v", err)
 	}
 }
+
+func TestNetScriptTaskPassEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	script := []byte(`printf '%s %s' "$GPKI_VERSION" "$GPKI_TOKEN" > out.txt` + "\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(script)
+	}))
+	defer server.Close()
+
+	RegisterNetScriptTask()
+	ctx := core.NewInstallContext()
+	ctx.Set("version", "1.2")
+	ctx.Set("token", "hidden")
+	factory, _ := core.Tasks.Get("net_script")
+	task, err := factory(map[string]any{
+		"url":     server.URL,
+		"workDir": tmpDir,
+		"passEnv": []any{"version"},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("factory error = %v", err)
+	}
+	if err := task.Execute(ctx, core.NewEventBus()); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(tmpDir, "out.txt")); string(data) != "1.2 " {
+		t.Errorf("expected only the listed values to be passed, got %q", data)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/HanHan666666/go-pkg-installer/pkg/core"
 )
@@ -21,6 +22,9 @@ type PermissionTask struct {
 	Group            string
 	Recursive        bool
 	RequirePrivilege bool
+
+	// For rollback
+	backups []core.FileBackup
 }
 
 // RegisterPermissionTask registers the permission task factory.
@@ -70,21 +74,28 @@ func (t *PermissionTask) Execute(ctx *core.InstallContext, bus *core.EventBus) e
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Updating permissions: %s", t.Path))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Updating permissions: %s", t.Path))
 
 	if t.Recursive {
 		return filepath.Walk(t.Path, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			return t.apply(path)
+			return t.apply(ctx, path)
 		})
 	}
 
-	return t.apply(t.Path)
+	return t.apply(ctx, t.Path)
 }
 
-func (t *PermissionTask) apply(path string) error {
+func (t *PermissionTask) apply(ctx *core.InstallContext, path string) error {
+	// Keep the previous mode and owner for rollback
+	backup, err := ctx.Backups().SnapshotAttrs(path)
+	if err != nil {
+		return err
+	}
+	t.backups = append(t.backups, backup)
+
 	if t.Mode != 0 {
 		if err := os.Chmod(path, t.Mode); err != nil {
 			return fmt.Errorf("chmod failed for %s: %w", path, err)
@@ -104,13 +115,57 @@ func (t *PermissionTask) apply(path string) error {
 	return nil
 }
 
-// CanRollback returns false by default.
+// Plan describes the permission change without applying it.
+func (t *PermissionTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	var details []string
+	if t.Mode != 0 {
+		details = append(details, fmt.Sprintf("mode %04o", uint32(t.Mode.Perm())))
+	}
+	if t.Owner != "" || t.Group != "" {
+		details = append(details, fmt.Sprintf("owner %s:%s", t.Owner, t.Group))
+	}
+	if t.Recursive {
+		details = append(details, "recursive")
+	}
+	return []core.PlannedAction{{Kind: core.ActionChmod, Path: t.Path, Detail: strings.Join(details, ", ")}}
+}
+
+// CanRollback returns true once a path was changed.
 func (t *PermissionTask) CanRollback() bool {
-	return false
+	return len(t.backups) > 0
 }
 
-// Rollback does nothing for permission operations.
+// Rollback restores the previous modes and owners.
 func (t *PermissionTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
+	if len(t.backups) == 0 {
+		return nil
+	}
+
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Rolling back permissions: %s", t.Path))
+
+	if err := ctx.Backups().RestoreAll(t.backups); err != nil {
+		return fmt.Errorf("failed to restore permissions: %w", err)
+	}
+	return nil
+}
+
+// permissionState is the journaled form of the PermissionTask rollback data.
+type permissionState struct {
+	Backups []core.FileBackup `json:"backups,omitempty"`
+}
+
+// RollbackState returns the data needed to roll back after a restart.
+func (t *PermissionTask) RollbackState() map[string]any {
+	return encodeState(permissionState{Backups: t.backups})
+}
+
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *PermissionTask) RestoreRollbackState(data map[string]any) error {
+	var state permissionState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.backups = state.Backups
 	return nil
 }
 
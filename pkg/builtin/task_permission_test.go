@@ -1,6 +1,7 @@
 package builtin
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -15,7 +16,7 @@ func TestPermissionTaskMode(t *testing.T) {
 		t.Fatalf("write failed: %v", err)
 	}
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	ctx.Env.IsRoot = true
 	bus := core.NewEventBus()
 
@@ -41,3 +42,39 @@ func TestPermissionTaskMode(t *testing.T) {
 		t.Fatalf("expected mode 0600, got %v", info.Mode().Perm())
 	}
 }
+
+func TestPermissionTaskRollback(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "app")
+	os.MkdirAll(filepath.Join(dir, "bin"), 0755)
+	os.WriteFile(filepath.Join(dir, "bin", "app"), []byte("#!/bin/sh"), 0755)
+
+	ctx := newQuarantineContext(t)
+	bus := core.NewEventBus()
+
+	task := &PermissionTask{Path: dir, Mode: 0700, Recursive: true}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if !task.CanRollback() {
+		t.Fatal("expected CanRollback to return true")
+	}
+
+	// Simulate a restart: a fresh task only has the journaled state.
+	data, _ := json.Marshal(task.RollbackState())
+	var state map[string]any
+	_ = json.Unmarshal(data, &state)
+	restored := &PermissionTask{}
+	if err := restored.RestoreRollbackState(state); err != nil {
+		t.Fatalf("RestoreRollbackState failed: %v", err)
+	}
+	if err := restored.Rollback(ctx, bus); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	for _, path := range []string{dir, filepath.Join(dir, "bin"), filepath.Join(dir, "bin", "app")} {
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0755 {
+			t.Errorf("expected mode 0755 for %s, got %v", path, info.Mode().Perm())
+		}
+	}
+}
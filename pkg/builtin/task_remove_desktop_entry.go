@@ -60,13 +60,27 @@ func (t *RemoveDesktopEntryTask) Execute(ctx *core.InstallContext, bus *core.Eve
 		if err := removeFile(path); err != nil {
 			return err
 		}
-		ctx.AddLog(core.LogInfo, fmt.Sprintf("Removed desktop entry: %s", path))
+		t.Log(ctx, core.LogInfo, fmt.Sprintf("Removed desktop entry: %s", path))
 		return nil
 	}
 
 	return fmt.Errorf("desktop entry not found for %s", t.Name)
 }
 
+// Plan describes which desktop entry would be removed.
+func (t *RemoveDesktopEntryTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	paths := t.resolvePaths()
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return []core.PlannedAction{{Kind: core.ActionDelete, Path: path}}
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return []core.PlannedAction{{Kind: core.ActionDelete, Path: paths[0], Detail: "not found"}}
+}
+
 // CanRollback returns false by default.
 func (t *RemoveDesktopEntryTask) CanRollback() bool {
 	return false
@@ -10,7 +10,9 @@ import (
 	"github.com/HanHan666666/go-pkg-installer/pkg/core"
 )
 
-// RemovePathTask removes a file or directory.
+// RemovePathTask removes a file or directory. The path is moved into the
+// context's quarantine rather than deleted, so rollback can restore it; the
+// quarantine is purged once the flow has succeeded.
 type RemovePathTask struct {
 	core.BaseTask
 	Path             string
@@ -19,9 +21,9 @@ type RemovePathTask struct {
 	UserData         bool
 	RequirePrivilege bool
 
-	// For rollback - we don't support full rollback for remove
-	// but we track what was removed for logging
+	// For rollback
 	removedPath string
+	keptPath    string // Where the quarantine keeps the removed path
 }
 
 // RegisterRemovePathTask registers the remove_path task factory.
@@ -61,7 +63,7 @@ func (t *RemovePathTask) Execute(ctx *core.InstallContext, bus *core.EventBus) e
 	if t.UserData {
 		if keep, ok := ctx.Get("uninstall.keepUserData"); ok {
 			if keepBool, ok := keep.(bool); ok && keepBool {
-				ctx.AddLog(core.LogInfo, fmt.Sprintf("Skipping user data removal: %s", t.Path))
+				t.Log(ctx, core.LogInfo, fmt.Sprintf("Skipping user data removal: %s", t.Path))
 				return nil
 			}
 		}
@@ -71,14 +73,14 @@ func (t *RemovePathTask) Execute(ctx *core.InstallContext, bus *core.EventBus) e
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Removing: %s", t.Path))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Removing: %s", t.Path))
 
 	// Check if path exists
 	info, err := os.Lstat(t.Path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			if t.Force {
-				ctx.AddLog(core.LogInfo, "Path does not exist, skipping")
+				t.Log(ctx, core.LogInfo, "Path does not exist, skipping")
 				return nil
 			}
 			return fmt.Errorf("path does not exist: %s", t.Path)
@@ -97,36 +99,76 @@ func (t *RemovePathTask) Execute(ctx *core.InstallContext, bus *core.EventBus) e
 		}
 	}
 
-	// Remove
-	var removeErr error
-	if t.Recursive {
-		removeErr = os.RemoveAll(t.Path)
-	} else {
-		removeErr = os.Remove(t.Path)
-	}
-
-	if removeErr != nil {
-		if t.Force && os.IsNotExist(removeErr) {
+	// Remove into the quarantine
+	kept, err := ctx.Quarantine().Move(t.Path)
+	if err != nil {
+		if t.Force && os.IsNotExist(err) {
 			return nil
 		}
-		return fmt.Errorf("failed to remove: %w", removeErr)
+		return fmt.Errorf("failed to remove: %w", err)
 	}
 
 	t.removedPath = t.Path
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Removed: %s", t.Path))
+	t.keptPath = kept
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Removed: %s", t.Path), "quarantine", kept)
 
 	return nil
 }
 
-// CanRollback returns false as we can't restore deleted files.
+// Plan describes the removal without deleting anything.
+func (t *RemovePathTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	if t.UserData {
+		if keep, ok := ctx.Get("uninstall.keepUserData"); ok {
+			if keepBool, ok := keep.(bool); ok && keepBool {
+				return nil
+			}
+		}
+	}
+
+	action := core.PlannedAction{Kind: core.ActionDelete, Path: t.Path}
+	if t.Recursive {
+		action.Detail = "recursive"
+	}
+	return []core.PlannedAction{action}
+}
+
+// CanRollback returns true once a path has been moved into the quarantine.
 func (t *RemovePathTask) CanRollback() bool {
-	return false
+	return t.keptPath != ""
 }
 
-// Rollback does nothing for remove operations.
+// Rollback restores the removed path from the quarantine.
 func (t *RemovePathTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
-	if t.removedPath != "" {
-		ctx.AddLog(core.LogWarn, fmt.Sprintf("Cannot restore removed path: %s", t.removedPath))
+	if t.keptPath == "" {
+		return nil
+	}
+
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Restoring removed path: %s", t.removedPath))
+	if err := ctx.Quarantine().Restore(t.keptPath, t.removedPath); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", t.removedPath, err)
+	}
+	t.keptPath = ""
+	return nil
+}
+
+// removePathState is the journaled form of the RemovePathTask rollback data.
+type removePathState struct {
+	RemovedPath string `json:"removedPath,omitempty"`
+	KeptPath    string `json:"keptPath,omitempty"`
+}
+
+// RollbackState returns the data needed to roll back after a restart.
+func (t *RemovePathTask) RollbackState() map[string]any {
+	return encodeState(removePathState{RemovedPath: t.removedPath, KeptPath: t.keptPath})
+}
+
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *RemovePathTask) RestoreRollbackState(data map[string]any) error {
+	var state removePathState
+	if err := decodeState(data, &state); err != nil {
+		return err
 	}
+	t.removedPath = state.RemovedPath
+	t.keptPath = state.KeptPath
 	return nil
 }
@@ -49,7 +49,7 @@ func TestRemovePathTaskExecuteFile(t *testing.T) {
 	testFile := filepath.Join(tmpDir, "test.txt")
 	os.WriteFile(testFile, []byte("content"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &RemovePathTask{
@@ -76,7 +76,7 @@ func TestRemovePathTaskExecuteEmptyDir(t *testing.T) {
 	testDir := filepath.Join(tmpDir, "empty")
 	os.MkdirAll(testDir, 0755)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &RemovePathTask{
@@ -105,7 +105,7 @@ func TestRemovePathTaskNonEmptyDirNoRecursive(t *testing.T) {
 	os.MkdirAll(testDir, 0755)
 	os.WriteFile(filepath.Join(testDir, "file.txt"), []byte("content"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &RemovePathTask{
@@ -126,7 +126,7 @@ func TestRemovePathTaskRecursive(t *testing.T) {
 	os.WriteFile(filepath.Join(testDir, "file1.txt"), []byte("content1"), 0644)
 	os.WriteFile(filepath.Join(testDir, "subdir", "file2.txt"), []byte("content2"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &RemovePathTask{
@@ -153,7 +153,7 @@ func TestRemovePathTaskNonExistent(t *testing.T) {
 	tmpDir := t.TempDir()
 	nonExistent := filepath.Join(tmpDir, "nonexistent")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	t.Run("without force", func(t *testing.T) {
@@ -181,13 +181,61 @@ func TestRemovePathTaskNonExistent(t *testing.T) {
 	})
 }
 
-func TestRemovePathTaskNoRollback(t *testing.T) {
-	task := &RemovePathTask{
-		Path: "/tmp/file",
-	}
+func TestRemovePathTaskRollbackRestoresFromQuarantine(t *testing.T) {
+	tmpDir := t.TempDir()
+	testDir := filepath.Join(tmpDir, "app")
+	os.MkdirAll(filepath.Join(testDir, "data"), 0750)
+	os.WriteFile(filepath.Join(testDir, "data", "settings.json"), []byte("{}"), 0600)
 
+	ctx := newQuarantineContext(t)
+	bus := core.NewEventBus()
+	task := &RemovePathTask{Path: testDir, Recursive: true}
 	if task.CanRollback() {
-		t.Error("expected CanRollback to return false for remove operations")
+		t.Error("expected nothing to roll back before the removal")
+	}
+
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if _, err := os.Stat(testDir); !os.IsNotExist(err) {
+		t.Fatal("directory should have been removed")
+	}
+	if !task.CanRollback() {
+		t.Fatal("expected the removal to be rollbackable")
+	}
+
+	if err := task.Rollback(ctx, bus); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	info, err := os.Stat(filepath.Join(testDir, "data", "settings.json"))
+	if err != nil {
+		t.Fatalf("expected the directory to be restored: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file mode to be kept, got %v", info.Mode().Perm())
+	}
+}
+
+func TestRemovePathTaskRollbackAfterRestart(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "app.conf")
+	os.WriteFile(testFile, []byte("content"), 0644)
+
+	ctx := newQuarantineContext(t)
+	task := &RemovePathTask{Path: testFile}
+	if err := task.Execute(ctx, core.NewEventBus()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// A new process knows the task only from the journal
+	restored := &RemovePathTask{Path: testFile}
+	if err := restored.RestoreRollbackState(task.RollbackState()); err != nil {
+		t.Fatalf("RestoreRollbackState() error = %v", err)
+	}
+	if err := restored.Rollback(newQuarantineContext(t), core.NewEventBus()); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if data, err := os.ReadFile(testFile); err != nil || string(data) != "content" {
+		t.Errorf("expected the file to be restored, got %q %v", data, err)
 	}
 }
 
@@ -199,7 +247,7 @@ func TestRemovePathTaskRemoveSymlink(t *testing.T) {
 	os.WriteFile(target, []byte("content"), 0644)
 	os.Symlink(target, link)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &RemovePathTask{
@@ -261,3 +309,11 @@ func TestRemovePathTaskFactory(t *testing.T) {
 		t.Error("expected force to be true")
 	}
 }
+
+// newQuarantineContext returns a context whose quarantine lives in a
+// temporary directory of the test.
+func newQuarantineContext(t *testing.T) *core.InstallContext {
+	ctx := core.NewInstallContext()
+	ctx.SetQuarantine(core.NewQuarantine(filepath.Join(t.TempDir(), "quarantine")))
+	return ctx
+}
@@ -15,7 +15,7 @@ func TestRemovePathUserDataSkip(t *testing.T) {
 		t.Fatalf("write failed: %v", err)
 	}
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	ctx.Env.IsRoot = true
 	ctx.Set("uninstall.keepUserData", true)
 	bus := core.NewEventBus()
@@ -37,3 +37,18 @@ func TestRemovePathUserDataSkip(t *testing.T) {
 		t.Fatalf("expected file to remain, got %v", err)
 	}
 }
+
+func TestRemovePathTaskPlanKeepUserData(t *testing.T) {
+	task := &RemovePathTask{Path: "/home/user/.config/app", Recursive: true, UserData: true}
+
+	ctx := newQuarantineContext(t)
+	actions := task.Plan(ctx)
+	if len(actions) != 1 || actions[0].Kind != core.ActionDelete || actions[0].Detail != "recursive" {
+		t.Fatalf("unexpected plan: %+v", actions)
+	}
+
+	ctx.Set("uninstall.keepUserData", true)
+	if actions := task.Plan(ctx); len(actions) != 0 {
+		t.Errorf("expected no actions when keeping user data, got %+v", actions)
+	}
+}
@@ -44,7 +44,7 @@ func (t *RollbackTask) Validate() error {
 
 // Execute is a no-op for rollback tasks.
 func (t *RollbackTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
-	ctx.AddLog(core.LogInfo, "Rollback task registered")
+	t.Log(ctx, core.LogInfo, "Rollback task registered")
 	return nil
 }
 
@@ -31,7 +31,8 @@ func TestRollbackTask(t *testing.T) {
 		t.Fatalf("rollback factory not registered")
 	}
 
-	task, err := factory(cfg, core.NewInstallContext())
+	ctx := newQuarantineContext(t)
+	task, err := factory(cfg, ctx)
 	if err != nil {
 		t.Fatalf("factory failed: %v", err)
 	}
@@ -40,7 +41,7 @@ func TestRollbackTask(t *testing.T) {
 		t.Fatalf("validate failed: %v", err)
 	}
 
-	if err := task.Execute(core.NewInstallContext(), core.NewEventBus()); err != nil {
+	if err := task.Execute(ctx, core.NewEventBus()); err != nil {
 		t.Fatalf("execute failed: %v", err)
 	}
 
@@ -48,7 +49,7 @@ func TestRollbackTask(t *testing.T) {
 		t.Fatalf("expected file to not exist before rollback")
 	}
 
-	if err := task.Rollback(core.NewInstallContext(), core.NewEventBus()); err != nil {
+	if err := task.Rollback(ctx, core.NewEventBus()); err != nil {
 		t.Fatalf("rollback failed: %v", err)
 	}
 
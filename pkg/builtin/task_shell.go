@@ -5,10 +5,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"strings"
 	"sync"
@@ -17,6 +17,13 @@ import (
 	"github.com/HanHan666666/go-pkg-installer/pkg/core"
 )
 
+// shellTaskWeight is the progress weight of a command, whose duration cannot
+// be estimated up front. Commands usually take longer than file operations.
+const shellTaskWeight = 5 * core.DefaultTaskWeight
+
+// shellOutputLimit caps how much stdout is kept for the task's outputs.
+const shellOutputLimit = 1 << 20
+
 // ShellTask executes a shell command.
 type ShellTask struct {
 	core.BaseTask
@@ -24,11 +31,16 @@ type ShellTask struct {
 	Args             []string
 	WorkDir          string
 	Env              map[string]string
+	ContextEnv       map[string]string // Context values as GPKI_* variables
 	Timeout          time.Duration
 	RequirePrivilege bool
 
 	// Rollback command (optional)
 	RollbackCmd string
+
+	// Outputs of the last run
+	stdout   string
+	exitCode int
 }
 
 // RegisterShellTask registers the shell task factory.
@@ -44,18 +56,28 @@ func RegisterShellTask() {
 			}
 		}
 
+		// Without args the command is a script for sh, so values are quoted
+		command := getConfigStringAny(config, "command", "script")
+		args := renderStringSlice(ctx, getConfigStringSlice(config, "args"))
+		if len(args) > 0 {
+			command = ctx.Render(command)
+		} else {
+			command = ctx.RenderShell(command)
+		}
+
 		task := &ShellTask{
 			BaseTask: core.BaseTask{
 				TaskID:   getConfigString(config, "id"),
 				TaskType: "shell",
 				Config:   config,
 			},
-			Command:          ctx.Render(getConfigStringAny(config, "command", "script")),
-			Args:             renderStringSlice(ctx, getConfigStringSlice(config, "args")),
+			Command:          command,
+			Args:             args,
 			WorkDir:          ctx.Render(getConfigStringAny(config, "workDir", "workdir")),
 			Env:              env,
+			ContextEnv:       ctx.ShellEnv(getConfigStringSlice(config, "passEnv")),
 			Timeout:          time.Duration(getConfigIntAny(config, 300, "timeoutSec", "timeout")) * time.Second,
-			RollbackCmd:      ctx.Render(getConfigStringAny(config, "rollbackCommand", "rollback_command")),
+			RollbackCmd:      ctx.RenderShell(getConfigStringAny(config, "rollbackCommand", "rollback_command")),
 			RequirePrivilege: getConfigBool(config, "requirePrivilege"),
 		}
 
@@ -92,11 +114,17 @@ func (t *ShellTask) Validate() error {
 
 // Execute runs the shell command.
 func (t *ShellTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
+	return t.ExecuteContext(context.Background(), ctx, bus)
+}
+
+// ExecuteContext runs the shell command, killing it and its children when
+// cctx is done.
+func (t *ShellTask) ExecuteContext(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	if err := ensurePrivilege(ctx, t.RequirePrivilege); err != nil {
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Executing: %s %s", t.Command, strings.Join(t.Args, " ")))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Executing: %s %s", t.Command, strings.Join(t.Args, " ")))
 
 	// Default timeout if not set
 	timeout := t.Timeout
@@ -106,7 +134,7 @@ func (t *ShellTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error
 
 	// Build command
 	var cmd *exec.Cmd
-	ctxTimeout, cancel := context.WithTimeout(context.Background(), timeout)
+	ctxTimeout, cancel := context.WithTimeout(cctx, timeout)
 	defer cancel()
 	if len(t.Args) > 0 {
 		cmd = exec.CommandContext(ctxTimeout, t.Command, t.Args...)
@@ -114,28 +142,22 @@ func (t *ShellTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error
 		// Use shell to execute the command
 		cmd = exec.CommandContext(ctxTimeout, "sh", "-c", t.Command)
 	}
+	setProcessGroup(cmd)
 
 	// Set working directory
 	if t.WorkDir != "" {
 		cmd.Dir = t.WorkDir
 	}
 
-	// Set environment
-	if len(t.Env) > 0 {
-		cmd.Env = os.Environ()
-		for k, v := range t.Env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	}
+	cmd.Env = commandEnv(t.ContextEnv, t.Env)
 
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("shell: failed to capture stdout: %w", err)
-	}
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("shell: failed to capture stderr: %w", err)
-	}
+	// Output is copied through pipes that are closed only after Wait, so
+	// nothing the command printed just before exiting is lost.
+	stdout := &cappedBuffer{limit: shellOutputLimit}
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	cmd.Stdout = io.MultiWriter(stdoutWriter, stdout)
+	cmd.Stderr = stderrWriter
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("shell: failed to start command: %w", err)
@@ -143,24 +165,66 @@ func (t *ShellTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error
 
 	var wg sync.WaitGroup
 	wg.Add(2)
-	go streamOutput(ctx, stdoutPipe, core.LogInfo, "", &wg)
-	go streamOutput(ctx, stderrPipe, core.LogError, "", &wg)
+	go streamOutput(ctx, &t.BaseTask, stdoutReader, core.LogInfo, "stdout", &wg)
+	go streamOutput(ctx, &t.BaseTask, stderrReader, core.LogError, "stderr", &wg)
 
-	err = cmd.Wait()
+	err := cmd.Wait()
+	stdoutWriter.Close()
+	stderrWriter.Close()
 	wg.Wait()
+	t.stdout = strings.TrimRight(stdout.String(), "\r\n")
+	if cmd.ProcessState != nil {
+		t.exitCode = cmd.ProcessState.ExitCode()
+	}
 
+	if cctx.Err() != nil {
+		t.Log(ctx, core.LogWarn, "Command cancelled")
+		return fmt.Errorf("command cancelled: %w", cctx.Err())
+	}
 	if ctxTimeout.Err() == context.DeadlineExceeded {
-		ctx.AddLog(core.LogError, fmt.Sprintf("Command timed out after %v", timeout))
+		t.Log(ctx, core.LogError, fmt.Sprintf("Command timed out after %v", timeout))
 		return fmt.Errorf("command timed out after %v", timeout)
 	}
 	if err != nil {
-		ctx.AddLog(core.LogError, fmt.Sprintf("Command failed: %v", err))
+		t.Log(ctx, core.LogError, fmt.Sprintf("Command failed: %v", err), "exitCode", t.exitCode)
 		return fmt.Errorf("command failed: %w", err)
 	}
 
 	return nil
 }
 
+// Plan describes the command without running it.
+func (t *ShellTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	command := strings.TrimSpace(t.Command)
+	if len(t.Args) > 0 {
+		command = strings.Join(append([]string{t.Command}, t.Args...), " ")
+	}
+	action := core.PlannedAction{Kind: core.ActionRunCommand, Command: command}
+	if t.WorkDir != "" {
+		action.Detail = "in " + t.WorkDir
+	}
+	return []core.PlannedAction{action}
+}
+
+// Outputs returns the command's stdout and exit code, plus stdout parsed as
+// json when it is valid JSON.
+func (t *ShellTask) Outputs() map[string]any {
+	outputs := map[string]any{
+		"stdout":   t.stdout,
+		"exitCode": t.exitCode,
+	}
+	var parsed any
+	if err := json.Unmarshal([]byte(t.stdout), &parsed); err == nil {
+		outputs["json"] = parsed
+	}
+	return outputs
+}
+
+// Weight returns the fixed progress weight of a command.
+func (t *ShellTask) Weight() float64 {
+	return shellTaskWeight
+}
+
 // CanRollback returns true if a rollback command is configured.
 func (t *ShellTask) CanRollback() bool {
 	return t.RollbackCmd != ""
@@ -172,32 +236,29 @@ func (t *ShellTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error
 		return nil
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Rolling back: %s", t.RollbackCmd))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Rolling back: %s", t.RollbackCmd))
 
 	cmd := exec.Command("sh", "-c", t.RollbackCmd)
 	if t.WorkDir != "" {
 		cmd.Dir = t.WorkDir
 	}
 
-	if len(t.Env) > 0 {
-		cmd.Env = os.Environ()
-		for k, v := range t.Env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	}
+	cmd.Env = commandEnv(t.ContextEnv, t.Env)
 
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		ctx.AddLog(core.LogWarn, fmt.Sprintf("Rollback command failed: %v\nstderr: %s", err, stderr.String()))
+		t.Log(ctx, core.LogWarn, fmt.Sprintf("Rollback command failed: %v\nstderr: %s", err, stderr.String()))
 		return fmt.Errorf("rollback command failed: %w", err)
 	}
 
 	return nil
 }
 
-func streamOutput(ctx *core.InstallContext, reader io.Reader, level core.LogLevel, label string, wg *sync.WaitGroup) {
+// streamOutput logs each line the command writes to a stream, attributed to
+// the task and tagged with the stream's name.
+func streamOutput(ctx *core.InstallContext, task *core.BaseTask, reader io.Reader, level core.LogLevel, stream string, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	scanner := bufio.NewScanner(reader)
@@ -209,14 +270,12 @@ func streamOutput(ctx *core.InstallContext, reader io.Reader, level core.LogLeve
 		if line == "" {
 			continue
 		}
-		if label != "" {
-			ctx.AddLog(level, fmt.Sprintf("%s: %s", label, line))
-		} else {
-			ctx.AddLog(level, line)
-		}
+		task.Log(ctx, level, line, "stream", stream)
 	}
 
 	if err := scanner.Err(); err != nil {
-		ctx.AddLog(core.LogWarn, fmt.Sprintf("stream read error (%s): %v", label, err))
+		task.Log(ctx, core.LogWarn, fmt.Sprintf("stream read error (%s): %v", stream, err))
+		// Keep draining so the writer never blocks
+		_, _ = io.Copy(io.Discard, reader)
 	}
 }
@@ -1,9 +1,13 @@
 package builtin
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/HanHan666666/go-pkg-installer/pkg/core"
 )
@@ -182,6 +186,46 @@ func TestShellTaskFailure(t *testing.T) {
 	}
 }
 
+func TestShellTaskOutputs(t *testing.T) {
+	ctx := core.NewInstallContext()
+	bus := core.NewEventBus()
+
+	task := &ShellTask{
+		BaseTask: core.BaseTask{
+			TaskID:   "test-shell",
+			TaskType: "shell",
+		},
+		Command: `echo '{"port": 8080}'`,
+	}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	outputs := task.Outputs()
+	if outputs["stdout"] != `{"port": 8080}` {
+		t.Errorf("expected stdout without trailing newline, got %q", outputs["stdout"])
+	}
+	if outputs["exitCode"] != 0 {
+		t.Errorf("expected exit code 0, got %v", outputs["exitCode"])
+	}
+	parsed, ok := outputs["json"].(map[string]any)
+	if !ok || parsed["port"] != float64(8080) {
+		t.Errorf("expected parsed json output, got %v", outputs["json"])
+	}
+
+	task.Command = "echo not json; exit 3"
+	if err := task.Execute(ctx, bus); err == nil {
+		t.Fatal("expected error for failed command")
+	}
+	outputs = task.Outputs()
+	if outputs["exitCode"] != 3 || outputs["stdout"] != "not json" {
+		t.Errorf("unexpected outputs after failure: %v", outputs)
+	}
+	if _, ok := outputs["json"]; ok {
+		t.Error("expected no json output for plain text")
+	}
+}
+
 func TestShellTaskRollback(t *testing.T) {
 	tmpDir := t.TempDir()
 	testFile := filepath.Join(tmpDir, "test.txt")
@@ -261,3 +305,119 @@ func TestShellTaskFactory(t *testing.T) {
 		t.Errorf("expected command to be rendered, got %q", shellTask.Command)
 	}
 }
+
+func TestShellTaskPlan(t *testing.T) {
+	task := &ShellTask{Command: "make", Args: []string{"install"}, WorkDir: "/src"}
+
+	actions := task.Plan(core.NewInstallContext())
+	if len(actions) != 1 {
+		t.Fatalf("expected one action, got %d", len(actions))
+	}
+	if actions[0].Kind != core.ActionRunCommand || actions[0].Command != "make install" {
+		t.Errorf("unexpected action: %+v", actions[0])
+	}
+}
+
+func TestShellTaskExecuteContextCancel(t *testing.T) {
+	cctx, cancel := context.WithCancel(context.Background())
+	task := &ShellTask{Command: "sleep 30"}
+
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err := task.ExecuteContext(cctx, core.NewInstallContext(), core.NewEventBus())
+	if err == nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command was not killed promptly, took %v", elapsed)
+	}
+}
+
+func TestShellTaskLogsOutputStreams(t *testing.T) {
+	ctx := core.NewInstallContext()
+	task := &ShellTask{
+		BaseTask: core.BaseTask{TaskID: "greet", TaskType: "shell"},
+		Command:  "echo out; echo err >&2",
+	}
+	if err := task.Execute(ctx, core.NewEventBus()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	streams := map[string]core.LogEntry{}
+	for _, entry := range ctx.Runtime.Logs {
+		if stream, ok := entry.Fields["stream"].(string); ok {
+			streams[stream] = entry
+		}
+	}
+	if got := streams["stdout"]; got.Message != "out" || got.TaskID != "greet" || got.Level != core.LogInfo {
+		t.Errorf("unexpected stdout entry: %+v", got)
+	}
+	if got := streams["stderr"]; got.Message != "err" || got.TaskID != "greet" || got.Level != core.LogError {
+		t.Errorf("unexpected stderr entry: %+v", got)
+	}
+}
+
+func TestShellTaskPassesContextSafely(t *testing.T) {
+	RegisterShellTask()
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, `it's $(touch pwned)`)
+
+	ctx := core.NewInstallContext()
+	ctx.Set("install_dir", dir)
+	factory, _ := core.Tasks.Get("shell")
+	task, err := factory(map[string]any{
+		"command":         `mkdir -p ${install_dir} && printf '%s' "$GPKI_INSTALL_DIR" > "${install_dir}/env"`,
+		"rollbackCommand": `rm -r ${install_dir}`,
+		"workDir":         tmpDir,
+	}, ctx)
+	if err != nil {
+		t.Fatalf("factory error = %v", err)
+	}
+
+	if err := task.Execute(ctx, core.NewEventBus()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "env")); string(data) != dir {
+		t.Errorf("expected GPKI_INSTALL_DIR=%q, got %q", dir, data)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "pwned")); err == nil {
+		t.Error("expected the value not to be run as a command")
+	}
+
+	if err := task.Rollback(ctx, core.NewEventBus()); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("expected the rollback command to get the quoted value")
+	}
+}
+
+func TestShellTaskRedactsSecrets(t *testing.T) {
+	RegisterShellTask()
+	ctx := core.NewInstallContext()
+	ctx.SetSecret("token", "hunter2's key")
+	factory, _ := core.Tasks.Get("shell")
+	task, err := factory(map[string]any{
+		"command": `echo "token=${token}"; test "${token}" = "$GPKI_TOKEN" || exit 3`,
+		"passEnv": []any{"token"},
+	}, ctx)
+	if err != nil {
+		t.Fatalf("factory error = %v", err)
+	}
+
+	if err := task.Execute(ctx, core.NewEventBus()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	found := false
+	for _, entry := range ctx.Runtime.Logs {
+		if strings.Contains(entry.Message, "hunter2") {
+			t.Errorf("expected the secret to be redacted, got %q", entry.Message)
+		}
+		if entry.Message == "token="+core.RedactedValue {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected the command output to be logged with the secret redacted")
+	}
+}
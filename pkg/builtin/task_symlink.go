@@ -19,8 +19,7 @@ type SymlinkTask struct {
 	RequirePrivilege bool
 
 	// For rollback
-	createdLink string
-	oldTarget   string
+	backups []core.FileBackup
 }
 
 // RegisterSymlinkTask registers the symlink task factory.
@@ -63,66 +62,84 @@ func (t *SymlinkTask) Execute(ctx *core.InstallContext, bus *core.EventBus) erro
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Creating symlink %s -> %s", t.LinkPath, t.Target))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Creating symlink %s -> %s", t.LinkPath, t.Target))
 
 	// Ensure parent directory exists
-	linkDir := filepath.Dir(t.LinkPath)
-	if err := os.MkdirAll(linkDir, 0755); err != nil {
+	backups := ctx.Backups()
+	created, err := backups.MkdirAll(filepath.Dir(t.LinkPath), 0755)
+	t.backups = append(t.backups, created...)
+	if err != nil {
 		return fmt.Errorf("failed to create parent directory: %w", err)
 	}
 
 	// Check if link already exists
-	if info, err := os.Lstat(t.LinkPath); err == nil {
-		if info.Mode()&os.ModeSymlink != 0 {
-			// It's a symlink, save old target for rollback
-			oldTarget, err := os.Readlink(t.LinkPath)
-			if err == nil {
-				t.oldTarget = oldTarget
-			}
-		}
-
-		if !t.Overwrite {
-			return fmt.Errorf("link already exists: %s", t.LinkPath)
-		}
+	if _, err := os.Lstat(t.LinkPath); err == nil && !t.Overwrite {
+		return fmt.Errorf("link already exists: %s", t.LinkPath)
+	}
 
-		// Remove existing file/link
+	// Keep an existing file or link for rollback, then remove it
+	backup, err := backups.Snapshot(t.LinkPath)
+	if err != nil {
+		return err
+	}
+	if backup.Exists {
 		if err := os.Remove(t.LinkPath); err != nil {
 			return fmt.Errorf("failed to remove existing link: %w", err)
 		}
 	}
+	t.backups = append(t.backups, backup)
 
 	// Create the symlink
 	if err := os.Symlink(t.Target, t.LinkPath); err != nil {
 		return fmt.Errorf("failed to create symlink: %w", err)
 	}
-
-	t.createdLink = t.LinkPath
 	return nil
 }
 
+// Plan describes the link without creating it.
+func (t *SymlinkTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	action := core.PlannedAction{Kind: core.ActionSymlink, Path: t.LinkPath, Source: t.Target}
+	if t.Overwrite {
+		action.Detail = "replace existing"
+	}
+	return []core.PlannedAction{action}
+}
+
 // CanRollback returns true if the task can be rolled back.
 func (t *SymlinkTask) CanRollback() bool {
-	return t.createdLink != ""
+	return len(t.backups) > 0
 }
 
-// Rollback removes the symlink or restores the old target.
+// Rollback removes the symlink and restores what was at its path before.
 func (t *SymlinkTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
-	if t.createdLink == "" {
+	if len(t.backups) == 0 {
 		return nil
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Rolling back symlink: %s", t.createdLink))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Rolling back symlink: %s", t.LinkPath))
 
-	if err := os.Remove(t.createdLink); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove symlink: %w", err)
+	if err := ctx.Backups().RestoreAll(t.backups); err != nil {
+		return fmt.Errorf("failed to restore symlink: %w", err)
 	}
+	return nil
+}
 
-	// Restore old symlink if there was one
-	if t.oldTarget != "" {
-		if err := os.Symlink(t.oldTarget, t.createdLink); err != nil {
-			ctx.AddLog(core.LogWarn, fmt.Sprintf("Failed to restore old symlink: %v", err))
-		}
-	}
+// symlinkState is the journaled form of the SymlinkTask rollback data.
+type symlinkState struct {
+	Backups []core.FileBackup `json:"backups,omitempty"`
+}
 
+// RollbackState returns the data needed to roll back after a restart.
+func (t *SymlinkTask) RollbackState() map[string]any {
+	return encodeState(symlinkState{Backups: t.backups})
+}
+
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *SymlinkTask) RestoreRollbackState(data map[string]any) error {
+	var state symlinkState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.backups = state.Backups
 	return nil
 }
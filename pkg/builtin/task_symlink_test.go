@@ -56,7 +56,7 @@ func TestSymlinkTaskExecute(t *testing.T) {
 
 	os.WriteFile(target, []byte("content"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &SymlinkTask{
@@ -93,7 +93,7 @@ func TestSymlinkTaskOverwrite(t *testing.T) {
 	os.WriteFile(target2, []byte("content2"), 0644)
 	os.Symlink(target1, link)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	t.Run("without overwrite", func(t *testing.T) {
@@ -139,7 +139,7 @@ func TestSymlinkTaskRollback(t *testing.T) {
 
 	os.WriteFile(target, []byte("content"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &SymlinkTask{
@@ -182,7 +182,7 @@ func TestSymlinkTaskRollbackRestoresOld(t *testing.T) {
 	os.WriteFile(target2, []byte("content2"), 0644)
 	os.Symlink(target1, link)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &SymlinkTask{
@@ -222,7 +222,7 @@ func TestSymlinkTaskCreatesParentDir(t *testing.T) {
 
 	os.WriteFile(target, []byte("content"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &SymlinkTask{
@@ -244,3 +244,30 @@ func TestSymlinkTaskCreatesParentDir(t *testing.T) {
 		t.Errorf("symlink should exist: %v", err)
 	}
 }
+
+func TestSymlinkTaskRollbackRestoresFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "target.txt")
+	link := filepath.Join(tmpDir, "link.txt")
+	os.WriteFile(target, []byte("content"), 0644)
+	os.WriteFile(link, []byte("a regular file"), 0600)
+
+	ctx := newQuarantineContext(t)
+	bus := core.NewEventBus()
+
+	task := &SymlinkTask{Target: target, LinkPath: link, Overwrite: true}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if err := task.Rollback(ctx, bus); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("expected the regular file to be restored, got %v %v", info, err)
+	}
+	if data, _ := os.ReadFile(link); string(data) != "a regular file" {
+		t.Errorf("expected the file content to be restored, got %q", data)
+	}
+}
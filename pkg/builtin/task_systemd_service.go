@@ -73,7 +73,7 @@ func (t *SystemdServiceTask) Execute(ctx *core.InstallContext, bus *core.EventBu
 		args = append([]string{"--user"}, args...)
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("systemd %s %s", t.Action, unit))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("systemd %s %s", t.Action, unit))
 	cmd := execCommand("systemctl", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -82,6 +82,11 @@ func (t *SystemdServiceTask) Execute(ctx *core.InstallContext, bus *core.EventBu
 	return nil
 }
 
+// Plan describes the systemctl call without running it.
+func (t *SystemdServiceTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	return planSystemctl(t.Name, t.Action, t.UserScope)
+}
+
 // CanRollback returns false by default.
 func (t *SystemdServiceTask) CanRollback() bool {
 	return false
@@ -114,3 +119,18 @@ func buildSystemctlArgs(action, unit string) []string {
 		return nil
 	}
 }
+
+// planSystemctl describes a systemctl call for systemd and D-Bus service tasks.
+func planSystemctl(name, action string, userScope bool) []core.PlannedAction {
+	unit := normalizeUnitName(name)
+	args := buildSystemctlArgs(action, unit)
+	if userScope {
+		args = append([]string{"--user"}, args...)
+	}
+	return []core.PlannedAction{{
+		Kind:    core.ActionUnit,
+		Path:    unit,
+		Command: strings.Join(append([]string{"systemctl"}, args...), " "),
+		Detail:  action,
+	}}
+}
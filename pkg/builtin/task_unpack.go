@@ -5,6 +5,7 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -23,9 +24,10 @@ type UnpackTask struct {
 	StripPrefix      int
 	RequirePrivilege bool
 
-	// For rollback
 	createdFiles []string
-	createdDirs  []string
+
+	// For rollback
+	backups []core.FileBackup
 }
 
 // RegisterUnpackTask registers the unpack task factory.
@@ -64,14 +66,22 @@ func (t *UnpackTask) Validate() error {
 
 // Execute extracts the archive.
 func (t *UnpackTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error {
+	return t.ExecuteContext(context.Background(), ctx, bus)
+}
+
+// ExecuteContext extracts the archive, stopping between and within entries
+// when cctx is done.
+func (t *UnpackTask) ExecuteContext(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	if err := ensurePrivilege(ctx, t.RequirePrivilege); err != nil {
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Unpacking %s to %s", t.Source, t.Destination))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Unpacking %s to %s", t.Source, t.Destination))
 
 	// Ensure destination directory exists
-	if err := os.MkdirAll(t.Destination, 0755); err != nil {
+	created, err := ctx.Backups().MkdirAll(t.Destination, 0755)
+	t.backups = append(t.backups, created...)
+	if err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
@@ -80,54 +90,57 @@ func (t *UnpackTask) Execute(ctx *core.InstallContext, bus *core.EventBus) error
 
 	// Handle .tar.gz, .tgz
 	if strings.HasSuffix(strings.ToLower(t.Source), ".tar.gz") || ext == ".tgz" {
-		return t.extractTarGz(ctx, bus)
+		return t.extractTarGz(cctx, ctx, bus)
 	}
 
 	// Handle .tar
 	if ext == ".tar" {
-		return t.extractTar(ctx, bus)
+		return t.extractTar(cctx, ctx, bus)
 	}
 
 	// Handle .zip
 	if ext == ".zip" {
-		return t.extractZip(ctx, bus)
+		return t.extractZip(cctx, ctx, bus)
 	}
 
 	return fmt.Errorf("unsupported archive format: %s", ext)
 }
 
-func (t *UnpackTask) extractTarGz(ctx *core.InstallContext, bus *core.EventBus) error {
+func (t *UnpackTask) extractTarGz(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	file, err := os.Open(t.Source)
 	if err != nil {
 		return fmt.Errorf("failed to open archive: %w", err)
 	}
 	defer file.Close()
 
-	gzr, err := gzip.NewReader(file)
+	gzr, err := gzip.NewReader(withContext(cctx, t.trackProgress(file, bus)))
 	if err != nil {
 		return fmt.Errorf("failed to create gzip reader: %w", err)
 	}
 	defer gzr.Close()
 
-	return t.extractTarReader(tar.NewReader(gzr), ctx, bus)
+	return t.extractTarReader(cctx, tar.NewReader(gzr), ctx)
 }
 
-func (t *UnpackTask) extractTar(ctx *core.InstallContext, bus *core.EventBus) error {
+func (t *UnpackTask) extractTar(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	file, err := os.Open(t.Source)
 	if err != nil {
 		return fmt.Errorf("failed to open archive: %w", err)
 	}
 	defer file.Close()
 
-	return t.extractTarReader(tar.NewReader(file), ctx, bus)
+	return t.extractTarReader(cctx, tar.NewReader(withContext(cctx, t.trackProgress(file, bus))), ctx)
 }
 
-func (t *UnpackTask) extractTarReader(tr *tar.Reader, ctx *core.InstallContext, bus *core.EventBus) error {
+func (t *UnpackTask) extractTarReader(cctx context.Context, tr *tar.Reader, ctx *core.InstallContext) error {
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
+		if cctx.Err() != nil {
+			return fmt.Errorf("unpack cancelled: %w", cctx.Err())
+		}
 		if err != nil {
 			return fmt.Errorf("failed to read tar: %w", err)
 		}
@@ -146,15 +159,13 @@ func (t *UnpackTask) extractTarReader(tr *tar.Reader, ctx *core.InstallContext,
 
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
+			if err := t.mkdir(ctx, target, os.FileMode(header.Mode)); err != nil {
+				return err
 			}
-			t.createdDirs = append(t.createdDirs, target)
 
 		case tar.TypeReg:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directory: %w", err)
+			if err := t.prepare(ctx, target); err != nil {
+				return err
 			}
 
 			outFile, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
@@ -164,15 +175,18 @@ func (t *UnpackTask) extractTarReader(tr *tar.Reader, ctx *core.InstallContext,
 
 			if _, err := io.Copy(outFile, tr); err != nil {
 				outFile.Close()
+				if cctx.Err() != nil {
+					os.Remove(target)
+					return fmt.Errorf("unpack cancelled: %w", cctx.Err())
+				}
 				return fmt.Errorf("failed to write file: %w", err)
 			}
 			outFile.Close()
 			t.createdFiles = append(t.createdFiles, target)
 
 		case tar.TypeSymlink:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directory: %w", err)
+			if err := t.prepare(ctx, target); err != nil {
+				return err
 			}
 
 			if err := os.Symlink(header.Linkname, target); err != nil {
@@ -182,18 +196,31 @@ func (t *UnpackTask) extractTarReader(tr *tar.Reader, ctx *core.InstallContext,
 		}
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Extracted %d files", len(t.createdFiles)))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Extracted %d files", len(t.createdFiles)))
 	return nil
 }
 
-func (t *UnpackTask) extractZip(ctx *core.InstallContext, bus *core.EventBus) error {
+func (t *UnpackTask) extractZip(cctx context.Context, ctx *core.InstallContext, bus *core.EventBus) error {
 	r, err := zip.OpenReader(t.Source)
 	if err != nil {
 		return fmt.Errorf("failed to open zip: %w", err)
 	}
 	defer r.Close()
 
+	var total, current int64
 	for _, f := range r.File {
+		total += int64(f.CompressedSize64)
+	}
+
+	for _, f := range r.File {
+		if cctx.Err() != nil {
+			return fmt.Errorf("unpack cancelled: %w", cctx.Err())
+		}
+		current += int64(f.CompressedSize64)
+		if bus != nil && total > 0 {
+			bus.PublishTaskProgress(t.TaskID, current, total, fmt.Sprintf("Unpacking: %d%%", current*100/total))
+		}
+
 		// Apply strip prefix
 		name := t.stripPath(f.Name)
 		if name == "" {
@@ -208,17 +235,14 @@ func (t *UnpackTask) extractZip(ctx *core.InstallContext, bus *core.EventBus) er
 
 		if f.FileInfo().IsDir() {
 			// Use at least 0755 to ensure directories are accessible
-			mode := f.Mode() | 0755
-			if err := os.MkdirAll(target, mode); err != nil {
-				return fmt.Errorf("failed to create directory: %w", err)
+			if err := t.mkdir(ctx, target, f.Mode()|0755); err != nil {
+				return err
 			}
-			t.createdDirs = append(t.createdDirs, target)
 			continue
 		}
 
-		// Ensure parent directory exists
-		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-			return fmt.Errorf("failed to create parent directory: %w", err)
+		if err := t.prepare(ctx, target); err != nil {
+			return err
 		}
 
 		outFile, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
@@ -232,20 +256,75 @@ func (t *UnpackTask) extractZip(ctx *core.InstallContext, bus *core.EventBus) er
 			return fmt.Errorf("failed to open zip entry: %w", err)
 		}
 
-		_, err = io.Copy(outFile, rc)
+		_, err = io.Copy(outFile, withContext(cctx, rc))
 		rc.Close()
 		outFile.Close()
 		if err != nil {
+			if cctx.Err() != nil {
+				os.Remove(target)
+				return fmt.Errorf("unpack cancelled: %w", cctx.Err())
+			}
 			return fmt.Errorf("failed to write file: %w", err)
 		}
 
 		t.createdFiles = append(t.createdFiles, target)
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Extracted %d files", len(t.createdFiles)))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Extracted %d files", len(t.createdFiles)))
 	return nil
 }
 
+// mkdir creates a directory entry of the archive and its parents, keeping
+// backups of the directories it created.
+func (t *UnpackTask) mkdir(ctx *core.InstallContext, target string, mode os.FileMode) error {
+	created, err := ctx.Backups().MkdirAll(target, mode)
+	t.backups = append(t.backups, created...)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return nil
+}
+
+// prepare backs up the path a file or symlink entry is extracted to and
+// creates its parent directory. An existing file or symlink there is
+// removed, so it is replaced rather than written through.
+func (t *UnpackTask) prepare(ctx *core.InstallContext, target string) error {
+	backups := ctx.Backups()
+	created, err := backups.MkdirAll(filepath.Dir(target), 0755)
+	t.backups = append(t.backups, created...)
+	if err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	backup, err := backups.Snapshot(target)
+	if err != nil {
+		return err
+	}
+	t.backups = append(t.backups, backup)
+	if backup.Exists && !backup.Mode.IsDir() {
+		if err := os.Remove(target); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// trackProgress wraps the open archive so reading it reports task progress.
+func (t *UnpackTask) trackProgress(file *os.File, bus *core.EventBus) io.Reader {
+	info, err := file.Stat()
+	if err != nil || info.Size() <= 0 || bus == nil {
+		return file
+	}
+	return &progressReader{
+		reader:       file,
+		total:        info.Size(),
+		bus:          bus,
+		taskID:       t.TaskID,
+		label:        "Unpacking",
+		lastProgress: -1,
+	}
+}
+
 func (t *UnpackTask) stripPath(path string) string {
 	if t.StripPrefix <= 0 {
 		return path
@@ -258,29 +337,68 @@ func (t *UnpackTask) stripPath(path string) string {
 	return strings.Join(parts[t.StripPrefix:], "/")
 }
 
+// Plan describes the extraction without reading the archive.
+func (t *UnpackTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	extract := core.PlannedAction{Kind: core.ActionWriteFile, Path: t.Destination, Source: t.Source, Detail: "extract archive"}
+	if t.StripPrefix > 0 {
+		extract.Detail = fmt.Sprintf("extract archive, strip %d components", t.StripPrefix)
+	}
+	return []core.PlannedAction{
+		{Kind: core.ActionCreateDir, Path: t.Destination},
+		extract,
+	}
+}
+
+// Weight estimates the unpack cost from the archive size. Archives produced
+// by an earlier task of the same run do not exist yet and get the default weight.
+func (t *UnpackTask) Weight() float64 {
+	info, err := os.Stat(t.Source)
+	if err != nil {
+		return core.DefaultTaskWeight
+	}
+	return core.BytesWeight(info.Size())
+}
+
+// Outputs returns the destination and the files extracted into it.
+func (t *UnpackTask) Outputs() map[string]any {
+	return map[string]any{
+		"destination": t.Destination,
+		"files":       append([]string(nil), t.createdFiles...),
+	}
+}
+
 // CanRollback returns true if the task can be rolled back.
 func (t *UnpackTask) CanRollback() bool {
-	return len(t.createdFiles) > 0 || len(t.createdDirs) > 0
+	return len(t.backups) > 0
 }
 
-// Rollback removes extracted files and directories.
+// Rollback removes extracted files and created directories and restores the
+// files the archive replaced.
 func (t *UnpackTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
-	ctx.AddLog(core.LogInfo, "Rolling back unpacked files")
+	t.Log(ctx, core.LogInfo, "Rolling back unpacked files")
 
-	// Remove files first
-	for _, file := range t.createdFiles {
-		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
-			ctx.AddLog(core.LogWarn, fmt.Sprintf("Failed to remove file: %s", file))
-		}
+	if err := ctx.Backups().RestoreAll(t.backups); err != nil {
+		return fmt.Errorf("failed to restore unpacked files: %w", err)
 	}
+	return nil
+}
 
-	// Remove directories in reverse order (deepest first)
-	for i := len(t.createdDirs) - 1; i >= 0; i-- {
-		dir := t.createdDirs[i]
-		if err := os.RemoveAll(dir); err != nil && !os.IsNotExist(err) {
-			ctx.AddLog(core.LogWarn, fmt.Sprintf("Failed to remove directory: %s", dir))
-		}
-	}
+// unpackState is the journaled form of the UnpackTask rollback data.
+type unpackState struct {
+	Backups []core.FileBackup `json:"backups,omitempty"`
+}
+
+// RollbackState returns the data needed to roll back after a restart.
+func (t *UnpackTask) RollbackState() map[string]any {
+	return encodeState(unpackState{Backups: t.backups})
+}
 
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *UnpackTask) RestoreRollbackState(data map[string]any) error {
+	var state unpackState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.backups = state.Backups
 	return nil
 }
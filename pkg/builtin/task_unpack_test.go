@@ -116,7 +116,7 @@ func TestUnpackTarGz(t *testing.T) {
 	archivePath := createTestTarGz(t, tmpDir)
 	destDir := filepath.Join(tmpDir, "extracted")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &UnpackTask{
@@ -142,6 +142,11 @@ func TestUnpackTarGz(t *testing.T) {
 	if string(data) != "test content" {
 		t.Errorf("expected 'test content', got %q", string(data))
 	}
+
+	files, _ := task.Outputs()["files"].([]string)
+	if len(files) != 1 || files[0] != extractedFile {
+		t.Errorf("expected extracted file in outputs, got %v", files)
+	}
 }
 
 func TestUnpackZip(t *testing.T) {
@@ -149,7 +154,7 @@ func TestUnpackZip(t *testing.T) {
 	archivePath := createTestZip(t, tmpDir)
 	destDir := filepath.Join(tmpDir, "extracted")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &UnpackTask{
@@ -182,7 +187,7 @@ func TestUnpackWithStripPrefix(t *testing.T) {
 	archivePath := createTestTarGz(t, tmpDir)
 	destDir := filepath.Join(tmpDir, "extracted")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &UnpackTask{
@@ -216,7 +221,7 @@ func TestUnpackTaskRollback(t *testing.T) {
 	archivePath := createTestTarGz(t, tmpDir)
 	destDir := filepath.Join(tmpDir, "extracted")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &UnpackTask{
@@ -255,7 +260,7 @@ func TestUnpackUnsupportedFormat(t *testing.T) {
 	archivePath := filepath.Join(tmpDir, "test.xyz")
 	os.WriteFile(archivePath, []byte("data"), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &UnpackTask{
@@ -268,3 +273,30 @@ func TestUnpackUnsupportedFormat(t *testing.T) {
 		t.Error("expected error for unsupported format")
 	}
 }
+
+func TestUnpackTaskRollbackRestoresExistingTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	archivePath := createTestTarGz(t, tmpDir)
+	destDir := filepath.Join(tmpDir, "extracted")
+	os.MkdirAll(filepath.Join(destDir, "testdir"), 0755)
+	os.WriteFile(filepath.Join(destDir, "testdir", "file.txt"), []byte("old content"), 0644)
+	os.WriteFile(filepath.Join(destDir, "testdir", "keep.txt"), []byte("user data"), 0644)
+
+	ctx := newQuarantineContext(t)
+	bus := core.NewEventBus()
+
+	task := &UnpackTask{Source: archivePath, Destination: destDir}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if err := task.Rollback(ctx, bus); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(destDir, "testdir", "file.txt")); string(data) != "old content" {
+		t.Errorf("expected the replaced file to be restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "testdir", "keep.txt")); err != nil {
+		t.Error("expected files not in the archive to be kept")
+	}
+}
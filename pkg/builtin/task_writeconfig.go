@@ -23,9 +23,7 @@ type WriteConfigTask struct {
 	RequirePrivilege bool
 
 	// For rollback
-	wroteFile    string
-	previousData []byte
-	fileExisted  bool
+	backups []core.FileBackup
 }
 
 // RegisterWriteConfigTask registers the write_config task factory.
@@ -94,26 +92,30 @@ func (t *WriteConfigTask) Execute(ctx *core.InstallContext, bus *core.EventBus)
 		return err
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Writing config to %s (format: %s)", t.Destination, t.Format))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Writing config to %s (format: %s)", t.Destination, t.Format))
+
+	// Render content before touching the destination
+	content, err := renderValue(ctx, t.Content)
+	if err != nil {
+		return fmt.Errorf("failed to render content: %w", err)
+	}
 
 	// Ensure parent directory exists
-	destDir := filepath.Dir(t.Destination)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	backups := ctx.Backups()
+	created, err := backups.MkdirAll(filepath.Dir(t.Destination), 0755)
+	t.backups = append(t.backups, created...)
+	if err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
 	// Backup existing file for rollback
-	if data, err := os.ReadFile(t.Destination); err == nil {
-		t.previousData = data
-		t.fileExisted = true
+	backup, err := backups.Snapshot(t.Destination)
+	if err != nil {
+		return err
 	}
 
-	// Render content (if it's a string, apply template)
-	content := t.renderContent(ctx)
-
 	// Convert content to bytes based on format
 	var data []byte
-	var err error
 
 	switch t.Format {
 	case "json":
@@ -144,85 +146,85 @@ func (t *WriteConfigTask) Execute(ctx *core.InstallContext, bus *core.EventBus)
 	}
 
 	// Write file
+	t.backups = append(t.backups, backup)
 	if err := os.WriteFile(t.Destination, data, t.Mode); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
-
-	t.wroteFile = t.Destination
 	return nil
 }
 
-func (t *WriteConfigTask) renderContent(ctx *core.InstallContext) any {
-	switch content := t.Content.(type) {
+// renderValue applies template rendering to every string in a config value,
+// descending into maps and lists. It stops at the first template error.
+func renderValue(ctx *core.InstallContext, value any) (any, error) {
+	switch val := value.(type) {
 	case string:
-		return ctx.Render(content)
+		return ctx.RenderTemplate(val)
 	case map[string]any:
-		return t.renderMap(ctx, content)
+		result := make(map[string]any, len(val))
+		for k, v := range val {
+			rendered, err := renderValue(ctx, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			result[k] = rendered
+		}
+		return result, nil
 	case []any:
-		return t.renderSlice(ctx, content)
+		result := make([]any, len(val))
+		for i, v := range val {
+			rendered, err := renderValue(ctx, v)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			result[i] = rendered
+		}
+		return result, nil
 	default:
-		return content
+		return val, nil
 	}
 }
 
-func (t *WriteConfigTask) renderMap(ctx *core.InstallContext, m map[string]any) map[string]any {
-	result := make(map[string]any)
-	for k, v := range m {
-		switch val := v.(type) {
-		case string:
-			result[k] = ctx.Render(val)
-		case map[string]any:
-			result[k] = t.renderMap(ctx, val)
-		case []any:
-			result[k] = t.renderSlice(ctx, val)
-		default:
-			result[k] = val
-		}
-	}
-	return result
-}
-
-func (t *WriteConfigTask) renderSlice(ctx *core.InstallContext, s []any) []any {
-	result := make([]any, len(s))
-	for i, v := range s {
-		switch val := v.(type) {
-		case string:
-			result[i] = ctx.Render(val)
-		case map[string]any:
-			result[i] = t.renderMap(ctx, val)
-		case []any:
-			result[i] = t.renderSlice(ctx, val)
-		default:
-			result[i] = val
-		}
-	}
-	return result
+// Plan describes the config file without writing it.
+func (t *WriteConfigTask) Plan(ctx *core.InstallContext) []core.PlannedAction {
+	return []core.PlannedAction{{Kind: core.ActionWriteFile, Path: t.Destination, Detail: t.Format}}
 }
 
 // CanRollback returns true if the task can be rolled back.
 func (t *WriteConfigTask) CanRollback() bool {
-	return t.wroteFile != ""
+	return len(t.backups) > 0
 }
 
-// Rollback restores the previous file content or removes the file.
+// Rollback restores the previous file, or removes the file and the
+// directories created for it.
 func (t *WriteConfigTask) Rollback(ctx *core.InstallContext, bus *core.EventBus) error {
-	if t.wroteFile == "" {
+	if len(t.backups) == 0 {
 		return nil
 	}
 
-	ctx.AddLog(core.LogInfo, fmt.Sprintf("Rolling back config file: %s", t.wroteFile))
+	t.Log(ctx, core.LogInfo, fmt.Sprintf("Rolling back config file: %s", t.Destination))
 
-	if t.fileExisted {
-		// Restore previous content
-		if err := os.WriteFile(t.wroteFile, t.previousData, t.Mode); err != nil {
-			return fmt.Errorf("failed to restore config: %w", err)
-		}
-	} else {
-		// Remove created file
-		if err := os.Remove(t.wroteFile); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove config: %w", err)
-		}
+	if err := ctx.Backups().RestoreAll(t.backups); err != nil {
+		return fmt.Errorf("failed to restore config: %w", err)
 	}
+	return nil
+}
+
+// writeConfigState is the journaled form of the WriteConfigTask rollback data.
+type writeConfigState struct {
+	Backups []core.FileBackup `json:"backups,omitempty"`
+}
 
+// RollbackState returns the data needed to roll back after a restart.
+func (t *WriteConfigTask) RollbackState() map[string]any {
+	return encodeState(writeConfigState{Backups: t.backups})
+}
+
+// RestoreRollbackState reloads rollback data from the install journal.
+func (t *WriteConfigTask) RestoreRollbackState(data map[string]any) error {
+	var state writeConfigState
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	t.backups = state.Backups
 	return nil
 }
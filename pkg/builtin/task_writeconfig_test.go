@@ -55,7 +55,7 @@ func TestWriteConfigTaskJSON(t *testing.T) {
 	tmpDir := t.TempDir()
 	configFile := filepath.Join(tmpDir, "config.json")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &WriteConfigTask{
@@ -97,7 +97,7 @@ func TestWriteConfigTaskYAML(t *testing.T) {
 	tmpDir := t.TempDir()
 	configFile := filepath.Join(tmpDir, "config.yaml")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &WriteConfigTask{
@@ -141,7 +141,7 @@ func TestWriteConfigTaskText(t *testing.T) {
 	tmpDir := t.TempDir()
 	configFile := filepath.Join(tmpDir, "config.txt")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &WriteConfigTask{
@@ -173,7 +173,7 @@ func TestWriteConfigTaskText(t *testing.T) {
 func TestWriteConfigTaskAutoDetectFormat(t *testing.T) {
 	RegisterWriteConfigTask()
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 
 	factory, _ := core.Tasks.Get("writeConfig")
 
@@ -210,7 +210,7 @@ func TestWriteConfigTaskWithTemplates(t *testing.T) {
 	tmpDir := t.TempDir()
 	configFile := filepath.Join(tmpDir, "config.json")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	ctx.Set("appName", "MyApp")
 	ctx.Set("version", "1.0.0")
 	bus := core.NewEventBus()
@@ -254,7 +254,7 @@ func TestWriteConfigTaskRollback(t *testing.T) {
 	tmpDir := t.TempDir()
 	configFile := filepath.Join(tmpDir, "config.json")
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &WriteConfigTask{
@@ -296,7 +296,7 @@ func TestWriteConfigTaskRollbackRestoresOld(t *testing.T) {
 	// Create original file
 	os.WriteFile(configFile, []byte(`{"original": true}`), 0644)
 
-	ctx := core.NewInstallContext()
+	ctx := newQuarantineContext(t)
 	bus := core.NewEventBus()
 
 	task := &WriteConfigTask{
@@ -326,3 +326,84 @@ func TestWriteConfigTaskRollbackRestoresOld(t *testing.T) {
 		t.Errorf("expected original content to be restored, got %q", string(data))
 	}
 }
+
+func TestWriteConfigTaskRollbackStateRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.json")
+	os.WriteFile(configFile, []byte(`{"original": true}`), 0644)
+
+	ctx := newQuarantineContext(t)
+	bus := core.NewEventBus()
+
+	task := &WriteConfigTask{
+		Destination: configFile,
+		Format:      "json",
+		Content:     map[string]any{"new": true},
+		Mode:        0644,
+	}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// Simulate a restart: a fresh task only has the journaled state.
+	data, err := json.Marshal(task.RollbackState())
+	if err != nil {
+		t.Fatalf("failed to encode state: %v", err)
+	}
+	var state map[string]any
+	_ = json.Unmarshal(data, &state)
+
+	restored := &WriteConfigTask{Mode: 0644}
+	if err := restored.RestoreRollbackState(state); err != nil {
+		t.Fatalf("RestoreRollbackState() error = %v", err)
+	}
+	if !restored.CanRollback() {
+		t.Fatal("expected restored task to be rollbackable")
+	}
+	if err := restored.Rollback(ctx, bus); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(configFile)
+	if string(content) != `{"original": true}` {
+		t.Errorf("expected original content to be restored, got %q", string(content))
+	}
+}
+
+func TestWriteConfigTaskTextTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "app.env")
+
+	ctx := newQuarantineContext(t)
+	ctx.Set("install.dir", "/opt/app")
+	ctx.Set("features", []any{"sync", "backup"})
+	bus := core.NewEventBus()
+
+	task := &WriteConfigTask{
+		Destination: configFile,
+		Format:      "text",
+		Content:     "HOME={{ .install.dir | shellQuote }}\n{{ range .features }}FEATURE_{{ upper . }}=1\n{{ end }}",
+		Mode:        0644,
+	}
+	if err := task.Execute(ctx, bus); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(configFile)
+	if want := "HOME='/opt/app'\nFEATURE_SYNC=1\nFEATURE_BACKUP=1\n"; string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	broken := &WriteConfigTask{
+		Destination: filepath.Join(tmpDir, "broken.json"),
+		Format:      "json",
+		Content:     map[string]any{"dir": "{{ .install.dir"},
+		Mode:        0644,
+	}
+	if err := broken.Execute(ctx, bus); err == nil {
+		t.Error("expected a template error to fail the task")
+	}
+	if _, err := os.Stat(broken.Destination); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written")
+	}
+}
@@ -0,0 +1,282 @@
+// Package core provides the backup service that lets tasks undo changes to
+// existing files.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileBackup records the state of a path before a task changed it. It is
+// plain data so tasks can journal it with their rollback state.
+type FileBackup struct {
+	Path    string      `json:"path"`
+	Exists  bool        `json:"exists,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"` // Including the type bits
+	UID     int         `json:"uid,omitempty"`  // -1 if unknown
+	GID     int         `json:"gid,omitempty"`  // -1 if unknown
+	ModTime time.Time   `json:"modTime,omitempty"`
+	Link    string      `json:"link,omitempty"`    // Target of a symlink
+	Content string      `json:"content,omitempty"` // Kept copy of a regular file
+}
+
+// BackupStore snapshots paths before tasks modify them and restores the
+// snapshots on rollback. The content of regular files is copied into the
+// store directory; directories and symlinks only need their metadata.
+//
+// The store of an InstallContext lives inside its quarantine, so it is
+// purged together with it once the flow has succeeded.
+type BackupStore struct {
+	mu  sync.Mutex
+	dir string // Created on first use
+	seq int
+}
+
+// NewBackupStore creates a store keeping file content in dir.
+func NewBackupStore(dir string) *BackupStore {
+	return &BackupStore{dir: dir}
+}
+
+// Dir returns the directory the store keeps file content in.
+func (s *BackupStore) Dir() string {
+	return s.dir
+}
+
+// Snapshot records the state of path, including a copy of its content if it
+// is a regular file. A path that does not exist is recorded too: restoring
+// it removes whatever was created there.
+func (s *BackupStore) Snapshot(path string) (FileBackup, error) {
+	return s.snapshot(path, true)
+}
+
+// SnapshotAttrs records the mode, owner and modification time of path
+// without copying its content, for tasks that only change attributes.
+func (s *BackupStore) SnapshotAttrs(path string) (FileBackup, error) {
+	return s.snapshot(path, false)
+}
+
+func (s *BackupStore) snapshot(path string, content bool) (FileBackup, error) {
+	backup := FileBackup{Path: path, UID: -1, GID: -1}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return backup, nil
+	}
+	if err != nil {
+		return backup, fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+
+	backup.Exists = true
+	backup.Mode = info.Mode()
+	backup.ModTime = info.ModTime()
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		backup.UID = int(stat.Uid)
+		backup.GID = int(stat.Gid)
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if backup.Link, err = os.Readlink(path); err != nil {
+			return backup, fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	case info.IsDir():
+	case info.Mode().IsRegular():
+		if !content {
+			break
+		}
+		s.mu.Lock()
+		s.seq++
+		kept := filepath.Join(s.dir, fmt.Sprintf("%d-%s", s.seq, filepath.Base(path)))
+		s.mu.Unlock()
+
+		if err := os.MkdirAll(s.dir, 0700); err != nil {
+			return backup, fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		if err := copyRegularFile(path, kept, 0600); err != nil {
+			_ = os.Remove(kept)
+			return backup, fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+		backup.Content = kept
+	default:
+		return backup, fmt.Errorf("cannot back up special file %s", path)
+	}
+	return backup, nil
+}
+
+// MkdirAll creates a directory and its parents like os.MkdirAll and returns
+// a backup of each directory it created, parents first.
+func (s *BackupStore) MkdirAll(path string, perm os.FileMode) ([]FileBackup, error) {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	if err := os.MkdirAll(path, perm); err != nil {
+		return nil, err
+	}
+
+	backups := make([]FileBackup, 0, len(missing))
+	for i := len(missing) - 1; i >= 0; i-- {
+		backups = append(backups, FileBackup{Path: missing[i], UID: -1, GID: -1})
+	}
+	return backups, nil
+}
+
+// Restore puts a path back into the recorded state. A path that did not
+// exist is removed again, a directory only if it is empty. The kept copy of
+// a restored file is dropped afterwards.
+func (s *BackupStore) Restore(backup FileBackup) error {
+	path := backup.Path
+	current, err := os.Lstat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+	exists := err == nil
+
+	if !backup.Exists {
+		if exists {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case backup.Mode&os.ModeSymlink != 0:
+		if exists {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("cannot restore %s, the path is in use: %w", path, err)
+			}
+		}
+		if err := os.Symlink(backup.Link, path); err != nil {
+			return fmt.Errorf("failed to restore symlink %s: %w", path, err)
+		}
+
+	case backup.Mode.IsDir():
+		if exists && !current.IsDir() {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", path, err)
+			}
+			exists = false
+		}
+		if !exists {
+			if err := os.Mkdir(path, backup.Mode.Perm()); err != nil {
+				return fmt.Errorf("failed to restore directory %s: %w", path, err)
+			}
+		}
+
+	case backup.Content != "":
+		// Copy next to the path and rename, so the path is never half written
+		tmp := fmt.Sprintf("%s.restore-%d", path, os.Getpid())
+		_ = os.Remove(tmp)
+		if err := copyRegularFile(backup.Content, tmp, backup.Mode.Perm()); err != nil {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+		if exists && current.IsDir() {
+			if err := os.Remove(path); err != nil {
+				_ = os.Remove(tmp)
+				return fmt.Errorf("cannot restore %s, the path is in use: %w", path, err)
+			}
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+
+	case !exists:
+		return fmt.Errorf("cannot restore attributes of %s, the path is gone", path)
+	}
+
+	if err := restoreAttrs(backup); err != nil {
+		return err
+	}
+	if backup.Content != "" {
+		_ = os.Remove(backup.Content)
+	}
+	return nil
+}
+
+// RestoreAll restores backups in reverse order, so paths are restored
+// before the directories they were created in. Unlike Restore it goes on
+// after a failure; the returned error joins the failures.
+func (s *BackupStore) RestoreAll(backups []FileBackup) error {
+	var errs []error
+	for i := len(backups) - 1; i >= 0; i-- {
+		if err := s.Restore(backups[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Purge deletes the kept file content.
+func (s *BackupStore) Purge() error {
+	return os.RemoveAll(s.dir)
+}
+
+// restoreAttrs applies the recorded mode, owner and modification time.
+func restoreAttrs(backup FileBackup) error {
+	path := backup.Path
+	symlink := backup.Mode&os.ModeSymlink != 0
+	if !symlink {
+		mode := backup.Mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to restore mode of %s: %w", path, err)
+		}
+	}
+
+	if backup.UID >= 0 || backup.GID >= 0 {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("failed to restore owner of %s: %w", path, err)
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != backup.UID || int(stat.Gid) != backup.GID {
+			if err := os.Lchown(path, backup.UID, backup.GID); err != nil {
+				return fmt.Errorf("failed to restore owner of %s: %w", path, err)
+			}
+		}
+	}
+
+	if !symlink && !backup.ModTime.IsZero() {
+		if err := os.Chtimes(path, backup.ModTime, backup.ModTime); err != nil {
+			return fmt.Errorf("failed to restore modification time of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// SetBackupStore sets where tasks keep the prior state of paths they change.
+func (c *InstallContext) SetBackupStore(store *BackupStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backups = store
+}
+
+// Backups returns the backup store for tasks, creating one inside the
+// quarantine if none was set.
+func (c *InstallContext) Backups() *BackupStore {
+	quarantine := c.Quarantine()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.backups == nil {
+		// Without a quarantine directory backups fail rather than land in
+		// the working directory
+		dir := quarantine.Dir()
+		if dir != "" {
+			dir = filepath.Join(dir, "backups")
+		}
+		c.backups = NewBackupStore(dir)
+	}
+	return c.backups
+}
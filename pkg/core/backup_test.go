@@ -0,0 +1,161 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupRestoresFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app.conf")
+	os.WriteFile(target, []byte("old"), 0640)
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(target, mtime, mtime)
+
+	store := NewBackupStore(filepath.Join(dir, "backups"))
+	backup, err := store.Snapshot(target)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	os.WriteFile(target, []byte("new"), 0644)
+	os.Chmod(target, 0755)
+
+	// The backup survives a restart through the journal
+	data, _ := json.Marshal(backup)
+	var restored FileBackup
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("failed to decode backup: %v", err)
+	}
+	if err := store.Restore(restored); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	info, _ := os.Stat(target)
+	if content, _ := os.ReadFile(target); string(content) != "old" {
+		t.Errorf("expected content to be restored, got %q", content)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+	if _, err := os.Stat(backup.Content); !os.IsNotExist(err) {
+		t.Error("expected the kept copy to be dropped once restored")
+	}
+}
+
+func TestBackupRestoresMissingPath(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "new.conf")
+
+	store := NewBackupStore(filepath.Join(dir, "backups"))
+	backup, err := store.Snapshot(target)
+	if err != nil || backup.Exists {
+		t.Fatalf("expected a backup of a missing path, got %+v %v", backup, err)
+	}
+	os.WriteFile(target, []byte("new"), 0644)
+
+	if err := store.Restore(backup); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Error("expected the created file to be removed")
+	}
+}
+
+func TestBackupRestoresSymlink(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "current")
+	os.Symlink("v1", link)
+
+	store := NewBackupStore(filepath.Join(dir, "backups"))
+	backup, err := store.Snapshot(link)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	os.Remove(link)
+	os.WriteFile(link, []byte("not a link"), 0644)
+
+	if err := store.Restore(backup); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if target, err := os.Readlink(link); err != nil || target != "v1" {
+		t.Errorf("expected the link to point to v1 again, got %q %v", target, err)
+	}
+}
+
+func TestBackupAttrsOnly(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "bin")
+	os.Mkdir(target, 0755)
+
+	store := NewBackupStore(filepath.Join(dir, "backups"))
+	backup, err := store.SnapshotAttrs(target)
+	if err != nil {
+		t.Fatalf("SnapshotAttrs failed: %v", err)
+	}
+	if backup.Content != "" {
+		t.Error("expected no content to be kept")
+	}
+	os.Chmod(target, 0700)
+
+	if err := store.Restore(backup); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755, got %v", info.Mode().Perm())
+	}
+}
+
+func TestBackupMkdirAll(t *testing.T) {
+	dir := t.TempDir()
+	store := NewBackupStore(filepath.Join(dir, "backups"))
+
+	backups, err := store.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if len(backups) != 2 || backups[0].Path != filepath.Join(dir, "a") {
+		t.Fatalf("expected backups of the two created directories, got %+v", backups)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a", "b", "file"), []byte("x"), 0644)
+	if err := store.RestoreAll(backups); err == nil {
+		t.Error("expected error when a created directory is not empty")
+	}
+	os.Remove(filepath.Join(dir, "a", "b", "file"))
+	if err := store.RestoreAll(backups); err != nil {
+		t.Fatalf("RestoreAll failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Error("expected the created directories to be removed")
+	}
+}
+
+func TestBackupsLiveInQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app.conf")
+	os.WriteFile(target, []byte("old"), 0644)
+
+	ctx := NewInstallContext()
+	ctx.SetQuarantine(NewQuarantine(filepath.Join(dir, "quarantine")))
+	w := NewWorkflow(ctx, NewEventBus())
+	w.AddFlow(createTestFlow())
+	w.SelectFlow("install")
+
+	backup, err := ctx.Backups().Snapshot(target)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if filepath.Dir(filepath.Dir(backup.Content)) != ctx.Quarantine().Dir() {
+		t.Errorf("expected the copy to be kept in the quarantine, got %s", backup.Content)
+	}
+	w.Complete()
+	if _, err := os.Stat(backup.Content); !os.IsNotExist(err) {
+		t.Error("expected the backups to be purged once the flow succeeded")
+	}
+}
@@ -0,0 +1,151 @@
+// Package core provides condition evaluation for conditional tasks.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// EvalCondition evaluates a condition such as a task's when: against the
+// context. An empty condition is true. See Expression for the syntax.
+func EvalCondition(ctx *InstallContext, expr string) (bool, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return true, nil
+	}
+	compiled, err := compileExpression(expr)
+	if err != nil {
+		return false, err
+	}
+	return compiled.EvalBool(ctx)
+}
+
+// truthy reports whether a context value counts as true in a condition.
+func truthy(val any) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "0", "false", "no", "off":
+			return false
+		}
+		return true
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() != 0
+	}
+	return true
+}
+
+// contains reports whether item is an element of a list, a key of a map, or
+// an entry of a comma-separated string.
+func contains(container, item any) bool {
+	want := valueString(item)
+	if s, ok := container.(string); ok {
+		for _, entry := range strings.Split(s, ",") {
+			if strings.TrimSpace(entry) == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	rv := reflect.ValueOf(container)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if fmt.Sprint(rv.Index(i).Interface()) == want {
+				return true
+			}
+		}
+	case reflect.Map:
+		for _, key := range rv.MapKeys() {
+			if fmt.Sprint(key.Interface()) == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateConditions parses every expression in the config (task and step
+// when:, branch conditions and expression guards), so syntax errors are
+// reported when the config is loaded rather than when a condition is first
+// evaluated.
+func ValidateConditions(cfg *Config) error {
+	flows := make(map[string]*FlowConfig, len(cfg.Flows)+1)
+	for id, flow := range cfg.Flows {
+		flows[id] = flow
+	}
+	if cfg.Flow != nil {
+		flows["flow"] = cfg.Flow
+	}
+	ids := make([]string, 0, len(flows))
+	for id := range flows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var errs []error
+	check := func(where, expr string) {
+		if strings.TrimSpace(expr) == "" {
+			return
+		}
+		if _, err := compileExpression(expr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+		}
+	}
+
+	for _, flowID := range ids {
+		flow := flows[flowID]
+		if flow == nil {
+			continue
+		}
+		for _, step := range flow.Steps {
+			if step == nil {
+				continue
+			}
+			where := fmt.Sprintf("flows.%s step %s", flowID, step.ID)
+			check(where+" when", step.When)
+			if step.Branch != nil {
+				check(where+" branch", step.Branch.Condition)
+			}
+			for _, guard := range step.Guards {
+				if guard["type"] == "expression" {
+					expr, _ := guard["expression"].(string)
+					check(where+" guard", expr)
+				}
+			}
+			for i, task := range step.Tasks {
+				check(fmt.Sprintf("%s task %d (%s) when", where, i+1, task.Type), task.When)
+			}
+			for i, task := range step.OnEnter {
+				check(fmt.Sprintf("%s onEnter task %d (%s) when", where, i+1, task.Type), task.When)
+			}
+			for i, task := range step.OnLeave {
+				check(fmt.Sprintf("%s onLeave task %d (%s) when", where, i+1, task.Type), task.When)
+			}
+			if step.Screen != nil {
+				for _, field := range step.Screen.Fields {
+					check(fmt.Sprintf("%s field %s when", where, field.Variable), field.When)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
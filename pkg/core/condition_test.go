@@ -0,0 +1,52 @@
+package core
+
+import "testing"
+
+func TestEvalCondition(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Set("install_options", []string{"desktop_shortcut", "add_to_path"})
+	ctx.Set("install_type", "full")
+	ctx.Set("accepted", true)
+	ctx.Set("count", 0)
+	ctx.Set("csv", "a, b")
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"accepted", true},
+		{"!accepted", false},
+		{"count", false},
+		{"missing", false},
+		{"!missing", true},
+		{`"desktop_shortcut" in install_options`, true},
+		{`'start_after' in install_options`, false},
+		{`b in csv`, false}, // b resolves as a (missing) path
+		{`"b" in csv`, true},
+		{`install_type == "full"`, true},
+		{`install_type != 'full'`, false},
+		{`install_type == "a && b"`, false},
+		{`accepted && install_type == "full"`, true},
+		{`accepted && "start_after" in install_options`, false},
+		{`"start_after" in install_options || install_type == "full"`, true},
+		{`accepted == true`, true},
+	}
+
+	for _, tt := range tests {
+		got, err := EvalCondition(ctx, tt.expr)
+		if err != nil {
+			t.Errorf("EvalCondition(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EvalCondition(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"a == b == c", "accepted && "} {
+		if _, err := EvalCondition(ctx, expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
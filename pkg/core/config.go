@@ -45,28 +45,56 @@ func (b *BranchConfig) UnmarshalYAML(value *yaml.Node) error {
 
 // TaskConfig represents a task configuration from YAML.
 type TaskConfig struct {
-	Type          string         `yaml:"type" json:"type"`
-	ID            string         `yaml:"id,omitempty" json:"id,omitempty"`
-	Params        map[string]any `yaml:",inline" json:",inline"`
-	FailurePolicy string         `yaml:"on_failure,omitempty" json:"on_failure,omitempty"`
-	Retries       int            `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Type          string            `yaml:"type" json:"type"`
+	ID            string            `yaml:"id,omitempty" json:"id,omitempty"`
+	Params        map[string]any    `yaml:",inline" json:",inline"`
+	FailurePolicy string            `yaml:"on_failure,omitempty" json:"on_failure,omitempty"`
+	Retries       int               `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Backoff       *BackoffConfig    `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+	DependsOn     []string          `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+	Weight        float64           `yaml:"weight,omitempty" json:"weight,omitempty"`
+	When          string            `yaml:"when,omitempty" json:"when,omitempty"`
+	ForEach       string            `yaml:"forEach,omitempty" json:"forEach,omitempty"`
+	Register      string            `yaml:"register,omitempty" json:"register,omitempty"`
+	Outputs       map[string]string `yaml:"outputs,omitempty" json:"outputs,omitempty"`
 }
 
 // StepConfig represents a step configuration.
 type StepConfig struct {
-	ID     string           `yaml:"id" json:"id"`
-	Title  string           `yaml:"title" json:"title"`
-	Screen *ScreenConfig    `yaml:"screen,omitempty" json:"screen,omitempty"`
-	Tasks  []TaskConfig     `yaml:"tasks,omitempty" json:"tasks,omitempty"`
-	Guards []map[string]any `yaml:"guards,omitempty" json:"guards,omitempty"`
-	Next   string           `yaml:"next,omitempty" json:"next,omitempty"`
-	Prev   string           `yaml:"prev,omitempty" json:"prev,omitempty"`
-	Branch *BranchConfig    `yaml:"branch,omitempty" json:"branch,omitempty"`
+	ID     string        `yaml:"id" json:"id"`
+	Title  string        `yaml:"title" json:"title"`
+	Screen *ScreenConfig `yaml:"screen,omitempty" json:"screen,omitempty"`
+	Tasks  []TaskConfig  `yaml:"tasks,omitempty" json:"tasks,omitempty"`
+	// OnEnter and OnLeave run when navigation enters or leaves the step; a
+	// failure keeps the workflow where it was.
+	OnEnter []TaskConfig     `yaml:"onEnter,omitempty" json:"onEnter,omitempty"`
+	OnLeave []TaskConfig     `yaml:"onLeave,omitempty" json:"onLeave,omitempty"`
+	Guards  []map[string]any `yaml:"guards,omitempty" json:"guards,omitempty"`
+	Next    string           `yaml:"next,omitempty" json:"next,omitempty"`
+	Prev    string           `yaml:"prev,omitempty" json:"prev,omitempty"`
+	Branch  *BranchConfig    `yaml:"branch,omitempty" json:"branch,omitempty"`
+	When    string           `yaml:"when,omitempty" json:"when,omitempty"` // Step is skipped unless this holds
+	Flow    string           `yaml:"flow,omitempty" json:"flow,omitempty"` // Calls another flow as a sub-flow
 	// AllowBack keeps backward navigation enabled by default and only locks it
 	// when the config explicitly sets allowBack: false for a step.
 	AllowBack *bool  `yaml:"allowBack,omitempty" json:"allowBack,omitempty"`
 	AllowJump bool   `yaml:"allowJump,omitempty" json:"allowJump,omitempty"`
 	Route     string `yaml:"route,omitempty" json:"route,omitempty"`
+	// CalledFrom lists the IDs of the steps whose sub-flow call this step was
+	// copied through, outermost first. It is set by ExpandSubflows.
+	CalledFrom []string `yaml:"-" json:"-"`
+}
+
+// AllTasks returns the step's onEnter, tasks and onLeave task lists in the
+// order they run.
+func (s *StepConfig) AllTasks() []TaskConfig {
+	if s == nil {
+		return nil
+	}
+	tasks := make([]TaskConfig, 0, len(s.OnEnter)+len(s.Tasks)+len(s.OnLeave))
+	tasks = append(tasks, s.OnEnter...)
+	tasks = append(tasks, s.Tasks...)
+	return append(tasks, s.OnLeave...)
 }
 
 // ScreenConfig represents screen configuration.
@@ -94,6 +122,7 @@ type FieldConfig struct {
 	Hint       string   `yaml:"hint,omitempty" json:"hint,omitempty"`
 	Validation string   `yaml:"validation,omitempty" json:"validation,omitempty"`
 	Options    []Option `yaml:"options,omitempty" json:"options,omitempty"`
+	When       string   `yaml:"when,omitempty" json:"when,omitempty"` // Field is hidden unless this holds
 }
 
 // Option represents an option in options screen or select field.
@@ -162,6 +191,7 @@ type Config struct {
 	Schema    string                 `yaml:"$schema,omitempty" json:"$schema,omitempty"`
 	Product   *ProductConfig         `yaml:"product" json:"product"`
 	Meta      map[string]any         `yaml:"meta,omitempty" json:"meta,omitempty"`
+	Variables []VariableConfig       `yaml:"variables,omitempty" json:"variables,omitempty"`
 	Sources   *SourcesConfig         `yaml:"sources,omitempty" json:"sources,omitempty"`
 	Flow      *FlowConfig            `yaml:"flow,omitempty" json:"flow,omitempty"`
 	Flows     map[string]*FlowConfig `yaml:"flows,omitempty" json:"flows,omitempty"`
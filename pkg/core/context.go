@@ -3,12 +3,10 @@ package core
 
 import (
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
-	"regexp"
+	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 // InstallContext holds all state for an installation session.
@@ -34,9 +32,31 @@ type InstallContext struct {
 	// Event bus for log propagation
 	bus *EventBus
 
-	// Log output file
-	logFile *os.File
-	logPath string
+	// Log output
+	logFiles    []*logFile
+	logLevel    LogLevel    // Entries below this level are dropped
+	activeTasks []*logScope // Tasks log entries are attributed to
+
+	// Install journal for crash recovery
+	journal *Journal
+
+	// Flow-wide rollback transaction
+	transaction *Transaction
+
+	// Removed paths kept until the flow succeeds
+	quarantine *Quarantine
+
+	// Prior state of paths changed by tasks
+	backups *BackupStore
+
+	// Runner of the current step, see SetTaskRunner
+	runner *TaskRunner
+
+	// Declared variables, see DeclareVariables
+	variables []VariableConfig
+
+	// Scrubs secret values from logs, events and plans
+	redactor *Redactor
 }
 
 // EnvInfo contains detected environment information.
@@ -62,14 +82,21 @@ type EnvInfo struct {
 
 // TaskPlan represents the planned tasks for display in summary.
 type TaskPlan struct {
-	Tasks []TaskSummary
+	Tasks []TaskSummary `json:"tasks"`
 }
 
 // TaskSummary is a human-readable summary of a task.
 type TaskSummary struct {
-	Type         string
-	Description  string
-	RequiresRoot bool
+	ID           string          `json:"id,omitempty"`
+	Step         string          `json:"step,omitempty"`
+	Type         string          `json:"type"`
+	Description  string          `json:"description"`
+	RequiresRoot bool            `json:"requiresRoot,omitempty"`
+	Actions      []PlannedAction `json:"actions,omitempty"` // Filled by Planner tasks in dry-run mode
+	When         string          `json:"when,omitempty"`    // Condition the task runs under
+	Skipped      bool            `json:"skipped,omitempty"` // The when: condition was not met
+	ForEach      string          `json:"forEach,omitempty"` // Context list the task is repeated for
+	Hook         string          `json:"hook,omitempty"`    // Step hook (onEnter, onLeave) the task runs in
 }
 
 // RuntimeState contains current execution state.
@@ -80,15 +107,26 @@ type RuntimeState struct {
 	Progress    float64
 	Logs        []LogEntry
 	Errors      []error
-	StartTime   int64
+	StartTime   int64 // Unix milliseconds when the context was created
 	Completed   bool
+	DryRun      bool // Tasks describe their actions instead of executing
 }
 
-// LogEntry represents a single log message.
+// LogEntry represents a single log message and where it came from.
 type LogEntry struct {
-	Level   LogLevel
-	Message string
-	Time    int64
+	Level    LogLevel       `json:"level"`
+	Message  string         `json:"message"`
+	Time     int64          `json:"time"` // Unix milliseconds
+	Flow     string         `json:"flow,omitempty"`
+	Step     string         `json:"step,omitempty"`
+	TaskID   string         `json:"task,omitempty"`
+	TaskType string         `json:"taskType,omitempty"`
+	Fields   map[string]any `json:"fields,omitempty"` // Key/value details
+}
+
+// Timestamp returns the time the entry was logged.
+func (e LogEntry) Timestamp() time.Time {
+	return time.UnixMilli(e.Time)
 }
 
 // LogLevel represents log severity.
@@ -100,68 +138,91 @@ const (
 	LogError
 )
 
+// Verbose levels rank below LogInfo and are dropped unless enabled with
+// SetLogLevel.
+const (
+	LogDebug LogLevel = -1
+	LogTrace LogLevel = -2
+)
+
 // NewInstallContext creates a new empty InstallContext.
 func NewInstallContext() *InstallContext {
 	return &InstallContext{
 		UserInput: make(map[string]any),
 		Meta:      make(map[string]any),
 		Runtime: RuntimeState{
-			Logs:   make([]LogEntry, 0),
-			Errors: make([]error, 0),
+			Logs:      make([]LogEntry, 0),
+			Errors:    make([]error, 0),
+			StartTime: currentTimeMillis(),
 		},
+		redactor: NewRedactor(),
 	}
 }
 
-// SetEventBus attaches an EventBus to the context for log propagation.
+// SetEventBus attaches an EventBus to the context for log propagation. The
+// bus redacts the context's secrets from the events it publishes.
 func (c *InstallContext) SetEventBus(bus *EventBus) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.bus = bus
+	if bus != nil {
+		bus.SetRedactor(c.redactor)
+	}
 }
 
-// SetLogFile configures a log file path for persistent logs.
-func (c *InstallContext) SetLogFile(path string) error {
+// AddPlannedTask appends a task summary to the plan, creating it if needed.
+func (c *InstallContext) AddPlannedTask(summary TaskSummary) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.logFile != nil {
-		_ = c.logFile.Close()
-		c.logFile = nil
-	}
-
-	if path == "" {
-		c.logPath = ""
-		return nil
+	if c.Plan == nil {
+		c.Plan = &TaskPlan{}
 	}
-
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
+	summary.Description = c.redactor.Redact(summary.Description)
+	if len(summary.Actions) > 0 {
+		actions := make([]PlannedAction, len(summary.Actions))
+		for i, action := range summary.Actions {
+			action.Path = c.redactor.Redact(action.Path)
+			action.Source = c.redactor.Redact(action.Source)
+			action.Command = c.redactor.Redact(action.Command)
+			action.Detail = c.redactor.Redact(action.Detail)
+			actions[i] = action
+		}
+		summary.Actions = actions
 	}
+	c.Plan.Tasks = append(c.Plan.Tasks, summary)
+}
 
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return err
-	}
+// SetJournal attaches the install journal used by task runners.
+func (c *InstallContext) SetJournal(journal *Journal) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.journal = journal
+}
 
-	c.logFile = file
-	c.logPath = path
-	return nil
+// Journal returns the attached install journal, if any.
+func (c *InstallContext) Journal() *Journal {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.journal
 }
 
-// LogPath returns the active log file path, if any.
-func (c *InstallContext) LogPath() string {
+// InputSnapshot returns a copy of the user input containing only plain data
+// values, suitable for persisting in the journal.
+func (c *InstallContext) InputSnapshot() map[string]any {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.logPath
+
+	snapshot, _ := journalValue(c.UserInput)
+	return snapshot.(map[string]any)
 }
 
-// CloseLogFile closes the log file if configured.
-func (c *InstallContext) CloseLogFile() {
+// RestoreInput merges a journaled input snapshot into the user input.
+func (c *InstallContext) RestoreInput(input map[string]any) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.logFile != nil {
-		_ = c.logFile.Close()
-		c.logFile = nil
+	for k, v := range input {
+		c.UserInput[k] = v
 	}
 }
 
@@ -199,8 +260,11 @@ func (c *InstallContext) GetString(path string) string {
 	if !ok {
 		return ""
 	}
-	if s, ok := val.(string); ok {
+	switch s := val.(type) {
+	case string:
 		return s
+	case Secret:
+		return s.Reveal()
 	}
 	return fmt.Sprintf("%v", val)
 }
@@ -235,50 +299,74 @@ func (c *InstallContext) GetInt(path string) int64 {
 	}
 }
 
-// Set sets a value by dot-notation path in UserInput.
+// Set sets a value by dot-notation path in UserInput. Secret values in it
+// are redacted from then on. A changed value is published as
+// EventContextChanged.
 func (c *InstallContext) Set(path string, value any) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	setNestedValue(c.UserInput, path, value)
+	c.set(path, value, false)
 }
 
 // SetMeta sets a value in Meta by dot-notation path.
 func (c *InstallContext) SetMeta(path string, value any) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	setNestedValue(c.Meta, path, value)
+	c.set(path, value, true)
 }
 
-// Render replaces ${path} placeholders in a template string with context values.
-func (c *InstallContext) Render(template string) string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	result := template
+func (c *InstallContext) set(path string, value any, meta bool) {
+	c.registerSecrets(value)
+	c.mu.Lock()
+	target := c.UserInput
+	if meta {
+		target = c.Meta
+	}
+	old, _ := getNestedValue(target, path)
+	setNestedValue(target, path, value)
+	bus := c.bus
+	c.mu.Unlock()
 
-	// Support ${path} syntax
-	reDollar := regexp.MustCompile(`\$\{([^}]+)\}`)
-	result = reDollar.ReplaceAllStringFunc(result, func(match string) string {
-		path := match[2 : len(match)-1]
-		if val, ok := c.getUnlocked(path); ok {
-			return fmt.Sprintf("%v", val)
-		}
-		return match
+	// Only changes of plain data are published; events carry copies, so
+	// they neither share maps with the context nor keep objects alive
+	if bus == nil {
+		return
+	}
+	newValue, ok := plainValue(value)
+	if !ok {
+		return
+	}
+	oldValue, _ := plainValue(old)
+	if reflect.DeepEqual(oldValue, newValue) {
+		return
+	}
+	// Handlers may read the context, so they run without the lock
+	bus.Publish(Event{
+		Type:    EventContextChanged,
+		Payload: ContextChangePayload{Path: path, Old: oldValue, New: newValue, Meta: meta},
 	})
+}
 
-	// Support {{.path}} syntax (Go template style)
-	reMustache := regexp.MustCompile(`\{\{\.([^}]+)\}\}`)
-	result = reMustache.ReplaceAllStringFunc(result, func(match string) string {
-		path := match[3 : len(match)-2]
-		if val, ok := c.getUnlocked(path); ok {
-			return fmt.Sprintf("%v", val)
+// plainValue is journalValue for change events: a copy of plain data and
+// false for runtime objects. Secrets are kept; the bus redacts them.
+func plainValue(value any) (any, bool) {
+	switch v := value.(type) {
+	case Secret:
+		return v, true
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			if plain, ok := plainValue(item); ok {
+				result = append(result, plain)
+			}
 		}
-		return match
-	})
-
-	return result
+		return result, true
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			if plain, ok := plainValue(item); ok {
+				result[key] = plain
+			}
+		}
+		return result, true
+	}
+	return journalValue(value)
 }
 
 // RenderOrDefault returns the rendered value at path, or the default if not found.
@@ -290,38 +378,46 @@ func (c *InstallContext) RenderOrDefault(path string, defaultVal string) string
 	return fmt.Sprintf("%v", val)
 }
 
-// AddLog adds a log entry to the runtime state.
-func (c *InstallContext) AddLog(level LogLevel, message string) {
+// AddError adds an error to the runtime state.
+func (c *InstallContext) AddError(err error) {
 	c.mu.Lock()
-	bus := c.bus
-	writer := c.logFile
-	c.mu.Unlock()
+	defer c.mu.Unlock()
 
-	entry := LogEntry{
-		Level:   level,
-		Message: message,
-		Time:    currentTimeMillis(),
-	}
+	c.Runtime.Errors = append(c.Runtime.Errors, c.redactor.RedactError(err))
+}
 
+// setStep records the flow and step the workflow is at. The workflow calls
+// it, while task runners and logging read them from other goroutines.
+func (c *InstallContext) setStep(flowID, stepID string) {
 	c.mu.Lock()
-	c.Runtime.Logs = append(c.Runtime.Logs, entry)
-	c.mu.Unlock()
+	defer c.mu.Unlock()
 
-	if bus != nil {
-		bus.PublishLog(level, message)
-	}
+	c.Runtime.FlowID = flowID
+	c.Runtime.CurrentStep = stepID
+}
 
-	if writer != nil {
-		writeLogEntry(writer, entry)
-	}
+// step returns the flow and step recorded by setStep.
+func (c *InstallContext) step() (flowID, stepID string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.Runtime.FlowID, c.Runtime.CurrentStep
 }
 
-// AddError adds an error to the runtime state.
-func (c *InstallContext) AddError(err error) {
+// setCompleted marks the flow as completed.
+func (c *InstallContext) setCompleted() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.Runtime.Errors = append(c.Runtime.Errors, err)
+	c.Runtime.Completed = true
+}
+
+// completed reports whether the flow has completed.
+func (c *InstallContext) completed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.Runtime.Completed
 }
 
 // SetProgress updates the current progress (0.0 to 1.0).
@@ -364,17 +460,6 @@ func (c *InstallContext) getEnvField(path string) (any, bool) {
 	return nil, false
 }
 
-func writeLogEntry(w io.Writer, entry LogEntry) {
-	level := "INFO"
-	switch entry.Level {
-	case LogWarn:
-		level = "WARN"
-	case LogError:
-		level = "ERROR"
-	}
-	_, _ = fmt.Fprintf(w, "[%s] %s\n", level, entry.Message)
-}
-
 // getNestedValue retrieves a value from a nested map using dot notation.
 func getNestedValue(m map[string]any, path string) (any, bool) {
 	parts := strings.Split(path, ".")
@@ -417,8 +502,7 @@ func setNestedValue(m map[string]any, path string, value any) {
 	current[parts[len(parts)-1]] = value
 }
 
-// currentTimeMillis returns current time in milliseconds (stub for now).
+// currentTimeMillis returns the current time in Unix milliseconds.
 func currentTimeMillis() int64 {
-	// Will be replaced with actual time implementation
-	return 0
+	return time.Now().UnixMilli()
 }
@@ -97,6 +97,72 @@ func TestContextMeta(t *testing.T) {
 	}
 }
 
+func TestContextChangeEvents(t *testing.T) {
+	ctx := NewInstallContext()
+	bus := NewEventBus()
+	ctx.SetEventBus(bus)
+
+	var changes []ContextChangePayload
+	bus.Subscribe(EventContextChanged, func(e Event) {
+		if p := e.ContextChangePayload(); p != nil {
+			// Handlers may read the context
+			if got, _ := ctx.Get(p.Path); !p.Meta && got != p.New {
+				t.Errorf("expected %s to hold the new value in the handler, got %v", p.Path, got)
+			}
+			changes = append(changes, *p)
+		}
+	})
+	var install []string
+	bus.SubscribePaths([]string{"install"}, func(e Event) {
+		install = append(install, e.ContextChangePayload().Path)
+	})
+
+	ctx.Set("install.dir", "/opt/app")
+	ctx.Set("install.dir", "/opt/app")
+	ctx.Set("install.dir", "/srv/app")
+	ctx.Set("channel", "beta")
+	ctx.SetMeta("channel", "stable")
+	ctx.Set("runner", NewTaskRunner(ctx, nil)) // Runtime objects are not published
+
+	expected := []ContextChangePayload{
+		{Path: "install.dir", New: "/opt/app"},
+		{Path: "install.dir", Old: "/opt/app", New: "/srv/app"},
+		{Path: "channel", New: "beta"},
+		{Path: "channel", New: "stable", Meta: true},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for i, want := range expected {
+		if changes[i] != want {
+			t.Errorf("change %d: expected %+v, got %+v", i, want, changes[i])
+		}
+	}
+	if len(install) != 2 {
+		t.Errorf("expected the path subscriber to see 2 changes, got %v", install)
+	}
+}
+
+func TestContextChangeAffects(t *testing.T) {
+	change := ContextChangePayload{Path: "install.dir"}
+	tests := []struct {
+		paths    []string
+		expected bool
+	}{
+		{nil, true},
+		{[]string{"install.dir"}, true},
+		{[]string{"install"}, true},
+		{[]string{"install.dir.size"}, true},
+		{[]string{"install.directory", "install_dir"}, false},
+		{[]string{"channel", "install"}, true},
+	}
+	for _, tt := range tests {
+		if got := change.Affects(tt.paths...); got != tt.expected {
+			t.Errorf("Affects(%v) = %v, want %v", tt.paths, got, tt.expected)
+		}
+	}
+}
+
 func TestContextEnvFields(t *testing.T) {
 	ctx := NewInstallContext()
 	ctx.Env = EnvInfo{
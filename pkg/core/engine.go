@@ -28,15 +28,31 @@ type Step struct {
 	Next      string // Next step ID (empty = sequential)
 	Prev      string // Previous step ID (empty = sequential)
 	Branch    *BranchConfig
+	When      string // Condition for visiting the step (empty = always)
 	// AllowBack mirrors StepConfig.AllowBack so navigation rules remain enforced
 	// even when callers interact with Workflow directly instead of going through UI.
 	AllowBack *bool
 	AllowJump bool
 	Route     string
+	// CalledFrom lists the sub-flow call steps this step was copied through,
+	// outermost first (see ExpandSubflows)
+	CalledFrom []string
 	// Config holds the original step configuration
 	Config *StepConfig
 }
 
+// Depth returns how many sub-flow calls deep the step is; top-level steps
+// are at depth 0.
+func (s *Step) Depth() int {
+	if s == nil {
+		return 0
+	}
+	if len(s.CalledFrom) == 0 && s.Config != nil {
+		return len(s.Config.CalledFrom)
+	}
+	return len(s.CalledFrom)
+}
+
 // AllowsBack reports whether the current step permits backward navigation.
 // Unset config preserves the historical default of allowing back navigation.
 func (s *Step) AllowsBack() bool {
@@ -64,6 +80,8 @@ type Flow struct {
 // Workflow manages the state machine for step navigation.
 type Workflow struct {
 	mu sync.RWMutex
+	// nav serializes navigation, which releases mu while step hooks run
+	nav sync.Mutex
 
 	// Configuration
 	flows   map[string]*Flow
@@ -78,11 +96,16 @@ type Workflow struct {
 	// Dependencies
 	ctx *InstallContext
 	bus *EventBus
+	tx  *Transaction // Rollback of the tasks of all steps
+
+	elevate ElevateFunc // Called before entering a step that needs privileges
 }
 
 // NewWorkflow creates a new workflow engine.
+// The workflow's transaction is attached to ctx, so the task runners of all
+// steps record into it.
 func NewWorkflow(ctx *InstallContext, bus *EventBus) *Workflow {
-	return &Workflow{
+	w := &Workflow{
 		flows:      make(map[string]*Flow),
 		stepIndex:  make(map[string]int),
 		stepStatus: make(map[string]StepStatus),
@@ -90,7 +113,12 @@ func NewWorkflow(ctx *InstallContext, bus *EventBus) *Workflow {
 		currentIdx: -1,
 		ctx:        ctx,
 		bus:        bus,
+		tx:         NewTransaction(ctx, bus),
+	}
+	if ctx != nil {
+		ctx.SetTransaction(w.tx)
 	}
+	return w
 }
 
 // AddFlow adds a flow to the workflow.
@@ -146,8 +174,7 @@ func (w *Workflow) SelectFlow(flowID string) error {
 	w.visited[flow.Steps[entryIdx].ID] = true
 
 	// Update runtime context
-	w.ctx.Runtime.FlowID = flowID
-	w.ctx.Runtime.CurrentStep = flow.Steps[entryIdx].ID
+	w.ctx.setStep(flowID, flow.Steps[entryIdx].ID)
 
 	return nil
 }
@@ -248,23 +275,47 @@ func (w *Workflow) canGoNextUnlocked() error {
 
 // Next moves to the next step.
 // Returns the new step ID, or error if cannot proceed.
+//
+// The current step's onLeave hooks run before the next step is chosen, so
+// input they normalize decides the branch and the when: conditions. The
+// onEnter hooks of the chosen step run before it becomes current. A failed
+// hook keeps the current step.
 func (w *Workflow) Next() (string, error) {
+	w.nav.Lock()
+	defer w.nav.Unlock()
 	w.mu.Lock()
 
 	if err := w.canGoNextUnlocked(); err != nil {
 		w.mu.Unlock()
 		return "", err
 	}
-
 	step := w.current.Steps[w.currentIdx]
-	oldStepID := step.ID
+	w.mu.Unlock()
+
+	if err := w.runHooks(step, HookLeave); err != nil {
+		return "", err
+	}
+
+	var warnings []string
+	w.mu.Lock()
+	nextIdx, err := w.nextIndexUnlocked(step, &warnings)
+	w.mu.Unlock()
+	w.logWarnings(warnings)
+	if err != nil {
+		return "", err
+	}
+	return w.moveTo(step, nextIdx, StepCompleted)
+}
 
-	// Determine next step
+// nextIndexUnlocked returns the index of the step after step: the branch
+// target, the explicit next or the following step, passing over skipped
+// steps. Callers hold w.mu.
+func (w *Workflow) nextIndexUnlocked(step *Step, warnings *[]string) (int, error) {
 	nextID := ""
 
 	// Check for branch
 	if step.Branch != nil {
-		nextID = w.evaluateBranch(step.Branch)
+		nextID = w.evaluateBranch(step.Branch, warnings)
 	}
 
 	// Check for explicit next
@@ -274,54 +325,34 @@ func (w *Workflow) Next() (string, error) {
 
 	// Default to sequential
 	if nextID == "" {
-		if w.currentIdx+1 < len(w.current.Steps) {
-			nextID = w.current.Steps[w.currentIdx+1].ID
-		} else {
-			w.mu.Unlock()
-			return "", errors.New("no more steps")
+		if w.currentIdx+1 >= len(w.current.Steps) {
+			return 0, errors.New("no more steps")
 		}
+		nextID = w.current.Steps[w.currentIdx+1].ID
 	}
 
-	// Find and activate next step
 	nextIdx, ok := w.stepIndex[nextID]
 	if !ok {
-		w.mu.Unlock()
-		return "", fmt.Errorf("step %q not found", nextID)
+		return 0, fmt.Errorf("step %q not found", nextID)
 	}
 
-	// Skip disabled steps
-	for w.stepStatus[w.current.Steps[nextIdx].ID] == StepDisabled {
+	// Skip disabled steps and steps whose condition does not hold
+	for w.skipsStep(nextIdx, warnings) {
 		nextIdx++
 		if nextIdx >= len(w.current.Steps) {
-			w.mu.Unlock()
-			return "", errors.New("no more steps")
+			return 0, errors.New("no more steps")
 		}
-		nextID = w.current.Steps[nextIdx].ID
 	}
-
-	// Update status
-	w.stepStatus[oldStepID] = StepCompleted
-	w.stepStatus[nextID] = StepCurrent
-	w.currentIdx = nextIdx
-	w.visited[nextID] = true
-
-	// Update context
-	w.ctx.Runtime.CurrentStep = nextID
-
-	bus := w.bus
-	w.mu.Unlock()
-
-	// Emit event after unlocking to avoid deadlocks in handlers.
-	if bus != nil {
-		bus.PublishStepChange(oldStepID, nextID)
-	}
-
-	return nextID, nil
+	return nextIdx, nil
 }
 
 // Prev moves to the previous step.
-// Returns the new step ID, or error if cannot go back.
+// Returns the new step ID, or error if cannot go back. Like Next, it runs
+// the onLeave hooks before choosing the step to return to.
 func (w *Workflow) Prev() (string, error) {
+	w.nav.Lock()
+	defer w.nav.Unlock()
+	var warnings []string
 	w.mu.Lock()
 
 	if w.current == nil {
@@ -334,70 +365,100 @@ func (w *Workflow) Prev() (string, error) {
 		return "", errors.New("back navigation is disabled")
 	}
 
-	if !w.canGoBackUnlocked() {
+	if !w.canGoBackUnlocked(&warnings) {
 		w.mu.Unlock()
+		w.logWarnings(warnings)
 		return "", errors.New("already at first step")
 	}
-
 	step := w.current.Steps[w.currentIdx]
-	oldStepID := step.ID
+	w.mu.Unlock()
+	w.logWarnings(warnings)
 
-	// Determine previous step
-	prevID := ""
+	if err := w.runHooks(step, HookLeave); err != nil {
+		return "", err
+	}
 
-	// Check for explicit prev
-	if step.Prev != "" {
-		prevID = step.Prev
+	warnings = nil
+	w.mu.Lock()
+	prevIdx, err := w.prevIndexUnlocked(step, &warnings)
+	w.mu.Unlock()
+	w.logWarnings(warnings)
+	if err != nil {
+		return "", err
 	}
+	return w.moveTo(step, prevIdx, StepNotStarted)
+}
+
+// prevIndexUnlocked returns the index of the step before step: the
+// explicit prev or the preceding step, passing over skipped steps. Callers
+// hold w.mu.
+func (w *Workflow) prevIndexUnlocked(step *Step, warnings *[]string) (int, error) {
+	prevID := step.Prev
 
 	// Default to sequential
 	if prevID == "" {
-		if w.currentIdx-1 >= 0 {
-			prevID = w.current.Steps[w.currentIdx-1].ID
-		} else {
-			w.mu.Unlock()
-			return "", errors.New("already at first step")
+		if w.currentIdx-1 < 0 {
+			return 0, errors.New("already at first step")
 		}
+		prevID = w.current.Steps[w.currentIdx-1].ID
 	}
 
-	// Find and activate previous step
 	prevIdx, ok := w.stepIndex[prevID]
 	if !ok {
-		w.mu.Unlock()
-		return "", fmt.Errorf("step %q not found", prevID)
+		return 0, fmt.Errorf("step %q not found", prevID)
 	}
 
 	// Skip disabled steps going backward
-	for w.stepStatus[w.current.Steps[prevIdx].ID] == StepDisabled {
+	for w.skipsStep(prevIdx, warnings) {
 		prevIdx--
 		if prevIdx < 0 {
-			w.mu.Unlock()
-			return "", errors.New("already at first step")
+			return 0, errors.New("already at first step")
 		}
-		prevID = w.current.Steps[prevIdx].ID
 	}
+	return prevIdx, nil
+}
+
+// moveTo runs the onEnter hooks of the step at idx and makes it current,
+// leaving from with the given status. Its onLeave hooks have run already.
+func (w *Workflow) moveTo(from *Step, idx int, fromStatus StepStatus) (string, error) {
+	w.mu.RLock()
+	target := w.current.Steps[idx]
+	w.mu.RUnlock()
+
+	// A failure keeps the current step
+	if err := w.elevateFor(target, from, fromStatus); err != nil {
+		return "", err
+	}
+	if err := w.runHooks(target, HookEnter); err != nil {
+		return "", err
+	}
+
+	w.mu.Lock()
 
 	// Update status
-	w.stepStatus[oldStepID] = StepNotStarted
-	w.stepStatus[prevID] = StepCurrent
-	w.currentIdx = prevIdx
+	w.stepStatus[from.ID] = fromStatus
+	w.stepStatus[target.ID] = StepCurrent
+	w.currentIdx = idx
+	w.visited[target.ID] = true
 
 	// Update context
-	w.ctx.Runtime.CurrentStep = prevID
+	w.ctx.setStep(w.current.ID, target.ID)
 
 	bus := w.bus
 	w.mu.Unlock()
 
 	// Emit event after unlocking to avoid deadlocks in handlers.
 	if bus != nil {
-		bus.PublishStepChange(oldStepID, prevID)
+		bus.PublishStepChange(from.ID, target.ID)
 	}
 
-	return prevID, nil
+	return target.ID, nil
 }
 
 // JumpTo moves directly to a step (if allowed).
 func (w *Workflow) JumpTo(stepID string) error {
+	w.nav.Lock()
+	defer w.nav.Unlock()
 	w.mu.Lock()
 
 	if w.current == nil {
@@ -425,18 +486,30 @@ func (w *Workflow) JumpTo(stepID string) error {
 		return fmt.Errorf("step %q is disabled", stepID)
 	}
 
-	oldStepID := w.current.Steps[w.currentIdx].ID
+	oldStep := w.current.Steps[w.currentIdx]
+	oldStepID := oldStep.ID
+	oldStatus := StepNotStarted
+	if w.stepStatus[oldStepID] == StepCompleted {
+		oldStatus = StepCompleted
+	}
 
-	// Update status
-	if w.stepStatus[oldStepID] != StepCompleted {
-		w.stepStatus[oldStepID] = StepNotStarted
+	// Run step hooks; a failure keeps the current step
+	if oldStepID != stepID {
+		w.mu.Unlock()
+		if err := w.runTransition(oldStep, targetStep, oldStatus); err != nil {
+			return err
+		}
+		w.mu.Lock()
 	}
+
+	// Update status
+	w.stepStatus[oldStepID] = oldStatus
 	w.stepStatus[stepID] = StepCurrent
 	w.currentIdx = targetIdx
 	w.visited[stepID] = true
 
 	// Update context
-	w.ctx.Runtime.CurrentStep = stepID
+	w.ctx.setStep(w.current.ID, stepID)
 
 	bus := w.bus
 	w.mu.Unlock()
@@ -449,6 +522,50 @@ func (w *Workflow) JumpTo(stepID string) error {
 	return nil
 }
 
+// ResumeAt moves to a step recorded in an interrupted session's journal.
+// Unlike JumpTo, the target need not have been visited: every step before it
+// is marked completed so back navigation behaves as in the original run.
+func (w *Workflow) ResumeAt(stepID string) error {
+	w.mu.Lock()
+
+	if w.current == nil {
+		w.mu.Unlock()
+		return errors.New("no flow selected")
+	}
+
+	targetIdx, ok := w.stepIndex[stepID]
+	if !ok {
+		w.mu.Unlock()
+		return fmt.Errorf("step %q not found", stepID)
+	}
+
+	oldStepID := w.current.Steps[w.currentIdx].ID
+	for i := 0; i < targetIdx; i++ {
+		id := w.current.Steps[i].ID
+		if w.stepStatus[id] != StepDisabled {
+			w.stepStatus[id] = StepCompleted
+			w.visited[id] = true
+		}
+	}
+	if oldStepID != stepID && w.stepStatus[oldStepID] == StepCurrent {
+		w.stepStatus[oldStepID] = StepNotStarted
+	}
+	w.stepStatus[stepID] = StepCurrent
+	w.currentIdx = targetIdx
+	w.visited[stepID] = true
+
+	w.ctx.setStep(w.current.ID, stepID)
+
+	bus := w.bus
+	w.mu.Unlock()
+
+	if bus != nil && oldStepID != stepID {
+		bus.PublishStepChange(oldStepID, stepID)
+	}
+
+	return nil
+}
+
 // DisableStep disables a step (it will be skipped).
 func (w *Workflow) DisableStep(stepID string) error {
 	w.mu.Lock()
@@ -486,6 +603,8 @@ func (w *Workflow) EnableStep(stepID string) error {
 
 // IsFirstStep returns true if current step is the first (non-disabled) step.
 func (w *Workflow) IsFirstStep() bool {
+	var warnings []string
+	defer func() { w.logWarnings(warnings) }()
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
@@ -495,7 +614,7 @@ func (w *Workflow) IsFirstStep() bool {
 
 	// Check if there's any non-disabled step before current
 	for i := 0; i < w.currentIdx; i++ {
-		if w.stepStatus[w.current.Steps[i].ID] != StepDisabled {
+		if !w.skipsStep(i, &warnings) {
 			return false
 		}
 	}
@@ -504,6 +623,8 @@ func (w *Workflow) IsFirstStep() bool {
 
 // CanGoBack returns true if navigation to a previous step is possible.
 func (w *Workflow) CanGoBack() bool {
+	var warnings []string
+	defer func() { w.logWarnings(warnings) }()
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
@@ -515,10 +636,10 @@ func (w *Workflow) CanGoBack() bool {
 		return false
 	}
 
-	return w.canGoBackUnlocked()
+	return w.canGoBackUnlocked(&warnings)
 }
 
-func (w *Workflow) canGoBackUnlocked() bool {
+func (w *Workflow) canGoBackUnlocked(warnings *[]string) bool {
 	if w.current == nil || w.currentIdx < 0 {
 		return false
 	}
@@ -526,7 +647,7 @@ func (w *Workflow) canGoBackUnlocked() bool {
 	// Keep the historical first-step behavior separate from the step-level
 	// allowBack gate so callers can report a precise error reason.
 	for i := 0; i < w.currentIdx; i++ {
-		if w.stepStatus[w.current.Steps[i].ID] != StepDisabled {
+		if !w.skipsStep(i, warnings) {
 			return true
 		}
 	}
@@ -535,6 +656,8 @@ func (w *Workflow) canGoBackUnlocked() bool {
 
 // IsLastStep returns true if current step is the last (non-disabled) step.
 func (w *Workflow) IsLastStep() bool {
+	var warnings []string
+	defer func() { w.logWarnings(warnings) }()
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
@@ -544,7 +667,7 @@ func (w *Workflow) IsLastStep() bool {
 
 	// Check if there's any non-disabled step after current
 	for i := w.currentIdx + 1; i < len(w.current.Steps); i++ {
-		if w.stepStatus[w.current.Steps[i].ID] != StepDisabled {
+		if !w.skipsStep(i, &warnings) {
 			return false
 		}
 	}
@@ -556,40 +679,88 @@ func (w *Workflow) IsComplete() bool {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	return w.ctx.Runtime.Completed
+	return w.ctx.completed()
 }
 
 // evaluateBranch evaluates a branch condition and returns the target step ID.
-func (w *Workflow) evaluateBranch(branch *BranchConfig) string {
-	// Simple implementation: check condition value in context
-	val, ok := w.ctx.Get(branch.Condition)
-	if !ok {
+// The value of the condition selects the branch; a plain context path works
+// as before, and boolean expressions select the "true" or "false" branch.
+// Problems are added to warnings, for logging once w.mu is released.
+func (w *Workflow) evaluateBranch(branch *BranchConfig, warnings *[]string) string {
+	if branch.Condition == "" {
+		return branch.Default
+	}
+	expr, err := compileExpression(branch.Condition)
+	if err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("Invalid branch condition: %v", err))
+		return branch.Default
+	}
+	val, err := expr.Eval(w.ctx)
+	if err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("Branch condition failed: %v", err))
+		return branch.Default
+	}
+	if val == nil {
 		return branch.Default
 	}
 
 	// Convert to string and look up in branches
-	valStr := fmt.Sprintf("%v", val)
-	if target, ok := branch.Branches[valStr]; ok {
+	if target, ok := branch.Branches[valueString(val)]; ok {
 		return target
 	}
 
 	return branch.Default
 }
 
-// Complete marks the workflow as completed.
-func (w *Workflow) Complete() {
+// skipsStep reports whether navigation passes over the step at idx because
+// it is disabled or its when: condition does not hold. Callers hold w.mu;
+// a condition that fails is added to warnings, for logging once it is
+// released.
+func (w *Workflow) skipsStep(idx int, warnings *[]string) bool {
+	step := w.current.Steps[idx]
+	if w.stepStatus[step.ID] == StepDisabled {
+		return true
+	}
+	when := step.When
+	if when == "" && step.Config != nil {
+		when = step.Config.When
+	}
+	run, err := EvalCondition(w.ctx, when)
+	if err != nil {
+		*warnings = append(*warnings, fmt.Sprintf("Step %s: %v", step.ID, err))
+		return false
+	}
+	return !run
+}
+
+// logWarnings logs what skipsStep and evaluateBranch reported. Logging
+// publishes on the bus, so callers must not hold w.mu.
+func (w *Workflow) logWarnings(warnings []string) {
+	for _, warning := range warnings {
+		w.ctx.AddLog(LogWarn, warning)
+	}
+}
+
+// Complete marks the workflow as completed and commits its transaction. The
+// error reports what the commit failed to purge; the flow is completed
+// nonetheless.
+func (w *Workflow) Complete() error {
 	w.mu.Lock()
 
 	if w.current != nil && w.currentIdx >= 0 {
 		w.stepStatus[w.current.Steps[w.currentIdx].ID] = StepCompleted
 	}
-	w.ctx.Runtime.Completed = true
+	w.ctx.setCompleted()
 
 	bus := w.bus
 	w.mu.Unlock()
 
+	// A completed flow is no longer rolled back
+	err := w.tx.Commit()
+
 	// Emit event after unlocking to avoid deadlocks in handlers.
 	if bus != nil {
 		bus.Publish(Event{Type: EventFlowComplete})
 	}
+	return err
 }
@@ -492,6 +492,63 @@ func TestWorkflowBranching(t *testing.T) {
 	}
 }
 
+func TestWorkflowBranchingExpression(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+
+	flow := &Flow{
+		ID:    "test",
+		Entry: "start",
+		Steps: []*Step{
+			{
+				ID:    "start",
+				Title: "Start",
+				Branch: &BranchConfig{
+					Condition: `semver(env.installedVersion) < "2.0"`,
+					Branches:  map[string]string{"true": "migrate"},
+					Default:   "finish",
+				},
+			},
+			{ID: "migrate", Title: "Migrate"},
+			{ID: "finish", Title: "Finish"},
+		},
+	}
+	w.AddFlow(flow)
+	w.SelectFlow("test")
+
+	ctx.Env.InstalledVersion = "1.9.3"
+	if stepID, _ := w.Next(); stepID != "migrate" {
+		t.Errorf("Expected 'migrate', got %s", stepID)
+	}
+
+	w.SelectFlow("test")
+	ctx.Env.InstalledVersion = "2.1.0"
+	if stepID, _ := w.Next(); stepID != "finish" {
+		t.Errorf("Expected 'finish', got %s", stepID)
+	}
+}
+
+func TestWorkflowStepWhen(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+
+	flow := createTestFlow()
+	flow.Steps[1].When = "!license_accepted"
+	flow.Steps[2].Config = &StepConfig{When: `install_type == "custom"`}
+	w.AddFlow(flow)
+	w.SelectFlow("install")
+
+	ctx.Set("license_accepted", true)
+	if stepID, _ := w.Next(); stepID != "install" {
+		t.Errorf("Expected 'install' (skipping license and destination), got %s", stepID)
+	}
+
+	ctx.Set("install_type", "custom")
+	if stepID, _ := w.Prev(); stepID != "destination" {
+		t.Errorf("Expected 'destination' once its condition holds, got %s", stepID)
+	}
+}
+
 func TestWorkflowExplicitNextPrev(t *testing.T) {
 	w := NewWorkflow(NewInstallContext(), NewEventBus())
 
@@ -560,3 +617,32 @@ func TestWorkflowSteps(t *testing.T) {
 		t.Errorf("Expected 5 steps, got %d", len(steps))
 	}
 }
+
+func TestWorkflowNavigationWhileTasksLog(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	w.AddFlow(createTestFlow())
+	w.SelectFlow("install")
+	runner := NewTaskRunner(ctx, nil)
+
+	// Runners log and journal from goroutines of their own
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = runner.stepID()
+			ctx.AddLog(LogInfo, "working")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		w.Next()
+		w.Prev()
+		w.JumpTo("welcome")
+	}
+	w.Complete()
+	<-done
+
+	if !w.IsComplete() {
+		t.Error("expected the workflow to be complete")
+	}
+}
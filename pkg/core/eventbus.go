@@ -2,7 +2,9 @@
 package core
 
 import (
+	"strings"
 	"sync"
+	"time"
 )
 
 // EventType represents the type of event.
@@ -11,6 +13,8 @@ type EventType string
 const (
 	// EventProgress is emitted when task progress changes.
 	EventProgress EventType = "progress"
+	// EventTaskProgress is emitted by a running task to report its own progress.
+	EventTaskProgress EventType = "task_progress"
 	// EventLog is emitted when a log message is added.
 	EventLog EventType = "log"
 	// EventStepChange is emitted when the current step changes.
@@ -19,18 +23,23 @@ const (
 	EventTaskStart EventType = "task_start"
 	// EventTaskComplete is emitted when a task completes.
 	EventTaskComplete EventType = "task_complete"
+	// EventTaskSkipped is emitted when a task is skipped because its when: condition is false.
+	EventTaskSkipped EventType = "task_skipped"
 	// EventTaskError is emitted when a task fails.
 	EventTaskError EventType = "task_error"
 	// EventStepFailure is emitted when a step fails.
 	EventStepFailure EventType = "step_failure"
 	// EventFlowComplete is emitted when the entire flow completes.
 	EventFlowComplete EventType = "flow_complete"
+	// EventContextChanged is emitted when Set or SetMeta changes a context value.
+	EventContextChanged EventType = "context_changed"
 )
 
 // Event represents an event in the system.
 type Event struct {
 	Type    EventType
 	Payload any
+	Time    time.Time // Set by Publish if zero
 }
 
 // ProgressPayload returns the payload as ProgressPayload, or nil.
@@ -88,17 +97,37 @@ func (e Event) StepFailurePayload() *StepFailurePayload {
 	return nil
 }
 
-// ProgressPayload contains progress update data.
+// ContextChangePayload returns the payload as ContextChangePayload, or nil.
+func (e Event) ContextChangePayload() *ContextChangePayload {
+	if p, ok := e.Payload.(*ContextChangePayload); ok {
+		return p
+	}
+	if p, ok := e.Payload.(ContextChangePayload); ok {
+		return &p
+	}
+	return nil
+}
+
+// ProgressPayload contains progress update data. For EventProgress it holds
+// the overall progress of the run; for EventTaskProgress the progress of a
+// single task, optionally in bytes.
 type ProgressPayload struct {
 	TaskID   string
 	Progress float64 // 0.0 to 1.0
 	Message  string
+	Current  int64         // Units done (e.g. bytes), if known
+	Total    int64         // Units expected, 0 if unknown
+	ETA      time.Duration // Estimated time left in the run, 0 if unknown
 }
 
 // LogPayload contains log event data.
 type LogPayload struct {
-	Level   LogLevel
-	Message string
+	Level    LogLevel
+	Message  string
+	Step     string // Step that logged the message, if known
+	TaskID   string // Task that logged the message, if known
+	TaskType string
+	Fields   map[string]any // Key/value details, if any
 }
 
 // StepChangePayload contains step change data.
@@ -119,50 +148,372 @@ type TaskPayload struct {
 	Error    error
 }
 
+// ContextChangePayload contains context change data. Old is nil when the
+// path had no value.
+type ContextChangePayload struct {
+	Path string
+	Old  any
+	New  any
+	Meta bool // The value is in Meta rather than UserInput
+}
+
+// Affects reports whether the change touches one of paths: the path itself,
+// a value inside it or a map containing it. Without paths every change
+// does.
+func (p ContextChangePayload) Affects(paths ...string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, path := range paths {
+		if path == p.Path || strings.HasPrefix(path, p.Path+".") || strings.HasPrefix(p.Path, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
 // EventHandler is a function that handles events.
 type EventHandler func(event Event)
 
+// OverflowPolicy decides what an asynchronous subscriber's queue does with a
+// new event when it is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the publisher wait until the queue has room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the new event.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued event to make room.
+	OverflowDropOldest
+)
+
+// DefaultAsyncBuffer is the queue size of asynchronous subscribers that do
+// not set one.
+const DefaultAsyncBuffer = 256
+
+// AsyncOptions configures an asynchronous subscription.
+type AsyncOptions struct {
+	Buffer   int            // Queue size; DefaultAsyncBuffer if 0
+	Overflow OverflowPolicy // What to do when the queue is full
+}
+
+// Subscription is the handle returned by Subscribe. Pass it to Unsubscribe
+// to stop receiving events.
+type Subscription struct {
+	id        uint64
+	eventType EventType          // Empty for SubscribeAll
+	types     map[EventType]bool // Types an all-events subscriber wants, all if nil
+	handler   EventHandler
+	queue     *eventQueue // Nil for synchronous subscribers
+	bus       *EventBus
+
+	// While history is replayed, live events wait in pending
+	mu        sync.Mutex
+	replaying bool
+	pending   []Event
+}
+
+// Unsubscribe stops delivery to the subscription. It is the same as
+// calling EventBus.Unsubscribe.
+func (s *Subscription) Unsubscribe() {
+	if s != nil && s.bus != nil {
+		s.bus.Unsubscribe(s)
+	}
+}
+
+// Dropped returns how many events an asynchronous subscription discarded
+// because its queue was full.
+func (s *Subscription) Dropped() int64 {
+	if s == nil || s.queue == nil {
+		return 0
+	}
+	s.queue.mu.Lock()
+	defer s.queue.mu.Unlock()
+	return s.queue.dropped
+}
+
+// deliver hands a live event to the subscriber, or holds it back until the
+// history replay has caught up.
+func (s *Subscription) deliver(event Event) {
+	if s.types != nil && !s.types[event.Type] {
+		return
+	}
+	s.mu.Lock()
+	if s.replaying {
+		s.pending = append(s.pending, event)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	s.dispatch(event)
+}
+
+// dispatch runs the handler or queues the event for it.
+func (s *Subscription) dispatch(event Event) {
+	if s.queue != nil {
+		s.queue.push(event)
+		return
+	}
+	s.handler(event)
+}
+
+// eventQueue feeds one asynchronous subscriber from its own goroutine, so
+// the subscriber sees events in the order they were published.
+type eventQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	events   []Event
+	size     int
+	overflow OverflowPolicy
+	busy     bool // The handler is running
+	closed   bool
+	dropped  int64
+}
+
+func newEventQueue(opts AsyncOptions) *eventQueue {
+	size := opts.Buffer
+	if size <= 0 {
+		size = DefaultAsyncBuffer
+	}
+	q := &eventQueue{size: size, overflow: opts.Overflow}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for !q.closed && len(q.events) >= q.size {
+		switch q.overflow {
+		case OverflowDropNewest:
+			q.dropped++
+			return
+		case OverflowDropOldest:
+			q.events = q.events[1:]
+			q.dropped++
+		default:
+			q.cond.Wait()
+		}
+	}
+	if q.closed {
+		return
+	}
+	q.events = append(q.events, event)
+	q.cond.Broadcast()
+}
+
+// run delivers queued events until the queue is closed.
+func (q *eventQueue) run(handler EventHandler) {
+	for {
+		q.mu.Lock()
+		for !q.closed && len(q.events) == 0 {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		event := q.events[0]
+		q.events = q.events[1:]
+		q.busy = true
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		handler(event)
+
+		q.mu.Lock()
+		q.busy = false
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// wait blocks until every queued event has been handled.
+func (q *eventQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && (len(q.events) > 0 || q.busy) {
+		q.cond.Wait()
+	}
+}
+
+// close discards queued events and stops the delivery goroutine.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.events = nil
+	q.cond.Broadcast()
+}
+
 // EventBus provides publish-subscribe functionality for events.
+//
+// Handlers run synchronously on the publishing goroutine unless they were
+// added with SubscribeAsync or SubscribeAllAsync, which give each subscriber
+// a buffered queue and a goroutine of its own. Either way a subscriber
+// receives the events published from one goroutine in order.
 type EventBus struct {
 	mu          sync.RWMutex
-	handlers    map[EventType][]EventHandler
-	allHandlers []EventHandler
+	handlers    map[EventType][]*Subscription
+	allHandlers []*Subscription
+	nextID      uint64
+	history     eventHistory
+	redactor    *Redactor
 }
 
-// NewEventBus creates a new EventBus.
+// NewEventBus creates a new EventBus that keeps the last
+// DefaultHistoryLimit events for late subscribers.
 func NewEventBus() *EventBus {
 	return &EventBus{
-		handlers:    make(map[EventType][]EventHandler),
-		allHandlers: make([]EventHandler, 0),
+		handlers:    make(map[EventType][]*Subscription),
+		allHandlers: make([]*Subscription, 0),
+		history:     newEventHistory(DefaultHistoryLimit),
 	}
 }
 
-// Subscribe registers a handler for a specific event type.
-func (eb *EventBus) Subscribe(eventType EventType, handler EventHandler) {
+// SetRedactor makes the bus scrub secrets from the messages and errors of
+// the events it publishes.
+func (eb *EventBus) SetRedactor(r *Redactor) {
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
+	eb.redactor = r
+}
 
-	eb.handlers[eventType] = append(eb.handlers[eventType], handler)
+// Subscribe registers a handler for a specific event type.
+func (eb *EventBus) Subscribe(eventType EventType, handler EventHandler) *Subscription {
+	return eb.add(&Subscription{eventType: eventType, handler: handler})
 }
 
 // SubscribeAll registers a handler for all event types.
-func (eb *EventBus) SubscribeAll(handler EventHandler) {
+func (eb *EventBus) SubscribeAll(handler EventHandler) *Subscription {
+	return eb.add(&Subscription{handler: handler})
+}
+
+// SubscribePaths registers a handler for EventContextChanged events that
+// affect one of paths, see ContextChangePayload.Affects.
+func (eb *EventBus) SubscribePaths(paths []string, handler EventHandler) *Subscription {
+	paths = append([]string(nil), paths...)
+	return eb.Subscribe(EventContextChanged, func(event Event) {
+		if p := event.ContextChangePayload(); p != nil && p.Affects(paths...) {
+			handler(event)
+		}
+	})
+}
+
+// SubscribeAsync registers a handler for a specific event type that runs on
+// its own goroutine, so a slow handler does not hold up the publisher.
+func (eb *EventBus) SubscribeAsync(eventType EventType, handler EventHandler, opts AsyncOptions) *Subscription {
+	return eb.add(&Subscription{eventType: eventType, handler: handler, queue: newEventQueue(opts)})
+}
+
+// SubscribeAllAsync registers a handler for all event types that runs on its
+// own goroutine.
+func (eb *EventBus) SubscribeAllAsync(handler EventHandler, opts AsyncOptions) *Subscription {
+	return eb.add(&Subscription{handler: handler, queue: newEventQueue(opts)})
+}
+
+func (eb *EventBus) add(sub *Subscription) *Subscription {
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
+	return eb.addUnlocked(sub)
+}
+
+func (eb *EventBus) addUnlocked(sub *Subscription) *Subscription {
+	eb.nextID++
+	sub.id = eb.nextID
+	sub.bus = eb
+	if sub.eventType == "" {
+		eb.allHandlers = append(eb.allHandlers, sub)
+	} else {
+		eb.handlers[sub.eventType] = append(eb.handlers[sub.eventType], sub)
+	}
+	if sub.queue != nil {
+		go sub.queue.run(sub.handler)
+	}
+	return sub
+}
+
+// Unsubscribe removes a subscription. Events queued for an asynchronous
+// subscriber that it has not handled yet are discarded. Unsubscribing twice
+// is harmless.
+func (eb *EventBus) Unsubscribe(sub *Subscription) {
+	if sub == nil {
+		return
+	}
 
-	eb.allHandlers = append(eb.allHandlers, handler)
+	eb.mu.Lock()
+	if sub.eventType == "" {
+		eb.allHandlers = removeSubscription(eb.allHandlers, sub)
+	} else {
+		eb.handlers[sub.eventType] = removeSubscription(eb.handlers[sub.eventType], sub)
+		if len(eb.handlers[sub.eventType]) == 0 {
+			delete(eb.handlers, sub.eventType)
+		}
+	}
+	eb.mu.Unlock()
+
+	if sub.queue != nil {
+		sub.queue.close()
+	}
 }
 
-// Publish sends an event to all registered handlers.
+// removeSubscription returns subs without sub, leaving the original slice
+// untouched for publishers iterating over it.
+func removeSubscription(subs []*Subscription, sub *Subscription) []*Subscription {
+	result := make([]*Subscription, 0, len(subs))
+	for _, s := range subs {
+		if s.id != sub.id {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Publish sends an event to all registered handlers and records it in the
+// history.
 func (eb *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	// Recording and collecting subscribers together means a replaying
+	// subscriber sees each event either in the history or live
+	eb.mu.Lock()
+	event.Payload = eb.redactor.redactPayload(event.Payload)
+	eb.history.add(event)
+	subs := make([]*Subscription, 0, len(eb.handlers[event.Type])+len(eb.allHandlers))
+	subs = append(subs, eb.handlers[event.Type]...)
+	subs = append(subs, eb.allHandlers...)
+	eb.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.deliver(event)
+	}
+}
+
+// Flush waits until the asynchronous subscribers have handled every event
+// published so far.
+func (eb *EventBus) Flush() {
 	eb.mu.RLock()
-	handlers := make([]EventHandler, 0, len(eb.handlers[event.Type])+len(eb.allHandlers))
-	handlers = append(handlers, eb.handlers[event.Type]...)
-	handlers = append(handlers, eb.allHandlers...)
+	var queues []*eventQueue
+	for _, subs := range eb.handlers {
+		for _, sub := range subs {
+			if sub.queue != nil {
+				queues = append(queues, sub.queue)
+			}
+		}
+	}
+	for _, sub := range eb.allHandlers {
+		if sub.queue != nil {
+			queues = append(queues, sub.queue)
+		}
+	}
 	eb.mu.RUnlock()
 
-	for _, handler := range handlers {
-		handler(event)
+	for _, q := range queues {
+		q.wait()
 	}
 }
 
@@ -178,6 +529,25 @@ func (eb *EventBus) PublishProgress(taskID string, progress float64, message str
 	})
 }
 
+// PublishTaskProgress is a convenience method for tasks reporting how many of
+// total units (usually bytes) they have processed.
+func (eb *EventBus) PublishTaskProgress(taskID string, current, total int64, message string) {
+	var progress float64
+	if total > 0 {
+		progress = float64(current) / float64(total)
+	}
+	eb.Publish(Event{
+		Type: EventTaskProgress,
+		Payload: ProgressPayload{
+			TaskID:   taskID,
+			Progress: progress,
+			Message:  message,
+			Current:  current,
+			Total:    total,
+		},
+	})
+}
+
 // PublishLog is a convenience method for publishing log events.
 func (eb *EventBus) PublishLog(level LogLevel, message string) {
 	eb.Publish(Event{
@@ -189,6 +559,22 @@ func (eb *EventBus) PublishLog(level LogLevel, message string) {
 	})
 }
 
+// PublishLogEntry publishes a structured log entry with its time.
+func (eb *EventBus) PublishLogEntry(entry LogEntry) {
+	eb.Publish(Event{
+		Type: EventLog,
+		Time: entry.Timestamp(),
+		Payload: LogPayload{
+			Level:    entry.Level,
+			Message:  entry.Message,
+			Step:     entry.Step,
+			TaskID:   entry.TaskID,
+			TaskType: entry.TaskType,
+			Fields:   entry.Fields,
+		},
+	})
+}
+
 // PublishStepChange is a convenience method for publishing step change events.
 func (eb *EventBus) PublishStepChange(from, to string) {
 	eb.Publish(Event{
@@ -232,6 +618,17 @@ func (eb *EventBus) PublishTaskComplete(taskID, taskType string) {
 	})
 }
 
+// PublishTaskSkipped is a convenience method for publishing task skipped events.
+func (eb *EventBus) PublishTaskSkipped(taskID, taskType string) {
+	eb.Publish(Event{
+		Type: EventTaskSkipped,
+		Payload: TaskPayload{
+			TaskID:   taskID,
+			TaskType: taskType,
+		},
+	})
+}
+
 // PublishTaskError is a convenience method for publishing task error events.
 func (eb *EventBus) PublishTaskError(taskID, taskType string, err error) {
 	eb.Publish(Event{
@@ -247,8 +644,18 @@ func (eb *EventBus) PublishTaskError(taskID, taskType string, err error) {
 // Clear removes all handlers.
 func (eb *EventBus) Clear() {
 	eb.mu.Lock()
-	defer eb.mu.Unlock()
-
-	eb.handlers = make(map[EventType][]EventHandler)
-	eb.allHandlers = make([]EventHandler, 0)
+	var subs []*Subscription
+	for _, typed := range eb.handlers {
+		subs = append(subs, typed...)
+	}
+	subs = append(subs, eb.allHandlers...)
+	eb.handlers = make(map[EventType][]*Subscription)
+	eb.allHandlers = make([]*Subscription, 0)
+	eb.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.queue != nil {
+			sub.queue.close()
+		}
+	}
 }
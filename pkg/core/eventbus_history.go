@@ -0,0 +1,128 @@
+// Package core provides the event history late subscribers can replay.
+package core
+
+import (
+	"time"
+)
+
+// DefaultHistoryLimit is how many recent events a new EventBus keeps.
+const DefaultHistoryLimit = 1000
+
+// eventHistory is a ring buffer of the most recent events.
+type eventHistory struct {
+	events []Event
+	start  int // Index of the oldest event
+	count  int
+}
+
+func newEventHistory(limit int) eventHistory {
+	if limit <= 0 {
+		return eventHistory{}
+	}
+	return eventHistory{events: make([]Event, limit)}
+}
+
+func (h *eventHistory) add(event Event) {
+	if len(h.events) == 0 {
+		return
+	}
+	if h.count < len(h.events) {
+		h.events[(h.start+h.count)%len(h.events)] = event
+		h.count++
+		return
+	}
+	h.events[h.start] = event
+	h.start = (h.start + 1) % len(h.events)
+}
+
+// list returns the recorded events, oldest first.
+func (h *eventHistory) list() []Event {
+	result := make([]Event, 0, h.count)
+	for i := 0; i < h.count; i++ {
+		result = append(result, h.events[(h.start+i)%len(h.events)])
+	}
+	return result
+}
+
+// SetHistoryLimit changes how many recent events the bus keeps, dropping the
+// oldest ones if it keeps fewer than before. A limit of 0 disables the
+// history.
+func (eb *EventBus) SetHistoryLimit(limit int) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	events := eb.history.list()
+	eb.history = newEventHistory(limit)
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	for _, event := range events {
+		eb.history.add(event)
+	}
+}
+
+// History returns the recorded events, oldest first.
+func (eb *EventBus) History() []Event {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	return eb.history.list()
+}
+
+// ReplayOptions selects the events a SubscribeReplay subscriber receives.
+type ReplayOptions struct {
+	Types []EventType // Event types to receive, all if empty
+	Since time.Time   // Skip history events older than this, if set
+	// Async delivers events as SubscribeAsync does; nil runs the handler on
+	// the publishing goroutine
+	Async *AsyncOptions
+}
+
+// SubscribeReplay registers a handler that first receives the recorded
+// events it would have seen had it subscribed earlier, then live events.
+// Live events published during the replay are held back until it is done,
+// so the handler sees every event once and in order. It suits subscribers
+// that attach mid-install, such as a screen opened late or a diagnostics
+// exporter.
+func (eb *EventBus) SubscribeReplay(handler EventHandler, opts ReplayOptions) *Subscription {
+	sub := &Subscription{handler: handler, replaying: true}
+	if len(opts.Types) > 0 {
+		sub.types = make(map[EventType]bool, len(opts.Types))
+		for _, eventType := range opts.Types {
+			sub.types[eventType] = true
+		}
+	}
+	if opts.Async != nil {
+		sub.queue = newEventQueue(*opts.Async)
+	}
+
+	eb.mu.Lock()
+	history := eb.history.list()
+	eb.addUnlocked(sub)
+	eb.mu.Unlock()
+
+	for _, event := range history {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		if !opts.Since.IsZero() && event.Time.Before(opts.Since) {
+			continue
+		}
+		sub.dispatch(event)
+	}
+
+	// Catch up with the events published meanwhile, then go live
+	for {
+		sub.mu.Lock()
+		pending := sub.pending
+		sub.pending = nil
+		if len(pending) == 0 {
+			sub.replaying = false
+			sub.mu.Unlock()
+			return sub
+		}
+		sub.mu.Unlock()
+		for _, event := range pending {
+			sub.dispatch(event)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusTimestampsEvents(t *testing.T) {
+	eb := NewEventBus()
+	var got Event
+	eb.Subscribe(EventLog, func(e Event) { got = e })
+
+	before := time.Now()
+	eb.PublishLog(LogInfo, "hello")
+	if got.Time.Before(before) || got.Time.After(time.Now()) {
+		t.Errorf("expected event time to be set, got %v", got.Time)
+	}
+
+	fixed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	eb.Publish(Event{Type: EventLog, Time: fixed})
+	if !got.Time.Equal(fixed) {
+		t.Errorf("expected explicit time to be kept, got %v", got.Time)
+	}
+}
+
+func TestEventBusHistoryLimit(t *testing.T) {
+	eb := NewEventBus()
+	eb.SetHistoryLimit(3)
+	for i := 0; i < 5; i++ {
+		eb.Publish(Event{Type: EventLog, Payload: i})
+	}
+
+	history := eb.History()
+	if len(history) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(history))
+	}
+	for i, e := range history {
+		if e.Payload != i+2 {
+			t.Errorf("expected the newest events oldest first, got %v at %d", e.Payload, i)
+		}
+	}
+
+	eb.SetHistoryLimit(2)
+	if history := eb.History(); len(history) != 2 || history[0].Payload != 3 {
+		t.Errorf("expected shrinking to keep the newest events, got %v", history)
+	}
+	eb.SetHistoryLimit(0)
+	eb.Publish(Event{Type: EventLog})
+	if len(eb.History()) != 0 {
+		t.Error("expected no history when disabled")
+	}
+}
+
+func TestEventBusSubscribeReplay(t *testing.T) {
+	eb := NewEventBus()
+	eb.Publish(Event{Type: EventLog, Payload: 0})
+	eb.Publish(Event{Type: EventProgress, Payload: "skip"})
+	eb.Publish(Event{Type: EventLog, Payload: 1})
+
+	var got []any
+	first := true
+	eb.SubscribeReplay(func(e Event) {
+		got = append(got, e.Payload)
+		// A live event published while history is replayed waits its turn
+		if first {
+			first = false
+			eb.Publish(Event{Type: EventLog, Payload: 2})
+		}
+	}, ReplayOptions{Types: []EventType{EventLog}})
+	eb.Publish(Event{Type: EventLog, Payload: 3})
+	eb.Publish(Event{Type: EventProgress, Payload: "skip"})
+
+	want := []any{0, 1, 2, 3}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestEventBusSubscribeReplayAsyncSince(t *testing.T) {
+	eb := NewEventBus()
+	old := time.Now().Add(-time.Hour)
+	eb.Publish(Event{Type: EventLog, Payload: "old", Time: old})
+	eb.Publish(Event{Type: EventLog, Payload: "recent"})
+
+	got := make(chan any, 10)
+	sub := eb.SubscribeReplay(func(e Event) {
+		got <- e.Payload
+	}, ReplayOptions{Since: time.Now().Add(-time.Minute), Async: &AsyncOptions{}})
+	defer sub.Unsubscribe()
+	eb.Publish(Event{Type: EventStepChange, Payload: "live"})
+	eb.Flush()
+
+	close(got)
+	var payloads []any
+	for p := range got {
+		payloads = append(payloads, p)
+	}
+	if len(payloads) != 2 || payloads[0] != "recent" || payloads[1] != "live" {
+		t.Errorf("expected recent history then live events, got %v", payloads)
+	}
+}
+
+func TestAddLogTimestamps(t *testing.T) {
+	ctx := NewInstallContext()
+	if ctx.Runtime.StartTime == 0 {
+		t.Error("expected start time to be set")
+	}
+	ctx.AddLog(LogInfo, "hello")
+	entry := ctx.Runtime.Logs[0]
+	if time.Since(entry.Timestamp()) > time.Minute {
+		t.Errorf("expected a current timestamp, got %v", entry.Timestamp())
+	}
+}
@@ -249,3 +249,128 @@ func TestEventBusThreadSafety(t *testing.T) {
 		t.Errorf("Expected at least 100 events handled, got %d", count)
 	}
 }
+
+func TestEventBusUnsubscribe(t *testing.T) {
+	eb := NewEventBus()
+	count := 0
+
+	sub := eb.Subscribe(EventProgress, func(event Event) {
+		count++
+	})
+	all := eb.SubscribeAll(func(event Event) {
+		count++
+	})
+
+	eb.Publish(Event{Type: EventProgress})
+	sub.Unsubscribe()
+	eb.Unsubscribe(all)
+	all.Unsubscribe() // Twice is harmless
+	eb.Publish(Event{Type: EventProgress})
+
+	if count != 2 {
+		t.Errorf("Expected 2 calls before unsubscribing, got %d", count)
+	}
+	if len(eb.handlers) != 0 || len(eb.allHandlers) != 0 {
+		t.Error("Expected no handlers left")
+	}
+}
+
+func TestEventBusAsyncOrdering(t *testing.T) {
+	eb := NewEventBus()
+	var mu sync.Mutex
+	var got []int
+	release := make(chan struct{})
+
+	eb.SubscribeAsync(EventLog, func(event Event) {
+		<-release
+		mu.Lock()
+		got = append(got, event.Payload.(int))
+		mu.Unlock()
+	}, AsyncOptions{Buffer: 100})
+
+	// Publishing must not wait for the blocked handler
+	for i := 0; i < 50; i++ {
+		eb.Publish(Event{Type: EventLog, Payload: i})
+	}
+	close(release)
+	eb.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 50 {
+		t.Fatalf("Expected 50 events, got %d", len(got))
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("Expected events in order, got %v", got)
+		}
+	}
+}
+
+func TestEventBusAsyncOverflow(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		want   []int
+	}{
+		{OverflowDropNewest, []int{0, 1, 2}},
+		{OverflowDropOldest, []int{0, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		eb := NewEventBus()
+		var mu sync.Mutex
+		var got []int
+		started := make(chan struct{}, 1)
+		release := make(chan struct{})
+
+		sub := eb.SubscribeAsync(EventLog, func(event Event) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			mu.Lock()
+			got = append(got, event.Payload.(int))
+			mu.Unlock()
+		}, AsyncOptions{Buffer: 2, Overflow: tt.policy})
+
+		// Event 0 is taken by the handler, 1 and 2 fill the queue
+		eb.Publish(Event{Type: EventLog, Payload: 0})
+		<-started
+		for i := 1; i < 6; i++ {
+			eb.Publish(Event{Type: EventLog, Payload: i})
+		}
+		close(release)
+		eb.Flush()
+
+		mu.Lock()
+		if len(got) != len(tt.want) {
+			t.Errorf("policy %d: expected %v, got %v", tt.policy, tt.want, got)
+		} else {
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("policy %d: expected %v, got %v", tt.policy, tt.want, got)
+					break
+				}
+			}
+		}
+		mu.Unlock()
+		if sub.Dropped() != 3 {
+			t.Errorf("policy %d: expected 3 dropped events, got %d", tt.policy, sub.Dropped())
+		}
+		sub.Unsubscribe()
+	}
+}
+
+func TestTaskRunnerReleasesProgressSubscription(t *testing.T) {
+	eb := NewEventBus()
+	runner := NewTaskRunner(NewInstallContext(), eb)
+	runner.AddTask(NewMockTask("a", "mock"))
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(eb.handlers[EventTaskProgress]) != 0 {
+		t.Error("Expected the runner to unsubscribe once it finished")
+	}
+}
@@ -0,0 +1,746 @@
+// Package core provides the expression language used by conditions,
+// branches and guards.
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Expression is a parsed condition such as
+//
+//	install_type == "full" && !portable
+//	"desktop_shortcut" in install_options
+//	semver(env.installedVersion) < "2.0.0" || !exists(env.installedVersion)
+//
+// Operands are context paths (optionally written ${path}), quoted strings,
+// numbers, true, false, null and [lists]. Operators, loosest first: ||, &&,
+// !, then == != < <= > >= in contains matches =~ !~. Functions: exists(path),
+// len(x), semver(x), lower(x), upper(x), startsWith(s, prefix) and
+// endsWith(s, suffix). Missing paths evaluate to null, which compares equal
+// to "". Expressions cannot call out of the context or modify it.
+type Expression struct {
+	src  string
+	root exprNode
+}
+
+// ParseExpression parses an expression, reporting syntax errors with their
+// position.
+func ParseExpression(src string) (*Expression, error) {
+	p := &exprParser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, fmt.Errorf("expression %q: %w", src, err)
+	}
+	if len(p.tokens) == 1 {
+		return nil, fmt.Errorf("expression %q: empty expression", src)
+	}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("unexpected %s", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", src, err)
+	}
+	return &Expression{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against the context and returns its value.
+func (e *Expression) Eval(ctx *InstallContext) (any, error) {
+	val, err := e.root.eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", e.src, err)
+	}
+	return val, nil
+}
+
+// EvalBool evaluates the expression and reports whether its value is truthy.
+func (e *Expression) EvalBool(ctx *InstallContext) (bool, error) {
+	val, err := e.Eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	return truthy(val), nil
+}
+
+// expressionCache holds parsed expressions by source, since the same
+// conditions are evaluated on every navigation and task run.
+var expressionCache sync.Map
+
+// compileExpression parses src, reusing an earlier parse of the same source.
+func compileExpression(src string) (*Expression, error) {
+	if cached, ok := expressionCache.Load(src); ok {
+		return cached.(*Expression), nil
+	}
+	expr, err := ParseExpression(src)
+	if err != nil {
+		return nil, err
+	}
+	expressionCache.Store(src, expr)
+	return expr, nil
+}
+
+// --- Lexer ---
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// exprOperators lists symbolic operators, longest first.
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", "[", "]", ","}
+
+type exprParser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated string at position %d", i)
+			}
+			p.tokens = append(p.tokens, token{kind: tokString, text: b.String(), pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			if _, err := strconv.ParseFloat(s[i:j], 64); err != nil {
+				return fmt.Errorf("invalid number %q at position %d", s[i:j], i)
+			}
+			p.tokens = append(p.tokens, token{kind: tokNumber, text: s[i:j], pos: i})
+			i = j
+		case c == '$' && strings.HasPrefix(s[i:], "${"):
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return fmt.Errorf("unterminated ${ at position %d", i)
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: strings.TrimSpace(s[i+2 : i+end]), pos: i})
+			i += end + 1
+		case isIdentByte(c, true):
+			j := i + 1
+			for j < len(s) && isIdentByte(s[j], false) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokEOF, pos: len(s)})
+	return nil
+}
+
+func isIdentByte(c byte, first bool) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' {
+		return true
+	}
+	return !first && (c >= '0' && c <= '9' || c == '.' || c == '-')
+}
+
+// --- Parser ---
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator or keyword.
+func (p *exprParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokOp || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q, got %s", text, p.peek())
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf(format+" at position %d", append(args, p.peek().pos)...)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right exprNode
+		if right, err = p.parseAnd(); err == nil {
+			left = &logicalNode{or: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.accept("&&") {
+		var right exprNode
+		if right, err = p.parseUnary(); err == nil {
+			left = &logicalNode{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+// comparisonOps are the binary operators that compare two operands.
+var comparisonOps = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"=~": true, "!~": true, "in": true, "contains": true, "matches": true,
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if (t.kind != tokOp && t.kind != tokIdent) || !comparisonOps[t.text] {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); (next.kind == tokOp || next.kind == tokIdent) && comparisonOps[next.text] {
+		return nil, p.errorf("chained comparison %q", next.text)
+	}
+
+	node := &compareNode{op: t.text, left: left, right: right}
+	if node.op == "matches" || node.op == "=~" || node.op == "!~" {
+		if lit, ok := right.(*literalNode); ok {
+			pattern, _ := lit.value.(string)
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q at position %d: %w", pattern, t.pos, err)
+			}
+			node.re = re
+		}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return &literalNode{value: t.text}, nil
+	case tokNumber:
+		n, _ := strconv.ParseFloat(t.text, 64)
+		return &literalNode{value: n}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		if comparisonOps[t.text] {
+			p.pos--
+			return nil, p.errorf("expected operand, got %s", t)
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		return &pathNode{path: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		case "[":
+			list := &listNode{}
+			for !p.accept("]") {
+				if len(list.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+	}
+	p.pos--
+	return nil, p.errorf("expected operand, got %s", t)
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+
+	call := &callNode{name: name.text, fn: fn}
+	for !p.accept(")") {
+		if len(call.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+
+	if len(call.args) != fn.arity {
+		return nil, fmt.Errorf("%s() takes %d argument(s), got %d at position %d", name.text, fn.arity, len(call.args), name.pos)
+	}
+	if name.text == "exists" {
+		if _, ok := call.args[0].(*pathNode); !ok {
+			return nil, fmt.Errorf("exists() takes a context path at position %d", name.pos)
+		}
+	}
+	return call, nil
+}
+
+// --- Evaluation ---
+
+type exprNode interface {
+	eval(ctx *InstallContext) (any, error)
+}
+
+type literalNode struct{ value any }
+
+func (n *literalNode) eval(*InstallContext) (any, error) { return n.value, nil }
+
+type pathNode struct{ path string }
+
+func (n *pathNode) eval(ctx *InstallContext) (any, error) {
+	val, _ := ctx.Get(n.path)
+	return val, nil
+}
+
+type listNode struct{ items []exprNode }
+
+func (n *listNode) eval(ctx *InstallContext) (any, error) {
+	values := make([]any, len(n.items))
+	for i, item := range n.items {
+		val, err := item.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+type notNode struct{ operand exprNode }
+
+func (n *notNode) eval(ctx *InstallContext) (any, error) {
+	val, err := n.operand.eval(ctx)
+	return !truthy(val), err
+}
+
+type logicalNode struct {
+	or          bool
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(ctx *InstallContext) (any, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	if truthy(left) == n.or {
+		return n.or, nil
+	}
+	right, err := n.right.eval(ctx)
+	return truthy(right), err
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+	re          *regexp.Regexp // Precompiled pattern for literal regexes
+}
+
+func (n *compareNode) eval(ctx *InstallContext) (any, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right)
+	case "!=":
+		equal, err := valuesEqual(left, right)
+		return !equal, err
+	case "in":
+		return contains(right, left), nil
+	case "contains":
+		if s, ok := left.(string); ok {
+			return strings.Contains(s, valueString(right)), nil
+		}
+		return contains(left, right), nil
+	case "matches", "=~", "!~":
+		re := n.re
+		if re == nil {
+			if re, err = regexp.Compile(valueString(right)); err != nil {
+				return false, fmt.Errorf("invalid pattern: %w", err)
+			}
+		}
+		return re.MatchString(valueString(left)) == (n.op != "!~"), nil
+	}
+
+	cmp, err := compareValues(left, right)
+	if err != nil {
+		return false, err
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   exprFunc
+	args []exprNode
+}
+
+func (n *callNode) eval(ctx *InstallContext) (any, error) {
+	if n.name == "exists" {
+		_, ok := ctx.Get(n.args[0].(*pathNode).path)
+		return ok, nil
+	}
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		val, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	val, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return val, nil
+}
+
+type exprFunc struct {
+	arity int
+	call  func(args []any) (any, error)
+}
+
+var exprFuncs = map[string]exprFunc{
+	"exists": {arity: 1}, // Evaluated by callNode, which needs the path itself
+	"len": {arity: 1, call: func(args []any) (any, error) {
+		if s, ok := args[0].(string); ok {
+			return float64(len(s)), nil
+		}
+		if args[0] == nil {
+			return float64(0), nil
+		}
+		rv := reflect.ValueOf(args[0])
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return float64(rv.Len()), nil
+		}
+		return nil, fmt.Errorf("%T has no length", args[0])
+	}},
+	"semver": {arity: 1, call: func(args []any) (any, error) {
+		return parseSemver(valueString(args[0]))
+	}},
+	"lower": {arity: 1, call: func(args []any) (any, error) {
+		return strings.ToLower(valueString(args[0])), nil
+	}},
+	"upper": {arity: 1, call: func(args []any) (any, error) {
+		return strings.ToUpper(valueString(args[0])), nil
+	}},
+	"startsWith": {arity: 2, call: func(args []any) (any, error) {
+		return strings.HasPrefix(valueString(args[0]), valueString(args[1])), nil
+	}},
+	"endsWith": {arity: 2, call: func(args []any) (any, error) {
+		return strings.HasSuffix(valueString(args[0]), valueString(args[1])), nil
+	}},
+}
+
+// valueString formats a value for string operations; null is "".
+func valueString(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case Secret:
+		return v.Reveal()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(val)
+}
+
+// toNumber converts numbers and numeric strings to float64.
+func toNumber(val any) (float64, bool) {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		n, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func isNumber(val any) bool {
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// valuesEqual compares as versions if either side is a semver() value, as
+// numbers if either side is a number, and as strings otherwise.
+func valuesEqual(a, b any) (bool, error) {
+	if isSemver(a) || isSemver(b) {
+		cmp, err := compareValues(a, b)
+		return cmp == 0, err
+	}
+	if isNumber(a) || isNumber(b) {
+		x, okA := toNumber(a)
+		y, okB := toNumber(b)
+		if okA && okB {
+			return x == y, nil
+		}
+	}
+	return valueString(a) == valueString(b), nil
+}
+
+// compareValues orders two values as versions if either side is a semver()
+// value, as numbers if both sides are numeric, and as strings otherwise.
+func compareValues(a, b any) (int, error) {
+	if isSemver(a) || isSemver(b) {
+		x, err := asSemver(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := asSemver(b)
+		if err != nil {
+			return 0, err
+		}
+		return x.compare(y), nil
+	}
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return strings.Compare(valueString(a), valueString(b)), nil
+}
+
+// semVersion is a parsed semantic version such as 1.2.3-rc.1.
+type semVersion struct {
+	parts      []int
+	prerelease []string
+}
+
+// parseSemver parses a version like "v1.2", "1.2.3" or "2.0.0-beta.1+build".
+// Missing minor and patch numbers count as zero.
+func parseSemver(s string) (semVersion, error) {
+	raw := s
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	var v semVersion
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semVersion{}, fmt.Errorf("invalid version %q", raw)
+		}
+		v.parts = append(v.parts, n)
+	}
+	return v, nil
+}
+
+func isSemver(val any) bool {
+	_, ok := val.(semVersion)
+	return ok
+}
+
+func asSemver(val any) (semVersion, error) {
+	if v, ok := val.(semVersion); ok {
+		return v, nil
+	}
+	return parseSemver(valueString(val))
+}
+
+func (v semVersion) compare(o semVersion) int {
+	for i := 0; i < max(len(v.parts), len(o.parts)); i++ {
+		var a, b int
+		if i < len(v.parts) {
+			a = v.parts[i]
+		}
+		if i < len(o.parts) {
+			b = o.parts[i]
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A pre-release sorts before the release itself
+	switch {
+	case len(v.prerelease) == 0 && len(o.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(o.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < min(len(v.prerelease), len(o.prerelease)); i++ {
+		a, b := v.prerelease[i], o.prerelease[i]
+		if a == b {
+			continue
+		}
+		x, errA := strconv.Atoi(a)
+		y, errB := strconv.Atoi(b)
+		if errA == nil && errB == nil {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	}
+	return len(v.prerelease) - len(o.prerelease)
+}
+
+func (v semVersion) String() string {
+	parts := make([]string, len(v.parts))
+	for i, n := range v.parts {
+		parts[i] = strconv.Itoa(n)
+	}
+	s := strings.Join(parts, ".")
+	if len(v.prerelease) > 0 {
+		s += "-" + strings.Join(v.prerelease, ".")
+	}
+	return s
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpressionEval(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Set("port", "8080")
+	ctx.Set("plugins", []string{"git", "docker"})
+	ctx.Set("name", "My App")
+	ctx.Set("empty", "")
+	ctx.Env.InstalledVersion = "1.10.2"
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`port == 8080`, true},
+		{`port == "8080.0"`, false},
+		{`port > 1024 && port <= 65535`, true},
+		{`"9" < "10"`, true},
+		{`"b" > "a"`, true},
+		{`!(port == 8080) || false`, false},
+		{`"git" in plugins`, true},
+		{`"svn" in ["git", "hg"]`, false},
+		{`plugins contains "docker"`, true},
+		{`name contains "App"`, true},
+		{`name matches "^My"`, true},
+		{`name =~ "^my"`, false},
+		{`name !~ "^my"`, true},
+		{`lower(name) == "my app"`, true},
+		{`startsWith(upper(name), "MY") && endsWith(name, "App")`, true},
+		{`exists(port) && !exists(missing)`, true},
+		{`exists(empty)`, true},
+		{`len(plugins) == 2 && len(name) > 3 && len(missing) == 0`, true},
+		{`missing == ""`, true},
+		{`missing == null`, true},
+		{`${port} == 8080`, true},
+		{`semver(env.installedVersion) > "1.9.0"`, true},
+		{`semver(env.installedVersion) < "1.10.10"`, true},
+		{`semver("v2.0") == "2.0.0"`, true},
+		{`semver("2.0.0-rc.1") < "2.0.0"`, true},
+		{`semver("2.0.0-rc.2") > "2.0.0-rc.10"`, false},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseExpression(tt.expr)
+		if err != nil {
+			t.Errorf("ParseExpression(%q) error: %v", tt.expr, err)
+			continue
+		}
+		got, err := expr.EvalBool(ctx)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{``, "empty expression"},
+		{`a ==`, "expected operand"},
+		{`a == "b`, "unterminated string"},
+		{`(a || b`, `expected ")"`},
+		{`a # b`, "unexpected character"},
+		{`size(a) > 1`, `unknown function "size"`},
+		{`len(a, b)`, "takes 1 argument"},
+		{`exists("a")`, "takes a context path"},
+		{`a matches "("`, "invalid pattern"},
+		{`a b`, `unexpected "b"`},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseExpression(tt.expr)
+		if err == nil {
+			t.Errorf("ParseExpression(%q): expected error", tt.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseExpression(%q) error = %v, want it to mention %q", tt.expr, err, tt.want)
+		}
+	}
+
+	expr, _ := ParseExpression(`semver(version) > "1.0"`)
+	ctx := NewInstallContext()
+	ctx.Set("version", "not-a-version")
+	if _, err := expr.Eval(ctx); err == nil {
+		t.Error("expected error for invalid version")
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	cfg := &Config{Flows: map[string]*FlowConfig{
+		"install": {Steps: []*StepConfig{{
+			ID:     "welcome",
+			When:   "first_run",
+			Branch: &BranchConfig{Condition: `install_type ==`},
+			Guards: []map[string]any{{"type": "expression", "expression": "a &&"}},
+			Tasks:  []TaskConfig{{Type: "shell", When: `"${item}" != "x"`, ForEach: "items"}},
+			Screen: &ScreenConfig{Type: "form", Fields: []FieldConfig{
+				{Variable: "use_proxy", Type: "checkbox"},
+				{Variable: "proxy", When: "use_proxy ==", Type: "text"},
+			}},
+		}}},
+	}}
+
+	err := ValidateConditions(cfg)
+	if err == nil {
+		t.Fatal("expected errors for invalid conditions")
+	}
+	for _, want := range []string{"step welcome branch", "step welcome guard", "step welcome field proxy when"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "welcome when") || strings.Contains(err.Error(), "(shell) when") {
+		t.Errorf("expected valid when conditions to pass, got %v", err)
+	}
+}
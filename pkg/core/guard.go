@@ -114,11 +114,15 @@ func (g *FieldNotEmptyGuard) Check(ctx *InstallContext) error {
 	return nil
 }
 
-// ExpressionGuard evaluates a simple expression.
+// ExpressionGuard passes when an expression holds, e.g.
+// `semver(env.installedVersion) < "2.0.0"`. With an expected value it
+// instead compares the value of the expression with expected.
 type ExpressionGuard struct {
 	Expression string
 	Expected   any
 	Msg        string
+
+	compiled *Expression
 }
 
 // NewExpressionGuard creates an ExpressionGuard from config.
@@ -128,29 +132,50 @@ func NewExpressionGuard(config map[string]any) (Guard, error) {
 		return nil, errors.New("expression guard requires 'expression' property")
 	}
 
-	expected, ok := config["expected"]
-	if !ok {
-		expected = true // Default: expression field should be truthy
+	compiled, err := compileExpression(expr)
+	if err != nil {
+		return nil, err
 	}
 
+	// Without expected, the expression itself should be truthy
+	expected := config["expected"]
+
 	msg := "Condition not met"
 	if m, ok := config["message"].(string); ok && m != "" {
 		msg = m
 	}
 
-	return &ExpressionGuard{Expression: expr, Expected: expected, Msg: msg}, nil
+	return &ExpressionGuard{Expression: expr, Expected: expected, Msg: msg, compiled: compiled}, nil
 }
 
 func (g *ExpressionGuard) Type() string    { return "expression" }
 func (g *ExpressionGuard) Message() string { return g.Msg }
 
 func (g *ExpressionGuard) Check(ctx *InstallContext) error {
-	val, ok := ctx.Get(g.Expression)
-	if !ok {
-		return fmt.Errorf("%s (field not found: %s)", g.Msg, g.Expression)
+	compiled := g.compiled
+	if compiled == nil {
+		var err error
+		if compiled, err = compileExpression(g.Expression); err != nil {
+			return fmt.Errorf("%s (%v)", g.Msg, err)
+		}
+	}
+
+	val, err := compiled.Eval(ctx)
+	if err != nil {
+		return fmt.Errorf("%s (%v)", g.Msg, err)
 	}
 
-	if fmt.Sprintf("%v", val) != fmt.Sprintf("%v", g.Expected) {
+	if g.Expected == nil {
+		if !truthy(val) {
+			return errors.New(g.Msg)
+		}
+		return nil
+	}
+
+	if val == nil {
+		return fmt.Errorf("%s (field not found: %s)", g.Msg, g.Expression)
+	}
+	if equal, err := valuesEqual(val, g.Expected); err != nil || !equal {
 		return errors.New(g.Msg)
 	}
 	return nil
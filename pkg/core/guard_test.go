@@ -280,6 +280,31 @@ func TestExpressionGuardFieldNotFound(t *testing.T) {
 	}
 }
 
+func TestExpressionGuardFullExpression(t *testing.T) {
+	guard, err := NewExpressionGuard(map[string]any{
+		"expression": `env.diskFreeMB >= 500 && env.distro in ["ubuntu", "debian"]`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create guard: %v", err)
+	}
+
+	ctx := NewInstallContext()
+	ctx.Env.DiskFreeMB = 1024
+	ctx.Env.Distro = "fedora"
+	if err := guard.Check(ctx); err == nil {
+		t.Error("Guard should fail on an unsupported distro")
+	}
+
+	ctx.Env.Distro = "debian"
+	if err := guard.Check(ctx); err != nil {
+		t.Errorf("Guard should pass: %v", err)
+	}
+
+	if _, err := NewExpressionGuard(map[string]any{"expression": "a &&"}); err == nil {
+		t.Error("Should error when the expression does not parse")
+	}
+}
+
 func TestExpressionGuardMissingExpression(t *testing.T) {
 	_, err := NewExpressionGuard(map[string]any{})
 	if err == nil {
@@ -0,0 +1,464 @@
+// Package core provides the persistent install journal used for crash recovery.
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalKind identifies the type of a journal record.
+type JournalKind string
+
+const (
+	// JournalSessionStart opens a new installation session.
+	JournalSessionStart JournalKind = "session_start"
+	// JournalTaskStart is written before a task executes.
+	JournalTaskStart JournalKind = "task_start"
+	// JournalTaskFinish is written after a task succeeds, with its rollback data.
+	JournalTaskFinish JournalKind = "task_finish"
+	// JournalTaskFailed is written when a task fails.
+	JournalTaskFailed JournalKind = "task_failed"
+	// JournalTaskRollback is written after a task has been rolled back.
+	JournalTaskRollback JournalKind = "task_rollback"
+	// JournalSessionEnd closes the session; its absence marks an interrupted run.
+	JournalSessionEnd JournalKind = "session_end"
+)
+
+// Session end statuses.
+const (
+	SessionCompleted  = "completed"
+	SessionCancelled  = "cancelled"
+	SessionFailed     = "failed"
+	SessionRolledBack = "rolled_back"
+)
+
+// Recovery choices for an interrupted session.
+const (
+	RecoverRollback = "rollback" // Undo the completed tasks, then start over
+	RecoverResume   = "resume"   // Continue from the interrupted task
+	RecoverIgnore   = "ignore"   // Discard the journal and start over
+)
+
+// ParseRecoverMode validates a recovery choice; empty means "ask the user".
+func ParseRecoverMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", RecoverRollback, RecoverResume, RecoverIgnore:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown recovery mode: %q", value)
+	}
+}
+
+// JournalEntry is a single line of the journal file.
+type JournalEntry struct {
+	Time     time.Time      `json:"time"`
+	Kind     JournalKind    `json:"kind"`
+	Flow     string         `json:"flow,omitempty"`
+	Step     string         `json:"step,omitempty"`
+	Key      string         `json:"key,omitempty"`
+	TaskID   string         `json:"taskId,omitempty"`
+	TaskType string         `json:"taskType,omitempty"`
+	Config   map[string]any `json:"config,omitempty"`
+	State    map[string]any `json:"state,omitempty"`
+	Input    map[string]any `json:"input,omitempty"`
+	Status   string         `json:"status,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// JournaledTask is implemented by tasks whose rollback data must survive a
+// process restart. Tasks that only need their configuration to roll back
+// (for example a shell task with a rollback command) do not need it.
+type JournaledTask interface {
+	// RollbackState returns the data Rollback needs; it must be JSON encodable.
+	RollbackState() map[string]any
+	// RestoreRollbackState reloads data captured by RollbackState.
+	RestoreRollbackState(state map[string]any) error
+}
+
+// Journal is a write-ahead log of task execution stored as JSON lines.
+// Every record is synced to disk before the corresponding work starts or is
+// reported complete, so an interrupted session can be rolled back or resumed.
+type Journal struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	resume map[string]JournalEntry // key -> task_finish entry from a resumed session
+}
+
+// OpenJournal opens (or creates) a journal file without truncating it.
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: path, file: file}, nil
+}
+
+// Path returns the journal file path.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Begin truncates the journal and starts a new session for the given flow.
+func (j *Journal) Begin(flowID string, input map[string]any) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.truncateUnlocked(); err != nil {
+		return err
+	}
+	j.resume = nil
+	return j.writeUnlocked(JournalEntry{Kind: JournalSessionStart, Flow: flowID, Input: input})
+}
+
+// Resume starts a new session that continues an interrupted one. Tasks that
+// finished in the previous session are carried over so that a second crash
+// still knows about them, and the runner skips them instead of re-executing.
+func (j *Journal) Resume(state *JournalState) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.carryOverUnlocked(state, "resumed"); err != nil {
+		return err
+	}
+	j.resume = make(map[string]JournalEntry)
+	for _, entry := range state.CompletedTasks() {
+		j.resume[entry.Key] = entry
+	}
+	return nil
+}
+
+// Continue starts a new session that carries on a session of another
+// process, such as the run that re-executed the installer with privileges.
+// Tasks that finished are carried over like Resume does, but the runner
+// does not skip them: the flow continues past their steps, and
+// Transaction.Continue takes over their rollback.
+func (j *Journal) Continue(state *JournalState) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.resume = nil
+	return j.carryOverUnlocked(state, "continued")
+}
+
+// carryOverUnlocked truncates the journal and starts a session with the
+// finished tasks of state. Callers hold j.mu.
+func (j *Journal) carryOverUnlocked(state *JournalState, status string) error {
+	if err := j.truncateUnlocked(); err != nil {
+		return err
+	}
+	if err := j.writeUnlocked(JournalEntry{Kind: JournalSessionStart, Flow: state.Flow, Input: state.Input, Status: status}); err != nil {
+		return err
+	}
+	for _, entry := range state.CompletedTasks() {
+		if err := j.writeUnlocked(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record appends an entry and syncs it to disk.
+func (j *Journal) Record(entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.writeUnlocked(entry)
+}
+
+// End closes the current session with the given status.
+func (j *Journal) End(status string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.resume = nil
+	return j.writeUnlocked(JournalEntry{Kind: JournalSessionEnd, Status: status})
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// resumed returns the finished entry for a task key carried over by Resume.
+func (j *Journal) resumed(key string) (JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.resume[key]
+	if ok {
+		// A task is only skipped once; re-queuing it later runs it normally.
+		delete(j.resume, key)
+	}
+	return entry, ok
+}
+
+func (j *Journal) truncateUnlocked() error {
+	if j.file == nil {
+		return errors.New("journal is closed")
+	}
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := j.file.Seek(0, 0)
+	return err
+}
+
+func (j *Journal) writeUnlocked(entry JournalEntry) error {
+	if j.file == nil {
+		return errors.New("journal is closed")
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	data = append(data, '\n')
+	if _, err := j.file.Write(data); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// JournalState is the parsed content of a journal file.
+type JournalState struct {
+	Flow    string
+	Step    string         // Step of the last task that was started
+	Input   map[string]any // Last recorded user input
+	Status  string         // Session end status, empty if the session never ended
+	Entries []JournalEntry
+}
+
+// ReadJournal parses a journal file. A missing file yields an empty state.
+func ReadJournal(path string) (*JournalState, error) {
+	state := &JournalState{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn final write is expected after a crash; keep what we have.
+			break
+		}
+		state.apply(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *JournalState) apply(entry JournalEntry) {
+	s.Entries = append(s.Entries, entry)
+	switch entry.Kind {
+	case JournalSessionStart:
+		s.Flow = entry.Flow
+		s.Status = ""
+		if entry.Input != nil {
+			s.Input = entry.Input
+		}
+	case JournalTaskStart:
+		s.Step = entry.Step
+		if entry.Input != nil {
+			s.Input = entry.Input
+		}
+	case JournalSessionEnd:
+		s.Status = entry.Status
+	}
+}
+
+// Interrupted reports whether the last session started work but never ended.
+func (s *JournalState) Interrupted() bool {
+	if s == nil || s.Status != "" {
+		return false
+	}
+	for _, entry := range s.Entries {
+		if entry.Kind == JournalTaskStart {
+			return true
+		}
+	}
+	return false
+}
+
+// CompletedTasks returns the task_finish entries that have not been rolled
+// back, in execution order.
+func (s *JournalState) CompletedTasks() []JournalEntry {
+	rolledBack := make(map[string]bool)
+	for _, entry := range s.Entries {
+		if entry.Kind == JournalTaskRollback {
+			rolledBack[entry.Key] = true
+		}
+	}
+
+	var result []JournalEntry
+	for _, entry := range s.Entries {
+		if entry.Kind == JournalTaskFinish && !rolledBack[entry.Key] {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// FailedTask returns the last task that started but did not finish, if any.
+func (s *JournalState) FailedTask() *JournalEntry {
+	finished := make(map[string]bool)
+	for _, entry := range s.Entries {
+		if entry.Kind == JournalTaskFinish {
+			finished[entry.Key] = true
+		}
+	}
+
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		entry := s.Entries[i]
+		if entry.Kind == JournalTaskStart && !finished[entry.Key] {
+			return &entry
+		}
+	}
+	return nil
+}
+
+// Rollback undoes every completed task of the interrupted session in reverse
+// order and records the outcome in the journal (if non-nil).
+func (s *JournalState) Rollback(ctx *InstallContext, bus *EventBus, journal *Journal) error {
+	completed := s.CompletedTasks()
+	ctx.AddLog(LogInfo, fmt.Sprintf("Recovering interrupted session: rolling back %d tasks", len(completed)))
+
+	if failed := s.FailedTask(); failed != nil {
+		ctx.AddLog(LogWarn, fmt.Sprintf("Task %s was interrupted and may have left partial changes", failed.TaskID))
+	}
+
+	var errs []error
+	for i := len(completed) - 1; i >= 0; i-- {
+		entry := completed[i]
+		task, err := restoreJournaledTask(entry, ctx)
+		if err != nil {
+			ctx.AddLog(LogError, fmt.Sprintf("Cannot restore task %s for rollback: %v", entry.TaskID, err))
+			errs = append(errs, err)
+			continue
+		}
+		if !task.CanRollback() {
+			continue
+		}
+
+		ctx.AddLog(LogInfo, fmt.Sprintf("Rolling back: %s", entry.TaskID))
+		if err := task.Rollback(ctx, bus); err != nil {
+			ctx.AddLog(LogError, fmt.Sprintf("Rollback failed for %s: %v", entry.TaskID, err))
+			errs = append(errs, err)
+			continue
+		}
+
+		if journal != nil {
+			_ = journal.Record(JournalEntry{
+				Kind:     JournalTaskRollback,
+				Flow:     entry.Flow,
+				Step:     entry.Step,
+				Key:      entry.Key,
+				TaskID:   entry.TaskID,
+				TaskType: entry.TaskType,
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("recovery rollback incomplete: %w", errors.Join(errs...))
+	}
+	if journal != nil {
+		return journal.End(SessionRolledBack)
+	}
+	return nil
+}
+
+// restoreJournaledTask recreates a task from its journaled config and state.
+func restoreJournaledTask(entry JournalEntry, ctx *InstallContext) (Task, error) {
+	typeName, _ := entry.Config["type"].(string)
+	if typeName == "" {
+		typeName = entry.TaskType
+	}
+
+	factory, ok := Tasks.Get(typeName)
+	if !ok && IsGoExtension(typeName) {
+		factory, ok = Tasks.Get(StripGoPrefix(typeName))
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown task type: %s", typeName)
+	}
+
+	params := make(map[string]any, len(entry.Config))
+	for k, v := range entry.Config {
+		params[k] = v
+	}
+	params["type"] = typeName
+
+	task, err := factory(params, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if journaled, ok := task.(JournaledTask); ok && entry.State != nil {
+		if err := journaled.RestoreRollbackState(entry.State); err != nil {
+			return nil, err
+		}
+	}
+	return task, nil
+}
+
+// journalValue returns a JSON-safe copy of plain data values and false for
+// runtime objects (runners, channels, ...) that must not be persisted.
+func journalValue(value any) (any, bool) {
+	switch v := value.(type) {
+	case nil, string, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v, true
+	case Secret:
+		// Secrets are never written; they are read again from their source
+		return nil, false
+	case []string:
+		return append([]string(nil), v...), true
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			if plain, ok := journalValue(item); ok {
+				result = append(result, plain)
+			}
+		}
+		return result, true
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			if plain, ok := journalValue(item); ok {
+				result[key] = plain
+			}
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
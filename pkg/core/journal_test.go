@@ -0,0 +1,339 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// journalMockTask is a rollbackable task that keeps its rollback data in state.
+type journalMockTask struct {
+	MockTask
+	created string
+}
+
+func (t *journalMockTask) CanRollback() bool {
+	return t.created != ""
+}
+
+func (t *journalMockTask) RollbackState() map[string]any {
+	return map[string]any{"created": t.created}
+}
+
+func (t *journalMockTask) RestoreRollbackState(state map[string]any) error {
+	created, ok := state["created"].(string)
+	if !ok {
+		return errors.New("missing created")
+	}
+	t.created = created
+	return nil
+}
+
+var (
+	journalRollbacksMu sync.Mutex
+	journalRollbacks   []string
+)
+
+func registerJournalMock() string {
+	name := "journalMock"
+	_ = Tasks.Register(name, func(config map[string]any, ctx *InstallContext) (Task, error) {
+		task := &journalMockTask{MockTask: *NewMockTask(fmt.Sprintf("%v", config["id"]), name)}
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			if fail, _ := config["fail"].(bool); fail {
+				return errors.New("boom")
+			}
+			task.created = "/tmp/" + task.ID()
+			return nil
+		}
+		task.RollbackFunc = func(ctx *InstallContext, bus *EventBus) error {
+			journalRollbacksMu.Lock()
+			journalRollbacks = append(journalRollbacks, task.created)
+			journalRollbacksMu.Unlock()
+			return nil
+		}
+		return task, nil
+	})
+	return name
+}
+
+func openTestJournal(t *testing.T) (*Journal, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	t.Cleanup(func() { _ = journal.Close() })
+	return journal, path
+}
+
+// runJournaled runs the given task configs on a fresh runner and returns its error.
+func runJournaled(ctx *InstallContext, configs ...TaskConfig) error {
+	runner := NewTaskRunner(ctx, NewEventBus())
+	for _, config := range configs {
+		if err := runner.QueueConfig(config); err != nil {
+			return err
+		}
+	}
+	return runner.Run()
+}
+
+func TestParseRecoverMode(t *testing.T) {
+	for _, value := range []string{"", "rollback", "Resume", " ignore "} {
+		if _, err := ParseRecoverMode(value); err != nil {
+			t.Errorf("unexpected error for %q: %v", value, err)
+		}
+	}
+	if _, err := ParseRecoverMode("retry"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestJournalInterruptedSession(t *testing.T) {
+	name := registerJournalMock()
+	journal, path := openTestJournal(t)
+
+	ctx := NewInstallContext()
+	ctx.Runtime.FlowID = "install"
+	ctx.Runtime.CurrentStep = "copy"
+	ctx.Set("install_dir", "/opt/app")
+	ctx.Set("task_runner", NewTaskRunner(ctx, NewEventBus()))
+	ctx.SetJournal(journal)
+
+	if err := journal.Begin("install", ctx.InputSnapshot()); err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	err := runJournaled(ctx,
+		TaskConfig{Type: name, ID: "a"},
+		TaskConfig{Type: name, ID: "b", Params: map[string]any{"fail": true}},
+	)
+	if err == nil {
+		t.Fatal("expected task failure")
+	}
+
+	state, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("ReadJournal failed: %v", err)
+	}
+	if !state.Interrupted() {
+		t.Fatal("expected interrupted session")
+	}
+	if state.Flow != "install" || state.Step != "copy" {
+		t.Errorf("unexpected flow/step: %s/%s", state.Flow, state.Step)
+	}
+	if state.Input["install_dir"] != "/opt/app" {
+		t.Errorf("expected input snapshot, got %v", state.Input)
+	}
+	if _, ok := state.Input["task_runner"]; ok {
+		t.Error("runtime objects must not be journaled")
+	}
+
+	completed := state.CompletedTasks()
+	if len(completed) != 1 || completed[0].TaskID != "a" {
+		t.Fatalf("expected task a completed, got %+v", completed)
+	}
+	if completed[0].State["created"] != "/tmp/a" {
+		t.Errorf("expected rollback state, got %v", completed[0].State)
+	}
+	if failed := state.FailedTask(); failed == nil || failed.TaskID != "b" {
+		t.Errorf("expected task b to be the failed task, got %+v", failed)
+	}
+
+	if err := journal.End(SessionCompleted); err != nil {
+		t.Fatalf("End failed: %v", err)
+	}
+	state, _ = ReadJournal(path)
+	if state.Interrupted() {
+		t.Error("ended session must not be interrupted")
+	}
+}
+
+func TestJournalRecoveryRollback(t *testing.T) {
+	name := registerJournalMock()
+	journal, path := openTestJournal(t)
+
+	ctx := NewInstallContext()
+	ctx.Runtime.CurrentStep = "install"
+	ctx.SetJournal(journal)
+	_ = journal.Begin("install", nil)
+	_ = runJournaled(ctx,
+		TaskConfig{Type: name, ID: "first"},
+		TaskConfig{Type: name, ID: "second"},
+		TaskConfig{Type: name, ID: "third", Params: map[string]any{"fail": true}},
+	)
+
+	journalRollbacksMu.Lock()
+	journalRollbacks = nil
+	journalRollbacksMu.Unlock()
+
+	// Simulate a restart: a new context knows nothing but the journal.
+	state, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("ReadJournal failed: %v", err)
+	}
+	if err := state.Rollback(NewInstallContext(), NewEventBus(), journal); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	journalRollbacksMu.Lock()
+	got := fmt.Sprint(journalRollbacks)
+	journalRollbacksMu.Unlock()
+	if got != "[/tmp/second /tmp/first]" {
+		t.Errorf("expected reverse rollback from journaled state, got %s", got)
+	}
+
+	state, _ = ReadJournal(path)
+	if state.Interrupted() || state.Status != SessionRolledBack {
+		t.Errorf("expected rolled back session, got status %q", state.Status)
+	}
+	if len(state.CompletedTasks()) != 0 {
+		t.Error("rolled back tasks must not be reported as completed")
+	}
+}
+
+func TestJournalResumeSkipsCompletedTasks(t *testing.T) {
+	name := registerJournalMock()
+	journal, path := openTestJournal(t)
+
+	ctx := NewInstallContext()
+	ctx.Runtime.CurrentStep = "install"
+	ctx.SetJournal(journal)
+	_ = journal.Begin("install", nil)
+	_ = runJournaled(ctx,
+		TaskConfig{Type: name, ID: "a"},
+		TaskConfig{Type: name, ID: "b", Params: map[string]any{"fail": true}},
+	)
+
+	state, _ := ReadJournal(path)
+	if err := journal.Resume(state); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+
+	ctx = NewInstallContext()
+	ctx.Runtime.CurrentStep = "install"
+	ctx.SetJournal(journal)
+	runner := NewTaskRunner(ctx, NewEventBus())
+	first := &journalMockTask{MockTask: *NewMockTask("a", name)}
+	second := &journalMockTask{MockTask: *NewMockTask("b", name)}
+	runner.AddTask(first)
+	runner.AddTask(second)
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first.executed {
+		t.Error("task completed before the interruption must be skipped")
+	}
+	if first.created != "/tmp/a" {
+		t.Errorf("expected restored rollback state, got %q", first.created)
+	}
+	if !second.executed {
+		t.Error("interrupted task must run again")
+	}
+
+	// A later rollback still covers the task carried over from the first run.
+	if err := runner.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if !first.rolledBack {
+		t.Error("expected resumed task to be rolled back")
+	}
+}
+
+func TestJournalContinueTakesOverRollback(t *testing.T) {
+	name := registerJournalMock()
+	journal, path := openTestJournal(t)
+
+	// The run that elevates finishes a task and hands over its journal
+	ctx := NewInstallContext()
+	ctx.Runtime.CurrentStep = "prepare"
+	ctx.SetJournal(journal)
+	_ = journal.Begin("install", nil)
+	if err := runJournaled(ctx, TaskConfig{Type: name, ID: "a"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	state, _ := ReadJournal(path)
+	if err := journal.Continue(state); err != nil {
+		t.Fatalf("Continue failed: %v", err)
+	}
+	elevated := NewInstallContext()
+	w := NewWorkflow(elevated, NewEventBus())
+	elevated.SetJournal(journal)
+	if err := w.Transaction().Continue(state); err != nil {
+		t.Fatalf("Transaction.Continue failed: %v", err)
+	}
+	if w.Transaction().Pending() != 1 {
+		t.Fatalf("expected the finished task to be taken over, got %d", w.Transaction().Pending())
+	}
+
+	// Unlike Resume, the runner does not skip them
+	if _, ok := journal.resumed(state.CompletedTasks()[0].Key); ok {
+		t.Error("expected continued tasks not to be skipped")
+	}
+
+	journalRollbacksMu.Lock()
+	journalRollbacks = nil
+	journalRollbacksMu.Unlock()
+	if _, err := w.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	journalRollbacksMu.Lock()
+	got := fmt.Sprint(journalRollbacks)
+	journalRollbacksMu.Unlock()
+	if got != "[/tmp/a]" {
+		t.Errorf("expected the task of the first run to be rolled back, got %s", got)
+	}
+	if state, _ := ReadJournal(path); len(state.CompletedTasks()) != 0 {
+		t.Error("expected the rollback to be journaled")
+	}
+}
+
+func TestReadJournalTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	content := `{"kind":"session_start","flow":"install"}
+{"kind":"task_start","step":"copy","key":"copy/0/a","taskId":"a"}
+{"kind":"task_fin`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("ReadJournal failed: %v", err)
+	}
+	if len(state.Entries) != 2 || !state.Interrupted() {
+		t.Errorf("expected 2 entries of an interrupted session, got %d", len(state.Entries))
+	}
+
+	missing, err := ReadJournal(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || missing.Interrupted() {
+		t.Errorf("missing journal should be empty, got %v", err)
+	}
+}
+
+func TestWorkflowResumeAt(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	_ = w.AddFlow(createTestFlow())
+	_ = w.SelectFlow("install")
+
+	if err := w.ResumeAt("install"); err != nil {
+		t.Fatalf("ResumeAt failed: %v", err)
+	}
+	if w.CurrentStepID() != "install" || ctx.Runtime.CurrentStep != "install" {
+		t.Errorf("expected current step install, got %s", w.CurrentStepID())
+	}
+	if w.StepStatus("destination") != StepCompleted {
+		t.Error("expected earlier steps to be completed")
+	}
+	if err := w.JumpTo("license"); err != nil {
+		t.Errorf("expected earlier steps to be visited: %v", err)
+	}
+	if err := w.ResumeAt("missing"); err == nil {
+		t.Error("expected error for unknown step")
+	}
+}
@@ -0,0 +1,79 @@
+// Package core provides config checks that warn rather than fail.
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LintConfig returns warnings about a valid config that likely does not
+// do what its author meant, such as shell scripts that interpolate values
+// unquoted (see LintShellScript).
+func LintConfig(cfg *Config) []string {
+	if cfg == nil {
+		return nil
+	}
+
+	var warnings []string
+	lint := func(where string, tasks []TaskConfig) {
+		for i, task := range tasks {
+			name := task.ID
+			if name == "" {
+				name = fmt.Sprintf("#%d (%s)", i+1, task.Type)
+			}
+			for _, warning := range lintTask(task) {
+				warnings = append(warnings, fmt.Sprintf("%s, task %s: %s", where, name, warning))
+			}
+		}
+	}
+
+	flowIDs := make([]string, 0, len(cfg.Flows))
+	for id := range cfg.Flows {
+		flowIDs = append(flowIDs, id)
+	}
+	sort.Strings(flowIDs)
+	for _, id := range flowIDs {
+		if cfg.Flows[id] == nil {
+			continue
+		}
+		for _, step := range cfg.Flows[id].Steps {
+			if step != nil {
+				lint(fmt.Sprintf("flow %s, step %s", id, step.ID), step.AllTasks())
+			}
+		}
+	}
+	if cfg.Install != nil {
+		lint("install.preInstall", cfg.Install.PreInstall)
+		lint("install.install", cfg.Install.Install)
+		lint("install.postInstall", cfg.Install.PostInstall)
+	}
+	if cfg.Uninstall != nil {
+		lint("uninstall.tasks", cfg.Uninstall.Tasks)
+	}
+	return warnings
+}
+
+// lintTask checks the scripts of a shell task.
+func lintTask(task TaskConfig) []string {
+	if StripGoPrefix(task.Type) != "shell" {
+		return nil
+	}
+
+	var warnings []string
+	check := func(keys ...string) {
+		for _, key := range keys {
+			if script, ok := task.Params[key].(string); ok {
+				for _, warning := range LintShellScript(script) {
+					warnings = append(warnings, key+": "+warning)
+				}
+				return
+			}
+		}
+	}
+	// With args the command is run directly, not by sh
+	if _, ok := task.Params["args"]; !ok {
+		check("command", "script")
+	}
+	check("rollbackCommand", "rollback_command")
+	return warnings
+}
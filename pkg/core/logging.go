@@ -0,0 +1,439 @@
+// Package core provides structured logging with task attribution and log
+// files.
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogMaxSize is the size at which the installer rotates its log
+	// files.
+	DefaultLogMaxSize = 10 << 20
+	// DefaultLogBackups is how many rotated log files are kept.
+	DefaultLogBackups = 3
+)
+
+// String returns the lower-case level name.
+func (l LogLevel) String() string {
+	switch l {
+	case LogTrace:
+		return "trace"
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLogLevel parses a level name such as "debug" or "WARN".
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "trace":
+		return LogTrace, nil
+	case "debug":
+		return LogDebug, nil
+	case "info":
+		return LogInfo, nil
+	case "warn", "warning":
+		return LogWarn, nil
+	case "error":
+		return LogError, nil
+	}
+	return LogInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// LogFormat selects how a log file is written.
+type LogFormat string
+
+const (
+	// LogFormatText writes one human-readable line per entry.
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON writes one JSON object per line (JSON lines).
+	LogFormatJSON LogFormat = "json"
+)
+
+// LogFileOptions configures a log file.
+type LogFileOptions struct {
+	Format LogFormat // Default LogFormatText
+	// MaxSize rotates the file before it grows past this many bytes; 0 never
+	// rotates it
+	MaxSize int64
+	// MaxBackups is how many rotated files are kept, path.1 being the newest;
+	// 0 means DefaultLogBackups
+	MaxBackups int
+}
+
+// logFile is an open log file that rotates itself by size.
+type logFile struct {
+	mu   sync.Mutex
+	path string
+	opts LogFileOptions
+	file *os.File
+	size int64
+}
+
+func openLogFile(path string, opts LogFileOptions) (*logFile, error) {
+	if opts.Format == "" {
+		opts.Format = LogFormatText
+	}
+	if opts.Format != LogFormatText && opts.Format != LogFormatJSON {
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = DefaultLogBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f := &logFile{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *logFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	if info, err := file.Stat(); err == nil {
+		f.size = info.Size()
+	}
+	return nil
+}
+
+func (f *logFile) write(entry LogEntry) {
+	var line []byte
+	if f.opts.Format == LogFormatJSON {
+		line = formatLogJSON(entry)
+	} else {
+		line = []byte(formatLogText(entry))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return
+	}
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.opts.MaxSize {
+		f.rotate()
+		if f.file == nil {
+			return
+		}
+	}
+	n, _ := f.file.Write(line)
+	f.size += int64(n)
+}
+
+// rotate moves path to path.1, path.1 to path.2 and so on, dropping the
+// oldest file, and starts a new file at path.
+func (f *logFile) rotate() {
+	_ = f.file.Close()
+	f.file = nil
+
+	backup := func(n int) string { return f.path + "." + strconv.Itoa(n) }
+	_ = os.Remove(backup(f.opts.MaxBackups))
+	for n := f.opts.MaxBackups - 1; n >= 1; n-- {
+		_ = os.Rename(backup(n), backup(n+1))
+	}
+	_ = os.Rename(f.path, backup(1))
+
+	// Without a file, logging goes on in memory and on the event bus
+	_ = f.open()
+}
+
+func (f *logFile) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		_ = f.file.Close()
+		f.file = nil
+	}
+}
+
+// formatLogText renders an entry as
+// "2006-01-02 15:04:05.000 [INFO] [step/task] message key=value".
+func formatLogText(entry LogEntry) string {
+	var b strings.Builder
+	b.WriteString(entry.Timestamp().Format("2006-01-02 15:04:05.000"))
+	b.WriteString(" [")
+	b.WriteString(strings.ToUpper(entry.Level.String()))
+	b.WriteString("] ")
+
+	scope := entry.Step
+	if entry.TaskID != "" {
+		if scope != "" {
+			scope += "/"
+		}
+		scope += entry.TaskID
+	}
+	if scope != "" {
+		b.WriteString("[" + scope + "] ")
+	}
+
+	b.WriteString(entry.Message)
+	for _, key := range sortedKeys(entry.Fields) {
+		value := fmt.Sprint(entry.Fields[key])
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" " + key + "=" + value)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// logLine is the JSON-lines form of a LogEntry.
+type logLine struct {
+	Time     string         `json:"time"`
+	Level    string         `json:"level"`
+	Message  string         `json:"msg"`
+	Flow     string         `json:"flow,omitempty"`
+	Step     string         `json:"step,omitempty"`
+	TaskID   string         `json:"task,omitempty"`
+	TaskType string         `json:"taskType,omitempty"`
+	Fields   map[string]any `json:"fields,omitempty"`
+}
+
+func formatLogJSON(entry LogEntry) []byte {
+	line := logLine{
+		Time:     entry.Timestamp().Format(time.RFC3339Nano),
+		Level:    entry.Level.String(),
+		Message:  entry.Message,
+		Flow:     entry.Flow,
+		Step:     entry.Step,
+		TaskID:   entry.TaskID,
+		TaskType: entry.TaskType,
+		Fields:   entry.Fields,
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		// A field value JSON cannot encode; fall back to its text form
+		line.Fields = make(map[string]any, len(entry.Fields))
+		for k, v := range entry.Fields {
+			line.Fields[k] = fmt.Sprint(v)
+		}
+		data, _ = json.Marshal(line)
+	}
+	return append(data, '\n')
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// logFields turns alternating keys and values into a map. Errors are stored
+// as their message. A value without a key is stored under "!BADKEY", as
+// log/slog does.
+func logFields(keyvals []any) map[string]any {
+	if len(keyvals) == 0 {
+		return nil
+	}
+	fields := make(map[string]any, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			fields["!BADKEY"] = keyvals[i]
+			break
+		}
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		value := keyvals[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// logScope is a running task that log entries are attributed to.
+type logScope struct {
+	step     string
+	taskID   string
+	taskType string
+}
+
+// enterTask attributes log entries to a task until the returned function is
+// called. While several tasks run at once, entries logged with AddLog or Log
+// are attributed to none of them; tasks that may run in parallel log with
+// LogTask or BaseTask.Log to name themselves.
+func (c *InstallContext) enterTask(step string, task Task) func() {
+	scope := &logScope{step: step, taskID: task.ID(), taskType: task.Type()}
+	c.mu.Lock()
+	c.activeTasks = append(c.activeTasks, scope)
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, active := range c.activeTasks {
+			if active == scope {
+				c.activeTasks = append(c.activeTasks[:i], c.activeTasks[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// SetLogLevel drops entries below level. The default is LogInfo.
+func (c *InstallContext) SetLogLevel(level LogLevel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logLevel = level
+}
+
+// LogEnabled reports whether entries of level are kept, so callers can skip
+// building expensive debug messages.
+func (c *InstallContext) LogEnabled(level LogLevel) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return level >= c.logLevel
+}
+
+// SetLogFile replaces the log files with a single human-readable one at
+// path that is never rotated. An empty path disables file logging.
+func (c *InstallContext) SetLogFile(path string) error {
+	c.CloseLogFile()
+	if path == "" {
+		return nil
+	}
+	return c.AddLogFile(path, LogFileOptions{})
+}
+
+// AddLogFile writes log entries to another file, in the given format and with
+// the given rotation, next to those already set up.
+func (c *InstallContext) AddLogFile(path string, opts LogFileOptions) error {
+	file, err := openLogFile(path, opts)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logFiles = append(c.logFiles, file)
+	return nil
+}
+
+// LogPath returns the path of the first log file, if any.
+func (c *InstallContext) LogPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.logFiles) == 0 {
+		return ""
+	}
+	return c.logFiles[0].path
+}
+
+// CloseLogFile closes all log files.
+func (c *InstallContext) CloseLogFile() {
+	c.mu.Lock()
+	files := c.logFiles
+	c.logFiles = nil
+	c.mu.Unlock()
+
+	for _, file := range files {
+		file.close()
+	}
+}
+
+// AddLog adds a log entry to the runtime state, publishes it and writes it
+// to the log files. The entry is attributed to the current flow and step
+// and, while a single task runs, to that task.
+func (c *InstallContext) AddLog(level LogLevel, message string) {
+	c.log(LogEntry{Level: level, Message: message})
+}
+
+// Log adds a log entry like AddLog, with key/value fields given as
+// alternating keys and values:
+//
+//	ctx.Log(core.LogDebug, "Downloaded", "url", url, "bytes", n)
+func (c *InstallContext) Log(level LogLevel, message string, keyvals ...any) {
+	c.log(LogEntry{Level: level, Message: message, Fields: logFields(keyvals)})
+}
+
+// LogTask adds a log entry like Log, attributed to the given task even if
+// other tasks run at the same time.
+func (c *InstallContext) LogTask(task Task, level LogLevel, message string, keyvals ...any) {
+	c.log(LogEntry{
+		Level:    level,
+		Message:  message,
+		TaskID:   task.ID(),
+		TaskType: task.Type(),
+		Fields:   logFields(keyvals),
+	})
+}
+
+func (c *InstallContext) log(entry LogEntry) {
+	c.mu.Lock()
+	if entry.Level < c.logLevel {
+		c.mu.Unlock()
+		return
+	}
+
+	entry.Time = currentTimeMillis()
+	entry.Message = c.redactor.Redact(entry.Message)
+	entry.Fields = c.redactor.redactFields(entry.Fields)
+	entry.Flow = c.Runtime.FlowID
+	if entry.Step == "" || entry.TaskID != "" {
+		if scope := c.logScopeUnlocked(entry.TaskID); scope != nil {
+			entry.Step = scope.step
+			entry.TaskID = scope.taskID
+			entry.TaskType = scope.taskType
+		}
+	}
+	if entry.Step == "" {
+		entry.Step = c.Runtime.CurrentStep
+	}
+	c.Runtime.Logs = append(c.Runtime.Logs, entry)
+	bus := c.bus
+	files := c.logFiles
+	c.mu.Unlock()
+
+	if bus != nil {
+		bus.PublishLogEntry(entry)
+	}
+	for _, file := range files {
+		file.write(entry)
+	}
+}
+
+// logScopeUnlocked returns the running task named taskID or, without a
+// name, the only running task.
+func (c *InstallContext) logScopeUnlocked(taskID string) *logScope {
+	if taskID == "" {
+		if len(c.activeTasks) == 1 {
+			return c.activeTasks[0]
+		}
+		return nil
+	}
+	for i := len(c.activeTasks) - 1; i >= 0; i-- {
+		if c.activeTasks[i].taskID == taskID {
+			return c.activeTasks[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	for _, level := range []LogLevel{LogTrace, LogDebug, LogInfo, LogWarn, LogError} {
+		parsed, err := ParseLogLevel(strings.ToUpper(level.String()))
+		if err != nil || parsed != level {
+			t.Errorf("expected %s to round-trip, got %v %v", level, parsed, err)
+		}
+	}
+	if _, err := ParseLogLevel("loud"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestSetLogLevelDropsVerboseEntries(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.AddLog(LogDebug, "hidden")
+	ctx.AddLog(LogInfo, "shown")
+	if len(ctx.Runtime.Logs) != 1 || ctx.LogEnabled(LogDebug) {
+		t.Fatalf("expected debug entries to be dropped by default, got %+v", ctx.Runtime.Logs)
+	}
+
+	ctx.SetLogLevel(LogTrace)
+	ctx.AddLog(LogTrace, "trace")
+	if len(ctx.Runtime.Logs) != 2 {
+		t.Errorf("expected trace entry once enabled, got %+v", ctx.Runtime.Logs)
+	}
+}
+
+func TestLogAttributesRunningTask(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Runtime.FlowID = "install"
+	ctx.Runtime.CurrentStep = "progress"
+
+	task := NewMockTask("extract", "unpack")
+	task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		ctx.Log(LogInfo, "Extracted", "files", 3)
+		return nil
+	}
+	runner := NewTaskRunner(ctx, NewEventBus())
+	runner.AddTask(task)
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx.AddLog(LogInfo, "after")
+
+	var entry *LogEntry
+	for i := range ctx.Runtime.Logs {
+		if ctx.Runtime.Logs[i].Message == "Extracted" {
+			entry = &ctx.Runtime.Logs[i]
+		}
+	}
+	if entry == nil {
+		t.Fatal("expected the task's entry to be logged")
+	}
+	if entry.Flow != "install" || entry.Step != "progress" || entry.TaskID != "extract" || entry.TaskType != "unpack" {
+		t.Errorf("expected entry attributed to the task, got %+v", entry)
+	}
+	if entry.Fields["files"] != 3 {
+		t.Errorf("expected fields, got %v", entry.Fields)
+	}
+	if last := ctx.Runtime.Logs[len(ctx.Runtime.Logs)-1]; last.TaskID != "" || last.Step != "progress" {
+		t.Errorf("expected no task once it finished, got %+v", last)
+	}
+}
+
+func TestTaskLogWithParallelTasks(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Runtime.CurrentStep = "progress"
+	a := NewMockTask("a", "shell")
+	b := NewMockTask("b", "shell")
+	leaveA := ctx.enterTask("hooks", a)
+	leaveB := ctx.enterTask("progress", b)
+
+	ctx.AddLog(LogInfo, "ambiguous")
+	a.Log(ctx, LogInfo, "from a")
+	leaveA()
+	leaveB()
+
+	if got := ctx.Runtime.Logs[0]; got.TaskID != "" {
+		t.Errorf("expected no task while two run, got %q", got.TaskID)
+	}
+	if got := ctx.Runtime.Logs[1]; got.TaskID != "a" || got.Step != "hooks" {
+		t.Errorf("expected entry attributed to a in hooks, got %+v", got)
+	}
+}
+
+func TestLogFileFormats(t *testing.T) {
+	dir := t.TempDir()
+	ctx := NewInstallContext()
+	ctx.Runtime.CurrentStep = "progress"
+	textPath := filepath.Join(dir, "installer.log")
+	jsonPath := filepath.Join(dir, "installer.jsonl")
+	if err := ctx.AddLogFile(textPath, LogFileOptions{}); err != nil {
+		t.Fatalf("failed to add log file: %v", err)
+	}
+	if err := ctx.AddLogFile(jsonPath, LogFileOptions{Format: LogFormatJSON}); err != nil {
+		t.Fatalf("failed to add log file: %v", err)
+	}
+
+	task := NewMockTask("build", "shell")
+	task.Log(ctx, LogWarn, "compiler warning", "stream", "stderr", "line", "a b")
+	ctx.CloseLogFile()
+
+	text, _ := os.ReadFile(textPath)
+	if !strings.Contains(string(text), `[WARN] [progress/build] compiler warning line="a b" stream=stderr`) {
+		t.Errorf("unexpected text log: %s", text)
+	}
+
+	data, _ := os.ReadFile(jsonPath)
+	var line map[string]any
+	if err := json.Unmarshal(data, &line); err != nil {
+		t.Fatalf("expected a JSON line, got %s: %v", data, err)
+	}
+	if line["level"] != "warn" || line["msg"] != "compiler warning" || line["task"] != "build" || line["taskType"] != "shell" {
+		t.Errorf("unexpected JSON line: %v", line)
+	}
+	if fields, _ := line["fields"].(map[string]any); fields["stream"] != "stderr" {
+		t.Errorf("expected fields, got %v", line["fields"])
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "installer.log")
+	ctx := NewInstallContext()
+	if err := ctx.AddLogFile(path, LogFileOptions{MaxSize: 100, MaxBackups: 2}); err != nil {
+		t.Fatalf("failed to add log file: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		ctx.AddLog(LogInfo, strings.Repeat("x", 40))
+	}
+	ctx.CloseLogFile()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 100 {
+			t.Errorf("expected %s to stay within the limit, got %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected only two backups to be kept")
+	}
+}
@@ -57,7 +57,7 @@ func EnsurePrivilege(ctx *InstallContext, required bool) error {
 	return errors.New(msg)
 }
 
-// NeedsPrivilege returns true when any task config marks requirePrivilege.
+// NeedsPrivilege returns true when any task of the flow needs privileges.
 func NeedsPrivilege(cfg *Config, flowID string) bool {
 	if cfg == nil {
 		return false
@@ -73,16 +73,29 @@ func NeedsPrivilege(cfg *Config, flowID string) bool {
 	}
 
 	for _, step := range flow.Steps {
-		for _, task := range step.Tasks {
-			if taskRequiresPrivilege(task) {
-				return true
-			}
+		if stepRequiresPrivilege(step) {
+			return true
 		}
 	}
 
 	return false
 }
 
+// NeedsPrivilege returns true when any of the step's tasks, including its
+// hooks, needs administrator privileges.
+func (s *Step) NeedsPrivilege() bool {
+	return s != nil && stepRequiresPrivilege(s.Config)
+}
+
+func stepRequiresPrivilege(step *StepConfig) bool {
+	for _, task := range step.AllTasks() {
+		if taskRequiresPrivilege(task) {
+			return true
+		}
+	}
+	return false
+}
+
 func requiresPrivilege(params map[string]any) bool {
 	val, ok := params["requirePrivilege"]
 	if !ok {
@@ -129,6 +142,34 @@ func isUserScope(params map[string]any) bool {
 	}
 }
 
+// ElevateFunc continues the installation with administrator privileges when
+// the workflow reaches step, the first one that needs them. session holds
+// the state as of entering step, before its onEnter hooks run. The function
+// normally re-runs the installer from session and does not return; it
+// returns nil to go on in this process, or an error that stops navigation.
+type ElevateFunc func(step *Step, session *Session) error
+
+// SetElevator sets the function called before the workflow enters a step
+// that needs privileges, see ElevateFunc.
+func (w *Workflow) SetElevator(fn ElevateFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.elevate = fn
+}
+
+// elevateFor calls the elevator before target is entered, if target needs
+// privileges. from is the step being left with fromStatus, or nil if target
+// is current already. Callers must not hold w.mu.
+func (w *Workflow) elevateFor(target, from *Step, fromStatus StepStatus) error {
+	w.mu.RLock()
+	fn := w.elevate
+	w.mu.RUnlock()
+	if fn == nil || !target.NeedsPrivilege() {
+		return nil
+	}
+	return fn(target, w.sessionAt(target, from, fromStatus))
+}
+
 // Elevated returns true if the process is already elevated.
 func Elevated() bool {
 	return os.Getenv("GPKI_ELEVATED") == "1"
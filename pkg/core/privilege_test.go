@@ -1,6 +1,10 @@
 package core
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
 
 func TestGetPrivilegeStrategy(t *testing.T) {
 	ctx := NewInstallContext()
@@ -54,3 +58,59 @@ func TestNeedsPrivilege(t *testing.T) {
 		t.Fatalf("expected false for unknown flow")
 	}
 }
+
+func TestWorkflowElevatesBeforePrivilegedStep(t *testing.T) {
+	registerHookMock()
+	privileged := hookTask("enter-install")
+	privileged.Params = map[string]any{"requirePrivilege": true}
+
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	flow := createTestFlow()
+	flow.Steps[3].Config = &StepConfig{OnEnter: []TaskConfig{privileged}}
+	w.AddFlow(flow)
+	w.SelectFlow("install")
+
+	var steps []string
+	var session *Session
+	refuse := errors.New("not now")
+	w.SetElevator(func(step *Step, s *Session) error {
+		steps = append(steps, step.ID)
+		session = s
+		return refuse
+	})
+
+	w.Next()
+	w.Next()
+	if _, err := w.Next(); !errors.Is(err, refuse) {
+		t.Fatalf("expected the elevator's error, got %v", err)
+	}
+	if !reflect.DeepEqual(steps, []string{"install"}) {
+		t.Errorf("expected to elevate only for install, got %v", steps)
+	}
+	if w.CurrentStepID() != "destination" || len(takeHookMockRan()) != 0 {
+		t.Error("expected a refused elevation to keep the step and not run its hooks")
+	}
+
+	// The session continues at the privileged step, before its hooks
+	snapshot := session.Workflow
+	if snapshot.Step != "install" || snapshot.Statuses["install"] != StepCurrent ||
+		snapshot.Statuses["destination"] != StepCompleted {
+		t.Errorf("expected a session at install, got %+v", snapshot)
+	}
+	restored := NewWorkflow(NewInstallContext(), NewEventBus())
+	restored.AddFlow(createTestFlow())
+	restored.SelectFlow("install")
+	if err := session.Restore(restored.ctx, restored); err != nil || restored.CurrentStepID() != "install" {
+		t.Errorf("expected the session to restore at install, got %s: %v", restored.CurrentStepID(), err)
+	}
+
+	// An elevated run goes on in the same process
+	w.SetElevator(func(step *Step, s *Session) error { return nil })
+	if _, err := w.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if got := takeHookMockRan(); !reflect.DeepEqual(got, []string{"enter-install"}) {
+		t.Errorf("expected the hooks to run after elevation, got %v", got)
+	}
+}
@@ -0,0 +1,197 @@
+// Package core provides weighted progress tracking for the task runner.
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultTaskWeight is the cost of a task that declares no weight.
+	DefaultTaskWeight = 1.0
+	// BytesPerWeight is the number of bytes that cost as much as one default task.
+	BytesPerWeight = 1 << 20
+)
+
+// WeightedTask is implemented by tasks that can estimate their own cost
+// relative to DefaultTaskWeight. A weight declared in the task config takes
+// precedence over the estimate.
+type WeightedTask interface {
+	Weight() float64
+}
+
+// BytesWeight converts a byte count into a task weight. Unknown or small
+// sizes never weigh less than a default task.
+func BytesWeight(n int64) float64 {
+	weight := float64(n) / BytesPerWeight
+	if weight < DefaultTaskWeight {
+		return DefaultTaskWeight
+	}
+	return weight
+}
+
+// taskWeight returns the weight of the task at index. Callers hold r.mu.
+func (r *TaskRunner) taskWeight(index int) float64 {
+	if index < len(r.meta) && r.meta[index].weight > 0 {
+		return r.meta[index].weight
+	}
+	if weighted, ok := r.tasks[index].(WeightedTask); ok {
+		if weight := weighted.Weight(); weight > 0 {
+			return weight
+		}
+	}
+	return DefaultTaskWeight
+}
+
+// resetProgress estimates task weights and clears progress for a new run.
+func (r *TaskRunner) resetProgress() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.weights = make([]float64, len(r.tasks))
+	r.taskDone = make([]float64, len(r.tasks))
+	r.active = make([]bool, len(r.tasks))
+	r.totalWeight = 0
+	for i := range r.tasks {
+		// Skipped tasks take no share of the bar unless nothing else runs
+		if r.meta[i].skipWhen == "" {
+			r.weights[i] = r.taskWeight(i)
+			r.totalWeight += r.weights[i]
+		}
+	}
+	if r.totalWeight == 0 {
+		for i := range r.weights {
+			r.weights[i] = DefaultTaskWeight
+		}
+		r.totalWeight = float64(len(r.weights))
+	}
+	r.progress = 0
+	r.startedAt = time.Now()
+}
+
+// setTaskProgress records the completed fraction of the task at index and
+// returns the new overall progress. Overall progress never moves backwards,
+// so a retried task does not make the bar jump.
+func (r *TaskRunner) setTaskProgress(index int, fraction float64) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if index >= len(r.taskDone) || r.totalWeight <= 0 {
+		return r.progress
+	}
+	if fraction < 0 {
+		fraction = 0
+	} else if fraction > 1 {
+		fraction = 1
+	}
+	r.taskDone[index] = fraction
+
+	var done float64
+	for i, f := range r.taskDone {
+		done += r.weights[i] * f
+	}
+	if progress := done / r.totalWeight; progress > r.progress {
+		r.progress = min(progress, 1.0)
+	}
+	return r.progress
+}
+
+// setActive marks whether the task at index is currently executing, so its
+// own progress reports are attributed to it.
+func (r *TaskRunner) setActive(index int, active bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if index < len(r.active) {
+		r.active[index] = active
+	}
+}
+
+// finishTask marks the task at index as done and returns the new overall progress.
+func (r *TaskRunner) finishTask(index int) float64 {
+	return r.setTaskProgress(index, 1)
+}
+
+// ETA estimates the time left in the current run from the average rate so
+// far. It returns zero while there is not enough progress to estimate.
+func (r *TaskRunner) ETA() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.eta()
+}
+
+// eta is ETA for callers that hold r.mu.
+func (r *TaskRunner) eta() time.Duration {
+	if r.progress <= 0 || r.progress >= 1 || r.startedAt.IsZero() {
+		return 0
+	}
+	elapsed := time.Since(r.startedAt)
+	return time.Duration(float64(elapsed) * (1 - r.progress) / r.progress)
+}
+
+// publishProgress updates the context and publishes the overall progress.
+func (r *TaskRunner) publishProgress(taskID string, progress float64, message string) {
+	r.mu.RLock()
+	eta := r.eta()
+	r.mu.RUnlock()
+
+	r.ctx.SetProgress(progress)
+	if r.bus != nil {
+		r.bus.Publish(Event{
+			Type: EventProgress,
+			Payload: ProgressPayload{
+				TaskID:   taskID,
+				Progress: progress,
+				Message:  message,
+				ETA:      eta,
+			},
+		})
+	}
+}
+
+// onTaskProgress folds a task's own progress report into the overall progress.
+func (r *TaskRunner) onTaskProgress(e Event) {
+	p := e.ProgressPayload()
+	if p == nil {
+		return
+	}
+
+	r.mu.RLock()
+	index := -1
+	if r.running {
+		for i, task := range r.tasks {
+			if r.active[i] && task.ID() == p.TaskID {
+				index = i
+				break
+			}
+		}
+	}
+	r.mu.RUnlock()
+	if index < 0 {
+		return
+	}
+
+	fraction := p.Progress
+	if p.Total > 0 {
+		fraction = float64(p.Current) / float64(p.Total)
+	}
+	progress := r.setTaskProgress(index, fraction)
+
+	message := p.Message
+	if message == "" {
+		message = fmt.Sprintf("Running: %s", p.TaskID)
+	}
+	r.publishProgress(p.TaskID, progress, message)
+}
+
+// FormatETA formats an ETA for display, e.g. "1:05" or "1:02:03".
+func FormatETA(eta time.Duration) string {
+	eta = eta.Round(time.Second)
+	hours := int(eta / time.Hour)
+	minutes := int(eta%time.Hour) / int(time.Minute)
+	seconds := int(eta%time.Minute) / int(time.Second)
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
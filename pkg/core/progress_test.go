@@ -0,0 +1,129 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// weightedMockTask is a mock task with an estimated weight.
+type weightedMockTask struct {
+	MockTask
+	weight float64
+}
+
+func (t *weightedMockTask) Weight() float64 {
+	return t.weight
+}
+
+func TestBytesWeight(t *testing.T) {
+	if got := BytesWeight(0); got != DefaultTaskWeight {
+		t.Errorf("expected default weight for unknown size, got %f", got)
+	}
+	if got := BytesWeight(10 * BytesPerWeight); got != 10 {
+		t.Errorf("expected weight 10, got %f", got)
+	}
+}
+
+func TestTaskRunnerWeightedProgress(t *testing.T) {
+	ctx := NewInstallContext()
+	bus := NewEventBus()
+	runner := NewTaskRunner(ctx, bus)
+
+	var mu sync.Mutex
+	var seen []float64
+	bus.Subscribe(EventProgress, func(e Event) {
+		if p := e.ProgressPayload(); p != nil {
+			mu.Lock()
+			seen = append(seen, p.Progress)
+			mu.Unlock()
+		}
+	})
+
+	big := &weightedMockTask{MockTask: *NewMockTask("big", "mock"), weight: 3}
+	big.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		bus.PublishTaskProgress("big", 50, 100, "halfway")
+		return nil
+	}
+	small := NewMockTask("small", "mock")
+	runner.AddTasks([]Task{big, small})
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// big weighs 3 of 4: half of it is 37.5%, all of it 75%.
+	mu.Lock()
+	defer mu.Unlock()
+	want := []float64{0, 0.375, 0.75, 0.75, 1}
+	if len(seen) != len(want) {
+		t.Fatalf("expected %v, got %v", want, seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, seen)
+			break
+		}
+	}
+	if ctx.Runtime.Progress != 1 {
+		t.Errorf("expected context progress 1, got %f", ctx.Runtime.Progress)
+	}
+}
+
+func TestTaskRunnerDeclaredWeightOverridesEstimate(t *testing.T) {
+	name := "weightedMock"
+	_ = Tasks.Register(name, func(config map[string]any, ctx *InstallContext) (Task, error) {
+		return &weightedMockTask{MockTask: *NewMockTask(config["id"].(string), name), weight: 100}, nil
+	})
+
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "declared", Weight: 2})
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "estimated"})
+	runner.resetProgress()
+
+	if runner.weights[0] != 2 || runner.weights[1] != 100 {
+		t.Errorf("unexpected weights: %v", runner.weights)
+	}
+	if got := runner.finishTask(0); got != 2.0/102 {
+		t.Errorf("expected progress %f, got %f", 2.0/102, got)
+	}
+}
+
+func TestTaskRunnerProgressNeverMovesBackwards(t *testing.T) {
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	runner.AddTasks([]Task{NewMockTask("a", "mock"), NewMockTask("b", "mock")})
+	runner.resetProgress()
+
+	runner.setTaskProgress(0, 0.8)
+	if got := runner.setTaskProgress(0, 0.1); got != 0.4 {
+		t.Errorf("expected progress to stay at 0.4 after a retry, got %f", got)
+	}
+}
+
+func TestTaskRunnerETA(t *testing.T) {
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	runner.AddTasks([]Task{NewMockTask("a", "mock"), NewMockTask("b", "mock")})
+	runner.resetProgress()
+	if runner.ETA() != 0 {
+		t.Error("expected no ETA before any progress")
+	}
+
+	runner.startedAt = time.Now().Add(-10 * time.Second)
+	runner.finishTask(0)
+	if eta := runner.ETA(); eta < 9*time.Second || eta > 11*time.Second {
+		t.Errorf("expected ETA of about 10s, got %v", eta)
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := map[time.Duration]string{
+		5 * time.Second:                 "0:05",
+		65 * time.Second:                "1:05",
+		time.Hour + 2*time.Minute + 3e9: "1:02:03",
+	}
+	for eta, want := range tests {
+		if got := FormatETA(eta); got != want {
+			t.Errorf("FormatETA(%v) = %q, want %q", eta, got, want)
+		}
+	}
+}
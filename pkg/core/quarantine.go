@@ -0,0 +1,321 @@
+// Package core provides the quarantine that keeps removed paths until a flow
+// succeeds.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Quarantine keeps paths removed during a flow so that rolling the flow back
+// can restore them. A path is renamed into a hidden directory the session
+// creates next to it, so removing it stays a cheap rename on its own
+// filesystem. Where that is not possible, it is copied into the session
+// directory and then deleted. The quarantine is purged once the flow has
+// succeeded (see Transaction.Commit).
+type Quarantine struct {
+	mu    sync.Mutex
+	dir   string // Created on first use
+	seq   int
+	err   error             // Why the session directory could not be created
+	local map[string]string // Hidden directory of the session by parent path
+}
+
+// localQuarantinePrefix starts the names of the hidden directories a
+// quarantine creates next to removed paths.
+const localQuarantinePrefix = ".go-pkg-installer-quarantine-"
+
+// localDirsFile lists, in the session directory, the hidden directories the
+// session created, so PurgeQuarantines finds those of interrupted sessions.
+const localDirsFile = "local-dirs"
+
+// NewQuarantine creates a quarantine in a new session directory below root.
+func NewQuarantine(root string) *Quarantine {
+	session := fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
+	return &Quarantine{dir: filepath.Join(root, session)}
+}
+
+// Dir returns the session directory of the quarantine.
+func (q *Quarantine) Dir() string {
+	return q.dir
+}
+
+// Move moves path into the quarantine and returns where it is kept.
+func (q *Quarantine) Move(path string) (string, error) {
+	if _, err := os.Lstat(path); err != nil {
+		return "", err
+	}
+
+	q.mu.Lock()
+	q.seq++
+	name := fmt.Sprintf("%d-%s", q.seq, filepath.Base(path))
+	q.mu.Unlock()
+
+	if dir, err := q.localDir(filepath.Dir(path)); err == nil {
+		kept := filepath.Join(dir, name)
+		err := os.Rename(path, kept)
+		if err == nil {
+			return kept, nil
+		}
+		// A mount point is on another filesystem than its parent
+		if !errors.Is(err, syscall.EXDEV) {
+			return "", err
+		}
+	}
+
+	kept := filepath.Join(q.dir, name)
+	if q.err != nil {
+		return "", fmt.Errorf("failed to create quarantine: %w", q.err)
+	}
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	if err := movePath(path, kept); err != nil {
+		return "", err
+	}
+	return kept, nil
+}
+
+// localDir returns the hidden directory of the session in parent, creating
+// it on first use with a name other users cannot guess.
+func (q *Quarantine) localDir(parent string) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if dir, ok := q.local[parent]; ok {
+		return dir, nil
+	}
+	dir, err := os.MkdirTemp(parent, localQuarantinePrefix)
+	if err != nil {
+		return "", err
+	}
+	if q.local == nil {
+		q.local = make(map[string]string)
+	}
+	q.local[parent] = dir
+	q.recordLocalDir(dir)
+	return dir, nil
+}
+
+// recordLocalDir adds dir to the list in the session directory. Callers
+// hold q.mu.
+func (q *Quarantine) recordLocalDir(dir string) {
+	if q.err != nil || os.MkdirAll(q.dir, 0700) != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(q.dir, localDirsFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, dir)
+	f.Close()
+}
+
+// Restore moves a quarantined path back to where it was. An empty directory
+// created at that place in the meantime is replaced; anything else is an
+// error.
+func (q *Quarantine) Restore(kept, path string) error {
+	if _, err := os.Lstat(kept); err != nil {
+		return fmt.Errorf("quarantined copy of %s is gone: %w", path, err)
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("cannot restore %s, the path exists", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("cannot restore %s, the path exists: %w", path, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := movePath(kept, path); err != nil {
+		return err
+	}
+
+	// Drop the hidden directory once everything in it was restored
+	if dir := filepath.Dir(kept); os.Remove(dir) == nil {
+		q.mu.Lock()
+		for parent, local := range q.local {
+			if local == dir {
+				delete(q.local, parent)
+			}
+		}
+		q.mu.Unlock()
+	}
+	return nil
+}
+
+// Purge deletes everything in the quarantine.
+func (q *Quarantine) Purge() error {
+	q.mu.Lock()
+	local := q.local
+	q.local = nil
+	q.mu.Unlock()
+
+	var errs []error
+	for _, dir := range local {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := os.RemoveAll(q.dir); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// PurgeQuarantines deletes the quarantines of earlier sessions below root,
+// including the hidden directories they created next to removed paths.
+func PurgeQuarantines(root string) error {
+	sessions, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var errs []error
+	for _, session := range sessions {
+		data, err := os.ReadFile(filepath.Join(root, session.Name(), localDirsFile))
+		if err != nil {
+			continue
+		}
+		for _, dir := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			// Only what a quarantine created, whatever the list says
+			if !strings.HasPrefix(filepath.Base(dir), localQuarantinePrefix) {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := os.RemoveAll(root); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// movePath renames src to dst, or copies and then deletes src when they are
+// on different filesystems.
+func movePath(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		_ = os.RemoveAll(dst)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("failed to remove %s (a copy is kept in %s): %w", src, dst, err)
+	}
+	return nil
+}
+
+// copyTree copies a file, symlink or directory tree, keeping modes,
+// modification times and, where permitted, owners.
+func copyTree(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+	case info.IsDir():
+		if err := os.MkdirAll(dst, 0700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyTree(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		if err := copyRegularFile(src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot copy special file %s", src)
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Lchown(dst, int(stat.Uid), int(stat.Gid))
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		_ = os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+func copyRegularFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// SetQuarantine sets where removed paths are kept until the flow succeeds.
+func (c *InstallContext) SetQuarantine(q *Quarantine) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quarantine = q
+}
+
+// Quarantine returns the quarantine for removed paths, creating one in a
+// new private directory of the system temporary directory if none was set.
+func (c *InstallContext) Quarantine() *Quarantine {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.quarantine == nil {
+		c.quarantine = newTempQuarantine()
+	}
+	return c.quarantine
+}
+
+// newTempQuarantine creates a quarantine whose session directory is a new
+// directory in the system temporary directory, only accessible by the
+// installer, so other users cannot plant files or symlinks in it.
+func newTempQuarantine() *Quarantine {
+	dir, err := os.MkdirTemp("", "go-pkg-installer-quarantine-")
+	if err != nil {
+		return &Quarantine{err: err}
+	}
+	return &Quarantine{dir: dir}
+}
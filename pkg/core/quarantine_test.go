@@ -0,0 +1,179 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuarantineMoveAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	os.MkdirAll(filepath.Join(target, "bin"), 0755)
+	os.WriteFile(filepath.Join(target, "bin", "app"), []byte("#!/bin/sh"), 0755)
+
+	q := NewQuarantine(filepath.Join(dir, "quarantine"))
+	kept, err := q.Move(target)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("expected the path to be gone")
+	}
+	// Kept next to the path, so it was only renamed
+	local := filepath.Dir(kept)
+	if filepath.Dir(local) != dir || !strings.HasPrefix(filepath.Base(local), localQuarantinePrefix) {
+		t.Errorf("expected the path to be kept in a hidden directory of %s, got %s", dir, kept)
+	}
+	if info, err := os.Stat(local); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("expected a private directory, got %v %v", info, err)
+	}
+
+	// An empty directory re-created in the meantime is replaced
+	os.Mkdir(target, 0755)
+	if err := q.Restore(kept, target); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "bin", "app")); err != nil {
+		t.Errorf("expected the path to be restored: %v", err)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Error("expected the empty hidden directory to be removed")
+	}
+}
+
+func TestPurgeQuarantinesRemovesLocalDirs(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	os.WriteFile(target, []byte("app"), 0644)
+	root := filepath.Join(dir, "quarantine")
+
+	// A session that was interrupted before it could purge
+	kept, err := NewQuarantine(root).Move(target)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	// Never a directory the quarantine did not create
+	os.WriteFile(filepath.Join(dir, "keep"), []byte("keep"), 0644)
+	os.MkdirAll(filepath.Join(root, "old"), 0700)
+	os.WriteFile(filepath.Join(root, "old", localDirsFile), []byte(filepath.Join(dir, "keep")+"\n"), 0600)
+
+	if err := PurgeQuarantines(root); err != nil {
+		t.Fatalf("PurgeQuarantines failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(kept)); !os.IsNotExist(err) {
+		t.Error("expected the hidden directory of the session to be removed")
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Error("expected the quarantine root to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keep")); err != nil {
+		t.Errorf("expected unrelated paths to be kept: %v", err)
+	}
+}
+
+func TestQuarantineRestoreKeepsNewContent(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app.conf")
+	os.WriteFile(target, []byte("old"), 0644)
+
+	q := NewQuarantine(filepath.Join(dir, "quarantine"))
+	kept, err := q.Move(target)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	os.MkdirAll(filepath.Join(target, "sub"), 0755)
+	if err := q.Restore(kept, target); err == nil {
+		t.Error("expected error when the path is in use")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("expected the quarantined copy to be kept: %v", err)
+	}
+}
+
+func TestQuarantineRestoreKeepsNewFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app.conf")
+	os.WriteFile(target, []byte("old"), 0644)
+
+	q := NewQuarantine(filepath.Join(dir, "quarantine"))
+	kept, err := q.Move(target)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	os.WriteFile(target, []byte("new"), 0644)
+	if err := q.Restore(kept, target); err == nil {
+		t.Error("expected error when a file is in the way")
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "new" {
+		t.Errorf("expected the new file to be kept, got %q %v", data, err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("expected the quarantined copy to be kept: %v", err)
+	}
+}
+
+func TestDefaultQuarantineIsPrivate(t *testing.T) {
+	first := NewInstallContext().Quarantine()
+	second := NewInstallContext().Quarantine()
+	defer first.Purge()
+	defer second.Purge()
+
+	if first.Dir() == second.Dir() {
+		t.Errorf("expected a new directory per session, got %s twice", first.Dir())
+	}
+	info, err := os.Lstat(first.Dir())
+	if err != nil {
+		t.Fatalf("expected the quarantine to be created: %v", err)
+	}
+	if !info.IsDir() || info.Mode().Perm() != 0700 {
+		t.Errorf("expected a private directory, got %v", info.Mode())
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "lib"), 0750)
+	os.WriteFile(filepath.Join(src, "lib", "data"), []byte("data"), 0600)
+	os.Symlink("lib/data", filepath.Join(src, "link"))
+
+	dst := filepath.Join(dir, "dst")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree failed: %v", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dst, "lib")); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("expected directory mode to be kept, got %v %v", info, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "lib", "data")); err != nil || string(data) != "data" {
+		t.Errorf("expected file content to be copied, got %q %v", data, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "lib/data" {
+		t.Errorf("expected symlink to be copied as a link, got %q %v", target, err)
+	}
+}
+
+func TestTransactionCommitPurgesQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "cache")
+	os.WriteFile(target, []byte("cache"), 0644)
+
+	ctx := NewInstallContext()
+	ctx.SetQuarantine(NewQuarantine(filepath.Join(dir, "quarantine")))
+	w := NewWorkflow(ctx, NewEventBus())
+	w.AddFlow(createTestFlow())
+	w.SelectFlow("install")
+
+	kept, err := ctx.Quarantine().Move(target)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if err := w.Complete(); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Error("expected the quarantine to be purged once the flow succeeded")
+	}
+}
@@ -2,6 +2,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -130,6 +131,25 @@ type Task interface {
 	CanRollback() bool
 }
 
+// ContextTask is implemented by tasks that can stop early when the run is
+// cancelled. The runner calls ExecuteContext instead of Execute; Execute
+// should behave like ExecuteContext with context.Background().
+type ContextTask interface {
+	Task
+
+	// ExecuteContext runs the task until it finishes or cctx is done.
+	ExecuteContext(cctx context.Context, ctx *InstallContext, bus *EventBus) error
+}
+
+// ExecuteTask runs task with cancellation support if it implements
+// ContextTask, and through plain Execute otherwise.
+func ExecuteTask(cctx context.Context, task Task, ctx *InstallContext, bus *EventBus) error {
+	if ct, ok := task.(ContextTask); ok {
+		return ct.ExecuteContext(cctx, ctx, bus)
+	}
+	return task.Execute(ctx, bus)
+}
+
 // Screen represents a wizard step screen.
 type Screen interface {
 	// ID returns the screen identifier.
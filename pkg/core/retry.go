@@ -0,0 +1,235 @@
+// Package core provides per-task failure policies, retry backoff and error classification.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// String returns the YAML name of the failure policy.
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailureAbort:
+		return "abort"
+	case FailureSkip:
+		return "skip"
+	case FailureRollback:
+		return "rollback"
+	case FailureRetry:
+		return "retry"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFailurePolicy converts an on_failure value into a FailurePolicy.
+func ParseFailurePolicy(value string) (FailurePolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "abort":
+		return FailureAbort, nil
+	case "skip":
+		return FailureSkip, nil
+	case "rollback":
+		return FailureRollback, nil
+	case "retry":
+		return FailureRetry, nil
+	default:
+		return FailureAbort, fmt.Errorf("unknown failure policy: %q", value)
+	}
+}
+
+// BackoffStrategy controls how the delay grows between retry attempts.
+type BackoffStrategy string
+
+const (
+	// BackoffFixed waits the same delay before every retry.
+	BackoffFixed BackoffStrategy = "fixed"
+	// BackoffExponential doubles the delay after every failed attempt.
+	BackoffExponential BackoffStrategy = "exponential"
+)
+
+// Backoff describes the delay between retry attempts.
+type Backoff struct {
+	Strategy BackoffStrategy
+	Delay    time.Duration // Delay before the first retry
+	MaxDelay time.Duration // Upper bound for a single delay (0 = unbounded)
+	Jitter   float64       // Random spread as a fraction of the delay (0.0 to 1.0)
+}
+
+// DefaultBackoff returns the runner default: exponential, starting at one second.
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Strategy: BackoffExponential,
+		Delay:    time.Second,
+		MaxDelay: 30 * time.Second,
+	}
+}
+
+// Next returns the delay to wait before the given retry (1-based).
+func (b Backoff) Next(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+
+	delay := b.Delay
+	if b.Strategy == BackoffExponential {
+		for i := 1; i < retry; i++ {
+			delay *= 2
+			if b.MaxDelay > 0 && delay >= b.MaxDelay {
+				break
+			}
+		}
+	}
+	if b.MaxDelay > 0 && delay > b.MaxDelay {
+		delay = b.MaxDelay
+	}
+
+	if b.Jitter > 0 && delay > 0 {
+		jitter := b.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		spread := float64(delay) * jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+		if delay < 0 {
+			delay = 0
+		}
+	}
+
+	return delay
+}
+
+// BackoffConfig is the YAML form of Backoff.
+type BackoffConfig struct {
+	Strategy   string  `yaml:"strategy,omitempty" json:"strategy,omitempty"` // fixed or exponential
+	DelayMs    int     `yaml:"delayMs,omitempty" json:"delayMs,omitempty"`
+	MaxDelayMs int     `yaml:"maxDelayMs,omitempty" json:"maxDelayMs,omitempty"`
+	Jitter     float64 `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+}
+
+// Backoff converts the YAML configuration into a Backoff, filling unset fields
+// from DefaultBackoff.
+func (c *BackoffConfig) Backoff() (Backoff, error) {
+	backoff := DefaultBackoff()
+	if c == nil {
+		return backoff, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.Strategy)) {
+	case "":
+	case string(BackoffFixed):
+		backoff.Strategy = BackoffFixed
+	case string(BackoffExponential):
+		backoff.Strategy = BackoffExponential
+	default:
+		return backoff, fmt.Errorf("unknown backoff strategy: %q", c.Strategy)
+	}
+
+	if c.DelayMs < 0 || c.MaxDelayMs < 0 {
+		return backoff, errors.New("backoff delays must not be negative")
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return backoff, errors.New("backoff jitter must be between 0 and 1")
+	}
+
+	if c.DelayMs > 0 {
+		backoff.Delay = time.Duration(c.DelayMs) * time.Millisecond
+	}
+	if c.MaxDelayMs > 0 {
+		backoff.MaxDelay = time.Duration(c.MaxDelayMs) * time.Millisecond
+	}
+	backoff.Jitter = c.Jitter
+	return backoff, nil
+}
+
+// TaskPolicy overrides the runner-wide failure handling for a single task.
+type TaskPolicy struct {
+	// OnFailure replaces the runner failure policy when non-nil.
+	OnFailure *FailurePolicy
+	// Retries is the number of extra attempts after the first failure.
+	Retries int
+	// Backoff replaces the runner backoff when non-nil.
+	Backoff *Backoff
+}
+
+// TaskPolicyFromConfig builds a TaskPolicy from the on_failure, retries and
+// backoff keys of a task configuration.
+func TaskPolicyFromConfig(config TaskConfig) (TaskPolicy, error) {
+	var policy TaskPolicy
+
+	if config.FailurePolicy != "" {
+		onFailure, err := ParseFailurePolicy(config.FailurePolicy)
+		if err != nil {
+			return policy, err
+		}
+		policy.OnFailure = &onFailure
+	}
+
+	if config.Retries < 0 {
+		return policy, errors.New("retries must not be negative")
+	}
+	policy.Retries = config.Retries
+
+	if config.Backoff != nil {
+		backoff, err := config.Backoff.Backoff()
+		if err != nil {
+			return policy, err
+		}
+		policy.Backoff = &backoff
+	}
+
+	return policy, nil
+}
+
+// ErrorClass tells the runner whether a failed attempt is worth retrying.
+type ErrorClass int
+
+const (
+	// ErrorUnclassified errors follow the task retry policy.
+	ErrorUnclassified ErrorClass = iota
+	// ErrorRetryable errors are transient (network hiccups, busy resources).
+	ErrorRetryable
+	// ErrorPermanent errors can never succeed on retry (bad checksum, invalid input).
+	ErrorPermanent
+)
+
+type classifiedError struct {
+	err   error
+	class ErrorClass
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not retryable.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ErrorPermanent}
+}
+
+// Retryable marks an error as transient.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ErrorRetryable}
+}
+
+// ClassifyError reports the outermost classification found in the error chain.
+func ClassifyError(err error) ErrorClass {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+	return ErrorUnclassified
+}
+
+// IsPermanent returns true if the error was marked with Permanent.
+func IsPermanent(err error) bool {
+	return ClassifyError(err) == ErrorPermanent
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseFailurePolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected FailurePolicy
+	}{
+		{"abort", FailureAbort},
+		{"skip", FailureSkip},
+		{"Rollback", FailureRollback},
+		{" retry ", FailureRetry},
+	}
+
+	for _, tc := range tests {
+		policy, err := ParseFailurePolicy(tc.input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tc.input, err)
+		}
+		if policy != tc.expected {
+			t.Errorf("expected %s for %q, got %s", tc.expected, tc.input, policy)
+		}
+	}
+
+	if _, err := ParseFailurePolicy("ignore"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestBackoffNext(t *testing.T) {
+	t.Run("fixed", func(t *testing.T) {
+		b := Backoff{Strategy: BackoffFixed, Delay: 100 * time.Millisecond}
+		for retry := 1; retry <= 3; retry++ {
+			if d := b.Next(retry); d != 100*time.Millisecond {
+				t.Errorf("retry %d: expected 100ms, got %v", retry, d)
+			}
+		}
+	})
+
+	t.Run("exponential with max delay", func(t *testing.T) {
+		b := Backoff{Strategy: BackoffExponential, Delay: 100 * time.Millisecond, MaxDelay: 350 * time.Millisecond}
+		expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 350 * time.Millisecond, 350 * time.Millisecond}
+		for i, want := range expected {
+			if d := b.Next(i + 1); d != want {
+				t.Errorf("retry %d: expected %v, got %v", i+1, want, d)
+			}
+		}
+	})
+
+	t.Run("jitter stays in range", func(t *testing.T) {
+		b := Backoff{Strategy: BackoffFixed, Delay: 100 * time.Millisecond, Jitter: 0.5}
+		for i := 0; i < 50; i++ {
+			d := b.Next(1)
+			if d < 50*time.Millisecond || d > 150*time.Millisecond {
+				t.Fatalf("jittered delay out of range: %v", d)
+			}
+		}
+	})
+}
+
+func TestTaskPolicyFromConfig(t *testing.T) {
+	policy, err := TaskPolicyFromConfig(TaskConfig{
+		Type:          "mock",
+		FailurePolicy: "skip",
+		Retries:       2,
+		Backoff:       &BackoffConfig{Strategy: "fixed", DelayMs: 250},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.OnFailure == nil || *policy.OnFailure != FailureSkip {
+		t.Errorf("expected skip policy, got %v", policy.OnFailure)
+	}
+	if policy.Retries != 2 {
+		t.Errorf("expected 2 retries, got %d", policy.Retries)
+	}
+	if policy.Backoff == nil || policy.Backoff.Strategy != BackoffFixed || policy.Backoff.Delay != 250*time.Millisecond {
+		t.Errorf("unexpected backoff: %+v", policy.Backoff)
+	}
+
+	if _, err := TaskPolicyFromConfig(TaskConfig{Type: "mock", Backoff: &BackoffConfig{Strategy: "linear"}}); err == nil {
+		t.Error("expected error for unknown backoff strategy")
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	base := errors.New("boom")
+
+	if ClassifyError(base) != ErrorUnclassified {
+		t.Error("expected plain error to be unclassified")
+	}
+	if !IsPermanent(fmt.Errorf("wrapped: %w", Permanent(base))) {
+		t.Error("expected wrapped permanent error to be detected")
+	}
+	if ClassifyError(Retryable(base)) != ErrorRetryable {
+		t.Error("expected retryable classification")
+	}
+	if !errors.Is(Permanent(base), base) {
+		t.Error("expected classified error to unwrap to the original")
+	}
+	if Permanent(nil) != nil || Retryable(nil) != nil {
+		t.Error("expected nil errors to stay nil")
+	}
+}
+
+func TestTaskRunnerPerTaskPolicy(t *testing.T) {
+	fastBackoff := Backoff{Strategy: BackoffFixed, Delay: time.Millisecond}
+	skip := FailureSkip
+
+	t.Run("skip overrides runner abort", func(t *testing.T) {
+		runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+		runner.SetFailurePolicy(FailureAbort)
+
+		failing := NewMockTask("optional", "mock")
+		failing.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			return errors.New("optional failed")
+		}
+		next := NewMockTask("next", "mock")
+
+		runner.AddTaskWithPolicy(failing, TaskPolicy{OnFailure: &skip})
+		runner.AddTask(next)
+
+		if err := runner.Run(); err != nil {
+			t.Fatalf("expected skip policy to continue, got %v", err)
+		}
+		if !next.executed {
+			t.Error("expected next task to run after skipped failure")
+		}
+	})
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+
+		var attempts int32
+		task := NewMockTask("flaky", "mock")
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			if atomic.AddInt32(&attempts, 1) < 3 {
+				return Retryable(errors.New("connection reset"))
+			}
+			return nil
+		}
+		runner.AddTaskWithPolicy(task, TaskPolicy{Retries: 2, Backoff: &fastBackoff})
+
+		if err := runner.Run(); err != nil {
+			t.Fatalf("expected success after retries, got %v", err)
+		}
+		if atomic.LoadInt32(&attempts) != 3 {
+			t.Errorf("expected 3 attempts, got %d", atomic.LoadInt32(&attempts))
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+
+		var attempts int32
+		task := NewMockTask("checksum", "mock")
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			atomic.AddInt32(&attempts, 1)
+			return Permanent(errors.New("checksum mismatch"))
+		}
+		runner.AddTaskWithPolicy(task, TaskPolicy{Retries: 5, Backoff: &fastBackoff})
+
+		if err := runner.Run(); err == nil {
+			t.Fatal("expected permanent failure")
+		}
+		if atomic.LoadInt32(&attempts) != 1 {
+			t.Errorf("expected a single attempt, got %d", atomic.LoadInt32(&attempts))
+		}
+	})
+
+	t.Run("cancel interrupts backoff", func(t *testing.T) {
+		runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+
+		task := NewMockTask("slow-retry", "mock")
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			return errors.New("still failing")
+		}
+		slow := Backoff{Strategy: BackoffFixed, Delay: time.Minute}
+		runner.AddTaskWithPolicy(task, TaskPolicy{Retries: 3, Backoff: &slow})
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			runner.Cancel()
+		}()
+
+		done := make(chan error, 1)
+		go func() { done <- runner.Run() }()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("expected cancellation error")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected cancel to interrupt the backoff delay")
+		}
+	})
+}
+
+func TestTaskRunnerQueueConfigPolicy(t *testing.T) {
+	name := "retryPolicyMock"
+	_ = Tasks.Register(name, func(config map[string]any, ctx *InstallContext) (Task, error) {
+		return NewMockTask(fmt.Sprintf("%v", config["id"]), name), nil
+	})
+
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	if err := runner.QueueConfig(TaskConfig{Type: name, ID: "a", FailurePolicy: "rollback", Retries: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	onFailure, attempts, _ := runner.resolvePolicy(0)
+	if onFailure != FailureRollback {
+		t.Errorf("expected rollback policy, got %s", onFailure)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+
+	if err := runner.QueueConfig(TaskConfig{Type: name, FailurePolicy: "explode"}); err == nil {
+		t.Error("expected error for invalid on_failure")
+	}
+}
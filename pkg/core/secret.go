@@ -0,0 +1,227 @@
+// Package core provides secret values and their redaction.
+package core
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedValue is shown in place of a secret.
+const RedactedValue = "******"
+
+// MinRedactLength is the length below which a secret is not scrubbed from
+// free text, where it would hide every occurrence of a common word. The
+// Secret value itself is always printed as RedactedValue.
+const MinRedactLength = 4
+
+// Secret is a context value, such as a password, that is rendered into
+// task params and scripts as it is but printed as RedactedValue everywhere
+// else. Sessions and the journal leave secrets out.
+type Secret string
+
+// String returns RedactedValue, so fmt never prints the secret.
+func (s Secret) String() string { return RedactedValue }
+
+// GoString returns RedactedValue for %#v.
+func (s Secret) GoString() string { return RedactedValue }
+
+// MarshalJSON encodes the secret as RedactedValue.
+func (s Secret) MarshalJSON() ([]byte, error) { return json.Marshal(RedactedValue) }
+
+// MarshalYAML encodes the secret as RedactedValue.
+func (s Secret) MarshalYAML() (any, error) { return RedactedValue, nil }
+
+// Reveal returns the secret itself.
+func (s Secret) Reveal() string { return string(s) }
+
+// Redactor scrubs known secrets from text. It is shared by a context and
+// its event bus.
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  map[string]bool
+	replacer *strings.Replacer
+}
+
+// NewRedactor creates a Redactor without secrets.
+func NewRedactor() *Redactor {
+	return &Redactor{secrets: make(map[string]bool)}
+}
+
+// Add registers a secret. The forms it takes when quoted for a shell
+// script are registered too, so a logged command does not show it.
+func (r *Redactor) Add(secret string) {
+	if len(secret) < MinRedactLength {
+		return
+	}
+	variants := []string{
+		secret,
+		strings.ReplaceAll(secret, "'", `'\''`),
+		doubleQuoteEscaper.Replace(secret),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	added := false
+	for _, v := range variants {
+		if !r.secrets[v] {
+			r.secrets[v] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// Longer secrets first, so a secret containing another is replaced whole
+	secrets := make([]string, 0, len(r.secrets))
+	for s := range r.secrets {
+		secrets = append(secrets, s)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, s := range secrets {
+		pairs = append(pairs, s, RedactedValue)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact returns text with every registered secret replaced by
+// RedactedValue.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	r.mu.RLock()
+	replacer := r.replacer
+	r.mu.RUnlock()
+	if replacer == nil {
+		return text
+	}
+	return replacer.Replace(text)
+}
+
+// RedactError returns err with its message redacted. The result still
+// unwraps to err, so errors.Is keeps working.
+func (r *Redactor) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := r.Redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, msg: msg}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactFields redacts the string values of log fields.
+func (r *Redactor) redactFields(fields map[string]any) map[string]any {
+	if len(fields) == 0 {
+		return fields
+	}
+	result := make(map[string]any, len(fields))
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			v = r.Redact(s)
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// redactPayload redacts the messages and errors of event payloads.
+func (r *Redactor) redactPayload(payload any) any {
+	if r == nil {
+		return payload
+	}
+	switch p := payload.(type) {
+	case LogPayload:
+		p.Message = r.Redact(p.Message)
+		p.Fields = r.redactFields(p.Fields)
+		return p
+	case ProgressPayload:
+		p.Message = r.Redact(p.Message)
+		return p
+	case TaskPayload:
+		p.Error = r.RedactError(p.Error)
+		return p
+	case ContextChangePayload:
+		p.Old = r.redactValue(p.Old)
+		p.New = r.redactValue(p.New)
+		return p
+	}
+	return payload
+}
+
+// redactValue returns a copy of value with its strings redacted.
+func (r *Redactor) redactValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.Redact(v)
+	case []string:
+		result := make([]string, len(v))
+		for i, item := range v {
+			result[i] = r.Redact(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = r.redactValue(item)
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			result[k] = r.redactValue(item)
+		}
+		return result
+	}
+	return value
+}
+
+// SetSecret sets a secret value by dot-notation path in UserInput.
+func (c *InstallContext) SetSecret(path, value string) {
+	c.Set(path, Secret(value))
+}
+
+// Redact returns text with the context's secrets replaced by RedactedValue.
+func (c *InstallContext) Redact(text string) string {
+	return c.redactor.Redact(text)
+}
+
+// RedactError returns err with the context's secrets removed from its
+// message.
+func (c *InstallContext) RedactError(err error) error {
+	return c.redactor.RedactError(err)
+}
+
+// registerSecrets adds the secrets in value to the redactor.
+func (c *InstallContext) registerSecrets(value any) {
+	switch v := value.(type) {
+	case Secret:
+		c.redactor.Add(string(v))
+	case map[string]any:
+		for _, item := range v {
+			c.registerSecrets(item)
+		}
+	case []any:
+		for _, item := range v {
+			c.registerSecrets(item)
+		}
+	}
+}
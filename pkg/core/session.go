@@ -0,0 +1,313 @@
+// Package core provides session snapshots that survive a restart.
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// SessionVersion is the format version written by SaveSession.
+const SessionVersion = 1
+
+// Session is a snapshot of an installation in progress: where the user is in
+// the workflow and everything they entered so far. It lets the installer
+// continue exactly where it was after re-running itself with elevated
+// privileges, after a crash, or when the user comes back later.
+type Session struct {
+	Version  int               `json:"version"`
+	SavedAt  time.Time         `json:"savedAt"`
+	Context  *ContextSnapshot  `json:"context"`
+	Workflow *WorkflowSnapshot `json:"workflow,omitempty"`
+	// Journal is the install journal of the run that saved the session for
+	// elevation; the elevated run continues it.
+	Journal string `json:"journal,omitempty"`
+}
+
+// ContextSnapshot holds the persistable state of an InstallContext. Values
+// that are not plain data (such as a running TaskRunner) are left out.
+type ContextSnapshot struct {
+	Input   map[string]any  `json:"input"`
+	Meta    map[string]any  `json:"meta,omitempty"`
+	Plan    *TaskPlan       `json:"plan,omitempty"`
+	Runtime RuntimeSnapshot `json:"runtime"`
+}
+
+// RuntimeSnapshot holds the persistable part of RuntimeState. Whether the
+// run is a dry run is left to the process restoring the snapshot.
+type RuntimeSnapshot struct {
+	Action      string     `json:"action,omitempty"`
+	FlowID      string     `json:"flow,omitempty"`
+	CurrentStep string     `json:"step,omitempty"`
+	Progress    float64    `json:"progress,omitempty"`
+	Logs        []LogEntry `json:"logs,omitempty"`
+	Errors      []string   `json:"errors,omitempty"`
+	StartTime   int64      `json:"startTime,omitempty"`
+	Completed   bool       `json:"completed,omitempty"`
+}
+
+// WorkflowSnapshot holds the navigation state of a Workflow.
+type WorkflowSnapshot struct {
+	Flow     string                `json:"flow"`
+	Step     string                `json:"step"`
+	Statuses map[string]StepStatus `json:"statuses,omitempty"`
+	Visited  []string              `json:"visited,omitempty"`
+}
+
+// Snapshot captures the user input, metadata, plan and runtime state.
+func (c *InstallContext) Snapshot() *ContextSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	input, _ := journalValue(c.UserInput)
+	meta, _ := journalValue(c.Meta)
+	snapshot := &ContextSnapshot{
+		Input: input.(map[string]any),
+		Meta:  meta.(map[string]any),
+		Runtime: RuntimeSnapshot{
+			Action:      c.Runtime.Action,
+			FlowID:      c.Runtime.FlowID,
+			CurrentStep: c.Runtime.CurrentStep,
+			Progress:    c.Runtime.Progress,
+			Logs:        append([]LogEntry(nil), c.Runtime.Logs...),
+			StartTime:   c.Runtime.StartTime,
+			Completed:   c.Runtime.Completed,
+		},
+	}
+	for _, err := range c.Runtime.Errors {
+		snapshot.Runtime.Errors = append(snapshot.Runtime.Errors, err.Error())
+	}
+	if c.Plan != nil {
+		plan := *c.Plan
+		plan.Tasks = append([]TaskSummary(nil), c.Plan.Tasks...)
+		snapshot.Plan = &plan
+	}
+	return snapshot
+}
+
+// Restore loads a snapshot into the context. Snapshot values replace the
+// ones already set; other values, such as those that cannot be persisted,
+// are kept.
+func (c *InstallContext) Restore(snapshot *ContextSnapshot) {
+	if snapshot == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, v := range snapshot.Input {
+		c.UserInput[k] = v
+	}
+	for k, v := range snapshot.Meta {
+		c.Meta[k] = v
+	}
+	if snapshot.Plan != nil {
+		plan := *snapshot.Plan
+		c.Plan = &plan
+	}
+
+	rt := snapshot.Runtime
+	c.Runtime.Action = rt.Action
+	c.Runtime.FlowID = rt.FlowID
+	c.Runtime.CurrentStep = rt.CurrentStep
+	c.Runtime.Progress = rt.Progress
+	c.Runtime.Logs = append([]LogEntry(nil), rt.Logs...)
+	c.Runtime.Errors = make([]error, 0, len(rt.Errors))
+	for _, msg := range rt.Errors {
+		c.Runtime.Errors = append(c.Runtime.Errors, errors.New(msg))
+	}
+	c.Runtime.StartTime = rt.StartTime
+	c.Runtime.Completed = rt.Completed
+}
+
+// Snapshot captures the selected flow, the current step and the status of
+// every step. It returns nil if no flow is selected.
+func (w *Workflow) Snapshot() *WorkflowSnapshot {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.current == nil || w.currentIdx < 0 {
+		return nil
+	}
+
+	snapshot := &WorkflowSnapshot{
+		Flow:     w.current.ID,
+		Step:     w.current.Steps[w.currentIdx].ID,
+		Statuses: make(map[string]StepStatus, len(w.stepStatus)),
+	}
+	for _, step := range w.current.Steps {
+		if status := w.stepStatus[step.ID]; status != StepNotStarted {
+			snapshot.Statuses[step.ID] = status
+		}
+		if w.visited[step.ID] {
+			snapshot.Visited = append(snapshot.Visited, step.ID)
+		}
+	}
+	return snapshot
+}
+
+// Restore selects the snapshot's flow and returns to its step with the step
+// statuses and visited set it had. Like ResumeAt, it does not run step hooks.
+// Steps the flow no longer has are ignored.
+func (w *Workflow) Restore(snapshot *WorkflowSnapshot) error {
+	if snapshot == nil {
+		return errors.New("no workflow snapshot")
+	}
+
+	w.nav.Lock()
+	defer w.nav.Unlock()
+	w.mu.Lock()
+
+	flow, ok := w.flows[snapshot.Flow]
+	if !ok {
+		w.mu.Unlock()
+		return fmt.Errorf("flow %q not found", snapshot.Flow)
+	}
+	stepIndex := make(map[string]int, len(flow.Steps))
+	for i, step := range flow.Steps {
+		stepIndex[step.ID] = i
+	}
+	targetIdx, ok := stepIndex[snapshot.Step]
+	if !ok {
+		w.mu.Unlock()
+		return fmt.Errorf("step %q not found", snapshot.Step)
+	}
+
+	oldStepID := ""
+	if w.current != nil && w.currentIdx >= 0 {
+		oldStepID = w.current.Steps[w.currentIdx].ID
+	}
+
+	w.current = flow
+	w.stepIndex = stepIndex
+	w.stepStatus = make(map[string]StepStatus, len(flow.Steps))
+	w.visited = make(map[string]bool, len(flow.Steps))
+	for _, step := range flow.Steps {
+		w.stepStatus[step.ID] = snapshot.Statuses[step.ID]
+	}
+	for _, id := range snapshot.Visited {
+		if _, ok := stepIndex[id]; ok {
+			w.visited[id] = true
+		}
+	}
+	w.currentIdx = targetIdx
+	w.stepStatus[snapshot.Step] = StepCurrent
+	w.visited[snapshot.Step] = true
+
+	w.ctx.setStep(flow.ID, snapshot.Step)
+
+	bus := w.bus
+	w.mu.Unlock()
+
+	if bus != nil && oldStepID != snapshot.Step {
+		bus.PublishStepChange(oldStepID, snapshot.Step)
+	}
+	return nil
+}
+
+// NewSession snapshots a context and, if given, a workflow.
+func NewSession(ctx *InstallContext, workflow *Workflow) *Session {
+	session := &Session{
+		Version: SessionVersion,
+		SavedAt: time.Now(),
+		Context: ctx.Snapshot(),
+	}
+	if workflow != nil {
+		session.Workflow = workflow.Snapshot()
+	}
+	return session
+}
+
+// sessionAt snapshots the context and workflow as they will be once
+// navigation has left from with fromStatus and made target current. from is
+// nil if target is current already.
+func (w *Workflow) sessionAt(target, from *Step, fromStatus StepStatus) *Session {
+	session := NewSession(w.ctx, w)
+	snapshot := session.Workflow
+	if snapshot == nil || from == nil || from.ID == target.ID {
+		return session
+	}
+
+	if fromStatus == StepNotStarted {
+		delete(snapshot.Statuses, from.ID)
+	} else {
+		snapshot.Statuses[from.ID] = fromStatus
+	}
+	snapshot.Statuses[target.ID] = StepCurrent
+	snapshot.Step = target.ID
+	if !slices.Contains(snapshot.Visited, target.ID) {
+		snapshot.Visited = append(snapshot.Visited, target.ID)
+	}
+	return session
+}
+
+// Restore loads the session into a context and, if given, a workflow whose
+// flows have been added. Restored values of declared variables are
+// converted back to their type, which JSON does not keep, and checked like
+// SetVariable does; required variables without a value are left to
+// CheckVariables or the screens that ask for them.
+func (s *Session) Restore(ctx *InstallContext, workflow *Workflow) error {
+	ctx.Restore(s.Context)
+	if err := ctx.restoreVariables(); err != nil {
+		return fmt.Errorf("invalid variables in session: %w", err)
+	}
+	if workflow != nil && s.Workflow != nil {
+		if err := workflow.Restore(s.Workflow); err != nil {
+			return fmt.Errorf("failed to restore workflow: %w", err)
+		}
+	}
+	return nil
+}
+
+// SaveSession writes a snapshot of the context and workflow to path. The
+// file is readable only by its owner, as it holds everything the user
+// entered.
+func SaveSession(path string, ctx *InstallContext, workflow *Workflow) error {
+	return NewSession(ctx, workflow).Save(path)
+}
+
+// Save writes the session to path, readable only by its owner.
+func (s *Session) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write and rename so a crash never leaves half a session behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// LoadSession reads a session written by SaveSession.
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid session file: %w", err)
+	}
+	if session.Version != SessionVersion {
+		return nil, fmt.Errorf("unsupported session version %d", session.Version)
+	}
+	if session.Context == nil {
+		return nil, errors.New("invalid session file: no context")
+	}
+	return &session, nil
+}
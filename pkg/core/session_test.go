@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionSaveAndRestore(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	w.AddFlow(createTestFlow())
+	w.SelectFlow("install")
+
+	ctx.Set("install_dir", "/opt/app")
+	ctx.Set("license.accepted", true)
+	ctx.Set("task_runner", NewTaskRunner(ctx, nil))
+	ctx.SetMeta("channel", "beta")
+	ctx.Runtime.Action = "install"
+	ctx.AddError(errors.New("disk almost full"))
+	ctx.AddPlannedTask(TaskSummary{ID: "files", Type: "copy", Description: "files"})
+	w.Next()
+	w.Next()
+	w.DisableStep("install")
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := SaveSession(path, ctx, w); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected a private session file, got %v %v", info, err)
+	}
+
+	// A fresh process: same config, nothing entered yet
+	restored := NewInstallContext()
+	w2 := NewWorkflow(restored, NewEventBus())
+	w2.AddFlow(createTestFlow())
+	w2.SelectFlow("install")
+
+	session, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+	if err := session.Restore(restored, w2); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if got := restored.GetString("install_dir"); got != "/opt/app" {
+		t.Errorf("expected input to be restored, got %q", got)
+	}
+	if !restored.GetBool("license.accepted") {
+		t.Error("expected nested input to be restored")
+	}
+	if _, ok := restored.Get("task_runner"); ok {
+		t.Error("expected the task runner not to be persisted")
+	}
+	if got := restored.Meta["channel"]; got != "beta" {
+		t.Errorf("expected meta to be restored, got %v", got)
+	}
+	if restored.Runtime.Action != "install" || len(restored.Runtime.Errors) != 1 {
+		t.Errorf("expected runtime to be restored, got %+v", restored.Runtime)
+	}
+	if restored.Plan == nil || len(restored.Plan.Tasks) != 1 {
+		t.Errorf("expected plan to be restored, got %+v", restored.Plan)
+	}
+
+	if got := w2.CurrentStepID(); got != "destination" || restored.Runtime.CurrentStep != "destination" {
+		t.Errorf("expected to continue at destination, got %s", got)
+	}
+	if w2.StepStatus("license") != StepCompleted || w2.StepStatus("install") != StepDisabled {
+		t.Errorf("expected step statuses to be restored")
+	}
+	if !w2.IsVisited("license") || w2.IsVisited("finish") {
+		t.Errorf("expected visited steps to be restored")
+	}
+	if _, err := w2.Prev(); err != nil {
+		t.Errorf("expected back navigation to work after restore: %v", err)
+	}
+}
+
+func TestWorkflowRestoreUnknownStep(t *testing.T) {
+	w := NewWorkflow(NewInstallContext(), NewEventBus())
+	w.AddFlow(createTestFlow())
+	w.SelectFlow("install")
+
+	if err := w.Restore(&WorkflowSnapshot{Flow: "install", Step: "gone"}); err == nil {
+		t.Error("expected error for a step the flow no longer has")
+	}
+	if err := w.Restore(&WorkflowSnapshot{Flow: "repair", Step: "welcome"}); err == nil {
+		t.Error("expected error for an unknown flow")
+	}
+	if w.CurrentStepID() != "welcome" {
+		t.Errorf("expected failed restore to leave the workflow alone, got %s", w.CurrentStepID())
+	}
+}
+
+func TestLoadSessionInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	os.WriteFile(path, []byte(`{"version": 99, "context": {}}`), 0600)
+	if _, err := LoadSession(path); err == nil {
+		t.Error("expected error for an unsupported version")
+	}
+	os.WriteFile(path, []byte(`not json`), 0600)
+	if _, err := LoadSession(path); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestSessionRestoreCoercesVariables(t *testing.T) {
+	vars := []VariableConfig{
+		{Name: "port", Type: VarInt},
+		{Name: "edition", Enum: []any{"standard", "full"}},
+		{Name: "install.dir", Type: VarPath},
+	}
+	ctx := NewInstallContext()
+	ctx.DeclareVariables(vars)
+	ctx.SetVariable("port", "8080")
+	ctx.SetVariable("edition", "full")
+	ctx.SetVariable("install.dir", "/opt/app")
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := SaveSession(path, ctx, nil); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	session, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+
+	restored := NewInstallContext()
+	restored.DeclareVariables(vars)
+	if err := session.Restore(restored, nil); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got, _ := restored.Get("port"); got != 8080 {
+		t.Errorf("expected port to be an int again, got %#v", got)
+	}
+	if got := restored.GetString("install.dir"); got != "/opt/app" {
+		t.Errorf("expected the nested path to be restored, got %q", got)
+	}
+
+	// A value the declarations no longer accept is not restored silently
+	session.Context.Input["edition"] = "trial"
+	restored = NewInstallContext()
+	restored.DeclareVariables(vars)
+	if err := session.Restore(restored, nil); err == nil {
+		t.Error("expected an error for a restored value outside the enum")
+	}
+}
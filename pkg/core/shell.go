@@ -0,0 +1,271 @@
+// Package core provides the helpers that pass context values to shell scripts.
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ShellEnvPrefix starts the names of the environment variables that pass
+// context values to scripts, e.g. GPKI_INSTALL_DIR for install_dir.
+const ShellEnvPrefix = "GPKI_"
+
+// shellQuoting is how the shell reads a position in a script.
+type shellQuoting int
+
+const (
+	shellUnquoted shellQuoting = iota
+	shellSingleQuoted
+	shellDoubleQuoted
+)
+
+// templateActionPattern matches a {{ }} action, without trim markers.
+var templateActionPattern = regexp.MustCompile(`\{\{-?\s*(.*?)\s*-?\}\}`)
+
+// templateControlWords start actions that print nothing.
+var templateControlWords = map[string]bool{
+	"if": true, "else": true, "end": true, "range": true, "with": true,
+	"define": true, "block": true, "template": true, "break": true, "continue": true,
+}
+
+var doubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+var backtickEscaper = strings.NewReplacer(`\`, `\\`, "$", `\$`, "`", "\\`")
+
+// ShellQuote quotes s for a POSIX shell, so it is passed as a single word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// RenderShell is Render for scripts run by sh. Each ${path} value is quoted
+// for where it appears: a single word when unquoted, escaped inside "..."
+// and '...', and unquoted inside $(...) or `...` substitutions. The shell
+// therefore always sees the value as data, whatever quotes or $(...) it
+// contains. {{ }} actions are not quoted; use
+// shellQuote for them.
+func (c *InstallContext) RenderShell(script string) string {
+	quoting, backticks := scanShellQuoting(script)
+	result, err := c.render(script, func(offset int, value string) string {
+		value = quoteShellValue(value, quoting[offset])
+		// A `...` body is unescaped once per level before it is parsed
+		for i := 0; i < backticks[offset]; i++ {
+			value = backtickEscaper.Replace(value)
+		}
+		return value
+	})
+	if err != nil {
+		c.AddLog(LogWarn, fmt.Sprintf("Failed to render template: %v", err))
+	}
+	return result
+}
+
+// ShellEnv returns context values as environment variables for scripts. A
+// path becomes ShellEnvPrefix plus the path in upper case with every other
+// character than letters and digits replaced by _, so install.dir and
+// install_dir are both GPKI_INSTALL_DIR. Lists and maps are passed as JSON.
+// With paths, only those values are passed; otherwise every value of the
+// user input and meta, and the environment fields as GPKI_ENV_*. Runtime
+// objects are never passed, and secrets only when listed in paths.
+func (c *InstallContext) ShellEnv(paths []string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	env := make(map[string]string)
+	if len(paths) > 0 {
+		for _, path := range paths {
+			val, ok := c.getUnlocked(path)
+			if !ok {
+				continue
+			}
+			if secret, isSecret := val.(Secret); isSecret {
+				env[ShellEnvName(path)] = secret.Reveal()
+			} else if plain, ok := journalValue(val); ok {
+				env[ShellEnvName(path)] = shellEnvValue(plain)
+			}
+		}
+		return env
+	}
+
+	// journalValue leaves out runtime objects and secrets
+	meta, _ := journalValue(c.Meta)
+	input, _ := journalValue(c.UserInput)
+	data := map[string]any{"env": c.envValuesUnlocked()}
+	mergeValues(data, meta.(map[string]any))
+	mergeValues(data, input.(map[string]any))
+	flattenShellEnv(env, "", data)
+	return env
+}
+
+// ShellEnvName returns the environment variable ShellEnv passes the value
+// at path in.
+func ShellEnvName(path string) string {
+	name := []byte(strings.ToUpper(path))
+	for i, ch := range name {
+		if (ch < 'A' || ch > 'Z') && (ch < '0' || ch > '9') {
+			name[i] = '_'
+		}
+	}
+	return ShellEnvPrefix + string(name)
+}
+
+// LintShellScript returns warnings about values a script interpolates
+// unquoted: ${path} placeholders outside quotes, whose value is now passed
+// as a single word, and {{ }} actions not piped through shellQuote. Inside
+// an action a placeholder is a template value and is not reported.
+func LintShellScript(script string) []string {
+	var warnings []string
+	quoting, _ := scanShellQuoting(script)
+	actions := templateActionPattern.FindAllStringIndex(script, -1)
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(script, -1) {
+		if quoting[m[0]] != shellUnquoted || insideSpan(actions, m[0]) {
+			continue
+		}
+		path := script[m[2]:m[3]]
+		warnings = append(warnings, fmt.Sprintf("${%s} is not quoted; write \"${%s}\" or use \"$%s\"", path, path, ShellEnvName(path)))
+	}
+	for _, m := range templateActionPattern.FindAllStringSubmatch(script, -1) {
+		action := m[1]
+		fields := strings.Fields(action)
+		if len(fields) == 0 || templateControlWords[fields[0]] || strings.HasPrefix(action, "/*") {
+			continue
+		}
+		if !strings.Contains(action, "shellQuote") {
+			warnings = append(warnings, fmt.Sprintf("%s is not shell-quoted; pipe it through shellQuote", m[0]))
+		}
+	}
+	return warnings
+}
+
+// insideSpan reports whether offset lies in one of the [start, end) spans.
+func insideSpan(spans [][]int, offset int) bool {
+	for _, span := range spans {
+		if offset >= span[0] && offset < span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// shellSubstitution is a $(...) or `...` command substitution the scanner
+// is in. Its body is read unquoted, whatever quotes enclose it.
+type shellSubstitution struct {
+	backtick bool
+	outer    shellQuoting // Quoting around the substitution
+	parens   int          // Unclosed ( in the body of a $(...)
+}
+
+// scanShellQuoting returns how the shell reads each byte of script. Quote
+// characters themselves count as outside the quotes they open or close.
+// The body of a command substitution is read as unquoted, also inside
+// double quotes, until the substitution is closed. backticks holds the
+// number of `...` substitutions each byte is in.
+func scanShellQuoting(script string) (quoting []shellQuoting, backticks []int) {
+	quoting = make([]shellQuoting, len(script))
+	backticks = make([]int, len(script))
+	state := shellUnquoted
+	var subs []shellSubstitution
+	depth := 0
+	for i := 0; i < len(script); i++ {
+		quoting[i] = state
+		backticks[i] = depth
+		ch := script[i]
+		if state == shellSingleQuoted {
+			if ch == '\'' {
+				state = shellUnquoted
+				quoting[i] = state
+			}
+			continue
+		}
+
+		switch {
+		case ch == '\\':
+			if i+1 < len(script) {
+				i++
+				quoting[i] = state
+			}
+		case ch == '$' && i+1 < len(script) && script[i+1] == '(':
+			subs = append(subs, shellSubstitution{outer: state})
+			state = shellUnquoted
+			i++
+			quoting[i] = state
+		case ch == '`':
+			if n := len(subs); n > 0 && subs[n-1].backtick && state == shellUnquoted {
+				state = subs[n-1].outer
+				subs = subs[:n-1]
+				depth--
+			} else {
+				subs = append(subs, shellSubstitution{backtick: true, outer: state})
+				state = shellUnquoted
+				depth++
+			}
+			quoting[i] = state
+		case state == shellDoubleQuoted:
+			if ch == '"' {
+				state = shellUnquoted
+				quoting[i] = state
+			}
+		case ch == '\'':
+			state = shellSingleQuoted
+		case ch == '"':
+			state = shellDoubleQuoted
+		case ch == '(' && len(subs) > 0 && !subs[len(subs)-1].backtick:
+			subs[len(subs)-1].parens++
+		case ch == ')' && len(subs) > 0 && !subs[len(subs)-1].backtick:
+			n := len(subs)
+			if subs[n-1].parens > 0 {
+				subs[n-1].parens--
+				continue
+			}
+			state = subs[n-1].outer
+			subs = subs[:n-1]
+			quoting[i] = state
+		}
+	}
+	return quoting, backticks
+}
+
+// quoteShellValue makes value literal at a position quoted as given.
+func quoteShellValue(value string, quoting shellQuoting) string {
+	switch quoting {
+	case shellSingleQuoted:
+		return strings.ReplaceAll(value, "'", `'\''`)
+	case shellDoubleQuoted:
+		return doubleQuoteEscaper.Replace(value)
+	}
+	return ShellQuote(value)
+}
+
+// flattenShellEnv adds the leaves of data to env, named by their path.
+func flattenShellEnv(env map[string]string, prefix string, data map[string]any) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if m, ok := data[k].(map[string]any); ok {
+			flattenShellEnv(env, path, m)
+			continue
+		}
+		env[ShellEnvName(path)] = shellEnvValue(data[k])
+	}
+}
+
+// shellEnvValue formats a value for an environment variable.
+func shellEnvValue(val any) string {
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if data, err := json.Marshal(val); err == nil {
+			return string(data)
+		}
+	}
+	return valueString(val)
+}
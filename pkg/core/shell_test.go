@@ -0,0 +1,139 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderShellQuotesValues(t *testing.T) {
+	evil := `it's "$(echo pwned)" $HOME ` + "`id`" + ` \ end`
+	ctx := NewInstallContext()
+	ctx.Set("dir", evil)
+
+	scripts := []string{
+		`printf '%s' ${dir}`,
+		`printf '%s' "${dir}"`,
+		`printf '%s' '${dir}'`,
+		`printf '%s' "prefix ${dir}"`,
+		`printf '%s' "$(printf '%s' ${dir})"`,
+		`printf '%s' "$(printf '%s' "${dir}")"`,
+		`printf '%s' $(printf '%s' '${dir}' | wc -c | tr -d ' ')`,
+		"printf '%s' \"`printf '%s' ${dir}`\"",
+		"printf '%s' \"`printf '%s' \"${dir}\"`\"",
+		`{{ if eq (len "${dir}") ` + fmt.Sprint(len(evil)) + ` }}printf '%s' ${dir}{{ end }}`,
+	}
+	expected := []string{evil, evil, evil, "prefix " + evil, evil, evil, fmt.Sprint(len(evil)), evil, evil, evil}
+
+	for i, script := range scripts {
+		rendered := ctx.RenderShell(script)
+		out, err := exec.Command("sh", "-c", rendered).Output()
+		if err != nil {
+			t.Errorf("%q rendered to %q, which failed: %v", script, rendered, err)
+			continue
+		}
+		if string(out) != expected[i] {
+			t.Errorf("%q rendered to %q, printed %q", script, rendered, out)
+		}
+	}
+
+	// A value in a substitution inside double quotes is not run
+	dir := t.TempDir()
+	ctx.Set("dir", "x; touch "+filepath.Join(dir, "pwned")+" #")
+	for _, script := range []string{`echo "$(ls ${dir})"`, "echo \"`ls ${dir}`\""} {
+		rendered := ctx.RenderShell(script)
+		exec.Command("sh", "-c", rendered).Run()
+		if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+			t.Errorf("%q rendered to %q, which ran the value", script, rendered)
+			os.Remove(filepath.Join(dir, "pwned"))
+		}
+	}
+
+	if got := ctx.RenderShell(`echo ${HOME} '{{ .dir | shellQuote }}'`); !strings.HasPrefix(got, "echo ${HOME} ''") {
+		t.Errorf("expected unknown placeholders and templates to be left unquoted, got %q", got)
+	}
+}
+
+func TestShellEnv(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Set("install_dir", "/opt/app")
+	ctx.Set("app.plugins", []any{"a", "b"})
+	ctx.SetMeta("app.name", "demo")
+	ctx.Env.Arch = "arm64"
+
+	env := ctx.ShellEnv(nil)
+	want := map[string]string{
+		"GPKI_INSTALL_DIR": "/opt/app",
+		"GPKI_APP_PLUGINS": `["a","b"]`,
+		"GPKI_APP_NAME":    "demo",
+		"GPKI_ENV_ARCH":    "arm64",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, env[k])
+		}
+	}
+
+	env = ctx.ShellEnv([]string{"install_dir", "missing"})
+	if len(env) != 1 || env["GPKI_INSTALL_DIR"] != "/opt/app" {
+		t.Errorf("expected only the listed values, got %v", env)
+	}
+
+	ctx.Set("task_runner", NewTaskRunner(ctx, nil))
+	ctx.SetSecret("token", "s3cr3t!")
+	env = ctx.ShellEnv(nil)
+	if _, ok := env["GPKI_TASK_RUNNER"]; ok {
+		t.Error("expected runtime objects not to be passed")
+	}
+	if _, ok := env["GPKI_TOKEN"]; ok {
+		t.Error("expected secrets to be passed only when listed")
+	}
+	if env = ctx.ShellEnv([]string{"token", "task_runner"}); len(env) != 1 || env["GPKI_TOKEN"] != "s3cr3t!" {
+		t.Errorf("expected a listed secret to be passed, got %v", env)
+	}
+}
+
+func TestLintShellScript(t *testing.T) {
+	warnings := LintShellScript(`cp ${src} "${dst}" '${x}' {{ .a }} {{ .b | shellQuote }} {{ if .c }}{{ end }} {{ if eq ${c} "x" }}{{ end }}`)
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0], "${src}") || !strings.Contains(warnings[0], "$GPKI_SRC") {
+		t.Errorf("unexpected placeholder warning %q", warnings[0])
+	}
+	if !strings.Contains(warnings[1], "{{ .a }}") {
+		t.Errorf("unexpected template warning %q", warnings[1])
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	cfg := &Config{
+		Flows: map[string]*FlowConfig{
+			"install": {Steps: []*StepConfig{{
+				ID: "deploy",
+				Tasks: []TaskConfig{
+					{Type: "shell", ID: "copy", Params: map[string]any{"command": "cp -r app ${install_dir}"}},
+					{Type: "shell", Params: map[string]any{"command": "${tool}", "args": []any{"${x}"}}},
+					{Type: "copy", Params: map[string]any{"from": "${src}"}},
+				},
+			}}},
+		},
+		Uninstall: &UninstallConfig{Tasks: []TaskConfig{
+			{Type: "shell", Params: map[string]any{"command": "true", "rollbackCommand": "rm -rf ${install_dir}"}},
+		}},
+	}
+
+	warnings := LintConfig(cfg)
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	if !strings.HasPrefix(warnings[0], "flow install, step deploy, task copy: command: ${install_dir}") {
+		t.Errorf("unexpected warning %q", warnings[0])
+	}
+	if !strings.HasPrefix(warnings[1], "uninstall.tasks, task #1 (shell): rollbackCommand:") {
+		t.Errorf("unexpected warning %q", warnings[1])
+	}
+}
@@ -0,0 +1,122 @@
+// Package core provides step lifecycle hooks.
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HookPhase names a point in a step's lifecycle at which tasks run.
+type HookPhase string
+
+const (
+	// HookEnter runs when navigation arrives at a step, before it is shown.
+	HookEnter HookPhase = "onEnter"
+	// HookLeave runs when navigation leaves a step, after its screen has
+	// collected its input and its guards have passed.
+	HookLeave HookPhase = "onLeave"
+)
+
+// HookError reports a failed step hook. Navigation that ran the hook did not
+// take place.
+type HookError struct {
+	StepID string
+	Phase  HookPhase
+	Err    error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("step %s %s failed: %v", e.StepID, e.Phase, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// Hooks returns the tasks the step runs in the given phase.
+func (s *Step) Hooks(phase HookPhase) []TaskConfig {
+	if s == nil || s.Config == nil {
+		return nil
+	}
+	switch phase {
+	case HookEnter:
+		return s.Config.OnEnter
+	case HookLeave:
+		return s.Config.OnLeave
+	}
+	return nil
+}
+
+// runHooks runs the step's tasks for a phase with a runner of their own, so
+// they do not mix with the step's main task list in progress or the journal.
+// Callers must not hold w.mu.
+func (w *Workflow) runHooks(step *Step, phase HookPhase) error {
+	tasks := step.Hooks(phase)
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	runner := NewTaskRunner(w.ctx, w.bus)
+	runner.step = step.ID
+	runner.hook = string(phase)
+	for _, config := range tasks {
+		if err := runner.QueueConfig(config); err != nil {
+			return &HookError{StepID: step.ID, Phase: phase, Err: err}
+		}
+	}
+
+	// The hooks of a step being entered run before it becomes current
+	w.ctx.log(LogEntry{
+		Level:   LogInfo,
+		Message: fmt.Sprintf("Running %s tasks of step %s", phase, step.ID),
+		Step:    step.ID,
+	})
+	if err := runner.Run(); err != nil {
+		return &HookError{StepID: step.ID, Phase: phase, Err: err}
+	}
+	return nil
+}
+
+// runTransition runs the onLeave hooks of the step being left and then the
+// onEnter hooks of the step being entered. In between it elevates if the
+// step entered needs privileges; the step left ends up with fromStatus.
+func (w *Workflow) runTransition(from, to *Step, fromStatus StepStatus) error {
+	if err := w.runHooks(from, HookLeave); err != nil {
+		return err
+	}
+	if err := w.elevateFor(to, from, fromStatus); err != nil {
+		return err
+	}
+	return w.runHooks(to, HookEnter)
+}
+
+// EnterCurrentStep runs the onEnter hooks of the current step. Call it once
+// the flow is selected (and resumed, if at all) and before the step is
+// shown; Next, Prev and JumpTo run the hooks of the steps they move to.
+func (w *Workflow) EnterCurrentStep() error {
+	w.nav.Lock()
+	defer w.nav.Unlock()
+
+	step := w.CurrentStep()
+	if step == nil {
+		return errors.New("no flow selected")
+	}
+	if err := w.elevateFor(step, nil, StepCurrent); err != nil {
+		return err
+	}
+	return w.runHooks(step, HookEnter)
+}
+
+// LeaveCurrentStep runs the onLeave hooks of the current step. Call it when
+// the last step is done, before Complete; leaving a step through Next, Prev
+// or JumpTo runs its hooks already.
+func (w *Workflow) LeaveCurrentStep() error {
+	w.nav.Lock()
+	defer w.nav.Unlock()
+
+	step := w.CurrentStep()
+	if step == nil {
+		return errors.New("no flow selected")
+	}
+	return w.runHooks(step, HookLeave)
+}
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var (
+	hookMockMu  sync.Mutex
+	hookMockRan []string
+)
+
+// registerHookMock registers a task that records its ID when it runs and
+// fails if its "fail" param is set.
+func registerHookMock() {
+	hookMockMu.Lock()
+	hookMockRan = nil
+	hookMockMu.Unlock()
+
+	_ = Tasks.Register("hookMock", func(config map[string]any, ctx *InstallContext) (Task, error) {
+		task := NewMockTask(config["id"].(string), "hookMock")
+		fail, _ := config["fail"].(bool)
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			hookMockMu.Lock()
+			hookMockRan = append(hookMockRan, task.TaskID)
+			hookMockMu.Unlock()
+			if fail {
+				return errors.New("hook failed")
+			}
+			return nil
+		}
+		return task, nil
+	})
+}
+
+func takeHookMockRan() []string {
+	hookMockMu.Lock()
+	defer hookMockMu.Unlock()
+	ran := hookMockRan
+	hookMockRan = nil
+	return ran
+}
+
+func hookTask(id string) TaskConfig {
+	return TaskConfig{Type: "hookMock", ID: id}
+}
+
+func TestWorkflowRunsStepHooks(t *testing.T) {
+	registerHookMock()
+	w := NewWorkflow(NewInstallContext(), NewEventBus())
+
+	flow := &Flow{
+		ID:    "test",
+		Entry: "a",
+		Steps: []*Step{
+			{ID: "a", Title: "A", Config: &StepConfig{
+				OnEnter: []TaskConfig{hookTask("enter-a")},
+				OnLeave: []TaskConfig{hookTask("leave-a")},
+			}},
+			{ID: "b", Title: "B", Config: &StepConfig{
+				OnEnter: []TaskConfig{hookTask("enter-b")},
+				OnLeave: []TaskConfig{hookTask("leave-b")},
+			}},
+		},
+	}
+	w.AddFlow(flow)
+	w.SelectFlow("test")
+
+	if err := w.EnterCurrentStep(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := w.Next(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := w.Prev(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.JumpTo("b"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.LeaveCurrentStep(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"enter-a", "leave-a", "enter-b", "leave-b", "enter-a", "leave-a", "enter-b", "leave-b"}
+	if got := takeHookMockRan(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected hooks %v, got %v", want, got)
+	}
+}
+
+func TestWorkflowHookFailureBlocksNavigation(t *testing.T) {
+	registerHookMock()
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+
+	failing := hookTask("detect")
+	failing.Params = map[string]any{"fail": true}
+	flow := &Flow{
+		ID:    "test",
+		Entry: "a",
+		Steps: []*Step{
+			{ID: "a", Title: "A", Config: &StepConfig{OnLeave: []TaskConfig{hookTask("leave-a")}}},
+			{ID: "b", Title: "B", Config: &StepConfig{OnEnter: []TaskConfig{failing}}},
+		},
+	}
+	w.AddFlow(flow)
+	w.SelectFlow("test")
+
+	_, err := w.Next()
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("expected HookError, got %v", err)
+	}
+	if hookErr.StepID != "b" || hookErr.Phase != HookEnter {
+		t.Errorf("expected b onEnter to fail, got %s %s", hookErr.StepID, hookErr.Phase)
+	}
+	if w.CurrentStepID() != "a" || ctx.Runtime.CurrentStep != "a" {
+		t.Errorf("expected to stay on a, got %s", w.CurrentStepID())
+	}
+	if w.StepStatus("a") != StepCurrent || w.IsVisited("b") {
+		t.Error("expected step state to be unchanged")
+	}
+	if got := takeHookMockRan(); !reflect.DeepEqual(got, []string{"leave-a", "detect"}) {
+		t.Errorf("unexpected hooks run: %v", got)
+	}
+}
+
+func TestWorkflowLeaveHooksDecideRoute(t *testing.T) {
+	registerHookMock()
+	_ = Tasks.Register("hookSetMode", func(config map[string]any, ctx *InstallContext) (Task, error) {
+		task := NewMockTask("normalize", "hookSetMode")
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			ctx.Set("mode", "b")
+			return nil
+		}
+		return task, nil
+	})
+	normalize := []TaskConfig{{Type: "hookSetMode"}}
+
+	flows := map[string]*Flow{
+		"when": {ID: "when", Entry: "start", Steps: []*Step{
+			{ID: "start", Config: &StepConfig{OnLeave: normalize}},
+			{ID: "a", When: `mode == "a"`, Config: &StepConfig{OnEnter: []TaskConfig{hookTask("enter-a")}}},
+			{ID: "b", Config: &StepConfig{OnEnter: []TaskConfig{hookTask("enter-b")}}},
+		}},
+		"branch": {ID: "branch", Entry: "start", Steps: []*Step{
+			{ID: "start", Branch: &BranchConfig{Condition: "mode", Branches: map[string]string{"a": "a", "b": "b"}},
+				Config: &StepConfig{OnLeave: normalize}},
+			{ID: "a", Config: &StepConfig{OnEnter: []TaskConfig{hookTask("enter-a")}}},
+			{ID: "b", Config: &StepConfig{OnEnter: []TaskConfig{hookTask("enter-b")}}},
+		}},
+	}
+	for name, flow := range flows {
+		ctx := NewInstallContext()
+		ctx.Set("mode", "a")
+		w := NewWorkflow(ctx, NewEventBus())
+		w.AddFlow(flow)
+		w.SelectFlow(name)
+
+		next, err := w.Next()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if next != "b" {
+			t.Errorf("%s: expected the normalized input to route to b, got %s", name, next)
+		}
+		if got := takeHookMockRan(); !reflect.DeepEqual(got, []string{"enter-b"}) {
+			t.Errorf("%s: expected only b to be entered, got %v", name, got)
+		}
+	}
+}
+
+func TestBuildTaskPlanIncludesHooks(t *testing.T) {
+	plan := BuildTaskPlan(&FlowConfig{Steps: []*StepConfig{{
+		ID:      "dest",
+		OnEnter: []TaskConfig{{Type: "shell", ID: "detect"}},
+		Tasks:   []TaskConfig{{Type: "copy", ID: "files"}},
+		OnLeave: []TaskConfig{{Type: "shell", ID: "normalize"}},
+	}}})
+
+	var got []string
+	for _, task := range plan.Tasks {
+		got = append(got, task.Description)
+	}
+	want := []string{"detect (onEnter)", "files", "normalize (onLeave)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if plan.Tasks[0].Hook != "onEnter" {
+		t.Errorf("expected hook to be recorded, got %q", plan.Tasks[0].Hook)
+	}
+}
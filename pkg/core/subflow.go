@@ -0,0 +1,181 @@
+// Package core provides sub-flow expansion for flow configs.
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SubflowSeparator joins the ID of a step that calls a sub-flow with the IDs
+// of the sub-flow's steps, e.g. "repair/license".
+const SubflowSeparator = "/"
+
+// ExpandSubflows replaces every step that calls another flow (flow: <id>)
+// with a copy of that flow's steps, so the workflow navigates through them
+// like any other step and then returns to the caller:
+//
+//   - copied step IDs are prefixed with the call step's ID, and next, prev
+//     and branch targets inside the sub-flow are rewritten to match;
+//   - the last copied step continues with the call step's next, and the
+//     first one goes back to the call step's prev;
+//   - the call step's when: applies to every copied step;
+//   - references to the call step elsewhere lead to its first copied step.
+//
+// A sub-flow always runs from its first step. Sub-flows may call further
+// sub-flows; cycles are reported as errors.
+func ExpandSubflows(cfg *Config) error {
+	flows := make(map[string]*FlowConfig, len(cfg.Flows)+1)
+	for id, flow := range cfg.Flows {
+		if flow != nil {
+			flows[id] = flow
+		}
+	}
+	if cfg.Flow != nil {
+		if _, exists := flows["flow"]; !exists {
+			flows["flow"] = cfg.Flow
+		}
+	}
+
+	// Expand from the original steps of every flow, then swap them in.
+	expanded := make(map[*FlowConfig][]*StepConfig, len(flows))
+	for id, flow := range flows {
+		steps, entries, err := expandSteps(flows, flow.Steps, []string{id})
+		if err != nil {
+			return fmt.Errorf("flow %s: %w", id, err)
+		}
+		if target, ok := entries[flow.Entry]; ok {
+			flow.Entry = target
+		}
+		expanded[flow] = steps
+	}
+	for flow, steps := range expanded {
+		flow.Steps = steps
+	}
+	return nil
+}
+
+// expandSteps inlines the sub-flows called from steps. It returns the new
+// steps and, for each call step, the ID of the step that replaced it.
+func expandSteps(flows map[string]*FlowConfig, steps []*StepConfig, stack []string) ([]*StepConfig, map[string]string, error) {
+	var result []*StepConfig
+	entries := make(map[string]string)
+	for _, step := range steps {
+		if step == nil || step.Flow == "" {
+			result = append(result, step)
+			continue
+		}
+
+		target, ok := flows[step.Flow]
+		if !ok {
+			return nil, nil, fmt.Errorf("step %s calls unknown flow %q", step.ID, step.Flow)
+		}
+		for _, id := range stack {
+			if id == step.Flow {
+				return nil, nil, fmt.Errorf("step %s calls flow %q recursively (%s)", step.ID, step.Flow, strings.Join(append(stack, step.Flow), " -> "))
+			}
+		}
+		if step.Screen != nil || len(step.AllTasks()) > 0 || len(step.Guards) > 0 || step.Branch != nil {
+			return nil, nil, fmt.Errorf("step %s calls flow %q and cannot also have a screen, tasks, hooks, guards or a branch", step.ID, step.Flow)
+		}
+
+		inner, innerEntries, err := expandSteps(flows, target.Steps, append(stack, step.Flow))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(inner) == 0 {
+			return nil, nil, fmt.Errorf("step %s calls flow %q, which has no steps", step.ID, step.Flow)
+		}
+
+		prefixed := make(map[string]string, len(inner)+len(innerEntries))
+		for _, s := range inner {
+			prefixed[s.ID] = step.ID + SubflowSeparator + s.ID
+		}
+		for id, first := range innerEntries {
+			prefixed[id] = prefixed[first]
+		}
+		rename := func(id string) string {
+			if renamed, ok := prefixed[id]; ok {
+				return renamed
+			}
+			return id
+		}
+
+		for i, s := range inner {
+			copied := *s
+			copied.ID = rename(s.ID)
+			copied.Next = rename(s.Next)
+			copied.Prev = rename(s.Prev)
+			if s.Branch != nil {
+				branch := *s.Branch
+				branch.Default = rename(branch.Default)
+				branch.Branches = make(map[string]string, len(s.Branch.Branches))
+				for value, target := range s.Branch.Branches {
+					branch.Branches[value] = rename(target)
+				}
+				copied.Branch = &branch
+			}
+			copied.When = joinConditions(step.When, s.When)
+			copied.CalledFrom = append([]string{step.ID}, s.CalledFrom...)
+			for j, caller := range s.CalledFrom {
+				copied.CalledFrom[j+1] = step.ID + SubflowSeparator + caller
+			}
+
+			if i == 0 && copied.Prev == "" {
+				copied.Prev = step.Prev
+			}
+			if i == len(inner)-1 && copied.Next == "" && copied.Branch == nil {
+				copied.Next = step.Next
+			}
+			result = append(result, &copied)
+		}
+		entries[step.ID] = result[len(result)-len(inner)].ID
+	}
+
+	// Steps that name a call step go to its first copied step instead.
+	if len(entries) > 0 {
+		for i, s := range result {
+			if s == nil {
+				continue
+			}
+			_, callsNext := entries[s.Next]
+			_, callsPrev := entries[s.Prev]
+			if !callsNext && !callsPrev && s.Branch == nil {
+				continue
+			}
+			copied := *s
+			if callsNext {
+				copied.Next = entries[s.Next]
+			}
+			if callsPrev {
+				copied.Prev = entries[s.Prev]
+			}
+			if s.Branch != nil {
+				branch := *s.Branch
+				if first, ok := entries[branch.Default]; ok {
+					branch.Default = first
+				}
+				branch.Branches = make(map[string]string, len(s.Branch.Branches))
+				for value, target := range s.Branch.Branches {
+					if first, ok := entries[target]; ok {
+						target = first
+					}
+					branch.Branches[value] = target
+				}
+				copied.Branch = &branch
+			}
+			result[i] = &copied
+		}
+	}
+	return result, entries, nil
+}
+
+// joinConditions combines two when: conditions so both must hold.
+func joinConditions(outer, inner string) string {
+	switch {
+	case strings.TrimSpace(outer) == "":
+		return inner
+	case strings.TrimSpace(inner) == "":
+		return outer
+	}
+	return "(" + outer + ") && (" + inner + ")"
+}
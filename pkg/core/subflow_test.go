@@ -0,0 +1,175 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func subflowTestConfig() *Config {
+	return &Config{Flows: map[string]*FlowConfig{
+		"install": {Entry: "welcome", Steps: []*StepConfig{
+			{ID: "welcome", Title: "Welcome", Next: "common"},
+			{ID: "common", Flow: "shared", When: "!quick"},
+			{ID: "finish", Title: "Finish"},
+		}},
+		"shared": {Entry: "license", Steps: []*StepConfig{
+			{ID: "license", Title: "License"},
+			{ID: "options", Flow: "options"},
+			{ID: "install", Title: "Install", When: "ready"},
+		}},
+		"options": {Entry: "pick", Steps: []*StepConfig{
+			{ID: "pick", Title: "Pick", Branch: &BranchConfig{
+				Condition: "custom",
+				Branches:  map[string]string{"true": "custom"},
+				Default:   "done",
+			}},
+			{ID: "custom", Title: "Custom"},
+			{ID: "done", Title: "Done"},
+		}},
+	}}
+}
+
+func TestExpandSubflows(t *testing.T) {
+	cfg := subflowTestConfig()
+	if err := ExpandSubflows(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	steps := cfg.Flows["install"].Steps
+	var ids []string
+	byID := make(map[string]*StepConfig)
+	for _, step := range steps {
+		ids = append(ids, step.ID)
+		byID[step.ID] = step
+	}
+	want := []string{
+		"welcome",
+		"common/license",
+		"common/options/pick", "common/options/custom", "common/options/done",
+		"common/install",
+		"finish",
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("expected steps %v, got %v", want, ids)
+	}
+
+	if got := byID["welcome"].Next; got != "common/license" {
+		t.Errorf("expected next of a call step to lead into the sub-flow, got %q", got)
+	}
+	if got := byID["common/options/pick"].Branch.Branches["true"]; got != "common/options/custom" {
+		t.Errorf("expected branch targets to be renamed, got %q", got)
+	}
+	if got := byID["common/options/pick"].Branch.Default; got != "common/options/done" {
+		t.Errorf("expected branch default to be renamed, got %q", got)
+	}
+	if got := byID["common/install"].When; got != "(!quick) && (ready)" {
+		t.Errorf("expected call condition to be joined, got %q", got)
+	}
+	if got := byID["common/options/done"].CalledFrom; !reflect.DeepEqual(got, []string{"common", "common/options"}) {
+		t.Errorf("expected CalledFrom to list both calls, got %v", got)
+	}
+
+	// The called flows keep working on their own
+	if got := cfg.Flows["shared"].Steps[1].ID; got != "options/pick" {
+		t.Errorf("expected shared flow to be expanded too, got %q", got)
+	}
+}
+
+func TestExpandSubflowsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		flows map[string]*FlowConfig
+		want  string
+	}{
+		{
+			name: "unknown",
+			flows: map[string]*FlowConfig{"a": {Steps: []*StepConfig{
+				{ID: "call", Flow: "missing"},
+			}}},
+			want: `unknown flow "missing"`,
+		},
+		{
+			name: "recursive",
+			flows: map[string]*FlowConfig{
+				"a": {Steps: []*StepConfig{{ID: "call", Flow: "b"}}},
+				"b": {Steps: []*StepConfig{{ID: "back", Flow: "a"}}},
+			},
+			want: "recursively",
+		},
+		{
+			name: "screen",
+			flows: map[string]*FlowConfig{
+				"a": {Steps: []*StepConfig{{ID: "call", Flow: "b", Screen: &ScreenConfig{Type: "finish"}}}},
+				"b": {Steps: []*StepConfig{{ID: "x", Title: "X"}}},
+			},
+			want: "cannot also have a screen",
+		},
+	}
+
+	for _, tt := range tests {
+		err := ExpandSubflows(&Config{Flows: tt.flows})
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error to mention %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestWorkflowNavigatesSubflows(t *testing.T) {
+	cfg := subflowTestConfig()
+	if err := ExpandSubflows(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	flowCfg := cfg.Flows["install"]
+	flow := &Flow{ID: "install", Entry: flowCfg.Entry}
+	for _, stepCfg := range flowCfg.Steps {
+		flow.Steps = append(flow.Steps, &Step{
+			ID:         stepCfg.ID,
+			Title:      stepCfg.Title,
+			Next:       stepCfg.Next,
+			Prev:       stepCfg.Prev,
+			Branch:     stepCfg.Branch,
+			When:       stepCfg.When,
+			CalledFrom: stepCfg.CalledFrom,
+		})
+	}
+	w.AddFlow(flow)
+	w.SelectFlow("install")
+	ctx.Set("ready", true)
+
+	var visited []string
+	for !w.IsLastStep() {
+		stepID, err := w.Next()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		visited = append(visited, stepID)
+	}
+	want := []string{"common/license", "common/options/pick", "common/options/done", "common/install", "finish"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("expected to walk %v, got %v", want, visited)
+	}
+	if depth := flow.Steps[2].Depth(); depth != 2 {
+		t.Errorf("expected nested step depth 2, got %d", depth)
+	}
+
+	if stepID, _ := w.Prev(); stepID != "common/install" {
+		t.Errorf("expected Prev to return into the sub-flow, got %q", stepID)
+	}
+	if err := w.JumpTo("welcome"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A false call condition skips the whole sub-flow
+	ctx.Set("quick", true)
+	if stepID, _ := w.Next(); stepID != "finish" {
+		t.Errorf("expected skipped sub-flow, got %q", stepID)
+	}
+}
@@ -19,6 +19,7 @@ const (
 	TaskFailed
 	TaskCancelled
 	TaskRolledBack
+	TaskSkipped
 )
 
 func (s TaskState) String() string {
@@ -35,6 +36,8 @@ func (s TaskState) String() string {
 		return "cancelled"
 	case TaskRolledBack:
 		return "rolled_back"
+	case TaskSkipped:
+		return "skipped"
 	default:
 		return "unknown"
 	}
@@ -54,6 +57,9 @@ const (
 	FailureRetry
 )
 
+// ErrCancelled is returned by TaskRunner.Run when the run was cancelled.
+var ErrCancelled = errors.New("execution cancelled")
+
 // TaskResult contains the result of a task execution.
 type TaskResult struct {
 	TaskID    string
@@ -92,6 +98,19 @@ func (t *BaseTask) Rollback(ctx *InstallContext, bus *EventBus) error {
 	return nil
 }
 
+// Log adds a log entry attributed to the task, with key/value fields given
+// as alternating keys and values. Unlike ctx.AddLog, it names the task even
+// when other tasks run at the same time.
+func (t *BaseTask) Log(ctx *InstallContext, level LogLevel, message string, keyvals ...any) {
+	ctx.log(LogEntry{
+		Level:    level,
+		Message:  message,
+		TaskID:   t.TaskID,
+		TaskType: t.TaskType,
+		Fields:   logFields(keyvals),
+	})
+}
+
 // GetConfigString safely retrieves a string from config.
 func (t *BaseTask) GetConfigString(key string) string {
 	if v, ok := t.Config[key].(string); ok {
@@ -122,18 +141,44 @@ func (t *BaseTask) GetConfigInt(key string) int {
 	}
 }
 
+// taskMeta holds per-task settings that are not part of the Task interface.
+type taskMeta struct {
+	policy    *TaskPolicy       // Failure handling override (nil = runner default)
+	config    map[string]any    // Factory params, journaled so the task can be recreated
+	dependsOn []string          // IDs of tasks that must complete first
+	weight    float64           // Declared weight for progress (0 = estimate)
+	when      string            // Condition checked again before the task runs
+	skipWhen  string            // Unmet when: condition at queue time
+	loop      string            // ID of the forEach task this instance expands
+	register  string            // Context path that receives all task outputs
+	outputs   map[string]string // Output name to context path
+}
+
+// skippedTask stands in for a task whose when: condition was false, so it
+// keeps its place in results, plans and dependency graphs.
+type skippedTask struct {
+	BaseTask
+}
+
+func (t *skippedTask) Validate() error { return nil }
+
+func (t *skippedTask) Execute(ctx *InstallContext, bus *EventBus) error { return nil }
+
 // TaskRunner executes a sequence of tasks with progress tracking and rollback support.
 type TaskRunner struct {
 	mu sync.RWMutex
 
 	tasks          []Task
+	meta           []taskMeta // Per-task settings, parallel to tasks
 	results        []TaskResult
-	completedTasks []Task // For rollback
+	completedTasks []Task   // For rollback
+	completedKeys  []string // Journal keys, parallel to completedTasks
 
 	ctx           *InstallContext
 	bus           *EventBus
 	failurePolicy FailurePolicy
 	maxRetries    int
+	backoff       Backoff
 
 	// Cancellation
 	cancelCtx  context.Context
@@ -141,14 +186,26 @@ type TaskRunner struct {
 	cancelled  bool
 
 	// State
-	currentIndex int
-	running      bool
+	step        string          // Step the tasks belong to (default: current step)
+	hook        string          // Step hook the tasks run for, if any
+	loops       map[string]bool // IDs of queued forEach tasks, even if empty
+	concurrency int             // Maximum tasks running at once in graph mode
+	running     bool
+	done        sync.WaitGroup // Released when the current Run returns
+
+	// Progress of the current run
+	weights     []float64 // Per-task weight, parallel to tasks
+	taskDone    []float64 // Completed fraction of each task
+	active      []bool    // Tasks currently executing
+	totalWeight float64
+	progress    float64
+	startedAt   time.Time
 }
 
 // NewTaskRunner creates a new TaskRunner.
 func NewTaskRunner(ctx *InstallContext, bus *EventBus) *TaskRunner {
 	cancelCtx, cancelFunc := context.WithCancel(context.Background())
-	return &TaskRunner{
+	runner := &TaskRunner{
 		tasks:          make([]Task, 0),
 		results:        make([]TaskResult, 0),
 		completedTasks: make([]Task, 0),
@@ -156,10 +213,27 @@ func NewTaskRunner(ctx *InstallContext, bus *EventBus) *TaskRunner {
 		bus:            bus,
 		failurePolicy:  FailureAbort,
 		maxRetries:     3,
+		backoff:        DefaultBackoff(),
 		cancelCtx:      cancelCtx,
 		cancelFunc:     cancelFunc,
-		currentIndex:   -1,
+		concurrency:    DefaultConcurrency,
 	}
+	return runner
+}
+
+// SetTaskRunner records the runner of the current step, so it can be
+// cancelled from elsewhere, e.g. on an interrupt.
+func (c *InstallContext) SetTaskRunner(runner *TaskRunner) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runner = runner
+}
+
+// TaskRunner returns the runner of the current step, if any.
+func (c *InstallContext) TaskRunner() *TaskRunner {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.runner
 }
 
 // SetFailurePolicy sets the failure handling policy.
@@ -172,12 +246,18 @@ func (r *TaskRunner) SetMaxRetries(count int) {
 	r.maxRetries = count
 }
 
+// SetBackoff sets the default delay strategy between retry attempts.
+func (r *TaskRunner) SetBackoff(backoff Backoff) {
+	r.backoff = backoff
+}
+
 // AddTask adds a task to the run queue.
 func (r *TaskRunner) AddTask(task Task) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.tasks = append(r.tasks, task)
+	r.meta = append(r.meta, taskMeta{})
 }
 
 // AddTasks adds multiple tasks to the run queue.
@@ -186,17 +266,36 @@ func (r *TaskRunner) AddTasks(tasks []Task) {
 	defer r.mu.Unlock()
 
 	r.tasks = append(r.tasks, tasks...)
+	r.meta = append(r.meta, make([]taskMeta, len(tasks))...)
+}
+
+// AddTaskWithPolicy adds a task whose failure handling overrides the runner defaults.
+func (r *TaskRunner) AddTaskWithPolicy(task Task, policy TaskPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tasks = append(r.tasks, task)
+	r.meta = append(r.meta, taskMeta{policy: &policy})
 }
 
 // QueueConfig adds a task from a TaskConfig to the run queue.
-// This method uses the task registry to create the task.
+// This method uses the task registry to create the task. A config with
+// forEach: is expanded into one task per item.
 func (r *TaskRunner) QueueConfig(config TaskConfig) error {
+	if config.ForEach != "" {
+		return r.queueLoop(config)
+	}
+	return r.queueTask(config)
+}
+
+// queueTask creates a single task from its config and queues it.
+func (r *TaskRunner) queueTask(config TaskConfig) error {
 	taskType := config.Type
-	factory, ok := Tasks.Get(taskType)
-	if !ok && IsGoExtension(taskType) {
-		factory, ok = Tasks.Get(StripGoPrefix(taskType))
+	policy, err := TaskPolicyFromConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid failure policy for task %s: %w", config.Type, err)
 	}
-	if !ok {
+	if _, ok := lookupTaskFactory(taskType); !ok {
 		return fmt.Errorf("unknown task type: %s", taskType)
 	}
 
@@ -210,16 +309,100 @@ func (r *TaskRunner) QueueConfig(config TaskConfig) error {
 		params["id"] = config.ID
 	}
 
-	task, err := factory(params, r.ctx)
-	if err != nil {
-		return fmt.Errorf("failed to create task %s: %w", config.Type, err)
+	meta := taskMeta{
+		policy:    &policy,
+		config:    params,
+		dependsOn: config.DependsOn,
+		weight:    config.Weight,
+		when:      config.When,
+		register:  config.Register,
+		outputs:   config.Outputs,
+	}
+
+	run := true
+	if config.When != "" {
+		run, err = EvalCondition(r.ctx, config.When)
+		if err != nil {
+			return fmt.Errorf("invalid when condition for task %s: %w", config.Type, err)
+		}
+	}
+
+	var task Task
+	if run {
+		task, err = r.createTask(params)
+		if err != nil {
+			return fmt.Errorf("failed to create task %s: %w", config.Type, err)
+		}
+	} else {
+		id := config.ID
+		if id == "" {
+			id = taskType
+		}
+		task = &skippedTask{BaseTask{TaskID: id, TaskType: taskType, Config: config.Params}}
+		meta.skipWhen = config.When
 	}
 
-	r.AddTask(task)
+	r.mu.Lock()
+	r.tasks = append(r.tasks, task)
+	r.meta = append(r.meta, meta)
+	r.mu.Unlock()
 	return nil
 }
 
-// Run executes all tasks in sequence.
+// lookupTaskFactory finds the registered factory for a task type.
+func lookupTaskFactory(taskType string) (TaskFactory, bool) {
+	factory, ok := Tasks.Get(taskType)
+	if !ok && IsGoExtension(taskType) {
+		factory, ok = Tasks.Get(StripGoPrefix(taskType))
+	}
+	return factory, ok
+}
+
+// createTask creates a task from its factory params.
+func (r *TaskRunner) createTask(params map[string]any) (Task, error) {
+	taskType, _ := params["type"].(string)
+	factory, ok := lookupTaskFactory(taskType)
+	if !ok {
+		return nil, fmt.Errorf("unknown task type: %s", taskType)
+	}
+	return factory(params, r.ctx)
+}
+
+// prepareTask brings a config-queued task up to date just before it runs:
+// its when: condition is evaluated again and the task is re-created, so
+// both see the outputs of tasks that ran before it. It returns the task to
+// run and the condition that was not met, if any.
+func (r *TaskRunner) prepareTask(index int) (Task, string, error) {
+	r.mu.RLock()
+	task, meta := r.tasks[index], r.meta[index]
+	r.mu.RUnlock()
+	if meta.config == nil {
+		return task, meta.skipWhen, nil
+	}
+
+	if meta.when != "" {
+		run, err := EvalCondition(r.ctx, meta.when)
+		if err != nil {
+			return task, "", fmt.Errorf("invalid when condition: %w", err)
+		}
+		if !run {
+			return task, meta.when, nil
+		}
+	}
+
+	fresh, err := r.createTask(meta.config)
+	if err != nil {
+		return task, "", fmt.Errorf("failed to create task: %w", err)
+	}
+	r.mu.Lock()
+	r.tasks[index] = fresh
+	r.mu.Unlock()
+	return fresh, "", nil
+}
+
+// Run executes all tasks. Tasks run in queue order unless any of them
+// declares dependencies, in which case they are scheduled as a graph with up
+// to the configured number of tasks running at once.
 func (r *TaskRunner) Run() error {
 	r.mu.Lock()
 	if r.running {
@@ -227,24 +410,37 @@ func (r *TaskRunner) Run() error {
 		return errors.New("runner already running")
 	}
 	r.running = true
+	r.done.Add(1)
 	r.mu.Unlock()
+	r.resetProgress()
+
+	// Follow the tasks' own progress reports only while they run
+	var progressSub *Subscription
+	if r.bus != nil {
+		progressSub = r.bus.Subscribe(EventTaskProgress, r.onTaskProgress)
+	}
 
 	defer func() {
+		progressSub.Unsubscribe()
 		r.mu.Lock()
 		r.running = false
 		r.mu.Unlock()
+		r.done.Done()
 	}()
 
-	totalTasks := len(r.tasks)
-	if totalTasks == 0 {
+	if len(r.tasks) == 0 {
 		return nil
 	}
 
-	for i, task := range r.tasks {
-		r.mu.Lock()
-		r.currentIndex = i
-		r.mu.Unlock()
+	if r.hasDependencies() {
+		return r.runGraph()
+	}
+	return r.runSequential()
+}
 
+// runSequential executes all tasks one after another in queue order.
+func (r *TaskRunner) runSequential() error {
+	for i, task := range r.tasks {
 		// Check cancellation
 		select {
 		case <-r.cancelCtx.Done():
@@ -252,17 +448,17 @@ func (r *TaskRunner) Run() error {
 		default:
 		}
 
-		result := r.runTask(task, i, totalTasks)
-		r.mu.Lock()
-		r.results = append(r.results, result)
-		r.mu.Unlock()
+		if r.resumeTask(task, i) {
+			continue
+		}
+
+		result, onFailure := r.executeTask(i)
+		if result.State == TaskCancelled {
+			return r.handleCancellation()
+		}
 
 		if result.State == TaskFailed {
-			r.ctx.AddError(result.Error)
-			if result.Error != nil {
-				r.ctx.AddLog(LogError, fmt.Sprintf("Task %s failed: %v", task.ID(), result.Error))
-			}
-			switch r.failurePolicy {
+			switch onFailure {
 			case FailureAbort:
 				return result.Error
 			case FailureSkip:
@@ -274,22 +470,122 @@ func (r *TaskRunner) Run() error {
 				}
 				return result.Error
 			case FailureRetry:
-				// Retry is handled in runTask
+				// Retries are exhausted by runTask; the task still failed.
 				return result.Error
 			}
 		}
+	}
+
+	return nil
+}
+
+// executeTask runs the task at index with journaling and records its result.
+// It returns the result and the failure policy that applies to the task.
+func (r *TaskRunner) executeTask(index int) (TaskResult, FailurePolicy) {
+	onFailure, attempts, backoff := r.resolvePolicy(index)
 
-		if result.State == TaskCompleted && task.CanRollback() {
-			r.mu.Lock()
-			r.completedTasks = append(r.completedTasks, task)
-			r.mu.Unlock()
+	task, skipWhen, err := r.prepareTask(index)
+	defer r.ctx.enterTask(r.stepID(), task)()
+	if err != nil {
+		now := time.Now()
+		result := TaskResult{
+			TaskID:    task.ID(),
+			TaskType:  task.Type(),
+			State:     TaskFailed,
+			Error:     err,
+			StartTime: now,
+			EndTime:   now,
 		}
+		r.ctx.AddError(err)
+		r.ctx.AddLog(LogError, fmt.Sprintf("Task %s failed: %v", task.ID(), err))
+		r.bus.PublishTaskError(task.ID(), task.Type(), err)
+		r.mu.Lock()
+		r.results = append(r.results, result)
+		r.mu.Unlock()
+		return result, onFailure
+	}
+	if skipWhen != "" {
+		result := r.skipTask(task, index, skipWhen)
+		r.mu.Lock()
+		r.results = append(r.results, result)
+		r.mu.Unlock()
+		return result, onFailure
 	}
 
-	return nil
+	if r.ctx.Runtime.DryRun {
+		result := r.planTask(task, index)
+		r.mu.Lock()
+		r.results = append(r.results, result)
+		r.mu.Unlock()
+		return result, onFailure
+	}
+
+	r.journalTask(JournalTaskStart, task, index, nil)
+	r.setActive(index, true)
+	result := r.runTask(index, attempts, backoff)
+	r.setActive(index, false)
+	switch result.State {
+	case TaskCompleted:
+		r.storeOutputs(task, index)
+		r.journalTask(JournalTaskFinish, task, index, nil)
+	case TaskFailed:
+		// Outputs such as an exit code stay useful when the run goes on
+		r.storeOutputs(task, index)
+		r.journalTask(JournalTaskFailed, task, index, result.Error)
+		r.ctx.AddError(result.Error)
+		if result.Error != nil {
+			r.ctx.AddLog(LogError, fmt.Sprintf("Task %s failed: %v", task.ID(), result.Error))
+		}
+	case TaskCancelled:
+		r.journalTask(JournalTaskFailed, task, index, result.Error)
+	}
+
+	r.mu.Lock()
+	r.results = append(r.results, result)
+	// A task interrupted by cancellation is rolled back with the completed
+	// ones so its partial work is cleaned up.
+	if (result.State == TaskCompleted || result.State == TaskCancelled) && task.CanRollback() {
+		r.completedTasks = append(r.completedTasks, task)
+		r.completedKeys = append(r.completedKeys, r.journalKey(task, index))
+		if tx := r.ctx.Transaction(); tx != nil {
+			tx.record(task, r.stepID(), r.journalKey(task, index))
+		}
+	}
+	r.mu.Unlock()
+
+	return result, onFailure
 }
 
-func (r *TaskRunner) runTask(task Task, index, total int) TaskResult {
+// resolvePolicy returns the effective failure policy, total attempt count and
+// backoff for the task at index.
+func (r *TaskRunner) resolvePolicy(index int) (FailurePolicy, int, Backoff) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	onFailure := r.failurePolicy
+	backoff := r.backoff
+	retries := 0
+	if index < len(r.meta) && r.meta[index].policy != nil {
+		policy := r.meta[index].policy
+		if policy.OnFailure != nil {
+			onFailure = *policy.OnFailure
+		}
+		if policy.Backoff != nil {
+			backoff = *policy.Backoff
+		}
+		retries = policy.Retries
+	}
+
+	attempts := retries + 1
+	// Keep the historical runner-wide semantics where maxRetries counts attempts.
+	if retries == 0 && onFailure == FailureRetry && r.maxRetries > 1 {
+		attempts = r.maxRetries
+	}
+	return onFailure, attempts, backoff
+}
+
+func (r *TaskRunner) runTask(index int, attempts int, backoff Backoff) TaskResult {
+	task := r.tasks[index]
 	result := TaskResult{
 		TaskID:    task.ID(),
 		TaskType:  task.Type(),
@@ -308,41 +604,41 @@ func (r *TaskRunner) runTask(task Task, index, total int) TaskResult {
 	// Publish start event
 	r.bus.PublishTaskStart(task.ID(), task.Type())
 
-	// Calculate progress
-	baseProgress := float64(index) / float64(total)
-	r.bus.PublishProgress(task.ID(), baseProgress, fmt.Sprintf("Running: %s", task.ID()))
+	r.publishProgress(task.ID(), r.Progress(), fmt.Sprintf("Running: %s", task.ID()))
 
 	// Execute with retry support
 	var lastErr error
-	retries := 0
-	maxRetries := 1
-	if r.failurePolicy == FailureRetry {
-		maxRetries = r.maxRetries
-	}
-
-	for retries < maxRetries {
+	for attempt := 1; attempt <= attempts; attempt++ {
 		select {
 		case <-r.cancelCtx.Done():
-			result.State = TaskCancelled
-			result.Error = errors.New("task cancelled")
-			result.EndTime = time.Now()
-			result.Duration = result.EndTime.Sub(result.StartTime)
-			return result
+			return r.cancelledResult(result)
 		default:
 		}
 
-		err := task.Execute(r.ctx, r.bus)
+		r.ctx.Log(LogDebug, fmt.Sprintf("Starting task %s", task.ID()), "attempt", attempt, "attempts", attempts)
+		err := ExecuteTask(r.cancelCtx, task, r.ctx, r.bus)
 		if err == nil {
 			result.State = TaskCompleted
 			break
 		}
+		if r.cancelCtx.Err() != nil {
+			r.ctx.AddLog(LogWarn, fmt.Sprintf("Task %s interrupted: %v", task.ID(), err))
+			return r.cancelledResult(result)
+		}
 
 		lastErr = err
-		retries++
+		if attempt == attempts {
+			break
+		}
+		if IsPermanent(err) {
+			r.ctx.AddLog(LogWarn, fmt.Sprintf("Task %s failed with a permanent error, not retrying: %v", task.ID(), err))
+			break
+		}
 
-		if retries < maxRetries {
-			r.ctx.AddLog(LogWarn, fmt.Sprintf("Task %s failed, retrying (%d/%d): %v", task.ID(), retries, maxRetries, err))
-			time.Sleep(time.Second * time.Duration(retries)) // Exponential backoff
+		delay := backoff.Next(attempt)
+		r.ctx.AddLog(LogWarn, fmt.Sprintf("Task %s failed, retrying in %v (%d/%d): %v", task.ID(), delay, attempt, attempts-1, err))
+		if !r.wait(delay) {
+			return r.cancelledResult(result)
 		}
 	}
 
@@ -356,16 +652,205 @@ func (r *TaskRunner) runTask(task Task, index, total int) TaskResult {
 
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(result.StartTime)
+	r.ctx.Log(LogDebug, fmt.Sprintf("Task %s finished", task.ID()), "state", result.State.String(), "durationMs", result.Duration.Milliseconds())
 
 	// Update overall progress
-	progress := float64(index+1) / float64(total)
-	r.ctx.SetProgress(progress)
-	r.bus.PublishProgress(task.ID(), progress, fmt.Sprintf("Completed: %s", task.ID()))
+	r.publishProgress(task.ID(), r.finishTask(index), fmt.Sprintf("Completed: %s", task.ID()))
 
 	return result
 }
 
-// Cancel cancels the running tasks.
+// stepID returns the step the runner's tasks belong to.
+func (r *TaskRunner) stepID() string {
+	if r.step != "" {
+		return r.step
+	}
+	_, step := r.ctx.step()
+	return step
+}
+
+// journalKey identifies a queued task across runs of the same configuration.
+// Hook tasks are keyed apart from the step's own tasks.
+func (r *TaskRunner) journalKey(task Task, index int) string {
+	step := r.stepID()
+	if r.hook != "" {
+		step += "#" + r.hook
+	}
+	return fmt.Sprintf("%s/%d/%s", step, index, task.ID())
+}
+
+// journalTask records a task transition in the context journal, if any.
+func (r *TaskRunner) journalTask(kind JournalKind, task Task, index int, taskErr error) {
+	journal := r.ctx.Journal()
+	if journal == nil {
+		return
+	}
+
+	flow, _ := r.ctx.step()
+	entry := JournalEntry{
+		Kind:     kind,
+		Flow:     flow,
+		Step:     r.stepID(),
+		Key:      r.journalKey(task, index),
+		TaskID:   task.ID(),
+		TaskType: task.Type(),
+	}
+
+	r.mu.RLock()
+	if index < len(r.meta) && r.meta[index].config != nil {
+		if config, ok := journalValue(r.meta[index].config); ok {
+			entry.Config = config.(map[string]any)
+		}
+	}
+	r.mu.RUnlock()
+
+	switch kind {
+	case JournalTaskStart:
+		entry.Input = r.ctx.InputSnapshot()
+	case JournalTaskFinish:
+		if journaled, ok := task.(JournaledTask); ok {
+			entry.State = journaled.RollbackState()
+		}
+	}
+	if taskErr != nil {
+		entry.Error = taskErr.Error()
+	}
+
+	if err := journal.Record(entry); err != nil {
+		r.ctx.AddLog(LogWarn, fmt.Sprintf("Failed to write install journal: %v", err))
+	}
+}
+
+// resumeTask skips a task that already finished in a resumed session,
+// restoring its rollback state so a later failure can still undo it.
+func (r *TaskRunner) resumeTask(task Task, index int) bool {
+	journal := r.ctx.Journal()
+	if journal == nil {
+		return false
+	}
+
+	entry, ok := journal.resumed(r.journalKey(task, index))
+	if !ok {
+		return false
+	}
+
+	if journaled, ok := task.(JournaledTask); ok && entry.State != nil {
+		if err := journaled.RestoreRollbackState(entry.State); err != nil {
+			r.ctx.AddLog(LogWarn, fmt.Sprintf("Cannot restore state of %s, running it again: %v", task.ID(), err))
+			return false
+		}
+	}
+
+	r.ctx.AddLog(LogInfo, fmt.Sprintf("Skipping task completed before interruption: %s", task.ID()))
+	now := time.Now()
+	r.mu.Lock()
+	r.results = append(r.results, TaskResult{
+		TaskID:    task.ID(),
+		TaskType:  task.Type(),
+		State:     TaskCompleted,
+		StartTime: now,
+		EndTime:   now,
+	})
+	if task.CanRollback() {
+		r.completedTasks = append(r.completedTasks, task)
+		r.completedKeys = append(r.completedKeys, r.journalKey(task, index))
+	}
+	r.mu.Unlock()
+
+	progress := r.finishTask(index)
+	r.bus.PublishTaskComplete(task.ID(), task.Type())
+	r.publishProgress(task.ID(), progress, fmt.Sprintf("Completed: %s", task.ID()))
+	return true
+}
+
+// skipTask reports a task whose when: condition was not met.
+func (r *TaskRunner) skipTask(task Task, index int, when string) TaskResult {
+	now := time.Now()
+	r.ctx.AddLog(LogInfo, fmt.Sprintf("Skipping task %s: condition not met (%s)", task.ID(), when))
+	if r.ctx.Runtime.DryRun {
+		summary := DescribeTask(task, r.ctx, false)
+		summary.Step = r.stepID()
+		summary.Hook = r.hook
+		summary.When = when
+		summary.Skipped = true
+		r.ctx.AddPlannedTask(summary)
+	}
+	r.bus.PublishTaskSkipped(task.ID(), task.Type())
+	r.publishProgress(task.ID(), r.finishTask(index), fmt.Sprintf("Skipped: %s", task.ID()))
+	return TaskResult{
+		TaskID:    task.ID(),
+		TaskType:  task.Type(),
+		State:     TaskSkipped,
+		StartTime: now,
+		EndTime:   now,
+	}
+}
+
+// planTask records what the task would do instead of executing it.
+func (r *TaskRunner) planTask(task Task, index int) TaskResult {
+	result := TaskResult{
+		TaskID:    task.ID(),
+		TaskType:  task.Type(),
+		StartTime: time.Now(),
+	}
+
+	if err := task.Validate(); err != nil {
+		result.State = TaskFailed
+		result.Error = fmt.Errorf("validation failed: %w", err)
+		r.ctx.AddError(result.Error)
+		r.ctx.AddLog(LogError, fmt.Sprintf("Task %s failed: %v", task.ID(), result.Error))
+	} else {
+		r.bus.PublishTaskStart(task.ID(), task.Type())
+
+		r.mu.RLock()
+		config := r.meta[index].config
+		r.mu.RUnlock()
+		requiresRoot := taskRequiresPrivilege(TaskConfig{Type: task.Type(), Params: config})
+
+		summary := DescribeTask(task, r.ctx, requiresRoot)
+		summary.Step = r.stepID()
+		summary.Hook = r.hook
+		r.ctx.AddPlannedTask(summary)
+		r.ctx.AddLog(LogInfo, fmt.Sprintf("[dry-run] %s: %d planned actions", task.ID(), len(summary.Actions)))
+
+		result.State = TaskCompleted
+		r.bus.PublishTaskComplete(task.ID(), task.Type())
+	}
+
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime)
+
+	r.publishProgress(task.ID(), r.finishTask(index), fmt.Sprintf("Planned: %s", task.ID()))
+	return result
+}
+
+// wait sleeps for the given delay and returns false if the runner was cancelled meanwhile.
+func (r *TaskRunner) wait(delay time.Duration) bool {
+	if delay <= 0 {
+		return r.cancelCtx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-r.cancelCtx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (r *TaskRunner) cancelledResult(result TaskResult) TaskResult {
+	result.State = TaskCancelled
+	result.Error = errors.New("task cancelled")
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime)
+	return result
+}
+
+// Cancel cancels the run: tasks implementing ContextTask stop immediately,
+// no further tasks start, and the completed work is rolled back.
 func (r *TaskRunner) Cancel() {
 	r.mu.Lock()
 	r.cancelled = true
@@ -373,6 +858,12 @@ func (r *TaskRunner) Cancel() {
 	r.cancelFunc()
 }
 
+// Wait blocks until the current Run, including any rollback after a
+// cancellation, has returned. It returns immediately if nothing is running.
+func (r *TaskRunner) Wait() {
+	r.done.Wait()
+}
+
 // IsCancelled returns true if the runner was cancelled.
 func (r *TaskRunner) IsCancelled() bool {
 	r.mu.RLock()
@@ -380,12 +871,13 @@ func (r *TaskRunner) IsCancelled() bool {
 	return r.cancelled
 }
 
+// handleCancellation rolls back the work done so far and reports the cancellation.
 func (r *TaskRunner) handleCancellation() error {
 	r.ctx.AddLog(LogWarn, "Task execution cancelled")
-	if r.failurePolicy == FailureRollback {
-		return r.rollback()
+	if err := r.rollback(); err != nil {
+		return fmt.Errorf("%w: rollback failed: %v", ErrCancelled, err)
 	}
-	return errors.New("execution cancelled")
+	return ErrCancelled
 }
 
 // rollback executes rollback for all completed tasks in reverse order.
@@ -393,6 +885,8 @@ func (r *TaskRunner) rollback() error {
 	r.mu.RLock()
 	tasks := make([]Task, len(r.completedTasks))
 	copy(tasks, r.completedTasks)
+	keys := make([]string, len(r.completedKeys))
+	copy(keys, r.completedKeys)
 	r.mu.RUnlock()
 
 	r.ctx.AddLog(LogInfo, fmt.Sprintf("Rolling back %d tasks", len(tasks)))
@@ -404,11 +898,20 @@ func (r *TaskRunner) rollback() error {
 			continue
 		}
 
+		leave := r.ctx.enterTask(r.stepID(), task)
 		r.ctx.AddLog(LogInfo, fmt.Sprintf("Rolling back: %s", task.ID()))
-		if err := task.Rollback(r.ctx, r.bus); err != nil {
+		err := task.Rollback(r.ctx, r.bus)
+		if err != nil {
 			r.ctx.AddLog(LogError, fmt.Sprintf("Rollback failed for %s: %v", task.ID(), err))
+		}
+		leave()
+		if err != nil {
+			// The flow transaction still holds the task and retries it
 			return err
 		}
+		if tx := r.ctx.Transaction(); tx != nil {
+			tx.markRolledBack(task)
+		}
 
 		r.mu.Lock()
 		r.results = append(r.results, TaskResult{
@@ -417,6 +920,17 @@ func (r *TaskRunner) rollback() error {
 			State:    TaskRolledBack,
 		})
 		r.mu.Unlock()
+
+		if journal := r.ctx.Journal(); journal != nil {
+			flow, _ := r.ctx.step()
+			_ = journal.Record(JournalEntry{
+				Kind:     JournalTaskRollback,
+				Flow:     flow,
+				Key:      keys[i],
+				TaskID:   task.ID(),
+				TaskType: task.Type(),
+			})
+		}
 	}
 
 	return nil
@@ -445,7 +959,7 @@ func (r *TaskRunner) Progress() float64 {
 	if len(r.tasks) == 0 {
 		return 1.0
 	}
-	return float64(r.currentIndex+1) / float64(len(r.tasks))
+	return r.progress
 }
 
 // IsRunning returns true if the runner is currently executing tasks.
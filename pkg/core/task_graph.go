@@ -0,0 +1,284 @@
+// Package core provides dependency-aware parallel scheduling for the task runner.
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultConcurrency is the number of tasks a runner executes at once when
+// tasks declare dependencies.
+const DefaultConcurrency = 4
+
+// SetConcurrency sets how many tasks may run at once in dependency mode.
+// Values below one are treated as one.
+func (r *TaskRunner) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	r.mu.Lock()
+	r.concurrency = n
+	r.mu.Unlock()
+}
+
+// SetDependencies declares the IDs of tasks that must complete before the
+// queued task with the given ID may start.
+func (r *TaskRunner) SetDependencies(taskID string, dependsOn ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, task := range r.tasks {
+		if task.ID() == taskID {
+			r.meta[i].dependsOn = append([]string(nil), dependsOn...)
+			return nil
+		}
+	}
+	return fmt.Errorf("task %q not found", taskID)
+}
+
+// hasDependencies reports whether any queued task declares dependencies.
+func (r *TaskRunner) hasDependencies() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, meta := range r.meta {
+		if len(meta.dependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// buildGraph resolves dependsOn IDs to task indexes and returns, for each
+// task, the indexes of the tasks that depend on it plus the number of
+// dependencies it waits for. Unknown, ambiguous and cyclic dependencies are
+// reported before anything runs.
+func (r *TaskRunner) buildGraph() ([][]int, []int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byID := make(map[string]int, len(r.tasks))
+	byLoop := make(map[string][]int)
+	duplicate := make(map[string]bool)
+	for i, task := range r.tasks {
+		if _, exists := byID[task.ID()]; exists {
+			duplicate[task.ID()] = true
+		}
+		byID[task.ID()] = i
+		if loop := r.meta[i].loop; loop != "" {
+			byLoop[loop] = append(byLoop[loop], i)
+		}
+	}
+
+	dependents := make([][]int, len(r.tasks))
+	waiting := make([]int, len(r.tasks))
+	for i, meta := range r.meta {
+		seen := make(map[int]bool)
+		for _, dep := range meta.dependsOn {
+			// A forEach task stands for all of its instances, of which there
+			// may be none.
+			targets := byLoop[dep]
+			if j, ok := byID[dep]; ok {
+				if duplicate[dep] {
+					return nil, nil, fmt.Errorf("task %s depends on %q, which is not a unique task id", r.tasks[i].ID(), dep)
+				}
+				targets = []int{j}
+			} else if !r.loops[dep] {
+				return nil, nil, fmt.Errorf("task %s depends on unknown task %q", r.tasks[i].ID(), dep)
+			}
+			for _, j := range targets {
+				if seen[j] {
+					continue
+				}
+				seen[j] = true
+				dependents[j] = append(dependents[j], i)
+				waiting[i]++
+			}
+		}
+	}
+
+	// Kahn's algorithm: anything left unvisited sits on a cycle.
+	remaining := append([]int(nil), waiting...)
+	var queue []int
+	for i, n := range remaining {
+		if n == 0 {
+			queue = append(queue, i)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, j := range dependents[i] {
+			remaining[j]--
+			if remaining[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if visited < len(r.tasks) {
+		var cycle []string
+		for i, n := range remaining {
+			if n > 0 {
+				cycle = append(cycle, r.tasks[i].ID())
+			}
+		}
+		sort.Strings(cycle)
+		return nil, nil, fmt.Errorf("dependency cycle between tasks: %s", strings.Join(cycle, ", "))
+	}
+
+	return dependents, waiting, nil
+}
+
+// graphOutcome carries a finished task back to the scheduler.
+type graphOutcome struct {
+	index     int
+	result    TaskResult
+	onFailure FailurePolicy
+}
+
+// runGraph executes tasks as soon as their dependencies have completed,
+// keeping at most r.concurrency tasks in flight. A failure stops scheduling
+// new tasks and waits for the running ones before aborting or rolling back;
+// with FailureSkip only the dependents of the failed task are left out.
+func (r *TaskRunner) runGraph() error {
+	dependents, waiting, err := r.buildGraph()
+	if err != nil {
+		return fmt.Errorf("invalid task dependencies: %w", err)
+	}
+
+	r.mu.RLock()
+	limit := r.concurrency
+	r.mu.RUnlock()
+
+	var ready []int
+	for i, n := range waiting {
+		if n == 0 {
+			ready = append(ready, i)
+		}
+	}
+	release := func(index int) {
+		for _, j := range dependents[index] {
+			waiting[j]--
+			if waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	outcomes := make(chan graphOutcome)
+	started := make([]bool, len(r.tasks))
+	running := 0
+	stopped := false
+	cancelled := false
+	rollback := false
+	var failure error
+
+	for {
+		for !stopped && running < limit && len(ready) > 0 {
+			if r.cancelCtx.Err() != nil {
+				cancelled, stopped = true, true
+				break
+			}
+
+			index := ready[0]
+			ready = ready[1:]
+			started[index] = true
+
+			if r.resumeTask(r.tasks[index], index) {
+				release(index)
+				continue
+			}
+
+			running++
+			go func(index int) {
+				result, onFailure := r.executeTask(index)
+				outcomes <- graphOutcome{index: index, result: result, onFailure: onFailure}
+			}(index)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		outcome := <-outcomes
+		running--
+		task := r.tasks[outcome.index]
+
+		switch outcome.result.State {
+		case TaskCompleted, TaskSkipped:
+			release(outcome.index)
+		case TaskCancelled:
+			cancelled, stopped = true, true
+		case TaskFailed:
+			switch outcome.onFailure {
+			case FailureSkip:
+				r.ctx.AddLog(LogWarn, fmt.Sprintf("Skipping failed task: %s", task.ID()))
+			case FailureRollback:
+				rollback = true
+				fallthrough
+			default:
+				stopped = true
+				if failure == nil {
+					failure = outcome.result.Error
+					if failure == nil {
+						failure = fmt.Errorf("task %s failed", task.ID())
+					}
+				}
+			}
+		}
+	}
+
+	if cancelled {
+		return r.handleCancellation()
+	}
+
+	if failure != nil {
+		if rollback {
+			if err := r.rollback(); err != nil {
+				return fmt.Errorf("rollback failed: %w (original error: %v)", err, failure)
+			}
+		}
+		return failure
+	}
+
+	// Only dependents of skipped failures can be left over here.
+	var blocked []string
+	for i, ok := range started {
+		if !ok {
+			blocked = append(blocked, r.tasks[i].ID())
+		}
+	}
+	if len(blocked) > 0 {
+		r.ctx.AddLog(LogWarn, fmt.Sprintf("Skipping tasks whose dependencies failed: %s", strings.Join(blocked, ", ")))
+	}
+	for i, ok := range started {
+		if !ok {
+			r.skipBlocked(i)
+		}
+	}
+
+	return nil
+}
+
+// skipBlocked reports a task left out because a dependency failed under
+// FailureSkip. It counts as finished so the progress still reaches 1.0.
+func (r *TaskRunner) skipBlocked(index int) {
+	task := r.tasks[index]
+	now := time.Now()
+	r.mu.Lock()
+	r.results = append(r.results, TaskResult{
+		TaskID:    task.ID(),
+		TaskType:  task.Type(),
+		State:     TaskSkipped,
+		StartTime: now,
+		EndTime:   now,
+	})
+	r.mu.Unlock()
+
+	r.bus.PublishTaskSkipped(task.ID(), task.Type())
+	r.publishProgress(task.ID(), r.finishTask(index), fmt.Sprintf("Skipped: %s", task.ID()))
+}
@@ -0,0 +1,308 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// orderRecorder records task completion order across goroutines.
+type orderRecorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (o *orderRecorder) add(id string) {
+	o.mu.Lock()
+	o.order = append(o.order, id)
+	o.mu.Unlock()
+}
+
+func (o *orderRecorder) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return strings.Join(o.order, ",")
+}
+
+func recordingTask(id string, order *orderRecorder) *MockTask {
+	task := NewMockTask(id, "mock")
+	task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		order.add(id)
+		return nil
+	}
+	return task
+}
+
+func TestTaskRunnerGraphRunsIndependentTasksInParallel(t *testing.T) {
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+
+	// Each download waits until all three have started; sequential execution
+	// would deadlock and hit the timeout.
+	var started sync.WaitGroup
+	started.Add(3)
+	order := &orderRecorder{}
+	for _, id := range []string{"dl-a", "dl-b", "dl-c"} {
+		id := id
+		task := NewMockTask(id, "mock")
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			started.Done()
+			done := make(chan struct{})
+			go func() { started.Wait(); close(done) }()
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				return errors.New("downloads did not run in parallel")
+			}
+			order.add(id)
+			return nil
+		}
+		runner.AddTask(task)
+	}
+	runner.AddTask(recordingTask("unpack", order))
+	_ = runner.SetDependencies("unpack", "dl-a", "dl-b", "dl-c")
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(order.String(), ",unpack") {
+		t.Errorf("expected unpack to run after all downloads, got %s", order)
+	}
+	if runner.Progress() != 1.0 {
+		t.Errorf("expected progress 1.0, got %f", runner.Progress())
+	}
+}
+
+func TestTaskRunnerGraphConcurrencyLimit(t *testing.T) {
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	runner.SetConcurrency(2)
+
+	var active, peak int32
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		task := NewMockTask(id, "mock")
+		task.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		}
+		runner.AddTask(task)
+	}
+	runner.AddTask(NewMockTask("last", "mock"))
+	_ = runner.SetDependencies("last", "a")
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent tasks, got %d", peak)
+	}
+}
+
+func TestTaskRunnerGraphInvalidDependencies(t *testing.T) {
+	tests := []struct {
+		name string
+		deps map[string][]string
+		want string
+	}{
+		{"unknown", map[string][]string{"a": {"missing"}}, "unknown task"},
+		{"cycle", map[string][]string{"a": {"b"}, "b": {"a"}}, "cycle"},
+		{"self", map[string][]string{"a": {"a"}}, "cycle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+			a := NewMockTask("a", "mock")
+			b := NewMockTask("b", "mock")
+			runner.AddTasks([]Task{a, b})
+			for id, deps := range tt.deps {
+				_ = runner.SetDependencies(id, deps...)
+			}
+
+			err := runner.Run()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected %q error, got %v", tt.want, err)
+			}
+			if a.executed || b.executed {
+				t.Error("no task should run when the graph is invalid")
+			}
+		})
+	}
+
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	if err := runner.SetDependencies("nope", "a"); err == nil {
+		t.Error("expected error for unknown task id")
+	}
+}
+
+func TestTaskRunnerGraphFailureStopsDependents(t *testing.T) {
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	runner.SetFailurePolicy(FailureRollback)
+
+	order := &orderRecorder{}
+	base := recordingTask("base", order)
+	base.rollbackable = true
+	base.RollbackFunc = func(ctx *InstallContext, bus *EventBus) error {
+		order.add("rollback-base")
+		return nil
+	}
+	slow := NewMockTask("slow", "mock")
+	slow.rollbackable = true
+	slow.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		time.Sleep(30 * time.Millisecond)
+		order.add("slow")
+		return nil
+	}
+	slow.RollbackFunc = func(ctx *InstallContext, bus *EventBus) error {
+		order.add("rollback-slow")
+		return nil
+	}
+	broken := NewMockTask("broken", "mock")
+	broken.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		return errors.New("boom")
+	}
+	after := recordingTask("after", order)
+
+	runner.AddTasks([]Task{base, slow, broken, after})
+	_ = runner.SetDependencies("broken", "base")
+	_ = runner.SetDependencies("after", "broken")
+
+	err := runner.Run()
+	if err == nil || err.Error() != "boom" {
+		t.Fatalf("expected task error, got %v", err)
+	}
+	if after.executed {
+		t.Error("dependent of a failed task must not run")
+	}
+	// The in-flight task finishes before rollback, which runs in reverse
+	// completion order.
+	if got := order.String(); got != "base,slow,rollback-slow,rollback-base" {
+		t.Errorf("unexpected order: %s", got)
+	}
+}
+
+func TestTaskRunnerGraphSkipLeavesOutDependents(t *testing.T) {
+	ctx := NewInstallContext()
+	runner := NewTaskRunner(ctx, NewEventBus())
+	runner.SetFailurePolicy(FailureSkip)
+
+	broken := NewMockTask("broken", "mock")
+	broken.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		return errors.New("boom")
+	}
+	dependent := NewMockTask("dependent", "mock")
+	independent := NewMockTask("independent", "mock")
+	runner.AddTasks([]Task{broken, dependent, independent})
+	_ = runner.SetDependencies("dependent", "broken")
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dependent.executed {
+		t.Error("dependent of a skipped failure must not run")
+	}
+	if !independent.executed {
+		t.Error("independent task should still run")
+	}
+}
+
+func TestTaskRunnerGraphSkipReportsBlockedTasks(t *testing.T) {
+	ctx := NewInstallContext()
+	bus := NewEventBus()
+	runner := NewTaskRunner(ctx, bus)
+	runner.SetFailurePolicy(FailureSkip)
+
+	broken := NewMockTask("broken", "mock")
+	broken.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		return errors.New("boom")
+	}
+	runner.AddTasks([]Task{broken, NewMockTask("dependent", "mock"), NewMockTask("transitive", "mock"), NewMockTask("independent", "mock")})
+	_ = runner.SetDependencies("dependent", "broken")
+	_ = runner.SetDependencies("transitive", "dependent")
+
+	var skipped []string
+	bus.Subscribe(EventTaskSkipped, func(e Event) {
+		skipped = append(skipped, e.Payload.(TaskPayload).TaskID)
+	})
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	states := make(map[string]TaskState)
+	for _, result := range runner.Results() {
+		states[result.TaskID] = result.State
+	}
+	want := map[string]TaskState{
+		"broken":      TaskFailed,
+		"dependent":   TaskSkipped,
+		"transitive":  TaskSkipped,
+		"independent": TaskCompleted,
+	}
+	for id, state := range want {
+		if states[id] != state {
+			t.Errorf("task %s: expected %v, got %v", id, state, states[id])
+		}
+	}
+	if got := strings.Join(skipped, ","); got != "dependent,transitive" {
+		t.Errorf("expected skipped events for dependent,transitive, got %q", got)
+	}
+	if progress := runner.Progress(); progress != 1.0 {
+		t.Errorf("expected progress 1.0, got %v", progress)
+	}
+}
+
+func TestTaskRunnerGraphCancel(t *testing.T) {
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+
+	first := NewMockTask("first", "mock")
+	first.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		runner.Cancel()
+		return nil
+	}
+	second := NewMockTask("second", "mock")
+	runner.AddTasks([]Task{first, second})
+	_ = runner.SetDependencies("second", "first")
+
+	if err := runner.Run(); err == nil {
+		t.Fatal("expected cancellation error")
+	}
+	if second.executed {
+		t.Error("no task should start after cancellation")
+	}
+}
+
+// dependsOnOrder is shared with the registered factory, which outlives a single test run.
+var dependsOnOrder = &orderRecorder{}
+
+func TestTaskRunnerQueueConfigDependsOn(t *testing.T) {
+	name := "dependsOnMock"
+	_ = Tasks.Register(name, func(config map[string]any, ctx *InstallContext) (Task, error) {
+		return recordingTask(config["id"].(string), dependsOnOrder), nil
+	})
+	order := dependsOnOrder
+	order.mu.Lock()
+	order.order = nil
+	order.mu.Unlock()
+
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "write", DependsOn: []string{"unpack"}})
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "unpack", DependsOn: []string{"fetch"}})
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "fetch"})
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := order.String(); got != "fetch,unpack,write" {
+		t.Errorf("expected dependency order, got %s", got)
+	}
+}
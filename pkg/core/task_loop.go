@@ -0,0 +1,155 @@
+// Package core provides forEach expansion of task configs.
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Loop variables available to the params of a forEach task.
+const (
+	LoopItemVar  = "item"
+	LoopIndexVar = "index"
+)
+
+var loopVarPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\$\{((?:item|index)(?:\.[^}]+)?)\}`),
+	regexp.MustCompile(`\{\{\.((?:item|index)(?:\.[^}]+)?)\}\}`),
+}
+
+// queueLoop expands a task config with forEach: into one task per item of
+// the list or map at that context path. Each instance gets a unique ID so
+// it is journaled and rolled back on its own; tasks that depend on the loop
+// ID wait for every instance.
+func (r *TaskRunner) queueLoop(config TaskConfig) error {
+	items, err := loopItems(r.ctx, config.ForEach)
+	if err != nil {
+		return fmt.Errorf("invalid forEach for task %s: %w", config.Type, err)
+	}
+
+	base := config.ID
+	if base == "" {
+		base = config.Type
+	}
+	r.mu.Lock()
+	if r.loops == nil {
+		r.loops = make(map[string]bool)
+	}
+	r.loops[base] = true
+	r.mu.Unlock()
+
+	for index, item := range items {
+		vars := map[string]any{LoopItemVar: item, LoopIndexVar: index}
+
+		instance := config
+		instance.ForEach = ""
+		instance.Params, _ = renderLoopVars(config.Params, vars).(map[string]any)
+		instance.When = renderLoopVars(config.When, vars).(string)
+		instance.DependsOn, _ = renderLoopVars(config.DependsOn, vars).([]string)
+		instance.Register = renderLoopVars(config.Register, vars).(string)
+		if config.Outputs != nil {
+			instance.Outputs = make(map[string]string, len(config.Outputs))
+			for name, path := range config.Outputs {
+				instance.Outputs[name] = renderLoopVars(path, vars).(string)
+			}
+		}
+		if rendered := renderLoopVars(config.ID, vars).(string); rendered != config.ID {
+			instance.ID = rendered
+		} else {
+			instance.ID = fmt.Sprintf("%s[%d]", base, index)
+		}
+
+		if err := r.queueTask(instance); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.meta[len(r.meta)-1].loop = base
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// loopItems resolves the forEach path to the items to iterate. Lists yield
+// their elements, comma-separated strings their entries, and maps a
+// {key, value} item per key in sorted order. A missing value yields nothing.
+func loopItems(ctx *InstallContext, path string) ([]any, error) {
+	val, ok := ctx.Get(strings.TrimSpace(path))
+	if !ok || val == nil {
+		return nil, nil
+	}
+
+	if s, ok := val.(string); ok {
+		var items []any
+		for _, entry := range strings.Split(s, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				items = append(items, entry)
+			}
+		}
+		return items, nil
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]any, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+		return items, nil
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		items := make([]any, len(keys))
+		for i, key := range keys {
+			items[i] = map[string]any{
+				"key":   fmt.Sprint(key.Interface()),
+				"value": rv.MapIndex(key).Interface(),
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("%s is a %T, not a list or map", path, val)
+}
+
+// renderLoopVars substitutes ${item}, ${item.field} and ${index} in every
+// string of a config value. Other placeholders are left for the task's own
+// rendering against the context.
+func renderLoopVars(value any, vars map[string]any) any {
+	switch v := value.(type) {
+	case string:
+		for _, re := range loopVarPatterns {
+			v = re.ReplaceAllStringFunc(v, func(match string) string {
+				path := re.FindStringSubmatch(match)[1]
+				if val, ok := getNestedValue(vars, path); ok {
+					return fmt.Sprintf("%v", val)
+				}
+				return match
+			})
+		}
+		return v
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[k] = renderLoopVars(val, vars)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = renderLoopVars(val, vars)
+		}
+		return out
+	case []string:
+		out := make([]string, len(v))
+		for i, val := range v {
+			out[i] = renderLoopVars(val, vars).(string)
+		}
+		return out
+	}
+	return value
+}
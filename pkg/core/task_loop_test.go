@@ -0,0 +1,164 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var (
+	loopMockMu    sync.Mutex
+	loopMockTasks = make(map[string]*MockTask)
+)
+
+func registerLoopMock() {
+	_ = Tasks.Register("loopMock", func(config map[string]any, ctx *InstallContext) (Task, error) {
+		task := NewMockTask(config["id"].(string), "loopMock")
+		task.Config = config
+		task.rollbackable = true
+		if config["fail"] == true {
+			task.ExecuteFunc = func(*InstallContext, *EventBus) error { return errors.New("boom") }
+		}
+		loopMockMu.Lock()
+		loopMockTasks[task.TaskID] = task
+		loopMockMu.Unlock()
+		return task, nil
+	})
+}
+
+func TestTaskRunnerQueueConfigForEach(t *testing.T) {
+	registerLoopMock()
+	ctx := NewInstallContext()
+	ctx.Set("install_dir", "/opt/app")
+	ctx.Set("plugins", []string{"git", "docker"})
+
+	runner := NewTaskRunner(ctx, NewEventBus())
+	runner.SetFailurePolicy(FailureRollback)
+	err := runner.QueueConfig(TaskConfig{
+		Type:    "loopMock",
+		ID:      "plugin",
+		ForEach: "plugins",
+		Params:  map[string]any{"path": "${install_dir}/plugins/${item}", "order": "${index}"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = runner.QueueConfig(TaskConfig{Type: "loopMock", ID: "loop-after", DependsOn: []string{"plugin"}, Params: map[string]any{"fail": true}})
+
+	if err := runner.Run(); err == nil {
+		t.Fatal("expected error from failing task")
+	}
+
+	var order []string
+	for _, result := range runner.Results() {
+		if result.State != TaskRolledBack {
+			order = append(order, result.TaskID)
+		}
+	}
+	// The instances may run in parallel, but both finish before the dependent
+	if len(order) != 3 || order[2] != "loop-after" {
+		t.Errorf("expected both instances before loop-after, got %v", order)
+	}
+
+	loopMockMu.Lock()
+	defer loopMockMu.Unlock()
+	for i, name := range []string{"git", "docker"} {
+		task := loopMockTasks[fmt.Sprintf("plugin[%d]", i)]
+		if task == nil {
+			t.Fatalf("instance %d was not created", i)
+		}
+		if path := ctx.Render(task.Config["path"].(string)); path != "/opt/app/plugins/"+name {
+			t.Errorf("instance %d: expected item rendered into path, got %v", i, path)
+		}
+		if task.Config["order"] != fmt.Sprint(i) {
+			t.Errorf("instance %d: expected index %d, got %v", i, i, task.Config["order"])
+		}
+		if !task.rolledBack {
+			t.Errorf("instance %d was not rolled back", i)
+		}
+	}
+}
+
+func TestTaskRunnerQueueConfigForEachEmpty(t *testing.T) {
+	registerLoopMock()
+	ctx := NewInstallContext()
+	runner := NewTaskRunner(ctx, NewEventBus())
+	_ = runner.QueueConfig(TaskConfig{Type: "loopMock", ID: "none", ForEach: "missing"})
+	_ = runner.QueueConfig(TaskConfig{Type: "loopMock", ID: "none-after", DependsOn: []string{"none"}})
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results := runner.Results(); len(results) != 1 || results[0].TaskID != "none-after" {
+		t.Errorf("expected only the dependent task to run, got %v", results)
+	}
+
+	ctx.Set("scalar", 3)
+	if err := runner.QueueConfig(TaskConfig{Type: "loopMock", ForEach: "scalar"}); err == nil {
+		t.Error("expected error for forEach over a scalar")
+	}
+}
+
+func TestTaskRunnerQueueConfigForEachItemID(t *testing.T) {
+	registerLoopMock()
+	ctx := NewInstallContext()
+	ctx.Set("services", map[string]any{
+		"web": map[string]any{"port": 8080},
+		"api": map[string]any{"port": 9090},
+	})
+
+	runner := NewTaskRunner(ctx, NewEventBus())
+	err := runner.QueueConfig(TaskConfig{
+		Type:    "loopMock",
+		ID:      "service-${item.key}",
+		ForEach: "services",
+		When:    `"${item.key}" != "api"`,
+		Params:  map[string]any{"port": "${item.value.port}"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	states := make(map[string]TaskState)
+	for _, result := range runner.Results() {
+		states[result.TaskID] = result.State
+	}
+	if states["service-api"] != TaskSkipped || states["service-web"] != TaskCompleted {
+		t.Errorf("unexpected task states: %v", states)
+	}
+
+	loopMockMu.Lock()
+	defer loopMockMu.Unlock()
+	if task := loopMockTasks["service-web"]; task == nil || task.Config["port"] != "8080" {
+		t.Errorf("expected map item rendered into params, got %v", task)
+	}
+}
+
+func TestLoopItems(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Set("csv", "a, b,,c")
+	ctx.Set("list", []any{1, "two"})
+
+	tests := []struct {
+		path string
+		want []any
+	}{
+		{"csv", []any{"a", "b", "c"}},
+		{"list", []any{1, "two"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		got, err := loopItems(ctx, tt.path)
+		if err != nil {
+			t.Errorf("loopItems(%q): unexpected error: %v", tt.path, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("loopItems(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package core provides task outputs that later tasks can read from the context.
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// OutputTask is implemented by tasks that publish named results, such as a
+// command's stdout or a downloaded file's path. Outputs are read once the
+// task has completed or failed and stored in the context as the task config
+// asks:
+//
+//	register: result           # all outputs under result.<name>
+//	outputs:
+//	  stdout: app.port         # a single output at a context path
+//
+// Output values should be plain data (strings, numbers, lists and maps) so
+// they can be journaled with the rest of the user input.
+type OutputTask interface {
+	Outputs() map[string]any
+}
+
+// storeOutputs copies the outputs of a finished task into the context.
+func (r *TaskRunner) storeOutputs(task Task, index int) {
+	r.mu.RLock()
+	register, mapping := r.meta[index].register, r.meta[index].outputs
+	r.mu.RUnlock()
+	if register == "" && len(mapping) == 0 {
+		return
+	}
+
+	producer, ok := task.(OutputTask)
+	if !ok {
+		r.ctx.AddLog(LogWarn, fmt.Sprintf("Task %s (%s) has no outputs to register", task.ID(), task.Type()))
+		return
+	}
+	outputs := producer.Outputs()
+
+	if register != "" {
+		values := make(map[string]any, len(outputs))
+		for name, val := range outputs {
+			values[name] = val
+		}
+		r.ctx.Set(register, values)
+	}
+
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		val, ok := outputs[name]
+		if !ok {
+			r.ctx.AddLog(LogWarn, fmt.Sprintf("Task %s has no output %q", task.ID(), name))
+			continue
+		}
+		r.ctx.Set(mapping[name], val)
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"sync"
+	"testing"
+)
+
+// outputMockTask publishes the "value" param as its output.
+type outputMockTask struct {
+	*MockTask
+}
+
+func (t *outputMockTask) Outputs() map[string]any {
+	return map[string]any{"value": t.Config["value"], "count": 2}
+}
+
+var (
+	outputMockMu     sync.Mutex
+	outputMockValues = make(map[string]any)
+)
+
+func registerOutputMock() {
+	_ = Tasks.Register("outputMock", func(config map[string]any, ctx *InstallContext) (Task, error) {
+		task := NewMockTask(config["id"].(string), "outputMock")
+		task.Config = config
+		if value, ok := config["value"].(string); ok {
+			task.Config["value"] = ctx.Render(value)
+		}
+		outputMockMu.Lock()
+		outputMockValues[task.TaskID] = task.Config["value"]
+		outputMockMu.Unlock()
+		return &outputMockTask{task}, nil
+	})
+}
+
+func TestTaskRunnerRegistersOutputs(t *testing.T) {
+	registerOutputMock()
+	ctx := NewInstallContext()
+	runner := NewTaskRunner(ctx, NewEventBus())
+
+	_ = runner.QueueConfig(TaskConfig{
+		Type:     "outputMock",
+		ID:       "detect",
+		Register: "detected",
+		Outputs:  map[string]string{"value": "app.port", "missing": "app.other"},
+		Params:   map[string]any{"value": "8080"},
+	})
+	// Queued before detect has run, so both must be refreshed before running
+	_ = runner.QueueConfig(TaskConfig{
+		Type:   "outputMock",
+		ID:     "configure",
+		Params: map[string]any{"value": "port=${detected.value}"},
+	})
+	_ = runner.QueueConfig(TaskConfig{
+		Type:   "outputMock",
+		ID:     "guarded",
+		When:   `app.port == "8080"`,
+		Params: map[string]any{"value": "on"},
+	})
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := ctx.GetString("app.port"); got != "8080" {
+		t.Errorf("expected app.port 8080, got %q", got)
+	}
+	if got := ctx.GetInt("detected.count"); got != 2 {
+		t.Errorf("expected detected.count 2, got %d", got)
+	}
+	if _, ok := ctx.Get("app.other"); ok {
+		t.Error("expected missing output not to be stored")
+	}
+
+	outputMockMu.Lock()
+	configured := outputMockValues["configure"]
+	outputMockMu.Unlock()
+	if configured != "port=8080" {
+		t.Errorf("expected later task to render the output, got %v", configured)
+	}
+
+	for _, result := range runner.Results() {
+		if result.TaskID == "guarded" && result.State != TaskCompleted {
+			t.Errorf("expected guarded task to run once its condition holds, got %s", result.State)
+		}
+	}
+}
@@ -1,7 +1,75 @@
 // Package core provides task plan builders.
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+// ActionKind classifies a side effect a task would perform.
+type ActionKind string
+
+const (
+	ActionDownload   ActionKind = "download"    // Fetch a URL into Path
+	ActionWriteFile  ActionKind = "write_file"  // Create or overwrite Path
+	ActionCreateDir  ActionKind = "create_dir"  // Create directory Path
+	ActionDelete     ActionKind = "delete"      // Remove Path
+	ActionSymlink    ActionKind = "symlink"     // Link Path to Source
+	ActionChmod      ActionKind = "chmod"       // Change mode or owner of Path
+	ActionRunCommand ActionKind = "run_command" // Run Command
+	ActionUnit       ActionKind = "unit"        // Change the state of systemd unit Path
+)
+
+// PlannedAction describes one side effect with all templates rendered.
+type PlannedAction struct {
+	Kind    ActionKind `json:"kind"`
+	Path    string     `json:"path,omitempty"`
+	Source  string     `json:"source,omitempty"`
+	Command string     `json:"command,omitempty"`
+	Detail  string     `json:"detail,omitempty"`
+}
+
+// String returns a one-line, human-readable form of the action.
+func (a PlannedAction) String() string {
+	var text string
+	switch a.Kind {
+	case ActionDownload:
+		text = fmt.Sprintf("download %s -> %s", a.Source, a.Path)
+	case ActionWriteFile:
+		text = fmt.Sprintf("write %s", a.Path)
+		if a.Source != "" {
+			text = fmt.Sprintf("write %s (from %s)", a.Path, a.Source)
+		}
+	case ActionCreateDir:
+		text = fmt.Sprintf("mkdir %s", a.Path)
+	case ActionDelete:
+		text = fmt.Sprintf("delete %s", a.Path)
+	case ActionSymlink:
+		text = fmt.Sprintf("symlink %s -> %s", a.Path, a.Source)
+	case ActionChmod:
+		text = fmt.Sprintf("chmod %s", a.Path)
+	case ActionRunCommand:
+		text = fmt.Sprintf("run %s", a.Command)
+	case ActionUnit:
+		text = fmt.Sprintf("unit %s", a.Path)
+		if a.Command != "" {
+			text = fmt.Sprintf("unit %s: %s", a.Path, a.Command)
+		}
+	default:
+		text = strings.TrimSpace(fmt.Sprintf("%s %s", a.Kind, a.Path))
+	}
+	if a.Detail != "" {
+		text = fmt.Sprintf("%s [%s]", text, a.Detail)
+	}
+	return text
+}
+
+// Planner is implemented by tasks that can describe their side effects
+// without performing them. It is called instead of Execute in dry-run mode
+// and must not modify the system.
+type Planner interface {
+	Plan(ctx *InstallContext) []PlannedAction
+}
 
 // BuildTaskPlan builds a plan from a flow configuration.
 func BuildTaskPlan(flow *FlowConfig) *TaskPlan {
@@ -11,17 +79,65 @@ func BuildTaskPlan(flow *FlowConfig) *TaskPlan {
 
 	plan := &TaskPlan{Tasks: make([]TaskSummary, 0)}
 	for _, step := range flow.Steps {
-		for _, task := range step.Tasks {
-			desc := task.ID
-			if desc == "" {
-				desc = fmt.Sprintf("%s task", task.Type)
+		add := func(tasks []TaskConfig, hook string) {
+			for _, task := range tasks {
+				desc := task.ID
+				if desc == "" {
+					desc = fmt.Sprintf("%s task", task.Type)
+				}
+				if task.ForEach != "" {
+					desc = fmt.Sprintf("%s (for each %s)", desc, task.ForEach)
+				}
+				if hook != "" {
+					desc = fmt.Sprintf("%s (%s)", desc, hook)
+				}
+				plan.Tasks = append(plan.Tasks, TaskSummary{
+					ID:           task.ID,
+					Step:         step.ID,
+					Type:         task.Type,
+					Description:  desc,
+					RequiresRoot: requiresPrivilege(task.Params),
+					When:         task.When,
+					ForEach:      task.ForEach,
+					Hook:         hook,
+				})
 			}
-			plan.Tasks = append(plan.Tasks, TaskSummary{
-				Type:         task.Type,
-				Description:  desc,
-				RequiresRoot: requiresPrivilege(task.Params),
-			})
 		}
+		add(step.OnEnter, string(HookEnter))
+		add(step.Tasks, "")
+		add(step.OnLeave, string(HookLeave))
 	}
 	return plan
 }
+
+// SkippedIn reports whether the task is skipped given the current context,
+// either as recorded in a dry run or by re-evaluating its when: condition.
+func (s TaskSummary) SkippedIn(ctx *InstallContext) bool {
+	if s.Skipped || s.When == "" {
+		return s.Skipped
+	}
+	run, err := EvalCondition(ctx, s.When)
+	return err == nil && !run
+}
+
+// DescribeTask summarizes a created task, including the actions reported by
+// its Planner implementation (if any).
+func DescribeTask(task Task, ctx *InstallContext, requiresRoot bool) TaskSummary {
+	desc := task.ID()
+	if desc == "" {
+		desc = fmt.Sprintf("%s task", task.Type())
+	}
+
+	_, step := ctx.step()
+	summary := TaskSummary{
+		ID:           task.ID(),
+		Step:         step,
+		Type:         task.Type(),
+		Description:  desc,
+		RequiresRoot: requiresRoot,
+	}
+	if planner, ok := task.(Planner); ok {
+		summary.Actions = planner.Plan(ctx)
+	}
+	return summary
+}
@@ -33,3 +33,92 @@ func TestBuildTaskPlan(t *testing.T) {
 		t.Fatalf("expected RequiresRoot to be true")
 	}
 }
+
+// plannedMockTask reports a fixed set of actions.
+type plannedMockTask struct {
+	MockTask
+	actions []PlannedAction
+}
+
+func (t *plannedMockTask) Plan(ctx *InstallContext) []PlannedAction {
+	return t.actions
+}
+
+func TestTaskRunnerDryRun(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Runtime.DryRun = true
+	ctx.Runtime.CurrentStep = "install"
+	ctx.Plan = &TaskPlan{}
+	runner := NewTaskRunner(ctx, NewEventBus())
+
+	planned := &plannedMockTask{
+		MockTask: *NewMockTask("write", "mock"),
+		actions: []PlannedAction{
+			{Kind: ActionCreateDir, Path: "/opt/app"},
+			{Kind: ActionWriteFile, Path: "/opt/app/config.json"},
+		},
+	}
+	plain := NewMockTask("other", "mock")
+	runner.AddTasks([]Task{planned, plain})
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if planned.executed || plain.executed {
+		t.Error("tasks must not execute in dry-run mode")
+	}
+	if len(ctx.Plan.Tasks) != 2 {
+		t.Fatalf("expected 2 planned tasks, got %d", len(ctx.Plan.Tasks))
+	}
+	first := ctx.Plan.Tasks[0]
+	if first.ID != "write" || first.Step != "install" || len(first.Actions) != 2 {
+		t.Errorf("unexpected summary: %+v", first)
+	}
+	if got := first.Actions[1].String(); got != "write /opt/app/config.json" {
+		t.Errorf("unexpected action text: %q", got)
+	}
+	if len(ctx.Plan.Tasks[1].Actions) != 0 {
+		t.Error("tasks without a planner should have no actions")
+	}
+	if runner.Progress() != 1.0 {
+		t.Errorf("expected progress 1.0, got %f", runner.Progress())
+	}
+}
+
+func TestPlannedActionString(t *testing.T) {
+	tests := []struct {
+		action PlannedAction
+		want   string
+	}{
+		{PlannedAction{Kind: ActionDownload, Source: "https://x/a.tgz", Path: "/tmp/a.tgz"}, "download https://x/a.tgz -> /tmp/a.tgz"},
+		{PlannedAction{Kind: ActionSymlink, Path: "/usr/bin/app", Source: "/opt/app/app"}, "symlink /usr/bin/app -> /opt/app/app"},
+		{PlannedAction{Kind: ActionRunCommand, Command: "make install", Detail: "in /src"}, "run make install [in /src]"},
+		{PlannedAction{Kind: ActionUnit, Path: "app.service", Command: "enable"}, "unit app.service: enable"},
+	}
+	for _, tt := range tests {
+		if got := tt.action.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestTaskSummarySkippedIn(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Set("install_options", []string{"start_after"})
+
+	flow := &FlowConfig{Steps: []*StepConfig{{
+		ID: "install",
+		Tasks: []TaskConfig{
+			{Type: "shell", ID: "start", When: `"start_after" in install_options`},
+			{Type: "desktopEntry", ID: "shortcut", When: `"desktop_shortcut" in install_options`},
+		},
+	}}}
+
+	plan := BuildTaskPlan(flow)
+	if plan.Tasks[0].SkippedIn(ctx) {
+		t.Error("task with a met condition should not be skipped")
+	}
+	if !plan.Tasks[1].SkippedIn(ctx) {
+		t.Error("task with an unmet condition should be skipped")
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"sync/atomic"
@@ -68,6 +69,7 @@ func TestTaskStateString(t *testing.T) {
 		{TaskFailed, "failed"},
 		{TaskCancelled, "cancelled"},
 		{TaskRolledBack, "rolled_back"},
+		{TaskSkipped, "skipped"},
 		{TaskState(99), "unknown"},
 	}
 
@@ -407,6 +409,101 @@ func TestTaskRunnerCancel(t *testing.T) {
 	}
 }
 
+// blockingTask runs until its context is cancelled.
+type blockingTask struct {
+	MockTask
+	started chan struct{}
+}
+
+func (t *blockingTask) ExecuteContext(cctx context.Context, ctx *InstallContext, bus *EventBus) error {
+	t.executed = true
+	close(t.started)
+	<-cctx.Done()
+	return cctx.Err()
+}
+
+func TestTaskRunnerCancelInterruptsRunningTask(t *testing.T) {
+	runner := NewTaskRunner(NewInstallContext(), NewEventBus())
+
+	first := NewMockTask("first", "mock")
+	first.rollbackable = true
+	slow := &blockingTask{MockTask: *NewMockTask("slow", "mock"), started: make(chan struct{})}
+	slow.rollbackable = true
+	last := NewMockTask("last", "mock")
+	runner.AddTasks([]Task{first, slow, last})
+
+	go func() {
+		<-slow.started
+		runner.Cancel()
+	}()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- runner.Run() }()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrCancelled) {
+			t.Fatalf("expected ErrCancelled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancellation did not interrupt the running task")
+	}
+
+	runner.Wait()
+	if last.executed {
+		t.Error("no task should start after cancellation")
+	}
+	if !first.rolledBack {
+		t.Error("completed task should be rolled back on cancellation")
+	}
+	if !slow.rolledBack {
+		t.Error("interrupted task should be rolled back to clean up partial work")
+	}
+	if results := runner.Results(); len(results) < 2 || results[1].State != TaskCancelled {
+		t.Errorf("expected the interrupted task to be reported as cancelled, got %+v", results)
+	}
+}
+
+func TestTaskRunnerQueueConfigWhen(t *testing.T) {
+	name := "whenMock"
+	_ = Tasks.Register(name, func(config map[string]any, ctx *InstallContext) (Task, error) {
+		return NewMockTask(config["id"].(string), name), nil
+	})
+
+	ctx := NewInstallContext()
+	ctx.Set("install_options", []string{"desktop_shortcut"})
+	bus := NewEventBus()
+	var skipped []string
+	bus.Subscribe(EventTaskSkipped, func(e Event) {
+		skipped = append(skipped, e.TaskPayload().TaskID)
+	})
+
+	runner := NewTaskRunner(ctx, bus)
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "shortcut", When: `"desktop_shortcut" in install_options`})
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "path", When: `"add_to_path" in install_options`})
+	_ = runner.QueueConfig(TaskConfig{Type: name, ID: "after", DependsOn: []string{"path"}})
+	if err := runner.QueueConfig(TaskConfig{Type: name, ID: "bad", When: "a == b == c"}); err == nil {
+		t.Error("expected error for invalid when condition")
+	}
+
+	if err := runner.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	states := make(map[string]TaskState)
+	for _, result := range runner.Results() {
+		states[result.TaskID] = result.State
+	}
+	if states["shortcut"] != TaskCompleted || states["path"] != TaskSkipped || states["after"] != TaskCompleted {
+		t.Errorf("unexpected task states: %v", states)
+	}
+	if len(skipped) != 1 || skipped[0] != "path" {
+		t.Errorf("expected skipped event for path, got %v", skipped)
+	}
+	if runner.Progress() != 1.0 {
+		t.Errorf("expected progress 1.0, got %f", runner.Progress())
+	}
+}
+
 func TestTaskRunnerValidationFailure(t *testing.T) {
 	ctx := NewInstallContext()
 	bus := NewEventBus()
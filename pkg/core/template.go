@@ -0,0 +1,456 @@
+// Package core provides the template engine used to render config values.
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// placeholderPattern matches the ${path} shorthand for a context value.
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Functions render adds to every template: placeholderFunc returns the
+// value of a ${path} placeholder, and textFunc is appended to each action
+// so a missing value prints as nothing instead of "<no value>".
+const (
+	placeholderFunc = "_placeholder"
+	textFunc        = "_text"
+)
+
+// TemplateFuncs returns the functions available in templates:
+//
+//	default DEF VAL      VAL, or DEF if VAL is missing or empty
+//	upper S, lower S     change case
+//	join SEP LIST        join list items with SEP
+//	pathJoin A B...      join path elements
+//	base P, dir P        last element / directory of a path
+//	env NAME             environment variable of the installer process
+//	semver V             parsed version with Major, Minor, Patch and Compare
+//	toJSON V, toYAML V   encode a value
+//	quote S              double-quoted, escaped string
+//	shellQuote S         single-quoted string safe for sh
+//	sha256 S             hex SHA-256 digest
+//
+// Values come last so they can be piped: {{ .install.dir | default "/opt" }}.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"default": func(def, val any) any {
+			if isEmptyValue(val) {
+				return def
+			}
+			return val
+		},
+		"upper": func(s any) string { return strings.ToUpper(valueString(s)) },
+		"lower": func(s any) string { return strings.ToLower(valueString(s)) },
+		"join": func(sep string, list any) string {
+			return strings.Join(stringList(list), sep)
+		},
+		"pathJoin": func(elems ...any) string {
+			parts := make([]string, len(elems))
+			for i, e := range elems {
+				parts[i] = valueString(e)
+			}
+			return filepath.Join(parts...)
+		},
+		"base": func(p any) string { return filepath.Base(valueString(p)) },
+		"dir":  func(p any) string { return filepath.Dir(valueString(p)) },
+		"env":  func(name string) string { return os.Getenv(name) },
+		"semver": func(v any) (semVersion, error) {
+			return asSemver(v)
+		},
+		"toJSON": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"toYAML": func(v any) (string, error) {
+			data, err := yaml.Marshal(v)
+			return strings.TrimSuffix(string(data), "\n"), err
+		},
+		"quote":      func(s any) string { return strconv.Quote(valueString(s)) },
+		"shellQuote": func(s any) string { return ShellQuote(valueString(s)) },
+		"sha256": func(s any) string {
+			sum := sha256.Sum256([]byte(valueString(s)))
+			return hex.EncodeToString(sum[:])
+		},
+	}
+}
+
+// Major returns the first number of the version.
+func (v semVersion) Major() int { return v.part(0) }
+
+// Minor returns the second number of the version.
+func (v semVersion) Minor() int { return v.part(1) }
+
+// Patch returns the third number of the version.
+func (v semVersion) Patch() int { return v.part(2) }
+
+// Compare returns -1, 0 or 1 as the version is lower than, equal to or
+// higher than other.
+func (v semVersion) Compare(other any) (int, error) {
+	o, err := asSemver(other)
+	if err != nil {
+		return 0, err
+	}
+	return v.compare(o), nil
+}
+
+func (v semVersion) part(i int) int {
+	if i < len(v.parts) {
+		return v.parts[i]
+	}
+	return 0
+}
+
+// isEmptyValue reports whether default should replace val.
+func isEmptyValue(val any) bool {
+	if val == nil {
+		return true
+	}
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// stringList converts a list value to strings; other values become a list
+// of one.
+func stringList(list any) []string {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		if list == nil {
+			return nil
+		}
+		return []string{valueString(list)}
+	}
+	items := make([]string, rv.Len())
+	for i := range items {
+		items[i] = valueString(rv.Index(i).Interface())
+	}
+	return items
+}
+
+// Render expands a config string with context values. ${path} placeholders
+// are replaced with their values; unknown paths are left as they are. A
+// string that contains {{ is executed as a Go text/template (see
+// TemplateFuncs) with the context values as data, so {{ .install.dir }} and
+// ${install.dir} are the same, also inside actions: {{ base "${dir}" }}
+// passes the value of dir to base. A value is never executed as a template.
+// A template that fails is logged and the string is returned with only the
+// placeholders replaced.
+func (c *InstallContext) Render(text string) string {
+	result, err := c.RenderTemplate(text)
+	if err != nil {
+		c.AddLog(LogWarn, fmt.Sprintf("Failed to render template: %v", err))
+	}
+	return result
+}
+
+// RenderTemplate is Render for callers that report template errors
+// themselves. On error it returns the string with only the placeholders
+// replaced.
+func (c *InstallContext) RenderTemplate(text string) (string, error) {
+	return c.render(text, nil)
+}
+
+// render implements Render. When quote is set, each placeholder value
+// outside template actions is passed through it together with the offset of
+// the placeholder in text.
+func (c *InstallContext) render(text string, quote func(offset int, value string) string) (string, error) {
+	c.mu.RLock()
+	replaced := c.replacePlaceholdersUnlocked(text, quote)
+	if !strings.Contains(text, "{{") {
+		c.mu.RUnlock()
+		return replaced, nil
+	}
+	var values []string
+	source := rewriteTemplate(text, func(offset int, path string, action bool) (int, bool) {
+		val, ok := c.getUnlocked(path)
+		if !ok {
+			return 0, false
+		}
+		value := valueString(val)
+		if quote != nil && !action {
+			value = quote(offset, value)
+		}
+		values = append(values, value)
+		return len(values) - 1, true
+	})
+	data := c.templateDataUnlocked()
+	c.mu.RUnlock()
+
+	tmpl, err := template.New("config").Option("missingkey=zero").Funcs(TemplateFuncs()).Funcs(template.FuncMap{
+		placeholderFunc: func(i int) string { return values[i] },
+		textFunc: func(val any) any {
+			if val == nil {
+				return ""
+			}
+			return val
+		},
+	}).Parse(source)
+	if err != nil {
+		return replaced, err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			printMissingAsText(t.Tree, t.Tree.Root)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return replaced, err
+	}
+	return buf.String(), nil
+}
+
+// replacePlaceholdersUnlocked replaces the known ${path} placeholders of
+// text with their values, passed through quote if it is set.
+func (c *InstallContext) replacePlaceholdersUnlocked(text string, quote func(offset int, value string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(text, -1) {
+		val, ok := c.getUnlocked(text[m[2]:m[3]])
+		if !ok {
+			continue
+		}
+		value := valueString(val)
+		if quote != nil {
+			value = quote(m[0], value)
+		}
+		b.WriteString(text[last:m[0]])
+		b.WriteString(value)
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// rewriteTemplate turns the ${path} placeholders of a template into calls of
+// placeholderFunc, so the template sees their values. lookup stores the
+// value of a placeholder at offset in text and returns its index; action
+// tells whether the placeholder is inside a {{ }} action. Placeholders
+// lookup does not know are left as they are.
+//
+// Outside actions a placeholder becomes {{_placeholder N}}. Inside an action
+// it becomes (_placeholder N), and a string literal containing placeholders
+// becomes (print "text" (_placeholder N) ...).
+func rewriteTemplate(text string, lookup func(offset int, path string, action bool) (int, bool)) string {
+	var b strings.Builder
+	// placeholders writes text[start:end], a part without {{ }} syntax,
+	// with each known placeholder replaced by call(index).
+	placeholders := func(start, end int, action bool, call func(i int) string) {
+		last := start
+		for _, m := range placeholderPattern.FindAllStringSubmatchIndex(text[start:end], -1) {
+			i, ok := lookup(start+m[0], text[start+m[2]:start+m[3]], action)
+			if !ok {
+				continue
+			}
+			b.WriteString(text[last : start+m[0]])
+			b.WriteString(call(i))
+			last = start + m[1]
+		}
+		b.WriteString(text[last:end])
+	}
+	textCall := func(i int) string { return fmt.Sprintf("{{%s %d}}", placeholderFunc, i) }
+	actionCall := func(i int) string { return fmt.Sprintf("(%s %d)", placeholderFunc, i) }
+
+	pos := 0
+	for pos < len(text) {
+		start := strings.Index(text[pos:], "{{")
+		if start < 0 {
+			placeholders(pos, len(text), false, textCall)
+			break
+		}
+		start += pos
+		placeholders(pos, start, false, textCall)
+
+		// Copy the action, rewriting placeholders outside and inside its
+		// string literals; comments and character constants are kept
+		i := start + 2
+		last := i
+		b.WriteString("{{")
+		for i < len(text) && !strings.HasPrefix(text[i:], "}}") {
+			switch {
+			case strings.HasPrefix(text[i:], "/*"):
+				end := strings.Index(text[i+2:], "*/")
+				if end < 0 {
+					i = len(text)
+				} else {
+					i += end + 4
+				}
+			case text[i] == '"' || text[i] == '`' || text[i] == '\'':
+				end := literalEnd(text, i)
+				if text[i] != '\'' {
+					placeholders(last, i, true, actionCall)
+					b.WriteString(rewriteLiteral(text, i, end, lookup))
+					last = end
+				}
+				i = end
+			default:
+				i++
+			}
+		}
+		placeholders(last, i, true, actionCall)
+		pos = min(i+2, len(text))
+		b.WriteString(text[i:pos])
+	}
+	return b.String()
+}
+
+// literalEnd returns the offset after the string, raw string or character
+// literal starting at text[start], or len(text) if it is not closed.
+func literalEnd(text string, start int) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i + 1
+		case '\n':
+			if quote != '`' {
+				return i
+			}
+		}
+	}
+	return len(text)
+}
+
+// rewriteLiteral returns the string literal text[start:end] with its known
+// placeholders turned into calls of placeholderFunc, joined by print.
+func rewriteLiteral(text string, start, end int, lookup func(offset int, path string, action bool) (int, bool)) string {
+	literal := text[start:end]
+	value, err := strconv.Unquote(literal)
+	if err != nil {
+		return literal
+	}
+	var parts []string
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(value, -1) {
+		// Offsets inside an unquoted literal only locate the string
+		i, ok := lookup(start, value[m[2]:m[3]], true)
+		if !ok {
+			continue
+		}
+		if m[0] > last {
+			parts = append(parts, strconv.Quote(value[last:m[0]]))
+		}
+		parts = append(parts, fmt.Sprintf("(%s %d)", placeholderFunc, i))
+		last = m[1]
+	}
+	if parts == nil {
+		return literal
+	}
+	if last < len(value) {
+		parts = append(parts, strconv.Quote(value[last:]))
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "(print " + strings.Join(parts, " ") + ")"
+}
+
+// printMissingAsText appends textFunc to every action below node that
+// prints its value.
+func printMissingAsText(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			printMissingAsText(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			ident := parse.NewIdentifier(textFunc).SetTree(tree).SetPos(n.Pos)
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+		}
+	case *parse.IfNode:
+		printMissingAsText(tree, n.List)
+		printMissingAsText(tree, n.ElseList)
+	case *parse.RangeNode:
+		printMissingAsText(tree, n.List)
+		printMissingAsText(tree, n.ElseList)
+	case *parse.WithNode:
+		printMissingAsText(tree, n.List)
+		printMissingAsText(tree, n.ElseList)
+	}
+}
+
+// templateDataUnlocked returns the values templates see: environment
+// fields, under env. and at the top level, overlaid by Meta and then by
+// UserInput, the same order Get searches.
+func (c *InstallContext) templateDataUnlocked() map[string]any {
+	env := c.envValuesUnlocked()
+	data := make(map[string]any, len(env)+1)
+	mergeValues(data, env)
+	data["env"] = env
+	mergeValues(data, c.Meta)
+	mergeValues(data, c.UserInput)
+	return data
+}
+
+// envValuesUnlocked returns the environment fields by their context names.
+func (c *InstallContext) envValuesUnlocked() map[string]any {
+	return map[string]any{
+		"distro":           c.Env.Distro,
+		"distroVersion":    c.Env.DistroVersion,
+		"arch":             c.Env.Arch,
+		"desktop":          c.Env.Desktop,
+		"isRoot":           c.Env.IsRoot,
+		"hasPolkit":        c.Env.HasPolkit,
+		"hasSudo":          c.Env.HasSudo,
+		"diskFreeMB":       c.Env.DiskFreeMB,
+		"installedVersion": c.Env.InstalledVersion,
+		"installDir":       c.Env.InstallDir,
+	}
+}
+
+// mergeValues deep-copies src into dst; nested maps are merged and other
+// values of src win. Secrets are revealed, since the result is rendered.
+func mergeValues(dst, src map[string]any) {
+	for k, v := range src {
+		if s, ok := v.(Secret); ok {
+			v = s.Reveal()
+		}
+		if m, ok := v.(map[string]any); ok {
+			sub, ok := dst[k].(map[string]any)
+			if !ok {
+				sub = make(map[string]any, len(m))
+			} else {
+				sub = copyValues(sub)
+			}
+			mergeValues(sub, m)
+			dst[k] = sub
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func copyValues(m map[string]any) map[string]any {
+	result := make(map[string]any, len(m))
+	mergeValues(result, m)
+	return result
+}
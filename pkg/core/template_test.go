@@ -0,0 +1,110 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplateFuncs(t *testing.T) {
+	t.Setenv("INSTALLER_TEST_HOME", "/home/tester")
+	ctx := NewInstallContext()
+	ctx.Set("install.dir", "/opt/my app")
+	ctx.Set("plugins", []any{"core", "extra"})
+	ctx.Set("port", 8080)
+	ctx.SetMeta("version", "2.4.1")
+	ctx.SetMeta("install.channel", "stable")
+	ctx.Env.Arch = "x86_64"
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{{ .install.dir }} ${install.dir}`, "/opt/my app /opt/my app"},
+		{`{{ .missing | default "none" }}`, "none"},
+		{`{{ .install.dir | default "none" }}`, "/opt/my app"},
+		{`{{ .missing }}`, ""},
+		{`{{ upper .install.channel }}/{{ lower "ABC" }}`, "STABLE/abc"},
+		{`{{ join "," .plugins }}`, "core,extra"},
+		{`{{ range .plugins }}[{{ . }}]{{ end }}`, "[core][extra]"},
+		{`{{ pathJoin .install.dir "bin" "app" }}`, "/opt/my app/bin/app"},
+		{`{{ base .install.dir }} {{ dir .install.dir }}`, "my app /opt"},
+		{`{{ env "INSTALLER_TEST_HOME" }}`, "/home/tester"},
+		{`{{ (semver .version).Minor }}`, "4"},
+		{`{{ if lt ((semver .version).Compare "3.0") 0 }}old{{ end }}`, "old"},
+		{`{{ toJSON .plugins }}`, `["core","extra"]`},
+		{`{{ toYAML .plugins }}`, "- core\n- extra"},
+		{`{{ quote .install.dir }}`, `"/opt/my app"`},
+		{`{{ shellQuote "it's" }}`, `'it'\''s'`},
+		{`{{ sha256 "abc" }}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`{{ if eq .env.arch "x86_64" }}amd64{{ end }}`, "amd64"},
+		{`port={{ .port }}`, "port=8080"},
+		{`{{ if eq "${install.channel}" "stable" }}yes{{ end }}`, "yes"},
+		{`{{ base "${install.dir}" }}`, "my app"},
+		{`{{ sha256 "${version}" }}`, "4e103ffd9a1e40c6d18d4ccc6d632df4aca6f1cd5b2ab88a343884bf7832ffb6"},
+		{`{{ upper "v${version}-${install.channel}" }}`, "V2.4.1-STABLE"},
+		{`{{ ${port} }}`, "8080"},
+		{`{{ "${missing}" }}`, "${missing}"},
+		{`<no value> {{ .missing }}`, "<no value> "},
+		{`{{ with .missing }}x{{ else }}{{ .missing }}-{{ end }}`, "-"},
+	}
+
+	for _, tt := range tests {
+		result, err := ctx.RenderTemplate(tt.template)
+		if err != nil {
+			t.Errorf("RenderTemplate(%q) failed: %v", tt.template, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("RenderTemplate(%q) = %q, want %q", tt.template, result, tt.expected)
+		}
+	}
+}
+
+func TestRenderTemplateError(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Set("install.dir", "/opt/app")
+
+	if _, err := ctx.RenderTemplate("${install.dir}/{{ .x"); err == nil {
+		t.Error("expected parse error")
+	}
+	if _, err := ctx.RenderTemplate(`{{ semver "not a version" }}`); err == nil {
+		t.Error("expected execution error")
+	}
+
+	// Render logs the error and keeps the placeholders it could replace
+	if got := ctx.Render("${install.dir}/{{ .x"); got != "/opt/app/{{ .x" {
+		t.Errorf("unexpected fallback %q", got)
+	}
+	last := ctx.Runtime.Logs[len(ctx.Runtime.Logs)-1]
+	if last.Level != LogWarn || !strings.Contains(last.Message, "Failed to render template") {
+		t.Errorf("expected a warning, got %+v", last)
+	}
+}
+
+func TestRenderTemplateDataPrecedence(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.SetMeta("install.dir", "/opt/default")
+	ctx.SetMeta("install.type", "full")
+	ctx.Set("install.dir", "/srv/app")
+
+	got, err := ctx.RenderTemplate("{{ .install.dir }} {{ .install.type }}")
+	if err != nil || got != "/srv/app full" {
+		t.Errorf("expected user input over meta, merged per key, got %q %v", got, err)
+	}
+	if v, _ := ctx.Meta["install"].(map[string]any); v["dir"] != "/opt/default" {
+		t.Error("expected rendering not to modify the context")
+	}
+}
+
+func TestRenderTemplateDoesNotExecuteValues(t *testing.T) {
+	ctx := NewInstallContext()
+	ctx.Set("name", `{{ env "HOME" }}`)
+
+	got, err := ctx.RenderTemplate(`${name} {{ .name }} {{ print "${name}" }}`)
+	if err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+	if got != `{{ env "HOME" }} {{ env "HOME" }} {{ env "HOME" }}` {
+		t.Errorf("expected the value to be inserted as text, got %q", got)
+	}
+}
@@ -0,0 +1,223 @@
+// Package core provides the flow-wide rollback transaction.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Transaction collects the rollback-capable tasks completed by every task
+// runner of a flow, across all of its steps and step hooks. When the flow
+// fails or is cancelled, Rollback undoes them all in reverse order, not only
+// those of the step that was running.
+//
+// A Workflow owns one transaction and attaches it to its InstallContext, so
+// every TaskRunner on that context records into it.
+type Transaction struct {
+	mu      sync.Mutex
+	ctx     *InstallContext
+	bus     *EventBus
+	entries []*transactionEntry
+	results []RollbackResult // Of every Rollback so far
+}
+
+type transactionEntry struct {
+	task Task
+	step string
+	key  string // Journal key of the task
+	done bool   // Rolled back already, by its runner or the transaction
+}
+
+// RollbackResult reports the rollback of one task.
+type RollbackResult struct {
+	TaskID   string
+	TaskType string
+	Step     string
+	State    TaskState // TaskRolledBack, or TaskFailed if the rollback failed
+	Error    error
+}
+
+// NewTransaction creates an empty transaction.
+func NewTransaction(ctx *InstallContext, bus *EventBus) *Transaction {
+	return &Transaction{ctx: ctx, bus: bus}
+}
+
+// record adds a task that completed (or was interrupted) and can be rolled
+// back.
+func (t *Transaction) record(task Task, step, key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, &transactionEntry{task: task, step: step, key: key})
+}
+
+// Continue records the tasks that finished in the session of another
+// process, so that rolling back the flow undoes them too. See
+// Journal.Continue. Tasks that cannot be recreated are left out and
+// reported in the error.
+func (t *Transaction) Continue(state *JournalState) error {
+	var errs []error
+	for _, entry := range state.CompletedTasks() {
+		task, err := restoreJournaledTask(entry, t.ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.TaskID, err))
+			continue
+		}
+		if task.CanRollback() {
+			t.record(task, entry.Step, entry.Key)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// markRolledBack notes that a task's own runner has rolled it back, so the
+// transaction does not roll it back again.
+func (t *Transaction) markRolledBack(task Task) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, entry := range t.entries {
+		if entry.task == task {
+			entry.done = true
+		}
+	}
+}
+
+// Pending returns the number of tasks Rollback would undo.
+func (t *Transaction) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count := 0
+	for _, entry := range t.entries {
+		if !entry.done {
+			count++
+		}
+	}
+	return count
+}
+
+// Results returns the outcome of every task rolled back by Rollback so far,
+// in the order they were rolled back.
+func (t *Transaction) Results() []RollbackResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RollbackResult(nil), t.results...)
+}
+
+// Commit forgets the recorded tasks once the flow has succeeded and purges
+// the paths they quarantined and the file backups they kept. The flow stays
+// committed when purging fails; the returned error names what was left
+// behind.
+func (t *Transaction) Commit() error {
+	t.mu.Lock()
+	t.entries = nil
+	t.mu.Unlock()
+
+	if t.ctx == nil {
+		return nil
+	}
+	t.ctx.mu.RLock()
+	quarantine := t.ctx.quarantine
+	backups := t.ctx.backups
+	t.ctx.mu.RUnlock()
+	var errs []error
+	if backups != nil {
+		if err := backups.Purge(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge backups %s: %w", backups.Dir(), err))
+		}
+	}
+	if quarantine != nil {
+		if err := quarantine.Purge(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge quarantine %s: %w", quarantine.Dir(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rollback undoes the recorded tasks in reverse order of completion. Unlike
+// a runner's rollback it goes on when a task fails to roll back, so as much
+// as possible is undone; the returned error joins the failures. Each task is
+// rolled back at most once. Cancel and wait for running task runners before
+// calling it.
+func (t *Transaction) Rollback() ([]RollbackResult, error) {
+	t.mu.Lock()
+	var pending []*transactionEntry
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		if entry := t.entries[i]; !entry.done {
+			entry.done = true
+			pending = append(pending, entry)
+		}
+	}
+	t.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	t.ctx.AddLog(LogInfo, fmt.Sprintf("Rolling back %d tasks of the flow", len(pending)))
+
+	var results []RollbackResult
+	var errs []error
+	for _, entry := range pending {
+		task := entry.task
+		result := RollbackResult{
+			TaskID:   task.ID(),
+			TaskType: task.Type(),
+			Step:     entry.step,
+			State:    TaskRolledBack,
+		}
+
+		leave := t.ctx.enterTask(entry.step, task)
+		t.ctx.AddLog(LogInfo, fmt.Sprintf("Rolling back: %s", task.ID()))
+		if err := task.Rollback(t.ctx, t.bus); err != nil {
+			result.State = TaskFailed
+			result.Error = err
+			errs = append(errs, fmt.Errorf("%s: %w", task.ID(), err))
+			t.ctx.AddLog(LogError, fmt.Sprintf("Rollback failed for %s: %v", task.ID(), err))
+		} else if journal := t.ctx.Journal(); journal != nil {
+			flow, _ := t.ctx.step()
+			_ = journal.Record(JournalEntry{
+				Kind:     JournalTaskRollback,
+				Flow:     flow,
+				Step:     entry.step,
+				Key:      entry.key,
+				TaskID:   task.ID(),
+				TaskType: task.Type(),
+			})
+		}
+		leave()
+		results = append(results, result)
+	}
+
+	t.mu.Lock()
+	t.results = append(t.results, results...)
+	t.mu.Unlock()
+
+	if len(errs) > 0 {
+		return results, fmt.Errorf("rollback failed: %w", errors.Join(errs...))
+	}
+	return results, nil
+}
+
+// SetTransaction attaches the flow transaction task runners record into.
+func (c *InstallContext) SetTransaction(tx *Transaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transaction = tx
+}
+
+// Transaction returns the attached flow transaction, if any.
+func (c *InstallContext) Transaction() *Transaction {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.transaction
+}
+
+// Transaction returns the workflow's rollback transaction.
+func (w *Workflow) Transaction() *Transaction {
+	return w.tx
+}
+
+// Rollback undoes the work of every task step of the flow so far. Use it
+// when the flow fails or is cancelled; see Transaction.Rollback.
+func (w *Workflow) Rollback() ([]RollbackResult, error) {
+	return w.tx.Rollback()
+}
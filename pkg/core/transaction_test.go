@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// rollbackRecorder creates rollback-capable mock tasks that record the order
+// they are rolled back in.
+type rollbackRecorder struct {
+	order []string
+}
+
+func (r *rollbackRecorder) task(id string, rollbackErr error) *MockTask {
+	task := NewMockTask(id, "mock")
+	task.rollbackable = true
+	task.RollbackFunc = func(ctx *InstallContext, bus *EventBus) error {
+		r.order = append(r.order, id)
+		return rollbackErr
+	}
+	return task
+}
+
+// runStep runs tasks with a runner of their own, as each task step does.
+func runStep(ctx *InstallContext, step string, policy FailurePolicy, tasks ...Task) error {
+	ctx.Runtime.CurrentStep = step
+	runner := NewTaskRunner(ctx, NewEventBus())
+	runner.SetFailurePolicy(policy)
+	runner.AddTasks(tasks)
+	return runner.Run()
+}
+
+func TestWorkflowRollbackSpansSteps(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	rec := &rollbackRecorder{}
+
+	failing := NewMockTask("configure", "mock")
+	failing.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		return errors.New("boom")
+	}
+	if err := runStep(ctx, "download", FailureAbort, rec.task("fetch", nil), NewMockTask("check", "mock")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runStep(ctx, "install", FailureAbort, rec.task("unpack", nil), rec.task("link", nil), failing); err == nil {
+		t.Fatal("expected the install step to fail")
+	}
+
+	if got := w.Transaction().Pending(); got != 3 {
+		t.Errorf("expected 3 tasks to roll back, got %d", got)
+	}
+	results, err := w.Rollback()
+	if err != nil {
+		t.Fatalf("unexpected rollback error: %v", err)
+	}
+	if want := []string{"link", "unpack", "fetch"}; !reflect.DeepEqual(rec.order, want) {
+		t.Errorf("expected rollback order %v, got %v", want, rec.order)
+	}
+	if len(results) != 3 || results[2].TaskID != "fetch" || results[2].Step != "download" || results[2].State != TaskRolledBack {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	// Each task is rolled back once
+	if results, _ := w.Rollback(); len(results) != 0 || len(rec.order) != 3 {
+		t.Errorf("expected a second rollback to do nothing, got %+v", results)
+	}
+	if len(w.Transaction().Results()) != 3 {
+		t.Errorf("expected the results to be kept")
+	}
+}
+
+func TestTransactionSkipsTasksRolledBackByRunner(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	rec := &rollbackRecorder{}
+
+	failing := NewMockTask("configure", "mock")
+	failing.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		return errors.New("boom")
+	}
+	runStep(ctx, "download", FailureAbort, rec.task("fetch", nil))
+	runStep(ctx, "install", FailureRollback, rec.task("unpack", nil), failing)
+	if want := []string{"unpack"}; !reflect.DeepEqual(rec.order, want) {
+		t.Fatalf("expected the runner to roll back its step, got %v", rec.order)
+	}
+
+	w.Rollback()
+	if want := []string{"unpack", "fetch"}; !reflect.DeepEqual(rec.order, want) {
+		t.Errorf("expected only the earlier step to be rolled back again, got %v", rec.order)
+	}
+}
+
+func TestTransactionRetriesFailedRunnerRollback(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	rec := &rollbackRecorder{}
+
+	failing := NewMockTask("configure", "mock")
+	failing.ExecuteFunc = func(ctx *InstallContext, bus *EventBus) error {
+		return errors.New("boom")
+	}
+	runStep(ctx, "download", FailureAbort, rec.task("fetch", nil))
+	runStep(ctx, "install", FailureRollback, rec.task("unpack", errors.New("busy")), failing)
+
+	if got := w.Transaction().Pending(); got != 2 {
+		t.Errorf("expected the failed undo to stay pending, got %d pending", got)
+	}
+	if _, err := w.Rollback(); err == nil {
+		t.Error("expected the retried undo to fail again")
+	}
+	if want := []string{"unpack", "unpack", "fetch"}; !reflect.DeepEqual(rec.order, want) {
+		t.Errorf("expected the flow to retry the failed undo, got %v", rec.order)
+	}
+}
+
+func TestTransactionRollbackContinuesAfterFailure(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	rec := &rollbackRecorder{}
+
+	runStep(ctx, "install", FailureAbort, rec.task("a", nil), rec.task("b", errors.New("busy")), rec.task("c", nil))
+	results, err := w.Rollback()
+	if err == nil {
+		t.Fatal("expected rollback error")
+	}
+	if want := []string{"c", "b", "a"}; !reflect.DeepEqual(rec.order, want) {
+		t.Errorf("expected all tasks to be tried, got %v", rec.order)
+	}
+	if results[1].State != TaskFailed || results[1].Error == nil || results[2].State != TaskRolledBack {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+func TestWorkflowCompleteCommitsTransaction(t *testing.T) {
+	ctx := NewInstallContext()
+	w := NewWorkflow(ctx, NewEventBus())
+	w.AddFlow(createTestFlow())
+	w.SelectFlow("install")
+	rec := &rollbackRecorder{}
+
+	runStep(ctx, "install", FailureAbort, rec.task("files", nil))
+	w.Complete()
+	if results, _ := w.Rollback(); len(results) != 0 || len(rec.order) != 0 {
+		t.Error("expected a completed flow not to roll back")
+	}
+}
@@ -0,0 +1,368 @@
+// Package core provides typed variable declarations for the install context.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Types of a declared variable.
+const (
+	VarString = "string"
+	VarBool   = "bool"
+	VarInt    = "int"
+	VarPath   = "path"
+	VarList   = "list"
+	VarSecret = "secret"
+)
+
+// VariableConfig declares a context value: its type, where it comes from and
+// which values it accepts. Sources are tried in order: an override (-set or
+// Flag), the Env variable, a value already in the context (meta or a
+// restored session), Compute and then Default.
+type VariableConfig struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type,omitempty" json:"type,omitempty"` // Defaults to string
+	Default     any    `yaml:"default,omitempty" json:"default,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Required    bool   `yaml:"required,omitempty" json:"required,omitempty"`
+	Pattern     string `yaml:"pattern,omitempty" json:"pattern,omitempty"` // Regexp the whole value must match
+	Enum        []any  `yaml:"enum,omitempty" json:"enum,omitempty"`
+	Min         *int   `yaml:"min,omitempty" json:"min,omitempty"` // Bounds of an int
+	Max         *int   `yaml:"max,omitempty" json:"max,omitempty"`
+	Env         string `yaml:"env,omitempty" json:"env,omitempty"`         // Environment variable to read
+	Flag        string `yaml:"flag,omitempty" json:"flag,omitempty"`       // Command line flag, without the dash
+	Compute     string `yaml:"compute,omitempty" json:"compute,omitempty"` // Expression evaluated at startup
+}
+
+// TypeName returns the variable's type, string when unset.
+func (v *VariableConfig) TypeName() string {
+	if v.Type == "" {
+		return VarString
+	}
+	return v.Type
+}
+
+// Coerce converts a value, typically a string from the command line or the
+// environment, to the variable's type: bool, int, a list (from a
+// comma-separated string) or a string. Paths have a leading ~ expanded and
+// are cleaned.
+func (v *VariableConfig) Coerce(value any) (any, error) {
+	switch v.TypeName() {
+	case VarBool:
+		switch val := value.(type) {
+		case bool:
+			return val, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(val)) {
+			case "1", "t", "true", "yes", "on":
+				return true, nil
+			case "0", "f", "false", "no", "off", "":
+				return false, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: %v is not a bool", v.Name, value)
+	case VarInt:
+		if s, ok := value.(string); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not an int", v.Name, s)
+			}
+			return n, nil
+		}
+		if n, ok := toNumber(value); ok && n == float64(int(n)) {
+			return int(n), nil
+		}
+		return nil, fmt.Errorf("%s: %v is not an int", v.Name, value)
+	case VarList:
+		if s, ok := value.(string); ok {
+			items := []any{}
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			return items, nil
+		}
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, fmt.Errorf("%s: %v is not a list", v.Name, value)
+		}
+		items := make([]any, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+		return items, nil
+	case VarPath:
+		return expandPath(valueString(value)), nil
+	case VarSecret:
+		return Secret(valueString(value)), nil
+	}
+	switch value.(type) {
+	case map[string]any, []any:
+		return nil, fmt.Errorf("%s: %v is not a %s", v.Name, value, v.TypeName())
+	}
+	return valueString(value), nil
+}
+
+// Check reports whether a coerced value satisfies the variable's pattern,
+// enum and bounds.
+func (v *VariableConfig) Check(value any) error {
+	if v.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + v.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", v.Name, err)
+		}
+		if !re.MatchString(valueString(value)) {
+			return fmt.Errorf("%s: %q does not match %s", v.Name, v.display(value), v.Pattern)
+		}
+	}
+	if len(v.Enum) > 0 {
+		found := false
+		for _, allowed := range v.Enum {
+			if valueString(allowed) == valueString(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %q is not one of %v", v.Name, v.display(value), v.Enum)
+		}
+	}
+	if n, ok := value.(int); ok {
+		if v.Min != nil && n < *v.Min {
+			return fmt.Errorf("%s: %d is less than %d", v.Name, n, *v.Min)
+		}
+		if v.Max != nil && n > *v.Max {
+			return fmt.Errorf("%s: %d is more than %d", v.Name, n, *v.Max)
+		}
+	}
+	return nil
+}
+
+// display keeps secrets out of error messages.
+func (v *VariableConfig) display(value any) string {
+	if v.TypeName() == VarSecret {
+		return RedactedValue
+	}
+	return valueString(value)
+}
+
+// validate checks the declaration itself.
+func (v *VariableConfig) validate() error {
+	if v.Name == "" {
+		return errors.New("variable without a name")
+	}
+	switch v.TypeName() {
+	case VarString, VarBool, VarInt, VarPath, VarList, VarSecret:
+	default:
+		return fmt.Errorf("%s: unknown type %q", v.Name, v.Type)
+	}
+	if v.Pattern != "" {
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", v.Name, err)
+		}
+	}
+	if v.Compute != "" {
+		if _, err := ParseExpression(v.Compute); err != nil {
+			return fmt.Errorf("%s: %w", v.Name, err)
+		}
+	}
+	// A templated default can only be checked once it is rendered
+	if s, ok := v.Default.(string); v.Default != nil && (!ok || !strings.Contains(s, "${") && !strings.Contains(s, "{{")) {
+		if _, err := v.Coerce(v.Default); err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+	}
+	return nil
+}
+
+// expandPath expands a leading ~ to the home directory and cleans the path.
+func expandPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// ValidateVariables checks variable declarations: known types, valid
+// patterns and compute expressions, defaults of the right type and unique
+// names and flags.
+func ValidateVariables(vars []VariableConfig) error {
+	names := make(map[string]bool, len(vars))
+	flags := make(map[string]bool, len(vars))
+	var errs []error
+	for i := range vars {
+		v := &vars[i]
+		if err := v.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if names[v.Name] {
+			errs = append(errs, fmt.Errorf("%s: declared twice", v.Name))
+		}
+		names[v.Name] = true
+		if v.Flag != "" {
+			if flags[v.Flag] {
+				errs = append(errs, fmt.Errorf("%s: flag -%s is used twice", v.Name, v.Flag))
+			}
+			flags[v.Flag] = true
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeclareVariables checks the declarations and makes them known to the
+// context, so SetVariable, ResolveVariables and CheckVariables apply them.
+func (c *InstallContext) DeclareVariables(vars []VariableConfig) error {
+	if err := ValidateVariables(vars); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.variables = append([]VariableConfig(nil), vars...)
+	return nil
+}
+
+// Variables returns the declared variables in declaration order.
+func (c *InstallContext) Variables() []VariableConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]VariableConfig(nil), c.variables...)
+}
+
+// Variable returns the declaration of name.
+func (c *InstallContext) Variable(name string) (VariableConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, v := range c.variables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return VariableConfig{}, false
+}
+
+// SetVariable sets a context value, converted to and checked against its
+// declaration when name is declared. The context is unchanged on error.
+func (c *InstallContext) SetVariable(name string, value any) error {
+	if v, ok := c.Variable(name); ok {
+		coerced, err := v.Coerce(value)
+		if err != nil {
+			return err
+		}
+		if err := v.Check(coerced); err != nil {
+			return err
+		}
+		value = coerced
+	}
+	c.Set(name, value)
+	return nil
+}
+
+// ResolveVariables sets every declared variable from the first source that
+// has a value, see VariableConfig. overrides holds the raw values given on
+// the command line by variable name. Variables without a value are left
+// unset; CheckVariables reports required ones.
+func (c *InstallContext) ResolveVariables(overrides map[string]string) error {
+	var errs []error
+	for _, v := range c.Variables() {
+		value, ok, err := c.variableSource(v, overrides)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := c.SetVariable(v.Name, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// variableSource returns the value of the first source of v that has one.
+func (c *InstallContext) variableSource(v VariableConfig, overrides map[string]string) (any, bool, error) {
+	if value, ok := overrides[v.Name]; ok {
+		return value, true, nil
+	}
+	if v.Env != "" {
+		if value, ok := os.LookupEnv(v.Env); ok {
+			return value, true, nil
+		}
+	}
+	if value, ok := c.Get(v.Name); ok {
+		return value, true, nil
+	}
+	if v.Compute != "" {
+		expr, err := ParseExpression(v.Compute)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", v.Name, err)
+		}
+		value, err := expr.Eval(c)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", v.Name, err)
+		}
+		return value, value != nil, nil
+	}
+	if v.Default != nil {
+		if s, ok := v.Default.(string); ok {
+			return c.Render(s), true, nil
+		}
+		return v.Default, true, nil
+	}
+	return nil, false, nil
+}
+
+// CheckVariables checks the current value of every declared variable and
+// reports required ones without a value.
+func (c *InstallContext) CheckVariables() error {
+	var errs []error
+	for _, v := range c.Variables() {
+		value, ok := c.Get(v.Name)
+		if !ok || isEmptyValue(value) && v.TypeName() != VarBool && v.TypeName() != VarInt {
+			if v.Required {
+				errs = append(errs, fmt.Errorf("%s is required", v.Name))
+			}
+			continue
+		}
+		coerced, err := v.Coerce(value)
+		if err == nil {
+			err = v.Check(coerced)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restoreVariables converts the values of declared variables loaded from a
+// session back to their type and checks them; JSON turns every number into
+// a float64.
+func (c *InstallContext) restoreVariables() error {
+	var errs []error
+	for _, v := range c.Variables() {
+		value, ok := c.Get(v.Name)
+		if !ok || value == nil || isEmptyValue(value) && v.TypeName() != VarBool && v.TypeName() != VarInt {
+			continue
+		}
+		if err := c.SetVariable(v.Name, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
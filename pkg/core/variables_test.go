@@ -0,0 +1,140 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestVariableCoerce(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	tests := []struct {
+		typ      string
+		value    any
+		expected any
+	}{
+		{VarString, 42, "42"},
+		{VarBool, "yes", true},
+		{VarBool, "0", false},
+		{VarInt, " 8080", 8080},
+		{VarInt, float64(3), 3},
+		{VarList, "a, b,,c", []any{"a", "b", "c"}},
+		{VarList, []string{"x"}, []any{"x"}},
+		{VarPath, "~/apps/../app/", filepath.Join(home, "app")},
+		{VarSecret, "s3cret", "s3cret"},
+	}
+	for _, tt := range tests {
+		v := VariableConfig{Name: "v", Type: tt.typ}
+		got, err := v.Coerce(tt.value)
+		if err != nil {
+			t.Errorf("Coerce(%s, %v) failed: %v", tt.typ, tt.value, err)
+			continue
+		}
+		if valueString(got) != valueString(tt.expected) {
+			t.Errorf("Coerce(%s, %v) = %#v, want %#v", tt.typ, tt.value, got, tt.expected)
+		}
+	}
+
+	for _, bad := range []VariableConfig{{Name: "b", Type: VarBool}, {Name: "i", Type: VarInt}} {
+		if _, err := bad.Coerce("maybe"); err == nil {
+			t.Errorf("expected %s to reject \"maybe\"", bad.Type)
+		}
+	}
+}
+
+func TestVariableCheck(t *testing.T) {
+	port := VariableConfig{Name: "port", Type: VarInt, Min: intPtr(1), Max: intPtr(65535)}
+	if err := port.Check(70000); err == nil {
+		t.Error("expected an int above max to fail")
+	}
+	channel := VariableConfig{Name: "channel", Enum: []any{"stable", "beta"}}
+	if err := channel.Check("nightly"); err == nil {
+		t.Error("expected a value outside the enum to fail")
+	}
+	token := VariableConfig{Name: "token", Type: VarSecret, Pattern: "[a-z]+"}
+	err := token.Check("abc-123")
+	if err == nil || strings.Contains(err.Error(), "abc-123") {
+		t.Errorf("expected the pattern to fail without showing the secret, got %v", err)
+	}
+	if err := token.Check("abc"); err != nil {
+		t.Errorf("expected a matching value to pass, got %v", err)
+	}
+}
+
+func TestValidateVariables(t *testing.T) {
+	err := ValidateVariables([]VariableConfig{
+		{Name: "a", Type: "float"},
+		{Name: "b", Pattern: "("},
+		{Name: "c", Compute: "x =="},
+		{Name: "d", Type: VarInt, Default: "many"},
+		{Name: "e", Flag: "e"},
+		{Name: "e", Flag: "e"},
+		{Name: "f", Type: VarInt, Default: "${port}"},
+	})
+	if err == nil {
+		t.Fatal("expected invalid declarations to fail")
+	}
+	for _, want := range []string{"a: unknown type", "b: invalid pattern", "c: expression", "d: \"many\"", "e: declared twice", "flag -e"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "f:") {
+		t.Errorf("expected a templated default to be accepted, got %v", err)
+	}
+}
+
+func TestResolveVariables(t *testing.T) {
+	t.Setenv("TEST_APP_CHANNEL", "beta")
+	ctx := NewInstallContext()
+	ctx.Env.Arch = "arm64"
+	ctx.Set("prefix", "/srv")
+	err := ctx.DeclareVariables([]VariableConfig{
+		{Name: "port", Type: VarInt, Default: 8080, Flag: "port"},
+		{Name: "channel", Enum: []any{"stable", "beta"}, Default: "stable", Env: "TEST_APP_CHANNEL"},
+		{Name: "prefix", Type: VarPath, Default: "/opt"},
+		{Name: "install_dir", Type: VarPath, Default: "${prefix}/app/"},
+		{Name: "arm", Type: VarBool, Compute: `env.arch == "arm64"`},
+		{Name: "plugins", Type: VarList},
+		{Name: "token", Type: VarSecret, Required: true},
+	})
+	if err != nil {
+		t.Fatalf("DeclareVariables failed: %v", err)
+	}
+
+	if err := ctx.ResolveVariables(map[string]string{"port": "9090"}); err != nil {
+		t.Fatalf("ResolveVariables failed: %v", err)
+	}
+	expected := map[string]any{
+		"port":        9090,
+		"channel":     "beta",
+		"prefix":      "/srv",
+		"install_dir": "/srv/app",
+		"arm":         true,
+	}
+	for name, want := range expected {
+		if got, _ := ctx.Get(name); got != want {
+			t.Errorf("expected %s = %#v, got %#v", name, want, got)
+		}
+	}
+	if _, ok := ctx.Get("plugins"); ok {
+		t.Error("expected a variable without a source to stay unset")
+	}
+
+	if err := ctx.CheckVariables(); err == nil || !strings.Contains(err.Error(), "token is required") {
+		t.Errorf("expected the missing required variable to be reported, got %v", err)
+	}
+	if err := ctx.SetVariable("port", "http"); err == nil {
+		t.Error("expected SetVariable to reject a value of the wrong type")
+	}
+	if got, _ := ctx.Get("port"); got != 9090 {
+		t.Errorf("expected a rejected value to leave the context unchanged, got %v", got)
+	}
+
+	if err := ctx.ResolveVariables(map[string]string{"channel": "nightly"}); err == nil {
+		t.Error("expected an invalid override to fail")
+	}
+}
@@ -0,0 +1,187 @@
+// Package schema provides config includes for splitting configs into fragments.
+package schema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the top-level key listing fragment files to merge in.
+const includeKey = "include"
+
+// fragmentKeys are the top-level keys an included fragment may define.
+var fragmentKeys = map[string]bool{"flows": true, "meta": true, includeKey: true}
+
+// LoadConfigFile loads and validates an installer configuration file,
+// merging in any fragments it includes. Include paths are relative to the
+// directory of the file that names them (config.dir for the main file).
+func LoadConfigFile(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	merged, err := resolveIncludes(content, path)
+	if err != nil {
+		return nil, err
+	}
+	loader := &SchemaValidatorLoader{}
+	return loader.Load(merged)
+}
+
+// ResolveIncludes merges the fragments named by a config's top-level
+// include: into it and returns the combined YAML. Fragments may define
+// flows and meta, and may include further fragments. A flow defined twice
+// is an error; meta set in the including file wins over its fragments.
+// Relative include paths are resolved against dir.
+func ResolveIncludes(yamlContent []byte, dir string) ([]byte, error) {
+	return resolveIncludes(yamlContent, filepath.Join(dir, "config.yaml"))
+}
+
+func resolveIncludes(content []byte, path string) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		// Leave reporting to the schema validator
+		return content, nil
+	}
+	if _, ok := doc[includeKey]; !ok {
+		return content, nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	if err := mergeIncludes(doc, abs, map[string]bool{abs: true}); err != nil {
+		return nil, err
+	}
+	merged, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge includes: %w", err)
+	}
+	return merged, nil
+}
+
+// mergeIncludes merges the fragments included by doc (read from path) into
+// it and removes the include key. seen holds the files being merged, to
+// catch include cycles.
+func mergeIncludes(doc map[string]any, path string, seen map[string]bool) error {
+	patterns, err := includePatterns(doc[includeKey])
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	delete(doc, includeKey)
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid include %q: %w", path, pattern, err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("%s: include %q matches no files", path, pattern)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			if seen[file] {
+				return fmt.Errorf("%s: include cycle through %s", path, file)
+			}
+			fragment, err := loadFragment(file)
+			if err != nil {
+				return err
+			}
+			seen[file] = true
+			err = mergeIncludes(fragment, file, seen)
+			delete(seen, file)
+			if err != nil {
+				return err
+			}
+			if err := mergeFragment(doc, fragment, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// includePatterns reads include: as a single path or a list of paths.
+func includePatterns(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		patterns := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("include entries must be file paths, got %v", item)
+			}
+			patterns = append(patterns, s)
+		}
+		return patterns, nil
+	default:
+		return nil, fmt.Errorf("include must be a file path or a list of paths, got %T", value)
+	}
+}
+
+// loadFragment reads an included file and checks it only has fragment keys.
+func loadFragment(file string) (map[string]any, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read include: %w", err)
+	}
+	var fragment map[string]any
+	if err := yaml.Unmarshal(content, &fragment); err != nil {
+		return nil, fmt.Errorf("%s: invalid YAML: %w", file, err)
+	}
+	if fragment == nil {
+		fragment = make(map[string]any)
+	}
+	for key := range fragment {
+		if !fragmentKeys[key] {
+			return nil, fmt.Errorf("%s: included files may only define flows, meta and include, not %q", file, key)
+		}
+	}
+	return fragment, nil
+}
+
+// mergeFragment copies the flows and meta of a fragment into doc.
+func mergeFragment(doc, fragment map[string]any, file string) error {
+	if flows, ok := fragment["flows"].(map[string]any); ok {
+		target, _ := doc["flows"].(map[string]any)
+		if target == nil {
+			target = make(map[string]any)
+			doc["flows"] = target
+		}
+		for id, flow := range flows {
+			if _, exists := target[id]; exists {
+				return fmt.Errorf("%s: flow %q is already defined", file, id)
+			}
+			target[id] = flow
+		}
+	} else if fragment["flows"] != nil {
+		return fmt.Errorf("%s: flows must be a map of flow IDs", file)
+	}
+
+	if meta, ok := fragment["meta"].(map[string]any); ok {
+		target, _ := doc["meta"].(map[string]any)
+		if target == nil {
+			target = make(map[string]any)
+			doc["meta"] = target
+		}
+		for key, val := range meta {
+			if _, exists := target[key]; !exists {
+				target[key] = val
+			}
+		}
+	}
+	return nil
+}
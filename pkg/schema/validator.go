@@ -237,14 +237,29 @@ func (l *SchemaValidatorLoader) Load(yamlContent []byte) (*core.Config, error) {
 	if err := yaml.Unmarshal(yamlContent, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	if err := core.ExpandSubflows(&config); err != nil {
+		return nil, fmt.Errorf("invalid sub-flow: %w", err)
+	}
+	if err := core.ValidateConditions(&config); err != nil {
+		return nil, fmt.Errorf("invalid condition: %w", err)
+	}
+	if err := core.ValidateVariables(config.Variables); err != nil {
+		return nil, fmt.Errorf("invalid variable: %w", err)
+	}
 
 	return &config, nil
 }
 
 // LoadConfig loads and validates an installer configuration from YAML.
+// Includes are resolved against the working directory; use LoadConfigFile
+// to resolve them against the config file's directory.
 func LoadConfig(yamlContent []byte) (*core.Config, error) {
+	merged, err := ResolveIncludes(yamlContent, ".")
+	if err != nil {
+		return nil, err
+	}
 	loader := &SchemaValidatorLoader{}
-	return loader.Load(yamlContent)
+	return loader.Load(merged)
 }
 
 // LoadConfigFromString loads and validates an installer configuration from a YAML string.
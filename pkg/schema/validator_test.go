@@ -1,6 +1,10 @@
 package schema
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -103,6 +107,157 @@ flows:
 	}
 }
 
+func TestValidateYAMLWithTaskFailurePolicy(t *testing.T) {
+	v, _ := NewValidator()
+
+	validYAML := `
+product:
+  name: "Test App"
+flows:
+  install:
+    entry: "install"
+    steps:
+      - id: "install"
+        title: "Installing"
+        screen:
+          type: "progress"
+        tasks:
+          - type: "download"
+            id: "fetch"
+            url: "https://example.com/app.tar.gz"
+            on_failure: "skip"
+            retries: 3
+            backoff:
+              strategy: "exponential"
+              delayMs: 500
+              maxDelayMs: 10000
+              jitter: 0.2
+`
+	result := v.ValidateYAML([]byte(validYAML))
+	if !result.Valid {
+		t.Errorf("Should be valid, errors: %v", result.Errors)
+	}
+
+	invalidYAML := strings.Replace(validYAML, `on_failure: "skip"`, `on_failure: "ignore"`, 1)
+	result = v.ValidateYAML([]byte(invalidYAML))
+	if result.Valid {
+		t.Error("Should be invalid for unknown on_failure value")
+	}
+}
+
+func TestValidateYAMLWithTaskDependencies(t *testing.T) {
+	v, _ := NewValidator()
+
+	validYAML := `
+product:
+  name: "Test App"
+flows:
+  install:
+    entry: "install"
+    steps:
+      - id: "install"
+        title: "Installing"
+        screen:
+          type: "progress"
+        tasks:
+          - type: "download"
+            id: "fetch"
+            url: "https://example.com/app.tar.gz"
+          - type: "unpack"
+            id: "extract"
+            source: "/tmp/app.tar.gz"
+            destination: "/opt/app"
+            dependsOn: ["fetch"]
+`
+	result := v.ValidateYAML([]byte(validYAML))
+	if !result.Valid {
+		t.Errorf("Should be valid, errors: %v", result.Errors)
+	}
+
+	invalidYAML := strings.Replace(validYAML, `dependsOn: ["fetch"]`, `dependsOn: "fetch"`, 1)
+	result = v.ValidateYAML([]byte(invalidYAML))
+	if result.Valid {
+		t.Error("Should be invalid when dependsOn is not a list")
+	}
+}
+
+func TestValidateYAMLWithTaskWeights(t *testing.T) {
+	v, _ := NewValidator()
+
+	validYAML := `
+product:
+  name: "Test App"
+flows:
+  install:
+    entry: "install"
+    steps:
+      - id: "install"
+        title: "Installing"
+        screen:
+          type: "progress"
+        tasks:
+          - type: "download"
+            url: "https://example.com/app.tar.gz"
+            size: 52428800
+          - type: "shell"
+            command: "make install"
+            weight: 20
+`
+	result := v.ValidateYAML([]byte(validYAML))
+	if !result.Valid {
+		t.Errorf("Should be valid, errors: %v", result.Errors)
+	}
+
+	invalidYAML := strings.Replace(validYAML, "weight: 20", "weight: 0", 1)
+	result = v.ValidateYAML([]byte(invalidYAML))
+	if result.Valid {
+		t.Error("Should be invalid when weight is not positive")
+	}
+}
+
+func TestValidateYAMLWithTaskConditions(t *testing.T) {
+	v, _ := NewValidator()
+
+	validYAML := `
+product:
+  name: "Test App"
+flows:
+  install:
+    entry: "install"
+    steps:
+      - id: "install"
+        title: "Installing"
+        screen:
+          type: "progress"
+        tasks:
+          - type: "shell"
+            command: "./start.sh"
+            when: '"start_after" in install_options'
+`
+	result := v.ValidateYAML([]byte(validYAML))
+	if !result.Valid {
+		t.Errorf("Should be valid, errors: %v", result.Errors)
+	}
+
+	loopYAML := strings.Replace(validYAML, `when: '"start_after" in install_options'`, "forEach: plugins", 1)
+	result = v.ValidateYAML([]byte(loopYAML))
+	if !result.Valid {
+		t.Errorf("forEach should be valid, errors: %v", result.Errors)
+	}
+
+	outputsYAML := strings.Replace(validYAML, `when: '"start_after" in install_options'`, "register: started\n            outputs:\n              stdout: app.pid", 1)
+	result = v.ValidateYAML([]byte(outputsYAML))
+	if !result.Valid {
+		t.Errorf("register and outputs should be valid, errors: %v", result.Errors)
+	}
+
+	invalidYAML := strings.Replace(validYAML, `when: '"start_after" in install_options'`, "when: true", 1)
+	result = v.ValidateYAML([]byte(invalidYAML))
+	if result.Valid {
+		t.Error("Should be invalid when when is not a string")
+	}
+}
+
 func TestValidateYAMLWithGuards(t *testing.T) {
 	v, _ := NewValidator()
 
@@ -429,6 +584,29 @@ product: {}
 	}
 }
 
+func TestLoadConfigInvalidCondition(t *testing.T) {
+	yamlContent := `
+product:
+  name: "Test App"
+flows:
+  install:
+    entry: "welcome"
+    steps:
+      - id: "welcome"
+        title: "Welcome"
+        when: "first_run &&"
+        screen:
+          type: "finish"
+`
+	_, err := LoadConfig([]byte(yamlContent))
+	if err == nil {
+		t.Fatal("LoadConfig should fail for a condition that does not parse")
+	}
+	if !strings.Contains(err.Error(), "step welcome when") {
+		t.Errorf("expected error to name the step, got %v", err)
+	}
+}
+
 func TestGoExtensionScreenType(t *testing.T) {
 	v, _ := NewValidator()
 
@@ -473,3 +651,218 @@ flows:
 		t.Errorf("go: extension task should be valid, errors: %v", result.Errors)
 	}
 }
+
+func TestExecPluginTaskType(t *testing.T) {
+	v, _ := NewValidator()
+
+	validYAML := `
+product:
+  name: "Test App"
+flows:
+  install:
+    entry: "install"
+    steps:
+      - id: "install"
+        title: "Install"
+        screen:
+          type: "progress"
+        tasks:
+          - type: "exec:check-glibc"
+            minVersion: "2.31"
+`
+	result := v.ValidateYAML([]byte(validYAML))
+	if !result.Valid {
+		t.Errorf("exec: plugin task should be valid, errors: %v", result.Errors)
+	}
+}
+
+func TestLoadConfigWithVariables(t *testing.T) {
+	config := `
+product:
+  name: "Test App"
+variables:
+  - name: install_dir
+    type: path
+    default: "/opt/test"
+    flag: install-dir
+    description: "Installation directory"
+  - name: port
+    type: %s
+    default: 8080
+    min: 1
+flows:
+  install:
+    entry: "install"
+    steps:
+      - id: "install"
+        title: "Install"
+        screen:
+          type: "progress"
+`
+	cfg, err := LoadConfigFromString(fmt.Sprintf(config, "int"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Variables) != 2 || cfg.Variables[0].Flag != "install-dir" || *cfg.Variables[1].Min != 1 {
+		t.Errorf("unexpected variables %+v", cfg.Variables)
+	}
+
+	if _, err := LoadConfigFromString(fmt.Sprintf(config, "float")); err == nil {
+		t.Error("expected an unknown variable type to be rejected")
+	}
+	if _, err := LoadConfigFromString(fmt.Sprintf(config, "bool")); err == nil || !strings.Contains(err.Error(), "invalid variable") {
+		t.Errorf("expected a default of the wrong type to be rejected, got %v", err)
+	}
+}
+
+func TestLoadConfigFileWithIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("installer.yaml", `
+product:
+  name: "Test App"
+meta:
+  version: "2.0"
+include: "fragments/*.yaml"
+flows:
+  install:
+    entry: "welcome"
+    steps:
+      - id: "welcome"
+        title: "Welcome"
+        screen:
+          type: "welcome"
+          content: "Hello"
+      - id: "common"
+        flow: "shared"
+`)
+	writeFile("fragments/shared.yaml", `
+meta:
+  version: "1.0"
+  channel: "stable"
+include: "../extra/finish.yaml"
+flows:
+  shared:
+    entry: "license"
+    steps:
+      - id: "license"
+        title: "License"
+        screen:
+          type: "license"
+          content: "Terms"
+      - id: "done"
+        flow: "finish"
+`)
+	writeFile("extra/finish.yaml", `
+flows:
+  finish:
+    entry: "finish"
+    steps:
+      - id: "finish"
+        title: "Finish"
+        screen:
+          type: "finish"
+`)
+
+	cfg, err := LoadConfigFile(filepath.Join(dir, "installer.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfigFile failed: %v", err)
+	}
+	if len(cfg.Flows) != 3 {
+		t.Errorf("expected included flows to be merged, got %d flows", len(cfg.Flows))
+	}
+	if cfg.Meta["version"] != "2.0" || cfg.Meta["channel"] != "stable" {
+		t.Errorf("expected main file meta to win over fragments, got %v", cfg.Meta)
+	}
+
+	var ids []string
+	for _, step := range cfg.Flows["install"].Steps {
+		ids = append(ids, step.ID)
+	}
+	if got := strings.Join(ids, ","); got != "welcome,common/license,common/done/finish" {
+		t.Errorf("expected sub-flow steps to be inlined, got %s", got)
+	}
+}
+
+func TestLoadConfigFileIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "missing",
+			files: map[string]string{"main.yaml": "include: nothing.yaml\n"},
+			want:  "matches no files",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"main.yaml": "include: a.yaml\n",
+				"a.yaml":    "include: b.yaml\n",
+				"b.yaml":    "include: a.yaml\n",
+			},
+			want: "include cycle",
+		},
+		{
+			name: "product",
+			files: map[string]string{
+				"main.yaml": "include: a.yaml\n",
+				"a.yaml":    "product:\n  name: Other\n",
+			},
+			want: `not "product"`,
+		},
+		{
+			name: "duplicate flow",
+			files: map[string]string{
+				"main.yaml": "include: a.yaml\nflows:\n  install: {}\n",
+				"a.yaml":    "flows:\n  install: {}\n",
+			},
+			want: `flow "install" is already defined`,
+		},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, content := range tt.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err := LoadConfigFile(filepath.Join(dir, "main.yaml"))
+		if err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error to mention %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestLoadConfigUnknownSubflow(t *testing.T) {
+	yamlContent := `
+product:
+  name: "Test App"
+flows:
+  install:
+    entry: "common"
+    steps:
+      - id: "common"
+        flow: "shared"
+`
+	_, err := LoadConfig([]byte(yamlContent))
+	if err == nil || !strings.Contains(err.Error(), `unknown flow "shared"`) {
+		t.Errorf("expected unknown sub-flow error, got %v", err)
+	}
+}
@@ -25,6 +25,8 @@ var uiTranslations = map[string]map[string]string{
 		"dialog.select.file":      "Select File",
 		"dialog.validation.title": "Validation Error",
 		"dialog.error.title":      "Error",
+		"dialog.recover.title":    "Interrupted Installation",
+		"dialog.recover.msg":      "A previous installation was interrupted at step \"%s\".\n\nYes: resume from the interrupted task\nNo: roll back the completed changes\nCancel: quit",
 		"title.welcome":           "Welcome to %s",
 		"title.license":           "License Agreement",
 		"title.directory":         "Select Installation Directory",
@@ -44,6 +46,7 @@ var uiTranslations = map[string]map[string]string{
 		"label.install.dir":       "Installation Directory:",
 		"label.required.space":    "Required space: ",
 		"label.plan":              "Planned actions:",
+		"label.skipped":           "(skipped)",
 		"label.errors":            "Errors:",
 		"label.logfile":           "Log file: %s",
 		"label.installed.to":      "Installed to:",
@@ -54,6 +57,7 @@ var uiTranslations = map[string]map[string]string{
 		"status.failed":           "Installation Failed",
 		"status.complete":         "Installation Complete",
 		"status.no_tasks":         "No tasks to run",
+		"status.eta":              "%s (about %s left)",
 		"msg.no_tasks":            "No tasks configured for installation.",
 		"msg.ready":               "Review the details before installing.",
 		"msg.content.file":        "Content would be loaded from: %s",
@@ -62,6 +66,7 @@ var uiTranslations = map[string]map[string]string{
 		"msg.scroll_end":          "Please scroll to the end of the license to continue.",
 		"msg.accept_license":      "You must accept the license agreement to continue.",
 		"msg.success":             "✓ The installation completed successfully!",
+		"msg.dry_run":             "Dry run finished. No changes were made.",
 		"msg.failure":             "✗ The installation encountered errors.",
 		"msg.detect.running":      "Detecting...",
 		"msg.detect.failed":       "Detection failed.",
@@ -76,6 +81,10 @@ var uiTranslations = map[string]map[string]string{
 		"msg.task.error":          "Error in %s: %v",
 		"msg.install.failed":      "Installation failed: %v",
 		"msg.install.in_progress": "Installation is still in progress",
+		"msg.cleanup.failed":      "The installation completed, but cleaning up failed: %v",
+		"msg.rollback.failed":     "The installation failed and could not be fully rolled back: %v",
+		"msg.rollback.done":       "The installation failed. %d completed tasks were rolled back.",
+		"msg.rollback.none":       "The installation failed. No changes had to be rolled back.",
 		"footer.close":            "Click 'Close' to exit the installer.",
 	},
 	"zh": {
@@ -91,6 +100,8 @@ var uiTranslations = map[string]map[string]string{
 		"dialog.cancel.msg":       "确定要取消安装吗？",
 		"dialog.validation.title": "校验错误",
 		"dialog.error.title":      "错误",
+		"dialog.recover.title":    "安装被中断",
+		"dialog.recover.msg":      "上次安装在步骤“%s”处中断。\n\n是：从中断的任务继续\n否：回滚已完成的更改\n取消：退出",
 		"title.welcome":           "欢迎使用 %s",
 		"title.license":           "许可协议",
 		"title.directory":         "选择安装目录",
@@ -106,6 +117,7 @@ var uiTranslations = map[string]map[string]string{
 		"label.install.dir":       "安装目录：",
 		"label.required.space":    "所需空间：",
 		"label.plan":              "计划执行：",
+		"label.skipped":           "（跳过）",
 		"label.errors":            "错误：",
 		"label.logfile":           "日志文件：%s",
 		"label.installed.to":      "安装位置：",
@@ -115,14 +127,20 @@ var uiTranslations = map[string]map[string]string{
 		"status.failed":           "安装失败",
 		"status.complete":         "安装完成",
 		"status.no_tasks":         "没有可执行的任务",
+		"status.eta":              "%s（剩余约 %s）",
 		"msg.no_tasks":            "未配置安装任务。",
 		"msg.scroll_end":          "请先滚动到协议末尾。",
 		"msg.accept_license":      "请先勾选同意许可协议。",
 		"msg.success":             "✓ 安装已成功完成！",
+		"msg.dry_run":             "演练完成，未做任何更改。",
 		"msg.failure":             "✗ 安装过程中出现错误。",
 		"msg.detect.running":      "检测中...",
 		"msg.detect.failed":       "检测失败。",
 		"msg.detect.in_progress":  "检测仍在进行中",
+		"msg.cleanup.failed":      "安装已完成，但清理失败：%v",
+		"msg.rollback.failed":     "安装失败，且未能完全回滚：%v",
+		"msg.rollback.done":       "安装失败，已回滚 %d 个已完成的任务。",
+		"msg.rollback.none":       "安装失败，没有需要回滚的更改。",
 		"footer.close":            "点击“关闭”退出安装程序。",
 	},
 }
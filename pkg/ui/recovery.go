@@ -0,0 +1,40 @@
+// Package ui provides the crash-recovery prompt shown before the installer window.
+package ui
+
+import (
+	"fmt"
+	"runtime"
+
+	. "modernc.org/tk9.0"
+
+	"github.com/HanHan666666/go-pkg-installer/pkg/core"
+)
+
+// PromptRecovery asks whether an interrupted installation should be resumed
+// or rolled back. It returns core.RecoverResume, core.RecoverRollback, or an
+// empty string if the user chose to quit.
+func PromptRecovery(ctx *core.InstallContext, state *core.JournalState) string {
+	// Lock to OS thread for tk9
+	runtime.LockOSThread()
+
+	step := state.Step
+	if failed := state.FailedTask(); failed != nil && failed.Step != "" {
+		step = failed.Step
+	}
+
+	result := MessageBox(
+		Icon("warning"),
+		Msg(fmt.Sprintf(tr(ctx, "dialog.recover.msg", "A previous installation was interrupted at step \"%s\".\n\nYes: resume from the interrupted task\nNo: roll back the completed changes\nCancel: quit"), step)),
+		Title(tr(ctx, "dialog.recover.title", "Interrupted Installation")),
+		Type("yesnocancel"),
+	)
+
+	switch result {
+	case "yes":
+		return core.RecoverResume
+	case "no":
+		return core.RecoverRollback
+	default:
+		return ""
+	}
+}
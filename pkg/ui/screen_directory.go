@@ -13,7 +13,9 @@ import (
 // DirectoryScreen renders a directory selection screen.
 type DirectoryScreen struct {
 	step       *core.StepConfig
+	ctx        *core.InstallContext
 	pathEntry  *TEntryWidget
+	spaceLabel *TLabelWidget
 	varName    string
 	defaultDir string
 }
@@ -25,6 +27,8 @@ func NewDirectoryScreen(step *core.StepConfig) ScreenRenderer {
 
 // Render creates the directory selection screen UI.
 func (s *DirectoryScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, bus *core.EventBus) error {
+	s.ctx = ctx
+
 	// Title
 	titleText := s.step.Screen.Title
 	if titleText == "" {
@@ -113,12 +117,10 @@ func (s *DirectoryScreen) Render(parent *TFrameWidget, ctx *core.InstallContext,
 	infoFrame := parent.TFrame()
 	Pack(infoFrame, Fill("x"), Pady("10"))
 
-	// Show disk space info if available
-	requiredSpace := ctx.RenderOrDefault("install.required_space", "")
-	if requiredSpace != "" {
-		spaceLabel := infoFrame.TLabel(Txt(tr(ctx, "label.required.space", "Required space: ") + requiredSpace))
-		Pack(spaceLabel, Side("left"))
-	}
+	// Show disk space info if available; it follows the context, e.g. the
+	// components chosen on an options screen
+	s.spaceLabel = infoFrame.TLabel(Txt(s.requiredSpaceText()))
+	Pack(s.spaceLabel, Side("left"))
 
 	// Spacer
 	spacer2 := parent.TFrame()
@@ -158,12 +160,34 @@ func (s *DirectoryScreen) Validate() error {
 // Collect collects the selected directory.
 func (s *DirectoryScreen) Collect(ctx *core.InstallContext) error {
 	dir := s.pathEntry.Textvariable()
-	ctx.Set(s.varName, dir)
+	if err := ctx.SetVariable(s.varName, dir); err != nil {
+		return err
+	}
 	// Also set as install_dir for convenience
-	ctx.Set("install_dir", dir)
+	if s.varName != "install_dir" {
+		return ctx.SetVariable("install_dir", dir)
+	}
 	return nil
 }
 
+// WatchPaths returns the context paths the screen shows.
+func (s *DirectoryScreen) WatchPaths() []string {
+	return []string{"install.required_space"}
+}
+
+// ContextChanged updates the required space label.
+func (s *DirectoryScreen) ContextChanged(change core.ContextChangePayload) {
+	s.spaceLabel.Configure(Txt(s.requiredSpaceText()))
+}
+
+func (s *DirectoryScreen) requiredSpaceText() string {
+	requiredSpace := s.ctx.RenderOrDefault("install.required_space", "")
+	if requiredSpace == "" {
+		return ""
+	}
+	return tr(s.ctx, "label.required.space", "Required space: ") + requiredSpace
+}
+
 // Cleanup cleans up the directory screen resources.
 func (s *DirectoryScreen) Cleanup() {}
 
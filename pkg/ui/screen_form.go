@@ -13,6 +13,7 @@ import (
 // FormScreen renders a form input screen with multiple field types.
 type FormScreen struct {
 	step   *core.StepConfig
+	ctx    *core.InstallContext
 	fields []formField
 }
 
@@ -20,6 +21,8 @@ type formField struct {
 	config   core.FieldConfig
 	widget   any
 	variable *VariableOpt
+	frame    *TFrameWidget // Row and hint, hidden when config.When fails
+	hidden   bool
 }
 
 // NewFormScreen creates a form screen renderer.
@@ -29,6 +32,8 @@ func NewFormScreen(step *core.StepConfig) ScreenRenderer {
 
 // Render creates the form screen UI.
 func (s *FormScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, bus *core.EventBus) error {
+	s.ctx = ctx
+
 	// Title
 	titleText := s.step.Screen.Title
 	if titleText == "" {
@@ -49,6 +54,7 @@ func (s *FormScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, bus
 	// Form frame
 	formFrame := parent.TFrame()
 	Pack(formFrame, Fill("both"), Expand(true), Pady("10"))
+	GridColumnConfigure(formFrame, 0, Weight(1))
 
 	// Create fields
 	s.fields = make([]formField, 0, len(s.step.Screen.Fields))
@@ -58,12 +64,16 @@ func (s *FormScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, bus
 
 		// Get existing value or default
 		defaultVal := ctx.Render(fieldConfig.Default)
-		if existing, ok := ctx.Get(fieldConfig.Variable); ok {
-			defaultVal = fmt.Sprintf("%v", existing)
+		if _, ok := ctx.Get(fieldConfig.Variable); ok {
+			defaultVal = ctx.GetString(fieldConfig.Variable)
 		}
 
+		// Field frame, holding the row and its hint
+		field.frame = formFrame.TFrame()
+		Grid(field.frame, Row(i), Column(0), Sticky("ew"))
+
 		// Field row frame
-		rowFrame := formFrame.TFrame()
+		rowFrame := field.frame.TFrame()
 		Pack(rowFrame, Fill("x"), Pady("5"))
 
 		// Label
@@ -205,21 +215,83 @@ func (s *FormScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, bus
 
 		// Hint text
 		if fieldConfig.Hint != "" {
-			hint := formFrame.TLabel(Txt(ctx.Render(fieldConfig.Hint)), Foreground("gray"))
+			hint := field.frame.TLabel(Txt(ctx.Render(fieldConfig.Hint)), Foreground("gray"))
 			Pack(hint, Side("top"), Anchor("w"), Padx("130"))
 		}
 
 		s.fields = append(s.fields, field)
 	}
 
+	// Choices are written to the context as they are made, so fields
+	// depending on them show or hide at once
+	for i := range s.fields {
+		field := &s.fields[i]
+		update := func() { s.update(field) }
+		switch field.config.Type {
+		case "checkbox", "bool":
+			field.widget.(*TCheckbuttonWidget).Configure(Command(update))
+		case "select", "dropdown", "combo":
+			Bind(field.widget.(*TComboboxWidget).Window, "<<ComboboxSelected>>", Command(update))
+		case "radio":
+			for _, radio := range WinfoChildren(field.widget.(*TFrameWidget).Window) {
+				radio.Configure(Command(update))
+			}
+		}
+	}
+	s.showFields()
+
+	return nil
+}
+
+// WatchPaths returns nil, so the form sees every change: a when:
+// condition may read any value.
+func (s *FormScreen) WatchPaths() []string {
 	return nil
 }
 
+// ContextChanged shows the fields whose condition holds and hides the
+// others.
+func (s *FormScreen) ContextChanged(change core.ContextChangePayload) {
+	s.showFields()
+}
+
+// showFields shows the fields whose when: condition holds and hides the
+// others. A condition that fails to evaluate shows the field.
+func (s *FormScreen) showFields() {
+	for i := range s.fields {
+		field := &s.fields[i]
+		if field.config.When == "" {
+			continue
+		}
+		show, err := core.EvalCondition(s.ctx, field.config.When)
+		if err != nil {
+			s.ctx.AddLog(core.LogWarn, fmt.Sprintf("Field %s: %v", field.config.Variable, err))
+			show = true
+		}
+		switch {
+		case show && field.hidden:
+			Grid(field.frame)
+		case !show && !field.hidden:
+			GridRemove(field.frame.Window)
+		}
+		field.hidden = !show
+	}
+}
+
+// update writes a field's current value to the context. Invalid values
+// are left for Validate to report.
+func (s *FormScreen) update(field *formField) {
+	_ = s.collectField(s.ctx, field)
+}
+
 // Validate validates all form fields.
 func (s *FormScreen) Validate() error {
 	var errs []string
 
 	for _, field := range s.fields {
+		if field.hidden {
+			continue
+		}
 		value := s.getFieldValue(field)
 
 		// Check required
@@ -228,8 +300,16 @@ func (s *FormScreen) Validate() error {
 			continue
 		}
 
-		// Check validation pattern (simplified)
-		// In production, use regex for field.config.Validation
+		// Check the value against the variable's declaration
+		if v, ok := s.ctx.Variable(field.config.Variable); ok && value != "" {
+			coerced, err := v.Coerce(value)
+			if err == nil {
+				err = v.Check(coerced)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", field.config.Label, err))
+			}
+		}
 	}
 
 	if len(errs) > 0 {
@@ -259,16 +339,34 @@ func (s *FormScreen) getFieldValue(field formField) string {
 
 // Collect collects all form data into the context.
 func (s *FormScreen) Collect(ctx *core.InstallContext) error {
-	for _, field := range s.fields {
-		value := s.getFieldValue(field)
-
-		// Convert types as needed
-		switch field.config.Type {
-		case "checkbox", "bool":
-			ctx.Set(field.config.Variable, value == "true")
-		default:
-			ctx.Set(field.config.Variable, value)
+	for i := range s.fields {
+		if s.fields[i].hidden {
+			continue
 		}
+		if err := s.collectField(ctx, &s.fields[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectField writes the value of one field to the context.
+func (s *FormScreen) collectField(ctx *core.InstallContext, field *formField) error {
+	value := s.getFieldValue(*field)
+
+	// Declared variables are converted to their type
+	if _, ok := ctx.Variable(field.config.Variable); ok {
+		return ctx.SetVariable(field.config.Variable, value)
+	}
+
+	// Convert types as needed
+	switch field.config.Type {
+	case "checkbox", "bool":
+		ctx.Set(field.config.Variable, value == "true")
+	case "password":
+		ctx.SetSecret(field.config.Variable, value)
+	default:
+		ctx.Set(field.config.Variable, value)
 	}
 	return nil
 }
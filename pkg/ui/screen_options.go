@@ -86,8 +86,7 @@ func (s *OptionsScreen) Collect(ctx *core.InstallContext) error {
 			selected = append(selected, value)
 		}
 	}
-	ctx.Set(s.bind, selected)
-	return nil
+	return ctx.SetVariable(s.bind, selected)
 }
 
 // Cleanup cleans up the options screen resources.
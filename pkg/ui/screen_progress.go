@@ -25,6 +25,7 @@ type ProgressScreen struct {
 	ctx         *core.InstallContext
 	bus         *core.EventBus
 	active      bool
+	subs        []*core.Subscription // Task event handlers of the current run
 }
 
 // NewProgressScreen creates a progress screen renderer.
@@ -136,12 +137,12 @@ func (s *ProgressScreen) AddLogMessage(msg string) {
 
 func (s *ProgressScreen) startInstallation() {
 	// Get the task runner from context if available
-	if runner, ok := s.ctx.Get("task_runner"); ok {
-		s.taskRunner = runner.(*core.TaskRunner)
+	if runner := s.ctx.TaskRunner(); runner != nil {
+		s.taskRunner = runner
 	} else {
 		// Create a new task runner
 		s.taskRunner = core.NewTaskRunner(s.ctx, s.bus)
-		s.ctx.Set("task_runner", s.taskRunner)
+		s.ctx.SetTaskRunner(s.taskRunner)
 	}
 
 	// Get tasks from the step configuration
@@ -174,30 +175,50 @@ func (s *ProgressScreen) startInstallation() {
 		}
 	}
 
-	// Subscribe to task events for logging
-	totalTasks := len(tasks)
-	completedTasks := 0
+	// Subscribe to task events for logging. Handlers run off the task
+	// goroutines, and a retried step replaces those of the previous run.
+	s.unsubscribe()
+	logOpts := core.AsyncOptions{}
+	subs := []*core.Subscription{
+		s.bus.SubscribeAsync(core.EventTaskStart, func(e core.Event) {
+			if p := e.TaskPayload(); p != nil {
+				s.AddLogMessage(fmt.Sprintf("Starting: %s", p.TaskID))
+			}
+		}, logOpts),
+
+		// The runner combines weighted task progress into one overall
+		// value, so only the latest update matters
+		s.bus.SubscribeAsync(core.EventProgress, func(e core.Event) {
+			if p := e.ProgressPayload(); p != nil {
+				status := p.Message
+				if p.ETA >= time.Second {
+					status = fmt.Sprintf(tr(s.ctx, "status.eta", "%s (about %s left)"), status, core.FormatETA(p.ETA))
+				}
+				s.UpdateProgress(p.Progress*100, status)
+			}
+		}, core.AsyncOptions{Buffer: 16, Overflow: core.OverflowDropOldest}),
 
-	s.bus.Subscribe(core.EventTaskStart, func(e core.Event) {
-		if p := e.TaskPayload(); p != nil {
-			s.AddLogMessage(fmt.Sprintf("Starting: %s", p.TaskID))
-		}
-	})
-
-	s.bus.Subscribe(core.EventTaskComplete, func(e core.Event) {
-		if p := e.TaskPayload(); p != nil {
-			completedTasks++
-			progress := float64(completedTasks) / float64(totalTasks) * 100
-			s.UpdateProgress(progress, fmt.Sprintf("Completed: %s", p.TaskID))
-			s.AddLogMessage(fmt.Sprintf("✓ Completed: %s", p.TaskID))
-		}
-	})
+		s.bus.SubscribeAsync(core.EventTaskComplete, func(e core.Event) {
+			if p := e.TaskPayload(); p != nil {
+				s.AddLogMessage(fmt.Sprintf("✓ Completed: %s", p.TaskID))
+			}
+		}, logOpts),
 
-	s.bus.Subscribe(core.EventTaskError, func(e core.Event) {
-		if p := e.TaskPayload(); p != nil {
-			s.AddLogMessage(fmt.Sprintf("✗ Error in %s: %v", p.TaskID, p.Error))
-		}
-	})
+		s.bus.SubscribeAsync(core.EventTaskSkipped, func(e core.Event) {
+			if p := e.TaskPayload(); p != nil {
+				s.AddLogMessage(fmt.Sprintf("- Skipped: %s", p.TaskID))
+			}
+		}, logOpts),
+
+		s.bus.SubscribeAsync(core.EventTaskError, func(e core.Event) {
+			if p := e.TaskPayload(); p != nil {
+				s.AddLogMessage(fmt.Sprintf("✗ Error in %s: %v", p.TaskID, p.Error))
+			}
+		}, logOpts),
+	}
+	s.mu.Lock()
+	s.subs = subs
+	s.mu.Unlock()
 
 	// Run tasks
 	go func() {
@@ -225,6 +246,18 @@ func (s *ProgressScreen) startInstallation() {
 	}()
 }
 
+// unsubscribe removes the task event handlers of the previous run.
+func (s *ProgressScreen) unsubscribe() {
+	s.mu.Lock()
+	subs := s.subs
+	s.subs = nil
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+}
+
 // Validate validates the progress screen (checks if complete).
 func (s *ProgressScreen) Validate() error {
 	if !s.isComplete {
@@ -257,6 +290,7 @@ func (s *ProgressScreen) Cleanup() {
 	if runner != nil && !complete {
 		runner.Cancel()
 	}
+	s.unsubscribe()
 }
 
 // Type returns the screen type identifier.
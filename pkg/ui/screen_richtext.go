@@ -61,7 +61,8 @@ func (s *RichtextScreen) Render(parent *TFrameWidget, ctx *core.InstallContext,
 	} else if s.step.Screen.ContentFile != "" {
 		filePath := ctx.Render(s.step.Screen.ContentFile)
 		if data, err := os.ReadFile(filePath); err == nil {
-			content = string(data)
+			// Content files are templates like inline content
+			content = ctx.Render(string(data))
 		} else {
 			content = "Content would be loaded from: " + filePath
 		}
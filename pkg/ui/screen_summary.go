@@ -13,6 +13,12 @@ import (
 type SummaryScreen struct {
 	step      *core.StepConfig
 	launchVar *VariableOpt
+
+	// Kept to render the screen again when a value it shows changes
+	parent *TFrameWidget
+	ctx    *core.InstallContext
+	bus    *core.EventBus
+	body   *TFrameWidget
 }
 
 // NewSummaryScreen creates a summary screen renderer.
@@ -22,6 +28,8 @@ func NewSummaryScreen(step *core.StepConfig) ScreenRenderer {
 
 // Render creates the summary screen UI.
 func (s *SummaryScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, bus *core.EventBus) error {
+	s.parent, s.ctx, s.bus = parent, ctx, bus
+
 	// Check installation status
 	isComplete, ok := ctx.Get("install.complete")
 	success := false
@@ -34,6 +42,7 @@ func (s *SummaryScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, b
 	}
 	body := parent.TFrame()
 	Pack(body, Fill("both"), Expand(true))
+	s.body = body
 	row := 0
 
 	// Title
@@ -57,6 +66,8 @@ func (s *SummaryScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, b
 	var statusText string
 	if !hasResult {
 		statusText = tr(ctx, "msg.ready", "Review the details before installing.")
+	} else if success && ctx.Runtime.DryRun {
+		statusText = tr(ctx, "msg.dry_run", "Dry run finished. No changes were made.")
 	} else if success {
 		statusText = tr(ctx, "msg.success", "✓ The installation completed successfully!")
 	} else {
@@ -69,7 +80,7 @@ func (s *SummaryScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, b
 
 	// Description
 	desc := s.step.Screen.Description
-	if desc == "" && success {
+	if desc == "" && success && !ctx.Runtime.DryRun {
 		productName := ctx.RenderOrDefault("product.name", "The application")
 		desc = fmt.Sprintf("%s has been installed on your computer.", productName)
 	}
@@ -115,7 +126,13 @@ func (s *SummaryScreen) Render(parent *TFrameWidget, ctx *core.InstallContext, b
 			if item.RequiresRoot {
 				line = fmt.Sprintf("%s (admin)", line)
 			}
+			if item.SkippedIn(ctx) {
+				line = fmt.Sprintf("%s %s", line, tr(ctx, "label.skipped", "(skipped)"))
+			}
 			lines = append(lines, line)
+			for _, action := range item.Actions {
+				lines = append(lines, fmt.Sprintf("    %s", action))
+			}
 		}
 	}
 
@@ -186,6 +203,22 @@ func (s *SummaryScreen) Collect(ctx *core.InstallContext) error {
 	return nil
 }
 
+// WatchPaths returns the context paths the summary shows.
+func (s *SummaryScreen) WatchPaths() []string {
+	return []string{"install_dir", "install.complete", "launch.command", "product.name"}
+}
+
+// ContextChanged renders the summary again with the current values.
+func (s *SummaryScreen) ContextChanged(change core.ContextChangePayload) {
+	if s.body != nil {
+		Destroy(s.body.Window)
+	}
+	s.launchVar = nil
+	if err := s.Render(s.parent, s.ctx, s.bus); err != nil {
+		s.ctx.AddLog(core.LogError, fmt.Sprintf("Failed to render screen: %v", err))
+	}
+}
+
 // Cleanup cleans up the summary screen resources.
 func (s *SummaryScreen) Cleanup() {}
 
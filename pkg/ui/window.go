@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -34,6 +35,7 @@ type InstallerWindow struct {
 
 	// Current screen
 	currentScreen ScreenRenderer
+	screenSub     *core.Subscription // Context changes the screen watches
 
 	// Screen registry
 	screenRenderers map[string]ScreenRendererFactory
@@ -45,6 +47,7 @@ type InstallerWindow struct {
 	// Callbacks
 	onComplete func()
 	onCancel   func()
+	onFailure  func()
 }
 
 const (
@@ -66,6 +69,22 @@ type ScreenRenderer interface {
 	Type() string
 }
 
+// ContextWatcher is implemented by screens that follow the context values
+// they show, so they update in place instead of being rendered again.
+type ContextWatcher interface {
+	// WatchPaths returns the context paths the screen shows. A change to a
+	// path, a value inside it or a map containing it is reported; no paths
+	// means every change.
+	WatchPaths() []string
+	// ContextChanged is called on the UI thread after a watched value
+	// changed. Bursts of changes may be coalesced, so read the current
+	// values from the context rather than relying on every call.
+	ContextChanged(change core.ContextChangePayload)
+}
+
+// sidebarPaths are the context values the sidebar shows.
+var sidebarPaths = []string{"product"}
+
 // ScreenRendererFactory creates a ScreenRenderer for a step configuration.
 type ScreenRendererFactory func(step *core.StepConfig) ScreenRenderer
 
@@ -123,6 +142,19 @@ func (w *InstallerWindow) OnCancel(fn func()) {
 	w.onCancel = fn
 }
 
+// OnFailure sets the callback for a failed installation. It is called once
+// the flow has been rolled back, before the window exits.
+func (w *InstallerWindow) OnFailure(fn func()) {
+	w.onFailure = fn
+}
+
+// Hide withdraws the window, for example while an elevated run of the
+// installer takes over.
+func (w *InstallerWindow) Hide() {
+	WmWithdraw(App)
+	Update()
+}
+
 // Run initializes and runs the installer UI.
 func (w *InstallerWindow) Run() error {
 	// Lock to OS thread for tk9
@@ -202,24 +234,25 @@ func (w *InstallerWindow) setupWindow() {
 }
 
 func (w *InstallerWindow) subscribeEvents() {
-	// Subscribe to progress events
-	w.bus.Subscribe(core.EventProgress, func(e core.Event) {
+	// Subscribe to progress events. Both are published from task
+	// goroutines, which should not wait for the window.
+	w.bus.SubscribeAsync(core.EventProgress, func(e core.Event) {
 		// Update progress bar if on progress screen
 		if ps, ok := w.currentScreen.(*ProgressScreen); ok {
 			if p := e.ProgressPayload(); p != nil {
 				ps.UpdateProgress(p.Progress*100, p.Message)
 			}
 		}
-	})
+	}, core.AsyncOptions{Buffer: 16, Overflow: core.OverflowDropOldest})
 
 	// Subscribe to log events
-	w.bus.Subscribe(core.EventLog, func(e core.Event) {
+	w.bus.SubscribeAsync(core.EventLog, func(e core.Event) {
 		if ps, ok := w.currentScreen.(*ProgressScreen); ok {
 			if p := e.LogPayload(); p != nil {
 				ps.AddLogMessage(p.Message)
 			}
 		}
-	})
+	}, core.AsyncOptions{})
 
 	// Subscribe to step change events
 	w.bus.Subscribe(core.EventStepChange, func(e core.Event) {
@@ -233,6 +266,31 @@ func (w *InstallerWindow) subscribeEvents() {
 			w.updateNavButtons()
 		}, true)
 	})
+
+	// Keep the product name and logo in the sidebar current
+	w.bus.SubscribePaths(sidebarPaths, func(e core.Event) {
+		PostEvent(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			w.renderSidebar()
+		}, true)
+	})
+}
+
+// watchScreen forwards the context changes a screen watches to the UI
+// thread, dropping those that arrive after the screen was replaced.
+func (w *InstallerWindow) watchScreen(screen ScreenRenderer, watcher ContextWatcher) *core.Subscription {
+	return w.bus.SubscribePaths(watcher.WatchPaths(), func(e core.Event) {
+		change := *e.ContextChangePayload()
+		PostEvent(func() {
+			w.mu.Lock()
+			current := w.currentScreen == screen
+			w.mu.Unlock()
+			if current {
+				watcher.ContextChanged(change)
+			}
+		}, true)
+	})
 }
 
 func (w *InstallerWindow) renderCurrentStep() {
@@ -240,6 +298,10 @@ func (w *InstallerWindow) renderCurrentStep() {
 	defer w.mu.Unlock()
 
 	// Clean up current screen
+	if w.screenSub != nil {
+		w.screenSub.Unsubscribe()
+		w.screenSub = nil
+	}
 	if w.currentScreen != nil {
 		w.currentScreen.Cleanup()
 	}
@@ -278,6 +340,9 @@ func (w *InstallerWindow) renderCurrentStep() {
 	if err := w.currentScreen.Render(w.contentFrame, w.ctx, w.bus); err != nil {
 		w.ctx.AddLog(core.LogError, fmt.Sprintf("Failed to render screen: %v", err))
 	}
+	if watcher, ok := w.currentScreen.(ContextWatcher); ok {
+		w.screenSub = w.watchScreen(w.currentScreen, watcher)
+	}
 
 	// Update sidebar and navigation buttons
 	w.renderSidebar()
@@ -319,7 +384,8 @@ func (w *InstallerWindow) renderSidebar() {
 			prefix = "𐄂"
 			style = "SidebarDisabled.TLabel"
 		}
-		text := fmt.Sprintf("%s %s", prefix, step.Title)
+		// Steps of a sub-flow are indented under the steps before them
+		text := fmt.Sprintf("%s%s %s", strings.Repeat("  ", step.Depth()), prefix, step.Title)
 		label := w.sidebarFrame.TLabel(
 			Txt(text),
 			Anchor("w"),
@@ -422,13 +488,13 @@ func (w *InstallerWindow) handleNext() {
 
 	step := w.workflow.CurrentStep()
 
-	// Validate current screen
 	if step != nil && isAnyStepFailed(w.ctx) {
-		Destroy(App)
-		os.Exit(1)
+		w.handleFailure()
 		return
 	}
 
+	// Validate current screen
+
 	if screen != nil {
 		if err := screen.Validate(); err != nil {
 			MessageBox(Icon("error"), Msg(err.Error()), Title(tr(w.ctx, "dialog.validation.title", "Validation Error")))
@@ -444,8 +510,11 @@ func (w *InstallerWindow) handleNext() {
 
 	// Check if this is the last step or summary
 	if w.workflow.IsLastStep() || w.nextEnabledStep(step.ID) == nil {
-		if w.onComplete != nil {
-			w.onComplete()
+		if err := w.finishFlow(); err != nil {
+			MessageBox(Icon("error"), Msg(err.Error()), Title(tr(w.ctx, "dialog.error.title", "Error")))
+			if !w.workflow.IsComplete() {
+				return
+			}
 		}
 		Destroy(App)
 		return
@@ -463,6 +532,24 @@ func (w *InstallerWindow) handleNext() {
 	}
 }
 
+// finishFlow leaves the last step and completes the flow, which purges the
+// paths and backups kept for a rollback, then calls OnComplete. An error
+// from leaving the step keeps the flow open; a failed purge is returned
+// after the flow has completed.
+func (w *InstallerWindow) finishFlow() error {
+	if err := w.workflow.LeaveCurrentStep(); err != nil {
+		return err
+	}
+	err := w.workflow.Complete()
+	if w.onComplete != nil {
+		w.onComplete()
+	}
+	if err != nil {
+		return fmt.Errorf(tr(w.ctx, "msg.cleanup.failed", "The installation completed, but cleaning up failed: %v"), err)
+	}
+	return nil
+}
+
 func (w *InstallerWindow) handleBack() {
 	step := w.workflow.CurrentStep()
 	if step != nil && isAnyStepFailed(w.ctx) {
@@ -493,11 +580,68 @@ func (w *InstallerWindow) handleCancel() {
 	)
 
 	if result == "yes" {
-		if w.onCancel != nil {
-			w.onCancel()
+		w.cancelBtn.Configure(State("disabled"))
+		// Wait off the GUI thread: the runner's rollback still posts log
+		// messages to the window.
+		go func() {
+			if runner := w.ctx.TaskRunner(); runner != nil && runner.IsRunning() {
+				runner.Cancel()
+				runner.Wait()
+			}
+			// Undo what the earlier steps installed as well
+			if _, err := w.workflow.Rollback(); err != nil {
+				w.ctx.AddLog(core.LogError, err.Error())
+			}
+			PostEvent(func() {
+				if w.onCancel != nil {
+					w.onCancel()
+				}
+				Destroy(App)
+				os.Exit(0)
+			}, false)
+		}()
+	}
+}
+
+// handleFailure rolls back what the steps of the failed flow installed,
+// shows the outcome and exits.
+func (w *InstallerWindow) handleFailure() {
+	w.nextBtn.Configure(State("disabled"))
+	w.backBtn.Configure(State("disabled"))
+	w.cancelBtn.Configure(State("disabled"))
+	// Roll back off the GUI thread, as in handleCancel
+	go func() {
+		if runner := w.ctx.TaskRunner(); runner != nil && runner.IsRunning() {
+			runner.Wait()
 		}
-		Destroy(App)
-		os.Exit(0)
+		results, err := w.workflow.Rollback()
+		if err != nil {
+			w.ctx.AddLog(core.LogError, err.Error())
+		}
+		PostEvent(func() {
+			icon := "info"
+			if err != nil {
+				icon = "error"
+			}
+			MessageBox(Icon(icon), Msg(rollbackSummary(w.ctx, results, err)), Title(tr(w.ctx, "status.failed", "Installation Failed")))
+			if w.onFailure != nil {
+				w.onFailure()
+			}
+			Destroy(App)
+			os.Exit(1)
+		}, false)
+	}()
+}
+
+// rollbackSummary describes the rollback of a failed installation.
+func rollbackSummary(ctx *core.InstallContext, results []core.RollbackResult, err error) string {
+	switch {
+	case err != nil:
+		return fmt.Sprintf(tr(ctx, "msg.rollback.failed", "The installation failed and could not be fully rolled back: %v"), err)
+	case len(results) > 0:
+		return fmt.Sprintf(tr(ctx, "msg.rollback.done", "The installation failed. %d completed tasks were rolled back."), len(results))
+	default:
+		return tr(ctx, "msg.rollback.none", "The installation failed. No changes had to be rolled back.")
 	}
 }
 
@@ -1,6 +1,10 @@
 package ui
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/HanHan666666/go-pkg-installer/pkg/core"
@@ -105,6 +109,62 @@ func TestOnCompleteCallback(t *testing.T) {
 	}
 }
 
+func TestFinishFlowCompletesWorkflow(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "old.conf")
+	os.WriteFile(target, []byte("old"), 0644)
+
+	ctx := core.NewInstallContext()
+	ctx.SetQuarantine(core.NewQuarantine(filepath.Join(dir, "quarantine")))
+	bus := core.NewEventBus()
+	workflow := core.NewWorkflow(ctx, bus)
+	workflow.AddFlow(&core.Flow{
+		ID:    "install",
+		Entry: "finish",
+		Steps: []*core.Step{{ID: "finish", Title: "Finish"}},
+	})
+	workflow.SelectFlow("install")
+
+	kept, err := ctx.Quarantine().Move(target)
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	window := NewInstallerWindow(ctx, workflow, bus)
+	called := false
+	window.OnComplete(func() {
+		called = true
+	})
+
+	if err := window.finishFlow(); err != nil {
+		t.Fatalf("finishFlow failed: %v", err)
+	}
+	if !workflow.IsComplete() {
+		t.Error("expected the workflow to be complete")
+	}
+	if !called {
+		t.Error("OnComplete callback was not called")
+	}
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Error("expected the quarantine to be purged once the flow completed")
+	}
+}
+
+func TestRollbackSummary(t *testing.T) {
+	ctx := core.NewInstallContext()
+	results := []core.RollbackResult{{TaskID: "copy", State: core.TaskRolledBack}}
+
+	if got := rollbackSummary(ctx, results, nil); !strings.Contains(got, "1 completed tasks were rolled back") {
+		t.Errorf("unexpected summary after a rollback: %q", got)
+	}
+	if got := rollbackSummary(ctx, nil, nil); !strings.Contains(got, "No changes") {
+		t.Errorf("unexpected summary without a rollback: %q", got)
+	}
+	if got := rollbackSummary(ctx, results, errors.New("copy: busy")); !strings.Contains(got, "copy: busy") {
+		t.Errorf("expected the rollback error in the summary, got %q", got)
+	}
+}
+
 func TestOnCancelCallback(t *testing.T) {
 	ctx := core.NewInstallContext()
 	bus := core.NewEventBus()
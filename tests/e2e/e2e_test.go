@@ -120,6 +120,7 @@ func TestUninstallFlow(t *testing.T) {
 	}
 
 	ctx := core.NewInstallContext()
+	ctx.SetQuarantine(core.NewQuarantine(filepath.Join(tmpDir, "quarantine")))
 	ctx.Set("install_dir", installDir)
 
 	eventBus := core.NewEventBus()
@@ -268,6 +269,7 @@ func TestContextVariableSubstitution(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	ctx := core.NewInstallContext()
+	ctx.SetQuarantine(core.NewQuarantine(filepath.Join(t.TempDir(), "quarantine")))
 	ctx.Set("install_dir", tmpDir)
 	ctx.Set("app_name", "TestApp")
 	ctx.Set("version", "2.0.0")